@@ -0,0 +1,45 @@
+// Command auditverify checks the hash chain of an audit log and exits with
+// status 1 when an entry was changed, removed, inserted or reordered.
+//
+//	go run ./cmd/auditverify -file db/audit.log -head <last recorded hash>
+//
+// Passing the head hash recorded at an earlier check also detects entries cut
+// from the end of the log.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+func main() {
+	file := flag.String("file", "db/audit.log", "the audit log to verify")
+	head := flag.String("head", "", "a hash the log must still contain, from an earlier check")
+	flag.Parse()
+
+	res, err := services.VerifyAuditLog(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not read the audit log:", err)
+		os.Exit(2)
+	}
+	if !res.Valid {
+		fmt.Printf("TAMPERED at entry %d: %s\n", res.BrokenAt, res.Reason)
+		fmt.Printf("%d entries verify up to head %s\n", res.Entries, res.Head)
+		os.Exit(1)
+	}
+	if *head != "" {
+		found, err := services.AuditLogContains(*file, *head)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not read the audit log:", err)
+			os.Exit(2)
+		}
+		if !found {
+			fmt.Printf("TAMPERED: head %s is no longer in the log\n", *head)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("ok: %d entries, head %s\n", res.Entries, res.Head)
+}
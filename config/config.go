@@ -11,5 +11,44 @@ type Config struct {
 	API_VERSION      string `mapstructure:"API_VERSION"`
 	CHAIN            string `mapstructure:"CHAIN_KEY"`
 	CALLBACK         string `mapstructure:"CALLBACK"`
+	PRICE_PROVIDER   string `mapstructure:"PRICE_PROVIDER"`
+	PRICE_URL        string `mapstructure:"PRICE_URL"`
+	PRICE_FEEDS      string `mapstructure:"PRICE_FEEDS"`
+	STATIC_PRICES    string `mapstructure:"STATIC_PRICES"`
+	PRICE_TTL        string `mapstructure:"PRICE_TTL"`
+	STAKE_SYMBOL     string `mapstructure:"STAKE_SYMBOL"`
+	SCORE_FIELDS     string `mapstructure:"LEADERBOARD_SCORE_FIELDS"`
+	SCORE_DEFAULT    string `mapstructure:"LEADERBOARD_DEFAULT_FIELD"`
+	SCORE_ASCENDING  string `mapstructure:"LEADERBOARD_ASC_GAMES"`
+	LEADERBOARD_TZ   string `mapstructure:"LEADERBOARD_TZ"`
+	SEASONS          string `mapstructure:"LEADERBOARD_SEASONS"`
+	ARCHIVE_GAMES    string `mapstructure:"LEADERBOARD_ARCHIVE_GAMES"`
+	ARCHIVE_GRACE    string `mapstructure:"LEADERBOARD_ARCHIVE_GRACE"`
+	DATA_DIR         string `mapstructure:"DATA_DIR"`
+	ADMIN_TOKEN      string `mapstructure:"ADMIN_TOKEN"`
+	REQUIRE_TYPES    bool   `mapstructure:"REQUIRE_GAME_TYPES"`
+	EGC_TOKEN        string `mapstructure:"EGC_TOKEN_ADDRESS"`
+	PAYOUT_PRIZES    string `mapstructure:"PAYOUT_PRIZES"`
+	PAYOUT_KEY       string `mapstructure:"PAYOUT_PRIVATE_KEY"`
+	ANTICHEAT_GAMES  string `mapstructure:"ANTICHEAT_GAMES"`
+	HOLD_RISK        int    `mapstructure:"ANTICHEAT_HOLD_RISK"`
+	ZSCORE           string `mapstructure:"ANTICHEAT_ZSCORE"`
+	MIN_DURATIONS    string `mapstructure:"ANTICHEAT_MIN_DURATIONS"`
+	MAX_PER_HOUR     int    `mapstructure:"ANTICHEAT_MAX_PER_HOUR"`
+	DURATION_FIELD   string `mapstructure:"ANTICHEAT_DURATION_FIELD"`
+	SESSION_SECRET   string `mapstructure:"SESSION_SECRET"`
+	SESSION_TTL      string `mapstructure:"SESSION_TOKEN_TTL"`
+	RATE_LIMITS      string `mapstructure:"RATE_LIMITS"`
+	TRUSTED_PROXIES  string `mapstructure:"TRUSTED_PROXIES"`
+	AUTH_SECRET      string `mapstructure:"AUTH_SECRET"`
+	AUTH_DOMAIN      string `mapstructure:"AUTH_DOMAIN"`
+	AUTH_TTL         string `mapstructure:"AUTH_SESSION_TTL"`
+	CACHE_ENTRIES    int    `mapstructure:"CACHE_MAX_ENTRIES"`
+	CACHE_BYTES      int    `mapstructure:"CACHE_MAX_BYTES"`
+	CACHE_POLICY     string `mapstructure:"CACHE_POLICY"`
+	CACHE_BACKEND    string `mapstructure:"CACHE_BACKEND"`
+	REDIS_URL        string `mapstructure:"REDIS_URL"`
+	CACHE_GRACE      string `mapstructure:"CACHE_STALE_GRACE"`
+	MAX_PAGE_SIZE    int    `mapstructure:"MAX_PAGE_SIZE"`
 	// CALLBACK_EMAIL   string `mapstructure:"CALLBACK_EMAIL"`
 }
@@ -1,9 +1,10 @@
 package data
 
 type GameSess struct {
-	Gid  int    `json:"gid" binding:"required"`
-	Gtid string `json:"gtid" binding:"required"`
-	Uid  string `json:"uid" binding:"required"`
-	Data string `json:"data" binding:"required"`
-	Time int    `json:"time" binding:"required"`
+	Gid   int    `json:"gid" binding:"required"`
+	Gtid  string `json:"gtid" binding:"required"`
+	Uid   string `json:"uid" binding:"required"`
+	Data  string `json:"data" binding:"required"`
+	Time  int    `json:"time" binding:"required"`
+	Token string `json:"token" binding:"required"`
 }
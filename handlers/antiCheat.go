@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+type AntiCheatHandler struct {
+	antiCheat    services.AntiCheatService
+	pending      services.PendingSessionService
+	TransactOpts *bind.TransactOpts
+}
+
+// NewAntiCheatHandler creates a new AntiCheatHandler instance.
+//
+// Parameters:
+//
+//	antiCheat: services.AntiCheatService
+//	pending: services.PendingSessionService following approved held sessions
+//	tans: *bind.TransactOpts used to store approved held sessions
+//
+// Return Type:
+//
+//	*AntiCheatHandler
+func NewAntiCheatHandler(antiCheat services.AntiCheatService, pending services.PendingSessionService, tans *bind.TransactOpts) *AntiCheatHandler {
+	return &AntiCheatHandler{
+		antiCheat:    antiCheat,
+		pending:      pending,
+		TransactOpts: tans,
+	}
+}
+
+// ListReviews godoc
+// @Summary      List session reviews
+// @Description  lists sessions the anti-cheat held before storing them or flagged after they were stored, with their risk score and the checks they failed.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        status  query     string  false  "held, flagged, approved or rejected"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/anticheat/reviews [get]
+func (a *AntiCheatHandler) ListReviews(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   a.antiCheat.Reviews(ctx.Query("status")),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ApproveReview godoc
+// @Summary      Approve a session
+// @Description  approves a held session, storing it on chain and following it until mined, or lets a flagged session back into leaderboards. Reviews are decided once.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Review ID"
+// @Success      200  {object}  handler.SessionReviewResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Router       /admin/anticheat/reviews/{id}/approve [post]
+func (a *AntiCheatHandler) ApproveReview(ctx *gin.Context) {
+	a.review(ctx, true)
+}
+
+// RejectReview godoc
+// @Summary      Reject a session
+// @Description  rejects a held session so it is never stored, or keeps a flagged session out of leaderboards. Reviews are decided once.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Review ID"
+// @Success      200  {object}  handler.SessionReviewResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Router       /admin/anticheat/reviews/{id}/reject [post]
+func (a *AntiCheatHandler) RejectReview(ctx *gin.Context) {
+	a.review(ctx, false)
+}
+
+func (a *AntiCheatHandler) review(ctx *gin.Context, approve bool) {
+	res, err := a.antiCheat.Review(a.TransactOpts, ctx.Param("id"), approve)
+	if errors.Is(err, services.ErrReviewNotFound) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+	if errors.Is(err, services.ErrReviewDecided) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusConflict, response)
+		return
+	}
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if res.TxHash != "" {
+		a.pending.Track(common.HexToHash(res.TxHash), storage.GameHistoryGameSession{
+			Gid:  big.NewInt(int64(res.Gid)),
+			Gtid: res.Gtid,
+			Uid:  res.Uid,
+			Data: res.Data,
+			Time: big.NewInt(res.Time),
+		})
+	}
+	response := SessionReviewResOk{
+		Status: "success",
+		Review: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+type APIKeyHandler struct {
+	keys services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler instance.
+//
+// Parameters:
+//
+//	keys: services.APIKeyService
+//
+// Return Type:
+//
+//	*APIKeyHandler
+func NewAPIKeyHandler(keys services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys: keys,
+	}
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  lists every issued API key with its scopes, games and expiry. Keys themselves are never shown again after they are issued.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/keys [get]
+func (a *APIKeyHandler) ListAPIKeys(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   a.keys.List(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// IssueAPIKey godoc
+// @Summary      Issue an API key
+// @Description  issues a key for a game server with scopes out of game:write, game:read, stake:read and admin, bound to the listed gids (every game when empty) and an optional expiry. The key is only returned here.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body handler.APIKeyReq true  "Key"
+// @Success      201  {object}  handler.APIKeyResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/keys [post]
+func (a *APIKeyHandler) IssueAPIKey(ctx *gin.Context) {
+	var req APIKeyReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res, err := a.keys.Issue(req.Name, req.Scopes, req.Gids, req.ExpiresAt)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := APIKeyResOk{
+		Status: "success",
+		Key:    res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// RotateAPIKey godoc
+// @Summary      Rotate an API key
+// @Description  replaces the secret of a key keeping its scopes, games and expiry. The old secret stops working at once.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Key ID"
+// @Success      200  {object}  handler.APIKeyResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Router       /admin/keys/{id}/rotate [post]
+func (a *APIKeyHandler) RotateAPIKey(ctx *gin.Context) {
+	res, err := a.keys.Rotate(ctx.Param("id"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(apiKeyStatus(err), response)
+		return
+	}
+
+	response := APIKeyResOk{
+		Status: "success",
+		Key:    res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  disables a key for good. The key stays listed with its revocation time.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Key ID"
+// @Success      200  {object}  handler.APIKeyResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/keys/{id} [delete]
+func (a *APIKeyHandler) RevokeAPIKey(ctx *gin.Context) {
+	res, err := a.keys.Revoke(ctx.Param("id"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(apiKeyStatus(err), response)
+		return
+	}
+
+	response := APIKeyResOk{
+		Status: "success",
+		Key:    services.IssuedAPIKey{APIKey: res},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// apiKeyStatus maps API key errors to a response status.
+func apiKeyStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAPIKeyInvalid):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// keyAllowsGid reports whether the API key of a request, if any, may act on gid.
+func keyAllowsGid(ctx *gin.Context, gid int) bool {
+	key, found := middleware.RequestAPIKey(ctx)
+	return !found || key.AllowsGid(gid)
+}
+
+// keySessions leaves out the sessions of games the API key of a request is not bound to.
+func keySessions(ctx *gin.Context, sessions []storage.GameHistoryGameSession) []storage.GameHistoryGameSession {
+	key, found := middleware.RequestAPIKey(ctx)
+	if !found || len(key.Gids) == 0 {
+		return sessions
+	}
+	res := make([]storage.GameHistoryGameSession, 0, len(sessions))
+	for _, session := range sessions {
+		if key.AllowsGid(int(session.Gid.Int64())) {
+			res = append(res, session)
+		}
+	}
+	return res
+}
+
+// keyPendingSessions is keySessions for pending sessions.
+func keyPendingSessions(ctx *gin.Context, sessions []services.PendingSession) []services.PendingSession {
+	key, found := middleware.RequestAPIKey(ctx)
+	if !found || len(key.Gids) == 0 {
+		return sessions
+	}
+	res := make([]services.PendingSession, 0, len(sessions))
+	for _, session := range sessions {
+		if key.AllowsGid(int(session.Session.Gid.Int64())) {
+			res = append(res, session)
+		}
+	}
+	return res
+}
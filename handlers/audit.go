@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+// maxAuditPage bounds how many audit entries one query returns.
+const maxAuditPage = 1000
+
+type AuditHandler struct {
+	audit services.AuditLog
+}
+
+// NewAuditHandler creates a new AuditHandler instance.
+//
+// Parameters:
+//
+//	audit: services.AuditLog
+//
+// Return Type:
+//
+//	*AuditHandler
+func NewAuditHandler(audit services.AuditLog) *AuditHandler {
+	return &AuditHandler{
+		audit: audit,
+	}
+}
+
+// ListAudit godoc
+// @Summary      Query the audit log
+// @Description  lists audit log entries of state changing requests, newest first, with the actor, route, request digest, transactions sent and outcome.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        actor    query     string  false  "API key ID, address, admin or client IP"
+// @Param        route    query     string  false  "Route pattern, e.g. /api/game/store"
+// @Param        outcome  query     string  false  "success, rejected or error"
+// @Param        tx       query     string  false  "Transaction hash"
+// @Param        since    query     string  false  "RFC 3339 time of the oldest entry"
+// @Param        until    query     string  false  "RFC 3339 time the entries end before"
+// @Param        limit    query     int     false  "Most entries to return (default 100, max 1000)"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /admin/audit [get]
+func (a *AuditHandler) ListAudit(ctx *gin.Context) {
+	filter := services.AuditFilter{
+		Actor:   ctx.Query("actor"),
+		Route:   ctx.Query("route"),
+		Outcome: ctx.Query("outcome"),
+		TxHash:  ctx.Query("tx"),
+	}
+
+	var err error
+	filter.Limit, err = strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	if err != nil || filter.Limit <= 0 || filter.Limit > maxAuditPage {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "limit must be between 1 and " + strconv.Itoa(maxAuditPage),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := ctx.Query(name)
+		if value == "" {
+			continue
+		}
+		if *bound, err = time.Parse(time.RFC3339, value); err != nil {
+			response := GameHistoryResFail{
+				Status:  "fail",
+				Message: name + " must be an RFC 3339 time",
+			}
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	res, err := a.audit.Query(filter)
+	if err != nil {
+		log.Println("while querying the audit log: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "could not read the audit log",
+		}
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// VerifyAudit godoc
+// @Summary      Verify the audit log
+// @Description  checks the hash chain of the audit log and reports the first entry that was changed, removed or reordered, with the hash of the last entry.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.AuditVerifyResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.AuditVerifyResOk
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /admin/audit/verify [get]
+func (a *AuditHandler) VerifyAudit(ctx *gin.Context) {
+	res, err := a.audit.Verify()
+	if err != nil {
+		log.Println("while verifying the audit log: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "could not read the audit log",
+		}
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if !res.Valid {
+		response := AuditVerifyResOk{
+			Status:       "fail",
+			Verification: res,
+		}
+		ctx.JSON(http.StatusConflict, response)
+		return
+	}
+
+	response := AuditVerifyResOk{
+		Status:       "success",
+		Verification: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type AuthHandler struct {
+	siwe services.SiweService
+}
+
+// NewAuthHandler creates a new AuthHandler instance.
+//
+// Parameters:
+//
+//	siwe: services.SiweService
+//
+// Return Type:
+//
+//	*AuthHandler
+func NewAuthHandler(siwe services.SiweService) *AuthHandler {
+	return &AuthHandler{
+		siwe: siwe,
+	}
+}
+
+// SiweNonce godoc
+// @Summary      Issue a sign in nonce
+// @Description  issues the single use nonce, domain and chain id to put in an EIP-4361 Sign-In with Ethereum message. The nonce can be used for 10 minutes.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  handler.SiweNonceResOk
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /auth/nonce [get]
+func (a *AuthHandler) SiweNonce(ctx *gin.Context) {
+	nonce, err := a.siwe.Nonce()
+	if err != nil {
+		log.Println("while issuing a sign in nonce: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "could not issue a nonce",
+		}
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := SiweNonceResOk{
+		Status:  "success",
+		Nonce:   nonce,
+		Domain:  a.siwe.Domain(),
+		ChainID: a.siwe.ChainID(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// SiweVerify godoc
+// @Summary      Sign in with Ethereum
+// @Description  verifies a personal_sign signature of an EIP-4361 message and starts a session for its address. The session token is set as a SameSite=Lax HttpOnly cookie for reads from the same site and returned for the Authorization bearer header, which state changing requests must send.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body handler.SiweVerifyReq true  "Signed message"
+// @Success      200  {object}  handler.SiweSessionResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /auth/verify [post]
+func (a *AuthHandler) SiweVerify(ctx *gin.Context) {
+	var req SiweVerifyReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	session, err := a.siwe.Verify(req.Message, req.Signature)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrSiweMessage):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrSiweNonce), errors.Is(err, services.ErrSiweSignature):
+			status = http.StatusUnauthorized
+		}
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(status, response)
+		return
+	}
+
+	// The cookie is only sent from the same site, and state changing requests
+	// need the bearer header besides, so other sites cannot act for the player.
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(middleware.SessionCookie, session.Token, int(session.ExpiresAt-time.Now().Unix()), "/", "", true, true)
+	ctx.JSON(http.StatusOK, newSiweSessionRes(session))
+}
+
+// SiweSession godoc
+// @Summary      Show the session
+// @Description  shows the address the request is signed in as.
+// @Tags         auth
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, when the session cookie is not sent"
+// @Success      200  {object}  handler.SiweSessionResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /auth/session [get]
+func (a *AuthHandler) SiweSession(ctx *gin.Context) {
+	session, _ := middleware.RequestSession(ctx)
+	ctx.JSON(http.StatusOK, newSiweSessionRes(session))
+}
+
+// SiweLogout godoc
+// @Summary      Sign out
+// @Description  ends the session before it expires and clears the session cookie.
+// @Tags         auth
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, when the session cookie is not sent"
+// @Success      200  {object}  handler.GameHistoryStoreOk
+// @Router       /auth/logout [post]
+func (a *AuthHandler) SiweLogout(ctx *gin.Context) {
+	if token := middleware.SessionToken(ctx); token != "" {
+		_ = a.siwe.Logout(token)
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(middleware.SessionCookie, "", -1, "/", "", true, true)
+	response := GameHistoryStoreOk{
+		Status:  "success",
+		Message: "signed out",
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func newSiweSessionRes(session services.SiweSession) SiweSessionResOk {
+	return SiweSessionResOk{
+		Status:    "success",
+		Address:   session.Address.Hex(),
+		ChainID:   session.ChainID,
+		ExpiresAt: time.Unix(session.ExpiresAt, 0).UTC(),
+		Token:     session.Token,
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Namespaces of the shared response cache. The game and user histories are
+// kept by services.GameHistoryCache.
+const (
+	stakesNamespace              = "stakes"
+	leaderboardNamespace         = "leaderboards"
+	leaderboardVersionsNamespace = "leaderboardVersions"
+)
+
+// stakeCache returns the stake payments of each wallet.
+func stakeCache(backend utils.CacheBackend) *utils.Cache[utils.Address, []storage.GameHistoryPayment] {
+	return utils.NewNamespace[utils.Address, []storage.GameHistoryPayment](backend, stakesNamespace)
+}
+
+// leaderboardCache returns the leaderboard of each gid and window, keyed
+// "gid:version:window".
+func leaderboardCache(backend utils.CacheBackend) *utils.Cache[string, []services.LeaderboardEntry] {
+	return utils.NewNamespace[string, []services.LeaderboardEntry](backend, leaderboardNamespace)
+}
+
+// leaderboardVersions returns the version of the cached leaderboards of each
+// gid. Changing it leaves every window cached before behind.
+func leaderboardVersions(backend utils.CacheBackend) *utils.Cache[utils.Gid, int64] {
+	return utils.NewNamespace[utils.Gid, int64](backend, leaderboardVersionsNamespace)
+}
+
+type CacheHandler struct {
+	cache   utils.CacheBackend
+	history services.GameHistoryCache
+}
+
+// NewCacheHandler creates a new CacheHandler instance.
+//
+// Parameters:
+//
+//	cache: utils.CacheBackend shared by the history, stake and leaderboard handlers
+//	history: services.GameHistoryCache whose refreshes are shown
+//
+// Return Type:
+//
+//	*CacheHandler
+func NewCacheHandler(cache utils.CacheBackend, history services.GameHistoryCache) *CacheHandler {
+	return &CacheHandler{
+		cache:   cache,
+		history: history,
+	}
+}
+
+// CacheStats godoc
+// @Summary      Show cache counters
+// @Description  shows the size, limits and eviction policy of the response cache with its hits, misses, evictions and expirations since the server started.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.CacheStatsResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/cache [get]
+func (h *CacheHandler) CacheStats(ctx *gin.Context) {
+	response := CacheStatsResOk{
+		Status: "success",
+		Stats:  h.cache.Stats(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// HistoryRefreshes godoc
+// @Summary      Show history refreshes
+// @Description  shows, for every cached game and user history, whether a contract read is in flight, how many reads were made, shared by concurrent requests or discarded because a session settled meanwhile, how often the stale history was served, and the last read error.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.RefreshesResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/cache/refreshes [get]
+func (h *CacheHandler) HistoryRefreshes(ctx *gin.Context) {
+	response := RefreshesResOk{
+		Status:    "success",
+		Refreshes: h.history.Refreshes(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+// Export formats, chosen with the format query parameter or the Accept
+// header.
+const (
+	csvFormat    = "csv"
+	ndjsonFormat = "ndjson"
+)
+
+// exportMediaTypes are the content types of the export formats.
+var exportMediaTypes = map[string]string{
+	csvFormat:    "text/csv",
+	ndjsonFormat: "application/x-ndjson",
+}
+
+// exportFlushEvery is how many rows are written between two flushes of the
+// response.
+const exportFlushEvery = 500
+
+// exportColumn is a field of an exported row. Values are strings, except
+// flags which stay booleans in NDJSON.
+type exportColumn[T any] struct {
+	name  string
+	value func(item T) any
+}
+
+// sessionColumns are the fields of exported game and user histories.
+var sessionColumns = []exportColumn[HistorySession]{
+	{name: "gid", value: func(s HistorySession) any { return decimal(s.Gid) }},
+	{name: "gtid", value: func(s HistorySession) any { return s.Gtid }},
+	{name: "uid", value: func(s HistorySession) any { return s.Uid }},
+	{name: "data", value: func(s HistorySession) any { return s.Data }},
+	{name: "time", value: func(s HistorySession) any { return decimal(s.Time) }},
+	{name: "pending", value: func(s HistorySession) any { return s.Pending }},
+}
+
+// paymentColumns are the fields of exported stake histories. Amounts are in
+// the smallest unit of the token.
+var paymentColumns = []exportColumn[storage.GameHistoryPayment]{
+	{name: "sender", value: func(p storage.GameHistoryPayment) any { return p.Sender.Hex() }},
+	{name: "amount", value: func(p storage.GameHistoryPayment) any { return decimal(p.Amount) }},
+	{name: "time", value: func(p storage.GameHistoryPayment) any { return decimal(p.Time) }},
+}
+
+// decimal renders a big value as its exact decimal string, empty when unset.
+func decimal(value *big.Int) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+// exportFormat reads the export format from the format query parameter,
+// falling back to the Accept header and then to CSV. It answers 400 for an
+// unknown format and 406 when no accepted type can be served.
+func exportFormat(ctx *gin.Context) (string, bool) {
+	if format := ctx.Query("format"); format != "" {
+		if _, found := exportMediaTypes[format]; !found {
+			queryFailed(ctx, fmt.Sprintf("cannot export as %q, use %s or %s", format, csvFormat, ndjsonFormat))
+			return "", false
+		}
+		return format, true
+	}
+
+	switch ctx.NegotiateFormat("text/csv", "application/x-ndjson", "application/ndjson") {
+	case "text/csv":
+		return csvFormat, true
+	case "application/x-ndjson", "application/ndjson":
+		return ndjsonFormat, true
+	}
+	response := GameHistoryResFail{
+		Status:  "fail",
+		Message: "exports are text/csv or application/x-ndjson",
+	}
+	ctx.JSON(http.StatusNotAcceptable, response)
+	return "", false
+}
+
+// writeExport streams items as an attachment named name, one row at a time,
+// flushing the response as it goes. It stops early when the client goes
+// away. CSV cells go through csvCell, so spreadsheets do not run player
+// supplied values as formulas.
+func writeExport[T any](ctx *gin.Context, format string, name string, items []T, columns []exportColumn[T]) {
+	ctx.Header("Content-Type", exportMediaTypes[format]+"; charset=utf-8")
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	ctx.Header("X-Total-Count", strconv.Itoa(len(items)))
+	ctx.Status(http.StatusOK)
+
+	var write func(item T) error
+	var flush func() error
+	if format == csvFormat {
+		writer := csv.NewWriter(ctx.Writer)
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = column.name
+		}
+		if err := writer.Write(row); err != nil {
+			log.Println("while exporting: ", err.Error())
+			return
+		}
+		write = func(item T) error {
+			for i, column := range columns {
+				row[i] = csvCell(fmt.Sprint(column.value(item)))
+			}
+			return writer.Write(row)
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		var line bytes.Buffer
+		write = func(item T) error {
+			line.Reset()
+			line.WriteByte('{')
+			for i, column := range columns {
+				if i > 0 {
+					line.WriteByte(',')
+				}
+				key, _ := json.Marshal(column.name)
+				value, err := json.Marshal(column.value(item))
+				if err != nil {
+					return err
+				}
+				line.Write(key)
+				line.WriteByte(':')
+				line.Write(value)
+			}
+			line.WriteString("}\n")
+			_, err := ctx.Writer.Write(line.Bytes())
+			return err
+		}
+		flush = func() error { return nil }
+	}
+
+	for i, item := range items {
+		if err := write(item); err != nil {
+			log.Println("while exporting: ", err.Error())
+			return
+		}
+		if (i+1)%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				log.Println("while exporting: ", err.Error())
+				return
+			}
+			ctx.Writer.Flush()
+			if ctx.Request.Context().Err() != nil {
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		log.Println("while exporting: ", err.Error())
+		return
+	}
+	ctx.Writer.Flush()
+}
+
+// csvCell quotes a value a spreadsheet would read as a formula, one starting
+// with =, +, -, @, a tab or a carriage return, by prefixing it with '.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
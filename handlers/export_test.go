@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportRouter serves items at /export in the negotiated format.
+func exportRouter[T any](items []T, columns []exportColumn[T]) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/export", func(ctx *gin.Context) {
+		format, ok := exportFormat(ctx)
+		if !ok {
+			return
+		}
+		writeExport(ctx, format, "history", items, columns)
+	})
+	return router
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		wantCode    int
+		wantType    string
+		wantPayload string
+	}{
+		{name: "Default", wantCode: http.StatusOK, wantType: "text/csv; charset=utf-8"},
+		{name: "Accept NDJSON", accept: "application/x-ndjson", wantCode: http.StatusOK, wantType: "application/x-ndjson; charset=utf-8"},
+		{name: "Format Overrides Accept", query: "?format=ndjson", accept: "text/csv", wantCode: http.StatusOK, wantType: "application/x-ndjson; charset=utf-8"},
+		{name: "Unknown Format", query: "?format=xml", wantCode: http.StatusBadRequest},
+		{name: "Unacceptable", accept: "application/xml", wantCode: http.StatusNotAcceptable},
+	}
+
+	router := exportRouter([]HistorySession{}, sessionColumns)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/export"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, resp.Header().Get("Content-Type"))
+				assert.Equal(t, "0", resp.Header().Get("X-Total-Count"))
+			}
+		})
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	// Larger than an int64, so only exact decimal strings keep it.
+	amount, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	payments := []storage.GameHistoryPayment{
+		{Sender: common.HexToAddress("0x01"), Amount: amount, Time: big.NewInt(1700000000)},
+		{Sender: common.HexToAddress("0x02"), Amount: big.NewInt(5), Time: nil},
+	}
+	router := exportRouter(payments, paymentColumns)
+
+	req, _ := http.NewRequest("GET", "/export?format=csv", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, `attachment; filename=history.csv`, resp.Header().Get("Content-Disposition"))
+	assert.Equal(t, "sender,amount,time\n"+
+		"0x0000000000000000000000000000000000000001,123456789012345678901234567890,1700000000\n"+
+		"0x0000000000000000000000000000000000000002,5,\n", resp.Body.String())
+
+	req, _ = http.NewRequest("GET", "/export?format=ndjson", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, `{"sender":"0x0000000000000000000000000000000000000001","amount":"123456789012345678901234567890","time":"1700000000"}`+"\n"+
+		`{"sender":"0x0000000000000000000000000000000000000002","amount":"5","time":""}`+"\n", resp.Body.String())
+
+	sessions := []HistorySession{{
+		GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(7), Gtid: "a,b", Uid: "alice", Data: `{"score":"1"}`, Time: big.NewInt(1)},
+		Pending:                true,
+	}}
+	req, _ = http.NewRequest("GET", "/export?format=ndjson", nil)
+	resp = httptest.NewRecorder()
+	exportRouter(sessions, sessionColumns).ServeHTTP(resp, req)
+
+	assert.Equal(t, `{"gid":"7","gtid":"a,b","uid":"alice","data":"{\"score\":\"1\"}","time":"1","pending":true}`+"\n", resp.Body.String())
+
+	req, _ = http.NewRequest("GET", "/export?format=csv", nil)
+	resp = httptest.NewRecorder()
+	exportRouter(sessions, sessionColumns).ServeHTTP(resp, req)
+
+	assert.Equal(t, "gid,gtid,uid,data,time,pending\n"+`7,"a,b",alice,"{""score"":""1""}",1,true`+"\n", resp.Body.String())
+}
+
+func TestWriteExportEscapesFormulas(t *testing.T) {
+	sessions := []HistorySession{
+		{GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(7), Gtid: "=HYPERLINK(\"http://evil.example\")", Uid: "@alice", Data: "+1", Time: big.NewInt(1)}},
+		{GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(7), Gtid: "-2", Uid: "\tbob", Data: "\rcarol", Time: big.NewInt(1)}},
+	}
+	req, _ := http.NewRequest("GET", "/export?format=csv", nil)
+	resp := httptest.NewRecorder()
+	exportRouter(sessions, sessionColumns).ServeHTTP(resp, req)
+
+	assert.Equal(t, "gid,gtid,uid,data,time,pending\n"+
+		`7,"'=HYPERLINK(""http://evil.example"")",'@alice,'+1,1,false`+"\n"+
+		"7,'-2,'\tbob,\"'\rcarol\",1,false\n", resp.Body.String())
+
+	req, _ = http.NewRequest("GET", "/export?format=ndjson", nil)
+	resp = httptest.NewRecorder()
+	exportRouter(sessions[:1], sessionColumns).ServeHTTP(resp, req)
+
+	assert.Contains(t, resp.Body.String(), `"uid":"@alice"`, "NDJSON keeps the values as they are")
+}
@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// DefaultFeedKeepAlive is how often an idle feed is pinged.
+const DefaultFeedKeepAlive = 15 * time.Second
+
+// feedWriteTimeout bounds one write to a WebSocket feed.
+const feedWriteTimeout = 10 * time.Second
+
+// feedReadLimit bounds a message sent on a WebSocket feed.
+const feedReadLimit = 4096
+
+// Actions of the messages sent on a WebSocket feed.
+const (
+	feedSubscribe   = "subscribe"
+	feedUnsubscribe = "unsubscribe"
+)
+
+type FeedHandler struct {
+	feed     services.SessionFeed
+	upgrader websocket.Upgrader
+	// KeepAlive is how often idle feeds are pinged, DefaultFeedKeepAlive
+	// when zero.
+	KeepAlive time.Duration
+}
+
+// NewFeedHandler creates a new FeedHandler instance.
+//
+// Parameters:
+//
+//	feed: services.SessionFeed the sessions are pushed from
+//	origin: string, the origin besides the API host allowed to open WebSocket feeds
+//
+// Return Type:
+//
+//	*FeedHandler
+func NewFeedHandler(feed services.SessionFeed, origin string) *FeedHandler {
+	return &FeedHandler{
+		feed: feed,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return feedOriginAllowed(r, origin)
+			},
+		},
+	}
+}
+
+// GameFeed godoc
+// @Summary      Stream game sessions
+// @Description  pushes the sessions of a game ID as Server-Sent Events once their transaction is mined. Each session event carries its cursor as the event ID; reconnect with Last-Event-ID, or the cursor parameter, to first get the sessions stored after it. A dropped event means the client fell behind and should reconnect.
+// @Tags         game history
+// @Produce      text/event-stream,json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Param        Last-Event-ID  header    string  false  "The cursor of the last session seen"
+// @Param        gid   path      string  true  "Game ID"
+// @Param        cursor  query     string     false  "The cursor of the last session seen, when Last-Event-ID is not sent"
+// @Success      200  {string}  string  "session events of the game"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Router       /feed/game/{gid} [get]
+func (f *FeedHandler) GameFeed(ctx *gin.Context) {
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		queryFailed(ctx, "invalid gid "+ctx.Param("gid"))
+		return
+	}
+	f.stream(ctx, services.GameTopic(gid))
+}
+
+// UserFeed godoc
+// @Summary      Stream user sessions
+// @Description  pushes the sessions of a user ID as Server-Sent Events once their transaction is mined. Each session event carries its cursor as the event ID; reconnect with Last-Event-ID, or the cursor parameter, to first get the sessions stored after it. A dropped event means the client fell behind and should reconnect.
+// @Tags         game history
+// @Produce      text/event-stream,json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Param        Last-Event-ID  header    string  false  "The cursor of the last session seen"
+// @Param        uid   path      string  true  "User ID"
+// @Param        cursor  query     string     false  "The cursor of the last session seen, when Last-Event-ID is not sent"
+// @Success      200  {string}  string  "session events of the player"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Router       /feed/user/{uid} [get]
+func (f *FeedHandler) UserFeed(ctx *gin.Context) {
+	f.stream(ctx, services.UserTopic(ctx.Param("uid")))
+}
+
+// Socket godoc
+// @Summary      Stream sessions over WebSocket
+// @Description  upgrades to a WebSocket on which clients send {"action": "subscribe", "gid": 7} or {"action": "subscribe", "uid": "alice"}, optionally with the "cursor" of the last session seen, and {"action": "unsubscribe", ...}. The server answers with subscribed, unsubscribed and error messages, pushes session messages once their transaction is mined, and sends dropped when a subscription fell behind and should be renewed from its last cursor.
+// @Tags         game history
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Success      101  {object}  handler.FeedMessage
+// @Failure      400  {string}  string
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Router       /feed/ws [get]
+func (f *FeedHandler) Socket(ctx *gin.Context) {
+	conn, err := f.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Println("while opening the session feed: ", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	keepAlive := f.keepAlive()
+	conn.SetReadLimit(feedReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * keepAlive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * keepAlive))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	requests := make(chan FeedRequest)
+	go func() {
+		defer close(requests)
+		for {
+			_, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var request FeedRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				request = FeedRequest{}
+			}
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	socket := feedSocket{ctx: ctx, feed: f.feed, subs: make(map[string]*services.FeedSubscription), events: make(chan feedSocketEvent), done: done}
+	defer socket.close()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		var message FeedMessage
+		select {
+		case request, open := <-requests:
+			if !open {
+				return
+			}
+			message = socket.handle(request)
+		case event := <-socket.events:
+			var ok bool
+			message, ok = socket.deliver(event)
+			if !ok {
+				continue
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteTimeout)); err != nil {
+				return
+			}
+			continue
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+// stream pushes the sessions of a topic as Server-Sent Events until the
+// client goes away.
+func (f *FeedHandler) stream(ctx *gin.Context, topic services.FeedTopic) {
+	if topic.Uid == "" && !keyAllowsGid(ctx, topic.Gid) {
+		ctx.JSON(http.StatusForbidden, GameHistoryResFail{Status: "fail", Message: "api key is not bound to game " + strconv.Itoa(topic.Gid)})
+		return
+	}
+	value := ctx.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = ctx.Query("cursor")
+	}
+	cursor, err := decodeFeedCursor(value)
+	if err != nil {
+		queryFailed(ctx, err.Error())
+		return
+	}
+	sub, err := f.feed.Subscribe(topic, cursor)
+	if err != nil {
+		log.Println("while subscribing to the session feed: ", err.Error())
+		queryFailed(ctx, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	ticker := time.NewTicker(f.keepAlive())
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case event, open := <-sub.Events:
+			if !open {
+				if sub.Dropped() {
+					_, _ = fmt.Fprintf(ctx.Writer, "event: dropped\ndata: {}\n\n")
+					ctx.Writer.Flush()
+				}
+				return
+			}
+			if !keyAllowsGid(ctx, int(event.Session.Gid.Int64())) {
+				continue
+			}
+			var data []byte
+			data, err = json.Marshal(event.Session)
+			if err == nil {
+				_, err = fmt.Fprintf(ctx.Writer, "id: %s\nevent: session\ndata: %s\n\n", event.Cursor, data)
+			}
+		case <-ticker.C:
+			_, err = fmt.Fprint(ctx.Writer, ": keep-alive\n\n")
+		case <-ctx.Request.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func (f *FeedHandler) keepAlive() time.Duration {
+	if f.KeepAlive <= 0 {
+		return DefaultFeedKeepAlive
+	}
+	return f.KeepAlive
+}
+
+// feedSocket holds the subscriptions of a WebSocket feed. Only the loop of
+// Socket uses it.
+type feedSocket struct {
+	ctx    *gin.Context
+	feed   services.SessionFeed
+	subs   map[string]*services.FeedSubscription
+	events chan feedSocketEvent
+	done   chan struct{}
+}
+
+// feedSocketEvent is an event of one of the subscriptions of a feedSocket,
+// or the end of the subscription.
+type feedSocketEvent struct {
+	sub   *services.FeedSubscription
+	event services.FeedEvent
+	ended bool
+}
+
+// handle answers a subscribe or unsubscribe request.
+func (s *feedSocket) handle(request FeedRequest) FeedMessage {
+	if request.Action != feedSubscribe && request.Action != feedUnsubscribe {
+		return feedError(fmt.Sprintf("unknown action, use %q or %q", feedSubscribe, feedUnsubscribe))
+	}
+	if (request.Gid == nil) == (request.Uid == "") {
+		return feedError("give either a gid or a uid")
+	}
+	topic := services.UserTopic(request.Uid)
+	if request.Gid != nil {
+		topic = services.GameTopic(*request.Gid)
+		if !keyAllowsGid(s.ctx, topic.Gid) {
+			return feedError("api key is not bound to game " + strconv.Itoa(topic.Gid))
+		}
+	}
+	name := topic.String()
+
+	if request.Action == feedUnsubscribe {
+		sub, found := s.subs[name]
+		if !found {
+			return feedError("not subscribed to " + name)
+		}
+		sub.Close()
+		delete(s.subs, name)
+		return FeedMessage{Type: "unsubscribed", Topic: name}
+	}
+
+	cursor, err := decodeFeedCursor(request.Cursor)
+	if err != nil {
+		return feedError(err.Error())
+	}
+	sub, err := s.feed.Subscribe(topic, cursor)
+	if err != nil {
+		log.Println("while subscribing to the session feed: ", err.Error())
+		return feedError(err.Error())
+	}
+	if previous, found := s.subs[name]; found {
+		previous.Close()
+	}
+	s.subs[name] = sub
+	go s.forward(sub)
+	return FeedMessage{Type: "subscribed", Topic: name}
+}
+
+// forward passes the events of a subscription to the loop of Socket.
+func (s *feedSocket) forward(sub *services.FeedSubscription) {
+	for event := range sub.Events {
+		select {
+		case s.events <- feedSocketEvent{sub: sub, event: event}:
+		case <-s.done:
+			return
+		}
+	}
+	select {
+	case s.events <- feedSocketEvent{sub: sub, ended: true}:
+	case <-s.done:
+	}
+}
+
+// deliver turns an event into the message sent for it, if any. Events of
+// subscriptions since closed or replaced are skipped.
+func (s *feedSocket) deliver(event feedSocketEvent) (FeedMessage, bool) {
+	name := event.sub.Topic.String()
+	if s.subs[name] != event.sub {
+		return FeedMessage{}, false
+	}
+	if event.ended {
+		delete(s.subs, name)
+		return FeedMessage{Type: "dropped", Topic: name}, true
+	}
+	if !keyAllowsGid(s.ctx, int(event.event.Session.Gid.Int64())) {
+		return FeedMessage{}, false
+	}
+	session := event.event.Session
+	return FeedMessage{Type: "session", Topic: name, Cursor: event.event.Cursor, Session: &session}, true
+}
+
+func (s *feedSocket) close() {
+	for _, sub := range s.subs {
+		sub.Close()
+	}
+}
+
+func feedError(message string) FeedMessage {
+	return FeedMessage{Type: "error", Message: message}
+}
+
+// decodeFeedCursor reads the cursor a feed resumes after, nil when not given.
+func decodeFeedCursor(value string) (*utils.Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	cursor, err := utils.DecodeCursor(value)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// feedOriginAllowed lets WebSocket feeds be opened by non-browser clients,
+// pages of the API host and pages of origin.
+func feedOriginAllowed(r *http.Request, origin string) bool {
+	given := r.Header.Get("Origin")
+	if given == "" || (origin != "" && strings.EqualFold(given, origin)) {
+		return true
+	}
+	parsed, err := url.Parse(given)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bufio"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feedServer serves the feed routes of a live-only SessionFeed.
+func feedServer(t *testing.T) (services.SessionFeed, *httptest.Server) {
+	gin.SetMode(gin.TestMode)
+	feed := services.NewSessionFeed(nil, nil, 0)
+	handler := NewFeedHandler(feed, "")
+	router := gin.New()
+	router.GET("/feed/game/:gid", handler.GameFeed)
+	router.GET("/feed/ws", handler.Socket)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return feed, server
+}
+
+func feedSession(gid int64, gtid string) storage.GameHistoryGameSession {
+	return storage.GameHistoryGameSession{Gid: big.NewInt(gid), Gtid: gtid, Uid: "alice", Data: "{}", Time: big.NewInt(100)}
+}
+
+func TestGameFeed(t *testing.T) {
+	feed, server := feedServer(t)
+
+	resp, err := http.Get(server.URL + "/feed/game/7")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	feed.Settled(feedSession(8, "other"), true)
+	feed.Settled(feedSession(7, "seen"), true)
+
+	lines := bufio.NewScanner(resp.Body)
+	var event []string
+	for lines.Scan() && lines.Text() != "" {
+		event = append(event, lines.Text())
+	}
+	require.Len(t, event, 3)
+	assert.True(t, strings.HasPrefix(event[0], "id: "))
+	assert.Equal(t, "event: session", event[1])
+	assert.Contains(t, event[2], `"Gtid":"seen"`)
+
+	resp, err = http.Get(server.URL + "/feed/game/7?cursor=%21%21")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSocketFeed(t *testing.T) {
+	feed, server := feedServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/feed/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	read := func() FeedMessage {
+		var message FeedMessage
+		require.NoError(t, conn.ReadJSON(&message))
+		return message
+	}
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"action": "subscribe"}))
+	assert.Equal(t, FeedMessage{Type: "error", Message: "give either a gid or a uid"}, read())
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"action": "subscribe", "gid": 7}))
+	assert.Equal(t, FeedMessage{Type: "subscribed", Topic: "games:7"}, read())
+
+	feed.Settled(feedSession(7, "live"), true)
+	message := read()
+	assert.Equal(t, "session", message.Type)
+	assert.Equal(t, "games:7", message.Topic)
+	assert.NotEmpty(t, message.Cursor)
+	require.NotNil(t, message.Session)
+	assert.Equal(t, "live", message.Session.Gtid)
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"action": "unsubscribe", "gid": 7}))
+	assert.Equal(t, FeedMessage{Type: "unsubscribed", Topic: "games:7"}, read())
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"action": "unsubscribe", "gid": 7}))
+	assert.Equal(t, FeedMessage{Type: "error", Message: "not subscribed to games:7"}, read())
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	assert.Equal(t, "error", read().Type)
+}
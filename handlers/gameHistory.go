@@ -2,15 +2,16 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
+	"math/big"
 	"net/http"
-	"sort"
 	"strconv"
-	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/gin-gonic/gin"
 	"github.com/joey1123455/easy_get_coin/data"
+	"github.com/joey1123455/easy_get_coin/middleware"
 	"github.com/joey1123455/easy_get_coin/services"
 	"github.com/joey1123455/easy_get_coin/storage"
 	"github.com/joey1123455/easy_get_coin/utils"
@@ -18,45 +19,56 @@ import (
 
 type GameHistoryHandler struct {
 	services     services.GameHistoryContract
+	sessions     services.GameSessionService
+	pending      services.PendingSessionService
 	ctx          *context.Context
 	TransactOpts *bind.TransactOpts
 	CallOpts     *bind.CallOpts
-	Cache        *utils.Cache
+	// Pages bounds the page sizes of the history routes.
+	Pages utils.Pagination
 }
 
 // NewGameHistoryHandler creates a new gameHistoryHandler instance.
 //
 // Parameters:
 //
-//	service: services.GameHistoryContract
+//	service: services.GameHistoryContract, usually a services.GameHistoryCache
+//	sessions: services.GameSessionService issuing the tokens sessions are stored with
+//	pending: services.PendingSessionService following stored sessions until they are mined
 //	ctx_: *context.Context
 //	tans: *bind.TransactOpts
 //	call: *bind.CallOpts
-//	cache: *utils.Cache
 //
 // Return Type:
 //
 //	*gameHistoryHandler
-func NewGameHistoryHandler(service services.GameHistoryContract, ctx_ *context.Context, tans *bind.TransactOpts, call *bind.CallOpts, cache *utils.Cache) *GameHistoryHandler {
+func NewGameHistoryHandler(service services.GameHistoryContract, sessions services.GameSessionService, pending services.PendingSessionService, ctx_ *context.Context, tans *bind.TransactOpts, call *bind.CallOpts) *GameHistoryHandler {
 	return &GameHistoryHandler{
 		services:     service,
+		sessions:     sessions,
+		pending:      pending,
 		ctx:          ctx_,
 		TransactOpts: tans,
 		CallOpts:     call,
-		Cache:        cache,
 	}
 }
 
 // StoreGameData godoc
 // @Summary      Store game data
-// @Description  stores game data in the game history handler.
+// @Description  stores game data in the game history handler. Until its transaction is mined the session is listed by the history routes with pending=true. The session must carry the token issued by /game/session/start for its gid and uid, each token stores one session, and the reported time and duration must fit the time since the start. Sessions the anti-cheat scores at or above the hold risk are held for review instead and answered with 202.
 // @Tags         game history
 // @Accept       json
 // @Produce      json
+// @Param        X-API-Key  header    string  true  "API key with the game:write scope"
 // @Param        data  body data.GameSess true  "Game data"
 // @Success      200  {object}  handler.GameHistoryResOk
+// @Success      202  {object}  handler.SessionHeldRes
 // @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Failure      422  {object}  handler.ValidationResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
 // @Router       /game/store [post]
 func (g *GameHistoryHandler) StoreGameData(ctx *gin.Context) {
@@ -70,8 +82,51 @@ func (g *GameHistoryHandler) StoreGameData(ctx *gin.Context) {
 		return
 	}
 
+	claims, err := g.sessions.Redeem(gameSess.Token, gameSess.Gid, gameSess.Uid, gameSess.Data, gameSess.Time)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(sessionTokenStatus(err), response)
+		return
+	}
+
 	tx, err := g.services.StoreGameData(g.TransactOpts, gameSess.Gid, gameSess.Gtid, gameSess.Uid, gameSess.Data, gameSess.Time)
 
+	// Only a stored or held session uses up its token.
+	var held *services.HeldError
+	if err != nil && !errors.As(err, &held) {
+		g.sessions.Release(claims.ID)
+	}
+	if held != nil {
+		response := SessionHeldRes{
+			Status:  "held",
+			Message: held.Error(),
+			Review:  held.Review,
+		}
+		ctx.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		response := ValidationResFail{
+			Status:  "fail",
+			Message: invalid.Error(),
+			Errors:  invalid.Fields,
+		}
+		ctx.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	if errors.Is(err, services.ErrGameTypeNotFound) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
 	if err != nil {
 		response := GameHistoryResFail{
 			Status:  "fail",
@@ -81,6 +136,14 @@ func (g *GameHistoryHandler) StoreGameData(ctx *gin.Context) {
 		return
 	}
 
+	middleware.AuditTx(ctx, tx.Hash().Hex())
+	g.pending.Track(tx.Hash(), storage.GameHistoryGameSession{
+		Gid:  big.NewInt(int64(gameSess.Gid)),
+		Gtid: gameSess.Gtid,
+		Uid:  gameSess.Uid,
+		Data: gameSess.Data,
+		Time: big.NewInt(int64(gameSess.Time)),
+	})
 	response := GameHistoryStoreOk{
 		Status:  "success",
 		Message: "transaction hex " + tx.Hash().String(),
@@ -88,208 +151,290 @@ func (g *GameHistoryHandler) StoreGameData(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, response)
 }
 
-// GameHistory godoc
-// @Summary      Show game history
-// @Description  handles the retrieval of game history for a given game ID. It paginates the results based on the page and pageSize query parameters.
+// StartSession godoc
+// @Summary      Start a game session
+// @Description  issues the signed, single use token a session of gid played by uid is stored with. The token records the server time the session started and expires after SESSION_TOKEN_TTL.
 // @Tags         game history
+// @Accept       json
 // @Produce      json
-// @Param        gid   path      string  true  "Game ID"
-// @Param        page  query     string     false  "Page number"
-// @Param        pageSize  query     string     false  "Page size"
-// @Success      200  {object}  handler.GameHistoryResOk
+// @Param        X-API-Key  header    string  true  "API key with the game:write scope"
+// @Param        data  body handler.GameSessionStartReq true  "Game and player"
+// @Success      201  {object}  handler.GameSessionResOk
 // @Failure      400  {object}  handler.GameHistoryResFail
-// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
-// @Router       /game/history/{gid} [get]
-func (g *GameHistoryHandler) GameHistory(ctx *gin.Context) {
-	var res []storage.GameHistoryGameSession
-	gid := ctx.Param("gid")
-	println(gid)
-
-	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		log.Println("Invalid page number")
+// @Router       /game/session/start [post]
+func (g *GameHistoryHandler) StartSession(ctx *gin.Context) {
+	var req GameSessionStartReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		response := GameHistoryResFail{
 			Status:  "fail",
-			Message: "Invalid page number",
+			Message: err.Error(),
 		}
 		ctx.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	pageSize, err := strconv.Atoi(ctx.DefaultQuery("pageSize", "20"))
-	if err != nil || pageSize < 1 {
-		log.Println("Invalid page size")
+	res, err := g.sessions.Start(req.Gid, req.Uid)
+	if err != nil {
+		log.Println("while starting a game session: ", err.Error())
 		response := GameHistoryResFail{
 			Status:  "fail",
-			Message: "Invalid page size",
+			Message: "could not start the session",
 		}
-		ctx.JSON(http.StatusBadRequest, response)
+		ctx.JSON(http.StatusInternalServerError, response)
 		return
 	}
-	// gameHistory := make([]data.GameSess, 0)
-
-	if _, found := g.Cache.Get(gid); !found {
-		_gid, err := strconv.Atoi(gid)
-		if err != nil {
-			log.Println("while parsing gid: ", err.Error())
-			response := GameHistoryResFail{
-				Status:  "fail",
-				Message: "internal server error",
-			}
-			ctx.JSON(http.StatusInternalServerError, response)
-			return
-		}
 
-		res, err = g.services.GetGameData(g.CallOpts, _gid)
-		if err != nil {
-			log.Println("while getting game data: ", err.Error())
-			response := GameHistoryResFail{
-				Status:  "fail",
-				Message: err.Error(),
+	response := GameSessionResOk{
+		Status:  "success",
+		Session: res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// withPending lists the sessions of a history, led by the pending sessions it
+// does not hold yet when the request asks for them with pending=true.
+func withPending(ctx *gin.Context, history []storage.GameHistoryGameSession, pending func() []services.PendingSession) []HistorySession {
+	res := make([]HistorySession, 0, len(history))
+	if ctx.Query("pending") == "true" {
+		stored := make(map[string]bool, len(history))
+		for _, session := range history {
+			stored[services.SessionFingerprint(session)] = true
+		}
+		for _, session := range pending() {
+			if !stored[services.SessionFingerprint(session.Session)] {
+				res = append(res, HistorySession{GameHistoryGameSession: session.Session, Pending: true})
 			}
-			ctx.JSON(http.StatusBadRequest, response)
-			return
 		}
+	}
+	for _, session := range history {
+		res = append(res, HistorySession{GameHistoryGameSession: session})
+	}
+	return res
+}
 
-		sort.SliceStable(res, func(i, j int) bool {
-			return utils.ComparePtrFieldsDesc(&res[i], &res[j])
-		})
+// sessionTokenStatus maps session token errors to a response status.
+func sessionTokenStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSessionTokenInvalid), errors.Is(err, services.ErrSessionTokenExpired),
+		errors.Is(err, services.ErrSessionTokenMismatch):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrSessionTokenUsed):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrSessionDuration):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// GameHistory godoc
+// @Summary      Show game history
+// @Description  handles the retrieval of game history for a given game ID. Sessions are listed newest first. Follow next_cursor, or the next Link, for the following page; cursors keep their place when new sessions are stored.
+// @Tags         game history
+// @Produce      json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Param        gid   path      string  true  "Game ID"
+// @Param        cursor  query     string     false  "The next_cursor of the previous page"
+// @Param        page  query     string     false  "Page number, when no cursor is given"
+// @Param        pageSize  query     string     false  "Page size, at most MAX_PAGE_SIZE"
+// @Param        pending  query     bool     false  "List sessions whose transaction is not mined yet first, flagged pending"
+// @Param        from  query     string     false  "Only sessions at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only sessions at or before this unix or RFC3339 time"
+// @Param        gid  query     string     false  "Only sessions of this game"
+// @Param        gtid  query     string     false  "Only sessions of this game transaction ID"
+// @Param        uid  query     string     false  "Only sessions of this player"
+// @Param        sort  query     string     false  "Comma separated time, gid, gtid or uid, descending with a leading -, defaults to -time"
+// @Success      200  {object}  handler.PageResOk
+// @Header       200  {string}  Link  "The first and next pages, RFC 5988"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /game/history/{gid} [get]
+func (g *GameHistoryHandler) GameHistory(ctx *gin.Context) {
+	request, ok := pageRequest(ctx, g.Pages)
+	if !ok {
+		return
+	}
 
-		g.Cache.Set(gid, res, 6*time.Minute)
+	sessions, ok := g.gameSessions(ctx)
+	if !ok {
+		return
 	}
 
-	cachedData, _ := g.Cache.Get(gid)
-	res = cachedData.([]storage.GameHistoryGameSession)
-	startIndex := (page - 1) * pageSize
-	endIndex := page * pageSize
+	page := utils.Paginate(sessions, request, sessionCursor, sessionOrder(ctx))
+	writePage(ctx, page, page.Items)
+}
+
+// gameSessions lists the sessions of the game in the path, filtered and
+// sorted by the query. It answers the request itself when that fails.
+func (g *GameHistoryHandler) gameSessions(ctx *gin.Context) ([]HistorySession, bool) {
+	gid := ctx.Param("gid")
+	println(gid)
 
-	if len(res) == 0 {
-		response := GameHistoryResOk{
-			Status: "failed no game data for provided gid",
-			Page:   []storage.GameHistoryGameSession{},
+	_gid, err := strconv.Atoi(gid)
+	if err != nil {
+		log.Println("while parsing gid: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "internal server error",
 		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
+		ctx.JSON(http.StatusInternalServerError, response)
+		return nil, false
 	}
 
-	if startIndex >= len(res) {
-		response := GameHistoryResOk{
-			Status: "failed no new page",
-			Page:   []storage.GameHistoryGameSession{},
+	res, err := g.services.GetGameData(g.CallOpts, _gid)
+	if err != nil {
+		log.Println("while getting game data: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
 		}
 		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-	if endIndex > len(res) {
-		endIndex = len(res)
+		return nil, false
 	}
-	response := GameHistoryResOk{
-		Status: "success",
-		Page:   res[startIndex:endIndex],
-	}
-	ctx.JSON(http.StatusOK, response)
-	return
+	sessions := withPending(ctx, res, func() []services.PendingSession { return g.pending.ByGid(_gid) })
+
+	return querySessions(ctx, sessions)
 }
 
 // UserHistory godoc
 // @Summary      Show user game history
-// @Description  handles the retrieval of game history for a given user ID. It paginates the results based on the page and pageSize query parameters.
+// @Description  handles the retrieval of game history for a given user ID. Sessions are listed newest first. Follow next_cursor, or the next Link, for the following page; cursors keep their place when new sessions are stored.
 // @Tags         game history
 // @Produce      json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
 // @Param        uid   path      string  true  "User ID"
-// @Param        page  query     string     false  "Page number"
-// @Param        pageSize  query     string     false  "Page size"
-// @Success      200  {object}  handler.GameHistoryResOk
+// @Param        cursor  query     string     false  "The next_cursor of the previous page"
+// @Param        page  query     string     false  "Page number, when no cursor is given"
+// @Param        pageSize  query     string     false  "Page size, at most MAX_PAGE_SIZE"
+// @Param        pending  query     bool     false  "List sessions whose transaction is not mined yet first, flagged pending"
+// @Param        from  query     string     false  "Only sessions at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only sessions at or before this unix or RFC3339 time"
+// @Param        gid  query     string     false  "Only sessions of this game"
+// @Param        gtid  query     string     false  "Only sessions of this game transaction ID"
+// @Param        uid  query     string     false  "Only sessions of this player"
+// @Param        sort  query     string     false  "Comma separated time, gid, gtid or uid, descending with a leading -, defaults to -time"
+// @Success      200  {object}  handler.PageResOk
+// @Header       200  {string}  Link  "The first and next pages, RFC 5988"
 // @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      404  {object}  handler.GameHistoryResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
 // @Router       /game/history/user/{uid} [get]
 func (g *GameHistoryHandler) UserHistory(ctx *gin.Context) {
-	var res []storage.GameHistoryGameSession
-	uid := ctx.Param("uid")
-
-	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		log.Println("Invalid page number")
-		response := GameHistoryResFail{
-			Status:  "fail",
-			Message: "Invalid page number",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+	request, ok := pageRequest(ctx, g.Pages)
+	if !ok {
 		return
 	}
 
-	pageSize, err := strconv.Atoi(ctx.DefaultQuery("pageSize", "20"))
-	if err != nil || pageSize < 1 {
-		log.Println("Invalid page size")
-		response := GameHistoryResFail{
-			Status:  "fail",
-			Message: "Invalid page size",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+	sessions, ok := g.userSessions(ctx)
+	if !ok {
 		return
 	}
-	// gameHistory := make([]data.GameSess, 0)
-
-	if _, found := g.Cache.Get(uid); !found {
-		if err != nil {
-			log.Println("while parsing gid: ", err.Error())
-			response := GameHistoryResFail{
-				Status:  "fail",
-				Message: "internal server error",
-			}
-			ctx.JSON(http.StatusInternalServerError, response)
-			return
-		}
 
-		res, err = g.services.GetUserGameData(g.CallOpts, uid)
-		if err != nil {
-			log.Println("while getting game data: ", err.Error())
-			response := GameHistoryResFail{
-				Status:  "fail",
-				Message: err.Error(),
-			}
-			ctx.JSON(http.StatusBadRequest, response)
-			return
-		}
+	page := utils.Paginate(sessions, request, sessionCursor, sessionOrder(ctx))
+	writePage(ctx, page, page.Items)
+}
 
-		sort.SliceStable(res, func(i, j int) bool {
-			return utils.ComparePtrFieldsDesc(&res[i], &res[j])
-		})
+// GameHistoryExport godoc
+// @Summary      Export game history
+// @Description  streams every session of a game ID as CSV or NDJSON, with the filters and sort of the game history. Times and IDs are exact decimal strings.
+// @Tags         game history
+// @Produce      text/csv,application/x-ndjson,json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Param        gid   path      string  true  "Game ID"
+// @Param        format  query     string     false  "csv or ndjson, overriding the Accept header"
+// @Param        pending  query     bool     false  "Export sessions whose transaction is not mined yet first, flagged pending"
+// @Param        from  query     string     false  "Only sessions at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only sessions at or before this unix or RFC3339 time"
+// @Param        gid  query     string     false  "Only sessions of this game"
+// @Param        gtid  query     string     false  "Only sessions of this game transaction ID"
+// @Param        uid  query     string     false  "Only sessions of this player"
+// @Param        sort  query     string     false  "Comma separated time, gid, gtid or uid, descending with a leading -, defaults to -time"
+// @Success      200  {string}  string  "One row per session with gid, gtid, uid, data, time and pending"
+// @Header       200  {string}  X-Total-Count  "The number of exported sessions"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      406  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /game/export/{gid} [get]
+func (g *GameHistoryHandler) GameHistoryExport(ctx *gin.Context) {
+	format, ok := exportFormat(ctx)
+	if !ok {
+		return
+	}
 
-		g.Cache.Set(uid, res, 6*time.Minute)
+	sessions, ok := g.gameSessions(ctx)
+	if !ok {
+		return
 	}
 
-	cachedData, _ := g.Cache.Get(uid)
-	res = cachedData.([]storage.GameHistoryGameSession)
+	writeExport(ctx, format, "game-"+ctx.Param("gid")+"-history", sessions, sessionColumns)
+}
 
-	if len(res) == 0 {
-		response := GameHistoryResOk{
-			Status: "failed no game data for provided gid",
-			Page:   []storage.GameHistoryGameSession{},
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+// UserHistoryExport godoc
+// @Summary      Export user game history
+// @Description  streams every session of a user ID as CSV or NDJSON, with the filters and sort of the user history. Times and IDs are exact decimal strings.
+// @Tags         game history
+// @Produce      text/csv,application/x-ndjson,json
+// @Param        X-API-Key  header    string  true  "API key with the game:read scope"
+// @Param        uid   path      string  true  "User ID"
+// @Param        format  query     string     false  "csv or ndjson, overriding the Accept header"
+// @Param        pending  query     bool     false  "Export sessions whose transaction is not mined yet first, flagged pending"
+// @Param        from  query     string     false  "Only sessions at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only sessions at or before this unix or RFC3339 time"
+// @Param        gid  query     string     false  "Only sessions of this game"
+// @Param        gtid  query     string     false  "Only sessions of this game transaction ID"
+// @Param        uid  query     string     false  "Only sessions of this player"
+// @Param        sort  query     string     false  "Comma separated time, gid, gtid or uid, descending with a leading -, defaults to -time"
+// @Success      200  {string}  string  "One row per session with gid, gtid, uid, data, time and pending"
+// @Header       200  {string}  X-Total-Count  "The number of exported sessions"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      406  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /game/export/user/{uid} [get]
+func (g *GameHistoryHandler) UserHistoryExport(ctx *gin.Context) {
+	format, ok := exportFormat(ctx)
+	if !ok {
 		return
 	}
 
-	startIndex := (page - 1) * pageSize
-	endIndex := page * pageSize
-	if startIndex >= len(res) {
-		response := GameHistoryResOk{
-			Status: "failed no new page",
-			Page:   []storage.GameHistoryGameSession{},
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+	sessions, ok := g.userSessions(ctx)
+	if !ok {
 		return
 	}
-	if endIndex > len(res) {
-		endIndex = len(res)
-	}
-	response := GameHistoryResOk{
-		Status: "success",
-		Page:   res[startIndex:endIndex],
+
+	writeExport(ctx, format, "user-"+ctx.Param("uid")+"-history", sessions, sessionColumns)
+}
+
+// userSessions lists the sessions of the player in the path the API key may
+// read, filtered and sorted by the query. It answers the request itself when
+// that fails.
+func (g *GameHistoryHandler) userSessions(ctx *gin.Context) ([]HistorySession, bool) {
+	uid := ctx.Param("uid")
+
+	res, err := g.services.GetUserGameData(g.CallOpts, uid)
+	if err != nil {
+		log.Println("while getting game data: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return nil, false
 	}
-	ctx.JSON(http.StatusOK, response)
-	return
+	res = keySessions(ctx, res)
+	sessions := withPending(ctx, res, func() []services.PendingSession {
+		return keyPendingSessions(ctx, g.pending.ByUid(uid))
+	})
+
+	return querySessions(ctx, sessions)
 }
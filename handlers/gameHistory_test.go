@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -17,7 +19,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joey1123455/easy_get_coin/services"
 	"github.com/joey1123455/easy_get_coin/storage"
-	"github.com/joey1123455/easy_get_coin/utils"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 )
@@ -29,7 +30,8 @@ var (
 	gameHistoryContract *storage.GameHistory
 	transactOpts        *bind.TransactOpts
 	callOpts            *bind.CallOpts
-	cache               utils.Cache
+	sessions            services.GameSessionService
+	pending             services.PendingSessionService
 )
 
 func init() {
@@ -57,7 +59,8 @@ func init() {
 
 	transactOpts = bind.NewKeyedTransactor(privateKey)
 	callOpts = &bind.CallOpts{Context: ctx}
-	cache = *utils.NewCache()
+	sessions, _ = services.NewGameSessionService("", "", time.Hour, "duration")
+	pending = services.NewPendingSessionService(client, 0, 0)
 }
 
 // TestNewGameHistoryHandler tests the NewGameHistoryHandler function.
@@ -65,14 +68,13 @@ func init() {
 // It verifies the fields of the created instance.
 func TestNewGameHistoryHandler(t *testing.T) {
 	service := services.NewGameHistoryContract(client, gameHistoryContract)
-	handler := NewGameHistoryHandler(service, &ctx, transactOpts, callOpts, &cache)
+	handler := NewGameHistoryHandler(service, sessions, pending, &ctx, transactOpts, callOpts)
 
 	// Verify the fields of the created instance
 	assert.Equal(t, service, handler.services, "services field should match")
 	assert.NotNil(t, ctx, handler.ctx, "ctx field should match")
 	assert.Equal(t, transactOpts, handler.TransactOpts, "TransactOpts field should match")
 	assert.Equal(t, callOpts, handler.CallOpts, "CallOpts field should match")
-	assert.NotNil(t, handler.Cache, "Cache field should match")
 }
 
 // TestStoreGameData tests the StoreGameData function.
@@ -81,9 +83,13 @@ func TestNewGameHistoryHandler(t *testing.T) {
 // - t: *testing.T
 func TestStoreGameData(t *testing.T) {
 	service := services.NewGameHistoryContract(client, gameHistoryContract)
-	handler := NewGameHistoryHandler(service, &ctx, transactOpts, callOpts, &cache)
+	handler := NewGameHistoryHandler(service, sessions, pending, &ctx, transactOpts, callOpts)
 	// Create a new HTTP request
-	body := []byte(`{"gid":1234,"gtid":"test","uid":"user123","data":"some data","time":12345}`)
+	started, err := sessions.Start(1234, "user123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(fmt.Sprintf(`{"gid":1234,"gtid":"test","uid":"user123","data":"some data","time":%d,"token":%q}`, time.Now().Unix()+1, started.Token))
 	req, err := http.NewRequest("POST", "/game/store", bytes.NewBuffer(body))
 	if err != nil {
 		t.Fatal(err)
@@ -115,7 +121,7 @@ func TestGameHistory(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
 	service := services.NewGameHistoryContract(client, gameHistoryContract)
-	handler := NewGameHistoryHandler(service, &ctx, transactOpts, callOpts, &cache)
+	handler := NewGameHistoryHandler(service, sessions, pending, &ctx, transactOpts, callOpts)
 
 	router := gin.New()
 	router.GET("/game/history", handler.GameHistory)
@@ -168,7 +174,7 @@ func TestUserHistory(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
 	service := services.NewGameHistoryContract(client, gameHistoryContract)
-	handler := NewGameHistoryHandler(service, &ctx, transactOpts, callOpts, &cache)
+	handler := NewGameHistoryHandler(service, sessions, pending, &ctx, transactOpts, callOpts)
 
 	router := gin.New()
 	router.GET("/user/history", handler.UserHistory)
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type GameTypeHandler struct {
+	registry services.GameTypeRegistry
+}
+
+// NewGameTypeHandler creates a new GameTypeHandler instance.
+//
+// Parameters:
+//
+//	registry: services.GameTypeRegistry
+//
+// Return Type:
+//
+//	*GameTypeHandler
+func NewGameTypeHandler(registry services.GameTypeRegistry) *GameTypeHandler {
+	return &GameTypeHandler{
+		registry: registry,
+	}
+}
+
+// ListGameTypes godoc
+// @Summary      List game types
+// @Description  lists every registered game type with the JSON schema its session data must match.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/gametypes [get]
+func (g *GameTypeHandler) ListGameTypes(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   g.registry.List(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetGameType godoc
+// @Summary      Show a game type
+// @Description  shows the game type registered for a game, or for one gtid of the game.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        gid   path      string  true  "Game ID"
+// @Param        gtid  query     string     false  "Game type ID, empty for the game wide type"
+// @Success      200  {object}  handler.GameTypeResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/gametypes/{gid} [get]
+func (g *GameTypeHandler) GetGameType(ctx *gin.Context) {
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid gid",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	gameType, found := g.registry.Get(gid, ctx.Query("gtid"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "game type not found",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := GameTypeResOk{
+		Status:   "success",
+		GameType: gameType,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// PutGameType godoc
+// @Summary      Register a game type
+// @Description  registers or replaces the game type of a gid and gtid. The schema is a JSON Schema that session data is validated against before it is stored.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body services.GameType true  "Game type"
+// @Success      200  {object}  handler.GameTypeResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /admin/gametypes [put]
+func (g *GameTypeHandler) PutGameType(ctx *gin.Context) {
+	var gameType services.GameType
+	if err := ctx.ShouldBindJSON(&gameType); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res, err := g.registry.Put(gameType)
+	if err != nil {
+		log.Println("while registering game type: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := GameTypeResOk{
+		Status:   "success",
+		GameType: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// DeleteGameType godoc
+// @Summary      Delete a game type
+// @Description  removes the game type registered for a game, or for one gtid of the game.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        gid   path      string  true  "Game ID"
+// @Param        gtid  query     string     false  "Game type ID, empty for the game wide type"
+// @Success      200  {object}  handler.GameHistoryStoreOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /admin/gametypes/{gid} [delete]
+func (g *GameTypeHandler) DeleteGameType(ctx *gin.Context) {
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid gid",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	deleted, err := g.registry.Delete(gid, ctx.Query("gtid"))
+	if err != nil {
+		log.Println("while deleting game type: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "internal server error",
+		}
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if !deleted {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "game type not found",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := GameHistoryStoreOk{
+		Status:  "success",
+		Message: "game type deleted",
+	}
+	ctx.JSON(http.StatusOK, response)
+}
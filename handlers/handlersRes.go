@@ -1,10 +1,54 @@
 package handler
 
+import (
+	"math/big"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
 type GameHistoryResOk struct {
 	Status string `json:"status"`
 	Page   any    `json:"page"`
 }
 
+// PageResOk is a page of a list paged with cursors.
+type PageResOk struct {
+	Status     string `json:"status"`
+	Page       any    `json:"page"`
+	Total      int    `json:"total"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// HistorySession is a session of a history page, flagged when its
+// transaction is not mined yet.
+type HistorySession struct {
+	storage.GameHistoryGameSession
+	Pending bool `json:"pending,omitempty"`
+}
+
+// FeedRequest is a message a client sends on a WebSocket feed, naming a
+// game with Gid or a player with Uid.
+type FeedRequest struct {
+	Action string `json:"action"`
+	Gid    *int   `json:"gid,omitempty"`
+	Uid    string `json:"uid,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// FeedMessage is a message the server sends on a WebSocket feed: subscribed,
+// unsubscribed, session, dropped or error.
+type FeedMessage struct {
+	Type    string                          `json:"type"`
+	Topic   string                          `json:"topic,omitempty"`
+	Cursor  string                          `json:"cursor,omitempty"`
+	Session *storage.GameHistoryGameSession `json:"session,omitempty"`
+	Message string                          `json:"message,omitempty"`
+}
+
 type GameHistoryStoreOk struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
@@ -14,3 +58,188 @@ type GameHistoryResFail struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
 }
+
+type StakeTotalRes struct {
+	Status string              `json:"status"`
+	Total  *big.Int            `json:"total"`
+	Fiat   *services.FiatValue `json:"fiat"`
+}
+
+type PaymentValuation struct {
+	storage.GameHistoryPayment
+	Fiat *services.FiatValue `json:"fiat"`
+}
+
+// LeaderboardResOk is a page of a ranking with the window it covers.
+type LeaderboardResOk struct {
+	PageResOk
+	Window services.LeaderboardWindow `json:"window"`
+}
+
+type PlayerRankResOk struct {
+	Status string              `json:"status"`
+	Player services.PlayerRank `json:"player"`
+}
+
+type GameTypeResOk struct {
+	Status   string            `json:"status"`
+	GameType services.GameType `json:"game_type"`
+}
+
+type ValidationResFail struct {
+	Status  string             `json:"status"`
+	Message string             `json:"message"`
+	Errors  []utils.FieldError `json:"errors"`
+}
+
+type PlayerStatsResOk struct {
+	Status string               `json:"status"`
+	Stats  services.PlayerStats `json:"stats"`
+}
+
+type LinkChallengeReq struct {
+	Uid     string `json:"uid" binding:"required"`
+	Address string `json:"address"`
+}
+
+type LinkChallengeResOk struct {
+	Status    string                 `json:"status"`
+	Challenge services.LinkChallenge `json:"challenge"`
+}
+
+type LinkWalletReq struct {
+	Nonce     string `json:"nonce" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+	Method    string `json:"method" enums:"personal_sign,eip712"`
+	// CurrentSignature is the signature of the wallet the uid is linked to,
+	// needed to replace it.
+	CurrentSignature string `json:"current_signature"`
+}
+
+type WalletLinkResOk struct {
+	Status string              `json:"status"`
+	Link   services.WalletLink `json:"link"`
+}
+
+type PlayerOverviewResOk struct {
+	Status   string                  `json:"status"`
+	Overview services.PlayerOverview `json:"overview"`
+}
+
+type PayoutReq struct {
+	Gid    int               `json:"gid" binding:"required"`
+	Window string            `json:"window" binding:"required" enums:"daily,weekly,monthly,season"`
+	At     string            `json:"at"`
+	Season string            `json:"season"`
+	Prizes map[string]string `json:"prizes"`
+}
+
+type PayoutResOk struct {
+	Status string               `json:"status"`
+	Batch  services.PayoutBatch `json:"batch"`
+}
+
+type TournamentResOk struct {
+	Status     string              `json:"status"`
+	Tournament services.Tournament `json:"tournament"`
+}
+
+type TournamentRegisterReq struct {
+	Uid string `json:"uid" binding:"required"`
+}
+
+type TournamentSessionReq struct {
+	Uid   string `json:"uid" binding:"required"`
+	Data  string `json:"data" binding:"required"`
+	Token string `json:"token" binding:"required"`
+}
+
+type TournamentEntryResOk struct {
+	Status string                   `json:"status"`
+	Entry  services.TournamentEntry `json:"entry"`
+}
+
+type SessionHeldRes struct {
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Review  services.SessionReview `json:"review"`
+}
+
+type SessionReviewResOk struct {
+	Status string                 `json:"status"`
+	Review services.SessionReview `json:"review"`
+}
+
+type GameSessionStartReq struct {
+	Gid int    `json:"gid" binding:"required"`
+	Uid string `json:"uid" binding:"required"`
+}
+
+type GameSessionResOk struct {
+	Status  string                    `json:"status"`
+	Session services.GameSessionToken `json:"session"`
+}
+
+type APIKeyReq struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	Gids      []int      `json:"gids"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResOk struct {
+	Status string                `json:"status"`
+	Key    services.IssuedAPIKey `json:"key"`
+}
+
+type WebhookReq struct {
+	URL       string   `json:"url" binding:"required"`
+	Events    []string `json:"events" binding:"required"`
+	Gids      []int    `json:"gids"`
+	Addresses []string `json:"addresses"`
+}
+
+type WebhookResOk struct {
+	Status  string           `json:"status"`
+	Webhook services.Webhook `json:"webhook"`
+}
+
+type WebhookDeliveryResOk struct {
+	Status   string                   `json:"status"`
+	Delivery services.WebhookDelivery `json:"delivery"`
+}
+
+type SiweNonceResOk struct {
+	Status  string `json:"status"`
+	Nonce   string `json:"nonce"`
+	Domain  string `json:"domain"`
+	ChainID int64  `json:"chain_id"`
+}
+
+type SiweVerifyReq struct {
+	Message   string `json:"message" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+type SiweSessionResOk struct {
+	Status    string    `json:"status"`
+	Address   string    `json:"address"`
+	ChainID   int64     `json:"chain_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"token"`
+}
+
+type AuditVerifyResOk struct {
+	Status       string                     `json:"status"`
+	Verification services.AuditVerification `json:"verification"`
+}
+
+type CacheStatsResOk struct {
+	Status string           `json:"status"`
+	Stats  utils.CacheStats `json:"stats"`
+}
+
+type RefreshesResOk struct {
+	Status    string                  `json:"status"`
+	Refreshes []services.RefreshState `json:"refreshes"`
+}
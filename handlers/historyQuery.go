@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// sessionSorts are the fields game and user histories can be sorted by.
+var sessionSorts = utils.SortFields[HistorySession]{
+	"time": utils.ByBig(func(s HistorySession) *big.Int { return s.Time }),
+	"gid":  utils.ByBig(func(s HistorySession) *big.Int { return s.Gid }),
+	"gtid": utils.By(func(s HistorySession) string { return s.Gtid }),
+	"uid":  utils.By(func(s HistorySession) string { return s.Uid }),
+}
+
+// paymentSorts are the fields stake histories can be sorted by.
+var paymentSorts = utils.SortFields[storage.GameHistoryPayment]{
+	"time":   utils.ByBig(func(p storage.GameHistoryPayment) *big.Int { return p.Time }),
+	"amount": utils.ByBig(func(p storage.GameHistoryPayment) *big.Int { return p.Amount }),
+	"sender": utils.By(func(p storage.GameHistoryPayment) string { return strings.ToLower(p.Sender.Hex()) }),
+}
+
+// querySessions keeps the sessions matching the from, to, gid, gtid and uid
+// query parameters, in the order of the sort parameter. It answers 400 when a
+// parameter is malformed.
+func querySessions(ctx *gin.Context, sessions []HistorySession) ([]HistorySession, bool) {
+	var filters []utils.Filter[HistorySession]
+	from, to, ok := timeRange(ctx)
+	if !ok {
+		return nil, false
+	}
+	if from != nil {
+		filters = append(filters, func(s HistorySession) bool { return !sessionSecond(s.Time).Before(*from) })
+	}
+	if to != nil {
+		filters = append(filters, func(s HistorySession) bool { return !sessionSecond(s.Time).After(*to) })
+	}
+	if gid := ctx.Query("gid"); gid != "" {
+		filters = append(filters, func(s HistorySession) bool { return s.Gid.String() == gid })
+	}
+	if gtid := ctx.Query("gtid"); gtid != "" {
+		filters = append(filters, func(s HistorySession) bool { return s.Gtid == gtid })
+	}
+	if uid := ctx.Query("uid"); uid != "" {
+		filters = append(filters, func(s HistorySession) bool { return s.Uid == uid })
+	}
+
+	order, err := sessionSorts.Parse(ctx.Query("sort"))
+	if err != nil {
+		queryFailed(ctx, err.Error())
+		return nil, false
+	}
+	res := utils.Where(sessions, filters...)
+	if order != nil {
+		order.Sort(res)
+	}
+	return res, true
+}
+
+// queryPayments keeps the payments matching the from, to, sender, min_amount
+// and max_amount query parameters, in the order of the sort parameter.
+// Amounts are whole tokens of symbol, such as "0.5". It answers 400 when a
+// parameter is malformed.
+func queryPayments(ctx *gin.Context, payments []storage.GameHistoryPayment, symbol string) ([]storage.GameHistoryPayment, bool) {
+	var filters []utils.Filter[storage.GameHistoryPayment]
+	from, to, ok := timeRange(ctx)
+	if !ok {
+		return nil, false
+	}
+	if from != nil {
+		filters = append(filters, func(p storage.GameHistoryPayment) bool { return !sessionSecond(p.Time).Before(*from) })
+	}
+	if to != nil {
+		filters = append(filters, func(p storage.GameHistoryPayment) bool { return !sessionSecond(p.Time).After(*to) })
+	}
+	if sender := ctx.Query("sender"); sender != "" {
+		if !common.IsHexAddress(sender) {
+			queryFailed(ctx, "invalid sender "+sender)
+			return nil, false
+		}
+		address := common.HexToAddress(sender)
+		filters = append(filters, func(p storage.GameHistoryPayment) bool { return p.Sender == address })
+	}
+
+	decimals, found := services.DefaultTokenDecimals[strings.ToUpper(symbol)]
+	if !found {
+		decimals = 18
+	}
+	for _, bound := range []struct {
+		param string
+		keep  func(cmp int) bool
+	}{
+		{param: "min_amount", keep: func(cmp int) bool { return cmp >= 0 }},
+		{param: "max_amount", keep: func(cmp int) bool { return cmp <= 0 }},
+	} {
+		value := ctx.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		amount, err := services.ParseTokenAmount(value, decimals)
+		if err != nil {
+			queryFailed(ctx, bound.param+": "+err.Error())
+			return nil, false
+		}
+		keep := bound.keep
+		filters = append(filters, func(p storage.GameHistoryPayment) bool { return keep(p.Amount.Cmp(amount)) })
+	}
+
+	order, err := paymentSorts.Parse(ctx.Query("sort"))
+	if err != nil {
+		queryFailed(ctx, err.Error())
+		return nil, false
+	}
+	res := utils.Where(payments, filters...)
+	if order != nil {
+		order.Sort(res)
+	}
+	return res, true
+}
+
+// sessionOrder returns the order of the sort parameter, nil for newest
+// first, to resume pages in. querySessions rejects unknown fields.
+func sessionOrder(ctx *gin.Context) utils.Comparator[HistorySession] {
+	order, _ := sessionSorts.Parse(ctx.Query("sort"))
+	return order
+}
+
+// paymentOrder returns the order of the sort parameter, nil for newest
+// first, to resume pages in. queryPayments rejects unknown fields.
+func paymentOrder(ctx *gin.Context) utils.Comparator[storage.GameHistoryPayment] {
+	order, _ := paymentSorts.Parse(ctx.Query("sort"))
+	return order
+}
+
+// timeRange reads the from and to query times, cut to the second, nil when
+// not given.
+func timeRange(ctx *gin.Context) (from, to *time.Time, ok bool) {
+	for _, bound := range []struct {
+		param string
+		value **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := ctx.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := parseTime(value)
+		if err != nil {
+			queryFailed(ctx, bound.param+": "+err.Error())
+			return nil, nil, false
+		}
+		at = at.Truncate(time.Second)
+		*bound.value = &at
+	}
+	return from, to, true
+}
+
+// sessionSecond reads a stored time in seconds or milliseconds, cut to the
+// second so the bounds of timeRange include their whole second.
+func sessionSecond(t *big.Int) time.Time {
+	return services.SessionTime(t).Truncate(time.Second)
+}
+
+func queryFailed(ctx *gin.Context, message string) {
+	response := GameHistoryResFail{
+		Status:  "fail",
+		Message: message,
+	}
+	ctx.JSON(http.StatusBadRequest, response)
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuerySessionsTimeRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := []HistorySession{
+		{GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(1), Gtid: "seconds", Time: big.NewInt(1_700_000_100)}},
+		{GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(1), Gtid: "millis", Time: big.NewInt(1_700_000_200_500)}},
+		{GameHistoryGameSession: storage.GameHistoryGameSession{Gid: big.NewInt(1), Gtid: "later", Time: big.NewInt(1_700_000_300_000)}},
+	}
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?from=1700000050&to=1700000200", nil)
+	res, ok := querySessions(ctx, sessions)
+	require.True(t, ok)
+	gtids := make([]string, 0, len(res))
+	for _, session := range res {
+		gtids = append(gtids, session.Gtid)
+	}
+	assert.Equal(t, []string{"seconds", "millis"}, gtids, "millisecond times are compared as times and the to second is included")
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// maxNeighbors caps the entries returned around a player.
+const maxNeighbors = 50
+
+type LeaderboardHandler struct {
+	services services.LeaderboardService
+	CallOpts *bind.CallOpts
+	Cache    *utils.Cache[string, []services.LeaderboardEntry]
+	versions *utils.Cache[utils.Gid, int64]
+	// Pages bounds the page sizes of the leaderboard.
+	Pages utils.Pagination
+}
+
+// NewLeaderboardHandler creates a new LeaderboardHandler instance.
+//
+// Parameters:
+//
+//	service: services.LeaderboardService
+//	call: *bind.CallOpts
+//	cache: utils.CacheBackend holding the leaderboard namespace
+//
+// Return Type:
+//
+//	*LeaderboardHandler
+func NewLeaderboardHandler(service services.LeaderboardService, call *bind.CallOpts, cache utils.CacheBackend) *LeaderboardHandler {
+	return &LeaderboardHandler{
+		services: service,
+		CallOpts: call,
+		Cache:    leaderboardCache(cache),
+		versions: leaderboardVersions(cache),
+	}
+}
+
+// Invalidate drops the cached leaderboards of a game, e.g. when the
+// anti-cheat flags or clears one of its sessions.
+func (l *LeaderboardHandler) Invalidate(gid int) {
+	l.versions.Set(utils.Gid(gid), time.Now().UnixNano(), 24*time.Hour)
+}
+
+// Leaderboard godoc
+// @Summary      Show game leaderboard
+// @Description  ranks the players of a game by their best score. The score is read from the session data at the field configured for the game. It paginates the results based on the cursor, page and pageSize query parameters, sizes above the configured maximum are cut to it.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gid   path      string  true  "Game ID"
+// @Param        window  query     string     false  "all, daily, weekly, monthly or season"
+// @Param        at  query     string     false  "A unix or RFC3339 time inside the window, defaults to now"
+// @Param        season  query     string     false  "Season name when window is season"
+// @Param        cursor  query     string     false  "next_cursor of the previous page"
+// @Param        page  query     string     false  "Page number, when no cursor is given"
+// @Param        pageSize  query     string     false  "Page size"
+// @Success      200  {object}  handler.LeaderboardResOk
+// @Header       200  {string}  Link  "The first and next pages, RFC 5988"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /game/leaderboard/{gid} [get]
+func (l *LeaderboardHandler) Leaderboard(ctx *gin.Context) {
+	var res []services.LeaderboardEntry
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid gid",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	request, ok := pageRequest(ctx, l.Pages)
+	if !ok {
+		return
+	}
+
+	window, err := l.window(ctx)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	version, _ := l.versions.Get(utils.Gid(gid))
+	key := strconv.Itoa(gid) + ":" + strconv.FormatInt(version, 10) + ":" + window.Key
+	if cached, found := l.Cache.Get(key); found {
+		res = cached
+	} else {
+		res, err = l.services.WindowLeaderboard(l.CallOpts, gid, window)
+		if err != nil {
+			log.Println("while building leaderboard: ", err.Error())
+			response := GameHistoryResFail{
+				Status:  "fail",
+				Message: err.Error(),
+			}
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		l.Cache.Set(key, res, time.Minute)
+	}
+
+	page := utils.Paginate(res, request, leaderboardCursor, nil)
+	response := LeaderboardResOk{
+		PageResOk: pageEnvelope(ctx, page, page.Items),
+		Window:    window,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Archive godoc
+// @Summary      Show archived leaderboards
+// @Description  lists the final rankings of closed daily, weekly, monthly and season windows of a game, most recent first. Each ranking is cut to its top entries.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gid   path      string  true  "Game ID"
+// @Param        top  query     string     false  "Entries kept per ranking"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Router       /game/leaderboard/{gid}/archive [get]
+func (l *LeaderboardHandler) Archive(ctx *gin.Context) {
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid gid",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	top, err := strconv.Atoi(ctx.DefaultQuery("top", "3"))
+	if err != nil || top < 1 {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid top",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res := l.services.Archived(gid)
+	for i := range res {
+		if len(res[i].Entries) > top {
+			res[i].Entries = res[i].Entries[:top]
+		}
+	}
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// PlayerRank godoc
+// @Summary      Show a player's rank
+// @Description  looks up a player's all time rank, percentile and best score on a game leaderboard together with the entries ranked directly above and below them.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gid   path      string  true  "Game ID"
+// @Param        uid   path      string  true  "User ID"
+// @Param        neighbors  query     string     false  "Entries returned above and below the player"
+// @Success      200  {object}  handler.PlayerRankResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /game/leaderboard/{gid}/player/{uid} [get]
+func (l *LeaderboardHandler) PlayerRank(ctx *gin.Context) {
+	gid, err := strconv.Atoi(ctx.Param("gid"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid gid",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	neighbors, err := strconv.Atoi(ctx.DefaultQuery("neighbors", "5"))
+	if err != nil || neighbors < 0 || neighbors > maxNeighbors {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid neighbors, must be between 0 and " + strconv.Itoa(maxNeighbors),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res, found, err := l.services.PlayerRank(l.CallOpts, gid, ctx.Param("uid"), neighbors)
+	if err != nil {
+		log.Println("while looking up player rank: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "player has no ranked session for this game",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := PlayerRankResOk{
+		Status: "success",
+		Player: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// window resolves the leaderboard window requested by the window, at and season query parameters.
+func (l *LeaderboardHandler) window(ctx *gin.Context) (services.LeaderboardWindow, error) {
+	at := time.Now()
+	if value := ctx.Query("at"); value != "" {
+		parsed, err := parseTime(value)
+		if err != nil {
+			return services.LeaderboardWindow{}, err
+		}
+		at = parsed
+	}
+	return l.services.Calendar().Window(ctx.DefaultQuery("window", services.WindowAllTime), at, ctx.Query("season"))
+}
+
+// parseTime reads a query time given as unix seconds or RFC3339.
+func parseTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + value)
+	}
+	return parsed, nil
+}
+
+// leaderboardCursor positions an entry by its rank, best first.
+func leaderboardCursor(entry services.LeaderboardEntry) utils.Cursor {
+	return utils.Cursor{
+		Position: -int64(entry.Rank),
+		ID:       entry.Uid,
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLeaderboard serves a fixed ranking of every window.
+type fakeLeaderboard struct {
+	services.LeaderboardService
+	entries []services.LeaderboardEntry
+}
+
+func (f *fakeLeaderboard) WindowLeaderboard(_ *bind.CallOpts, _ int, _ services.LeaderboardWindow) ([]services.LeaderboardEntry, error) {
+	return f.entries, nil
+}
+
+func (f *fakeLeaderboard) Calendar() *services.LeaderboardCalendar {
+	return services.NewLeaderboardCalendar(time.UTC, nil)
+}
+
+func TestLeaderboardInvalidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := &fakeLeaderboard{entries: []services.LeaderboardEntry{{Rank: 1, Uid: "alice"}, {Rank: 2, Uid: "mallory"}}}
+	handler := NewLeaderboardHandler(service, nil, utils.NewCache())
+	router := gin.New()
+	router.GET("/leaderboard/:gid", handler.Leaderboard)
+
+	read := func() PageResOk {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest("GET", "/leaderboard/1?pageSize=1", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		var res PageResOk
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &res))
+		return res
+	}
+
+	page := read()
+	assert.Equal(t, 2, page.Total)
+	assert.True(t, page.HasMore)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The ranking is cached until the anti-cheat changes a session of the game.
+	service.entries = service.entries[:1]
+	assert.Equal(t, 2, read().Total)
+	handler.Invalidate(1)
+	page = read()
+	assert.Equal(t, 1, page.Total)
+	assert.False(t, page.HasMore)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// pageRequest parses the cursor, page and pageSize query parameters,
+// answering 400 when they are malformed.
+func pageRequest(ctx *gin.Context, pages utils.Pagination) (utils.PageRequest, bool) {
+	res, err := pages.Parse(ctx.Request.URL.Query())
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return res, false
+	}
+	return res, true
+}
+
+// writePage answers with a page in the paged envelope, linking the first and
+// next pages in the Link header. items is what the page lists, usually
+// page.Items.
+func writePage[T any](ctx *gin.Context, page utils.Page[T], items any) {
+	ctx.JSON(http.StatusOK, pageEnvelope(ctx, page, items))
+}
+
+// pageEnvelope returns the paged envelope of a page and sets the Link header,
+// for responses that add fields to the envelope.
+func pageEnvelope[T any](ctx *gin.Context, page utils.Page[T], items any) PageResOk {
+	links := []string{`<` + pageLink(ctx, "") + `>; rel="first"`}
+	if page.Next != "" {
+		links = append(links, `<`+pageLink(ctx, page.Next)+`>; rel="next"`)
+	}
+	ctx.Header("Link", strings.Join(links, ", "))
+
+	return PageResOk{
+		Status:     "success",
+		Page:       items,
+		Total:      page.Total,
+		HasMore:    page.HasMore,
+		NextCursor: page.Next,
+	}
+}
+
+// pageLink returns the URL of the request with its page replaced by cursor,
+// or of the first page when cursor is empty.
+func pageLink(ctx *gin.Context, cursor string) string {
+	query := ctx.Request.URL.Query()
+	query.Del("page")
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	link := url.URL{Path: ctx.Request.URL.Path, RawQuery: query.Encode()}
+	return link.String()
+}
+
+// sessionCursor positions a listed session by its time, keeping the fields
+// it can be sorted by. The data is left out to keep cursors short.
+func sessionCursor(session HistorySession) utils.Cursor {
+	keys := session
+	keys.Data = ""
+	item, _ := json.Marshal(keys)
+	return utils.Cursor{
+		Position: session.Time.Int64(),
+		ID:       services.SessionFingerprint(session.GameHistoryGameSession),
+		Item:     item,
+	}
+}
+
+// paymentCursor positions a stake payment by its time, keeping the fields it
+// can be sorted by.
+func paymentCursor(payment storage.GameHistoryPayment) utils.Cursor {
+	item, _ := json.Marshal(payment)
+	return utils.Cursor{
+		Position: payment.Time.Int64(),
+		ID:       services.PaymentFingerprint(payment),
+		Item:     item,
+	}
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type PayoutHandler struct {
+	payouts     services.PayoutService
+	leaderboard services.LeaderboardService
+	prizes      services.PrizeTable
+	CallOpts    *bind.CallOpts
+}
+
+// NewPayoutHandler creates a new PayoutHandler instance.
+//
+// Parameters:
+//
+//	payouts: services.PayoutService
+//	leaderboard: services.LeaderboardService
+//	prizes: services.PrizeTable used when a request has no prizes of its own
+//	call: *bind.CallOpts
+//
+// Return Type:
+//
+//	*PayoutHandler
+func NewPayoutHandler(payouts services.PayoutService, leaderboard services.LeaderboardService, prizes services.PrizeTable, call *bind.CallOpts) *PayoutHandler {
+	return &PayoutHandler{
+		payouts:     payouts,
+		leaderboard: leaderboard,
+		prizes:      prizes,
+		CallOpts:    call,
+	}
+}
+
+// PreviewPayout godoc
+// @Summary      Preview a payout
+// @Description  dry run of the payout of a closed leaderboard window: shows each winner, their wallet, the prize in token units and the hot wallet balance. Nothing is stored or sent.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body handler.PayoutReq true  "Window and prizes"
+// @Success      200  {object}  handler.PayoutResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/payouts/preview [post]
+func (p *PayoutHandler) PreviewPayout(ctx *gin.Context) {
+	req, window, prizes, ok := p.bind(ctx)
+	if !ok {
+		return
+	}
+
+	res, err := p.payouts.Preview(p.CallOpts, req.Gid, window, prizes)
+	if err != nil {
+		log.Println("while previewing payout: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := PayoutResOk{
+		Status: "success",
+		Batch:  res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreatePayout godoc
+// @Summary      Create a payout
+// @Description  stores the payout batch of a closed leaderboard window in the ledger. A window can only have one batch, execute it to send the transfers.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body handler.PayoutReq true  "Window and prizes"
+// @Success      201  {object}  handler.PayoutResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.PayoutResOk
+// @Router       /admin/payouts [post]
+func (p *PayoutHandler) CreatePayout(ctx *gin.Context) {
+	req, window, prizes, ok := p.bind(ctx)
+	if !ok {
+		return
+	}
+
+	res, err := p.payouts.Create(p.CallOpts, req.Gid, window, prizes)
+	if errors.Is(err, services.ErrPayoutExists) {
+		response := PayoutResOk{
+			Status: "fail",
+			Batch:  res,
+		}
+		ctx.JSON(http.StatusConflict, response)
+		return
+	}
+	if err != nil {
+		log.Println("while creating payout: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := PayoutResOk{
+		Status: "success",
+		Batch:  res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// ExecutePayout godoc
+// @Summary      Execute a payout
+// @Description  sends the token transfers of a payout batch from the hot wallet. Safe to call again: paid winners are skipped and sent transfers are only rebroadcast, never signed twice. Call it again after the transfers are mined to mark them paid.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Payout batch ID"
+// @Success      200  {object}  handler.PayoutResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      502  {object}  handler.PayoutResOk
+// @Router       /admin/payouts/{id}/execute [post]
+func (p *PayoutHandler) ExecutePayout(ctx *gin.Context) {
+	res, err := p.payouts.Execute(ctx, ctx.Param("id"))
+	for _, item := range res.Items {
+		if item.TxHash != "" {
+			middleware.AuditTx(ctx, item.TxHash)
+		}
+	}
+	if errors.Is(err, services.ErrPayoutNotFound) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+	if err != nil {
+		log.Println("while executing payout: ", err.Error())
+		response := PayoutResOk{
+			Status: "fail",
+			Batch:  res,
+		}
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := PayoutResOk{
+		Status: "success",
+		Batch:  res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ResolvePayout godoc
+// @Summary      Resolve unlinked winners of a payout
+// @Description  approves the wallets winners without one linked since the payout batch was created, so the next execute pays them. Batches only ever pay the wallets stored on them.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Payout batch ID"
+// @Success      200  {object}  handler.PayoutResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /admin/payouts/{id}/resolve [post]
+func (p *PayoutHandler) ResolvePayout(ctx *gin.Context) {
+	res, err := p.payouts.Resolve(ctx.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPayoutNotFound) {
+			status = http.StatusNotFound
+		}
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(status, response)
+		return
+	}
+
+	response := PayoutResOk{
+		Status: "success",
+		Batch:  res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetPayout godoc
+// @Summary      Show a payout
+// @Description  shows a payout batch from the ledger with the status and transaction of every transfer.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Payout batch ID"
+// @Success      200  {object}  handler.PayoutResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/payouts/{id} [get]
+func (p *PayoutHandler) GetPayout(ctx *gin.Context) {
+	res, found := p.payouts.Get(ctx.Param("id"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: services.ErrPayoutNotFound.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := PayoutResOk{
+		Status: "success",
+		Batch:  res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ListPayouts godoc
+// @Summary      List payouts
+// @Description  lists every payout batch in the ledger, newest first.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/payouts [get]
+func (p *PayoutHandler) ListPayouts(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   p.payouts.List(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// bind reads a PayoutReq and resolves its window and prize table. Without
+// an at time the last closed window of the kind is used.
+func (p *PayoutHandler) bind(ctx *gin.Context) (req PayoutReq, window services.LeaderboardWindow, prizes services.PrizeTable, ok bool) {
+	fail := func(message string) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: message,
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	calendar := p.leaderboard.Calendar()
+	var err error
+	if req.At != "" {
+		at, parseErr := parseTime(req.At)
+		if parseErr != nil {
+			fail(parseErr.Error())
+			return
+		}
+		window, err = calendar.Window(req.Window, at, req.Season)
+	} else if window, err = calendar.Window(req.Window, time.Now(), req.Season); err == nil && req.Window != services.WindowSeason {
+		window, err = calendar.Previous(window)
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	prizes = p.prizes
+	if len(req.Prizes) > 0 {
+		if prizes, err = services.ParsePrizeTable(req.Prizes); err != nil {
+			fail(err.Error())
+			return
+		}
+	}
+	if len(prizes) == 0 {
+		fail("no prize table configured")
+		return
+	}
+	return req, window, prizes, true
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type PlayerHandler struct {
+	stats    services.PlayerStatsService
+	links    services.WalletLinkService
+	overview services.PlayerOverviewService
+	history  services.GameHistoryContract
+	CallOpts *bind.CallOpts
+}
+
+// NewPlayerHandler creates a new PlayerHandler instance.
+//
+// Parameters:
+//
+//	stats: services.PlayerStatsService
+//	links: services.WalletLinkService
+//	overview: services.PlayerOverviewService
+//	history: services.GameHistoryContract
+//	call: *bind.CallOpts
+//
+// Return Type:
+//
+//	*PlayerHandler
+func NewPlayerHandler(stats services.PlayerStatsService, links services.WalletLinkService, overview services.PlayerOverviewService, history services.GameHistoryContract, call *bind.CallOpts) *PlayerHandler {
+	return &PlayerHandler{
+		stats:    stats,
+		links:    links,
+		overview: overview,
+		history:  history,
+		CallOpts: call,
+	}
+}
+
+// PlayerStats godoc
+// @Summary      Show player statistics
+// @Description  summarises every session of a player: sessions per game with first and last played, best, average and median score, daily play streaks and sessions per week.
+// @Tags         player
+// @Produce      json
+// @Param        uid   path      string  true  "User ID"
+// @Success      200  {object}  handler.PlayerStatsResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /player/{uid}/stats [get]
+func (p *PlayerHandler) PlayerStats(ctx *gin.Context) {
+	res, err := p.stats.Stats(p.CallOpts, ctx.Param("uid"))
+	if err != nil {
+		log.Println("while getting player stats: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if res.TotalSessions == 0 {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "no game data for provided uid",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := PlayerStatsResOk{
+		Status: "success",
+		Stats:  res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// LinkChallenge godoc
+// @Summary      Start linking a wallet
+// @Description  issues a single use nonce for a player to sign with their wallet. Sign the message with personal_sign or the typed data with eth_signTypedData_v4, then post the signature to /player/link before the challenge expires.
+// @Description  The first link of a uid is made by its game server with an API key with the game:write scope for a game the uid played. A player signed in with Sign-In with Ethereum links the signed in address, and only to a uid that is already linked. Replacing a link also needs the signature of the linked wallet.
+// @Tags         player
+// @Accept       json
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, the session cookie does not change state"
+// @Param        X-API-Key  header    string  false  "API key with the game:write scope, when not signed in"
+// @Param        data  body handler.LinkChallengeReq true  "Player and wallet to link, the wallet defaults to the signed in address"
+// @Success      200  {object}  handler.LinkChallengeResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      429  {object}  handler.GameHistoryResFail
+// @Router       /player/link/challenge [post]
+func (p *PlayerHandler) LinkChallenge(ctx *gin.Context) {
+	var req LinkChallengeReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if session, found := middleware.RequestSession(ctx); found {
+		if req.Address != "" && (!common.IsHexAddress(req.Address) || common.HexToAddress(req.Address) != session.Address) {
+			response := GameHistoryResFail{
+				Status:  "fail",
+				Message: "only the signed in address can be linked",
+			}
+			ctx.JSON(http.StatusForbidden, response)
+			return
+		}
+		req.Address = session.Address.Hex()
+	}
+	requester, allowed := p.mayLink(ctx, req.Uid)
+	if !allowed {
+		return
+	}
+
+	res, err := p.links.Challenge(requester, req.Uid, req.Address)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrTooManyChallenges) {
+			status = http.StatusTooManyRequests
+		}
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(status, response)
+		return
+	}
+
+	response := LinkChallengeResOk{
+		Status:    "success",
+		Challenge: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// LinkWallet godoc
+// @Summary      Link a wallet
+// @Description  verifies the signed challenge and links the wallet to the player. It must be answered by whoever asked for the challenge. A player has one wallet, linking again replaces it when current_signature is the signature of the challenge by the linked wallet. A wallet linked to another player is rejected.
+// @Tags         player
+// @Accept       json
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, the session cookie does not change state"
+// @Param        X-API-Key  header    string  false  "API key with the game:write scope, when not signed in"
+// @Param        data  body handler.LinkWalletReq true  "Signed challenge"
+// @Success      200  {object}  handler.WalletLinkResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /player/link [post]
+func (p *PlayerHandler) LinkWallet(ctx *gin.Context) {
+	var req LinkWalletReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if req.Method == "" {
+		req.Method = services.SignPersonal
+	}
+
+	res, err := p.links.Link(linkRequester(ctx), req.Nonce, req.Signature, req.Method, req.CurrentSignature)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrChallengeNotFound), errors.Is(err, services.ErrSignatureMismatch), errors.Is(err, services.ErrLinkSignOff):
+			status = http.StatusUnauthorized
+		case errors.Is(err, services.ErrAddressLinked):
+			status = http.StatusConflict
+		}
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(status, response)
+		return
+	}
+
+	response := WalletLinkResOk{
+		Status: "success",
+		Link:   res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// linkRequester names the caller of a link route, by signed in address or
+// API key id.
+func linkRequester(ctx *gin.Context) string {
+	if session, found := middleware.RequestSession(ctx); found {
+		return "address:" + session.Address.Hex()
+	}
+	if key, found := middleware.RequestAPIKey(ctx); found {
+		return "key:" + key.ID
+	}
+	return ""
+}
+
+// mayLink checks the caller may link uid, answering the request when
+// it may not. Signed in players may only relink a uid that is already
+// linked, the linked wallet signing off on the change. Game servers may link
+// the uids of the games their API key is bound to.
+func (p *PlayerHandler) mayLink(ctx *gin.Context, uid string) (requester string, allowed bool) {
+	requester = linkRequester(ctx)
+	fail := func(status int, message string) (string, bool) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: message,
+		}
+		ctx.JSON(status, response)
+		return "", false
+	}
+
+	if _, found := middleware.RequestSession(ctx); found {
+		if _, linked := p.links.ByUid(uid); !linked {
+			return fail(http.StatusForbidden, "the game server has to link a uid the first time")
+		}
+		return requester, true
+	}
+
+	key, found := middleware.RequestAPIKey(ctx)
+	if !found {
+		return fail(http.StatusUnauthorized, "sign in or api key required")
+	}
+	if len(key.Gids) == 0 {
+		return requester, true
+	}
+	sessions, err := p.history.GetUserGameData(p.CallOpts, uid)
+	if err != nil {
+		log.Println("while checking the games of a uid to link: ", err.Error())
+		return fail(http.StatusInternalServerError, "could not read the games of the uid")
+	}
+	if len(keySessions(ctx, sessions)) == 0 {
+		return fail(http.StatusForbidden, "uid has not played a game the api key is bound to")
+	}
+	return requester, true
+}
+
+// PlayerWallet godoc
+// @Summary      Show a player's wallet
+// @Description  resolves a uid to its linked wallet. Players must be signed in with the linked wallet, game servers use an API key with the game:read scope.
+// @Tags         player
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the game:read scope, when not signed in"
+// @Param        uid   path      string  true  "User ID"
+// @Success      200  {object}  handler.WalletLinkResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /player/{uid}/wallet [get]
+func (p *PlayerHandler) PlayerWallet(ctx *gin.Context) {
+	if !p.ownsUid(ctx, ctx.Param("uid")) {
+		return
+	}
+	link, found := p.links.ByUid(ctx.Param("uid"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "no wallet linked to provided uid",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := WalletLinkResOk{
+		Status: "success",
+		Link:   link,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// WalletPlayer godoc
+// @Summary      Show a wallet's player
+// @Description  resolves a wallet address to the uid it is linked to. Players must be signed in as the address, game servers use an API key with the game:read scope.
+// @Tags         player
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the game:read scope, when not signed in"
+// @Param        address   path      string  true  "Wallet Address"
+// @Success      200  {object}  handler.WalletLinkResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /player/wallet/{address} [get]
+func (p *PlayerHandler) WalletPlayer(ctx *gin.Context) {
+	link, found := p.links.ByAddress(ctx.Param("address"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "no player linked to provided address",
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := WalletLinkResOk{
+		Status: "success",
+		Link:   link,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// PlayerOverview godoc
+// @Summary      Show a player overview
+// @Description  combines the latest game sessions of a player with the stake history and stake total of their linked wallet. Stake fields are null when no wallet is linked. Players must be signed in with the linked wallet, game servers use an API key with the game:read scope.
+// @Tags         player
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the game:read scope, when not signed in"
+// @Param        uid   path      string  true  "User ID"
+// @Param        limit  query     int     false  "Most sessions and stakes to return, newest first (default 20, max 100)"
+// @Success      200  {object}  handler.PlayerOverviewResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Router       /player/{uid}/overview [get]
+func (p *PlayerHandler) PlayerOverview(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "Invalid limit",
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if !p.ownsUid(ctx, ctx.Param("uid")) {
+		return
+	}
+
+	res, err := p.overview.Overview(p.CallOpts, ctx.Param("uid"), limit)
+	if err != nil {
+		log.Println("while getting player overview: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := PlayerOverviewResOk{
+		Status:   "success",
+		Overview: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ownsUid checks that a signed in player is linked to uid, answering 403 when
+// not. Links only change with the sign-off of the linked wallet, so the link
+// table can be trusted here. API key callers are let through.
+func (p *PlayerHandler) ownsUid(ctx *gin.Context, uid string) bool {
+	session, found := middleware.RequestSession(ctx)
+	if !found {
+		return true
+	}
+	if link, linked := p.links.ByUid(uid); !linked || link.Address != session.Address {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "player is not linked to the signed in address",
+		}
+		ctx.JSON(http.StatusForbidden, response)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+)
+
+type RateLimitHandler struct {
+	limiter *middleware.RateLimiter
+}
+
+// NewRateLimitHandler creates a new RateLimitHandler instance.
+//
+// Parameters:
+//
+//	limiter: *middleware.RateLimiter
+//
+// Return Type:
+//
+//	*RateLimitHandler
+func NewRateLimitHandler(limiter *middleware.RateLimiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		limiter: limiter,
+	}
+}
+
+// RateLimitStats godoc
+// @Summary      Show rate limit counters
+// @Description  lists every rate limited route with its limit and how many requests it let through and refused since the server started.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/ratelimits [get]
+func (r *RateLimitHandler) RateLimitStats(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   r.limiter.Stats(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"time"
 
@@ -20,8 +19,12 @@ type StakeHandler struct {
 	ctx             *context.Context
 	TransactOpts    *bind.TransactOpts
 	CallOpts        *bind.CallOpts
-	Cache           *utils.Cache
+	Stakes          *utils.Cache[utils.Address, []storage.GameHistoryPayment]
 	contractAddress string
+	prices          services.PriceService
+	stakeSymbol     string
+	// Pages bounds the page sizes of the stake history.
+	Pages utils.Pagination
 }
 
 // NewStakingHandler creates a new StakeHandler instance.
@@ -32,20 +35,24 @@ type StakeHandler struct {
 //		ctx_: *context.Context
 //		tans: *bind.TransactOpts
 //		call: *bind.CallOpts
-//		cache: *utils.Cache
+//		cache: utils.CacheBackend holding the stake history namespace
 //	 	contractAddress: string
+//		prices: services.PriceService
+//		stakeSymbol: string, the token stakes are paid in
 //
 // Return Type:
 //
 //	*StakeHandler
-func NewStakingHandler(service services.StackingContract, ctx_ *context.Context, tans *bind.TransactOpts, call *bind.CallOpts, cache *utils.Cache, contractAdd string) *StakeHandler {
+func NewStakingHandler(service services.StackingContract, ctx_ *context.Context, tans *bind.TransactOpts, call *bind.CallOpts, cache utils.CacheBackend, contractAdd string, prices services.PriceService, stakeSymbol string) *StakeHandler {
 	return &StakeHandler{
 		services:        service,
 		ctx:             ctx_,
 		TransactOpts:    tans,
 		CallOpts:        call,
-		Cache:           cache,
+		Stakes:          stakeCache(cache),
 		contractAddress: contractAdd,
+		prices:          prices,
+		stakeSymbol:     stakeSymbol,
 	}
 }
 
@@ -54,9 +61,14 @@ func NewStakingHandler(service services.StackingContract, ctx_ *context.Context,
 // @Description  handles the retrieval total stake for a users wallet..
 // @Tags         staking
 // @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token of the address, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the stake:read scope, when not signed in"
 // @Param        address   path      string  true  "Wallet Address"
-// @Success      200  {object}  handler.GameHistoryResOk
+// @Param        fiat  query     bool     false  "Include the fiat value of the total"
+// @Success      200  {object}  handler.StakeTotalRes
 // @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      404  {object}  handler.GameHistoryResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
 // @Router       /stake/total/user/{address} [get]
@@ -74,7 +86,28 @@ func (g *StakeHandler) UserTotalStake(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, res)
+	if !wantsFiat(ctx) {
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+
+	value, err := g.prices.Value(ctx, g.stakeSymbol, res)
+	if err != nil {
+		log.Println("while pricing stake total: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "price unavailable",
+		}
+		ctx.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+
+	response := StakeTotalRes{
+		Status: "success",
+		Total:  res,
+		Fiat:   value,
+	}
+	ctx.JSON(http.StatusOK, response)
 }
 
 // Stake godoc
@@ -82,9 +115,13 @@ func (g *StakeHandler) UserTotalStake(ctx *gin.Context) {
 // @Description  Generates the qr code and payment link for user stake.
 // @Tags         staking
 // @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, the session cookie does not change state"
+// @Param        X-API-Key  header    string  false  "API key with the stake:read scope, when not signed in"
 // @Param        value   query      string  true  "Transaction Value"
 // @Success      200  {object}  handler.GameHistoryResOk
 // @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      404  {object}  handler.GameHistoryResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
 // @Router       /stake/pay [get]
@@ -107,44 +144,112 @@ func (g *StakeHandler) Stake(ctx *gin.Context) {
 
 // UserStakeHistory godoc
 // @Summary      Show user game history
-// @Description  handles the retrieval of stake history for a given wallet. It paginates the results based on the page and pageSize query parameters.
+// @Description  handles the retrieval of stake history for a given wallet. Payments are listed newest first. Follow next_cursor, or the next Link, for the following page; cursors keep their place when new payments arrive.
 // @Tags         staking
 // @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token of the address, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the stake:read scope, when not signed in"
 // @Param        address   path      string  true  "Wallet Address"
-// @Param        page  query     string     false  "Page number"
-// @Param        pageSize  query     string     false  "Page size"
-// @Success      200  {object}  handler.GameHistoryResOk
+// @Param        cursor  query     string     false  "The next_cursor of the previous page"
+// @Param        page  query     string     false  "Page number, when no cursor is given"
+// @Param        pageSize  query     string     false  "Page size, at most MAX_PAGE_SIZE"
+// @Param        fiat  query     bool     false  "Include the fiat value of each payment"
+// @Param        from  query     string     false  "Only payments at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only payments at or before this unix or RFC3339 time"
+// @Param        sender  query     string     false  "Only payments from this address"
+// @Param        min_amount  query     string     false  "Only payments of at least this many whole tokens, such as 0.5"
+// @Param        max_amount  query     string     false  "Only payments of at most this many whole tokens"
+// @Param        sort  query     string     false  "Comma separated time, amount or sender, descending with a leading -, defaults to -time"
+// @Success      200  {object}  handler.PageResOk
+// @Header       200  {string}  Link  "The first and next pages, RFC 5988"
 // @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
 // @Failure      404  {object}  handler.GameHistoryResFail
 // @Failure      500  {object}  handler.GameHistoryResFail
 // @Router       /stake/history/user/{address} [get]
 func (g *StakeHandler) UserStakeHistory(ctx *gin.Context) {
-	var res []storage.GameHistoryPayment
-	address := ctx.Param("address")
+	request, ok := pageRequest(ctx, g.Pages)
+	if !ok {
+		return
+	}
 
-	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		log.Println("Invalid page number")
-		response := GameHistoryResFail{
-			Status:  "fail",
-			Message: "Invalid page number",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+	res, ok := g.stakePayments(ctx)
+	if !ok {
 		return
 	}
 
-	pageSize, err := strconv.Atoi(ctx.DefaultQuery("pageSize", "20"))
-	if err != nil || pageSize < 1 {
-		log.Println("Invalid page size")
-		response := GameHistoryResFail{
-			Status:  "fail",
-			Message: "Invalid page size",
+	page := utils.Paginate(res, request, paymentCursor, paymentOrder(ctx))
+	if !wantsFiat(ctx) {
+		writePage(ctx, page, page.Items)
+		return
+	}
+
+	valued := make([]PaymentValuation, 0, len(page.Items))
+	for _, payment := range page.Items {
+		value, err := g.prices.Value(ctx, g.stakeSymbol, payment.Amount)
+		if err != nil {
+			log.Println("while pricing payment: ", err.Error())
+			response := GameHistoryResFail{
+				Status:  "fail",
+				Message: "price unavailable",
+			}
+			ctx.JSON(http.StatusServiceUnavailable, response)
+			return
 		}
-		ctx.JSON(http.StatusBadRequest, response)
+		valued = append(valued, PaymentValuation{GameHistoryPayment: payment, Fiat: value})
+	}
+	writePage(ctx, page, valued)
+}
+
+// UserStakeExport godoc
+// @Summary      Export user stake history
+// @Description  streams every stake payment of a wallet as CSV or NDJSON, with the filters and sort of the stake history. Amounts, in the smallest unit of the token, and times are exact decimal strings.
+// @Tags         staking
+// @Produce      text/csv,application/x-ndjson,json
+// @Param        Authorization  header    string  false  "Bearer session token of the address, when the session cookie is not sent"
+// @Param        X-API-Key  header    string  false  "API key with the stake:read scope, when not signed in"
+// @Param        address   path      string  true  "Wallet Address"
+// @Param        format  query     string     false  "csv or ndjson, overriding the Accept header"
+// @Param        from  query     string     false  "Only payments at or after this unix or RFC3339 time"
+// @Param        to  query     string     false  "Only payments at or before this unix or RFC3339 time"
+// @Param        sender  query     string     false  "Only payments from this address"
+// @Param        min_amount  query     string     false  "Only payments of at least this many whole tokens, such as 0.5"
+// @Param        max_amount  query     string     false  "Only payments of at most this many whole tokens"
+// @Param        sort  query     string     false  "Comma separated time, amount or sender, descending with a leading -, defaults to -time"
+// @Success      200  {string}  string  "One row per payment with sender, amount and time"
+// @Header       200  {string}  X-Total-Count  "The number of exported payments"
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      406  {object}  handler.GameHistoryResFail
+// @Failure      500  {object}  handler.GameHistoryResFail
+// @Router       /stake/export/user/{address} [get]
+func (g *StakeHandler) UserStakeExport(ctx *gin.Context) {
+	format, ok := exportFormat(ctx)
+	if !ok {
+		return
+	}
+
+	res, ok := g.stakePayments(ctx)
+	if !ok {
 		return
 	}
 
-	if _, found := g.Cache.Get(address); !found {
+	writeExport(ctx, format, "stake-"+ctx.Param("address")+"-history", res, paymentColumns)
+}
+
+// stakePayments lists the stake payments of the address in the path,
+// filtered and sorted by the query. It answers the request itself when that
+// fails.
+func (g *StakeHandler) stakePayments(ctx *gin.Context) ([]storage.GameHistoryPayment, bool) {
+	var res []storage.GameHistoryPayment
+	address := ctx.Param("address")
+
+	if cached, found := g.Stakes.Get(utils.AddressKey(address)); found {
+		res = cached
+	} else {
+		var err error
 		res, err = g.services.UserStakeHistory(g.CallOpts, address)
 		if err != nil {
 			log.Println("while getting game data: ", err.Error())
@@ -153,44 +258,19 @@ func (g *StakeHandler) UserStakeHistory(ctx *gin.Context) {
 				Message: err.Error(),
 			}
 			ctx.JSON(http.StatusBadRequest, response)
-			return
+			return nil, false
 		}
 
-		sort.SliceStable(res, func(i, j int) bool {
-			return utils.ComparePtrFieldsDesc(&res[i], &res[j])
-		})
+		services.PaymentsNewestFirst.Sort(res)
 
-		g.Cache.Set(address, res, 6*time.Minute)
+		g.Stakes.Set(utils.AddressKey(address), res, 6*time.Minute)
 	}
 
-	cachedData, _ := g.Cache.Get(address)
-	res = cachedData.([]storage.GameHistoryPayment)
-
-	if len(res) == 0 {
-		response := GameHistoryResOk{
-			Status: "failed no game data for provided gid",
-			Page:   []storage.GameHistoryGameSession{},
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
+	return queryPayments(ctx, res, g.stakeSymbol)
+}
 
-	startIndex := (page - 1) * pageSize
-	endIndex := page * pageSize
-	if startIndex >= len(res) {
-		response := GameHistoryResOk{
-			Status: "failed no new page",
-			Page:   []storage.GameHistoryGameSession{},
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-	if endIndex > len(res) {
-		endIndex = len(res)
-	}
-	response := GameHistoryResOk{
-		Status: "success",
-		Page:   res[startIndex:endIndex],
-	}
-	ctx.JSON(http.StatusOK, response)
+// wantsFiat reports whether the request asked for fiat valuations with ?fiat=true.
+func wantsFiat(ctx *gin.Context) bool {
+	fiat, _ := strconv.ParseBool(ctx.Query("fiat"))
+	return fiat
 }
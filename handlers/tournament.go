@@ -0,0 +1,393 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/middleware"
+	"github.com/joey1123455/easy_get_coin/services"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+type TournamentHandler struct {
+	services     services.TournamentService
+	sessions     services.GameSessionService
+	links        services.WalletLinkService
+	pending      services.PendingSessionService
+	TransactOpts *bind.TransactOpts
+	CallOpts     *bind.CallOpts
+}
+
+// NewTournamentHandler creates a new TournamentHandler instance.
+//
+// Parameters:
+//
+//	service: services.TournamentService
+//	sessions: services.GameSessionService issuing the tokens sessions are submitted with
+//	links: services.WalletLinkService matching signed in players to uids
+//	pending: services.PendingSessionService following submitted sessions
+//	tans: *bind.TransactOpts
+//	call: *bind.CallOpts
+//
+// Return Type:
+//
+//	*TournamentHandler
+func NewTournamentHandler(service services.TournamentService, sessions services.GameSessionService, links services.WalletLinkService, pending services.PendingSessionService, tans *bind.TransactOpts, call *bind.CallOpts) *TournamentHandler {
+	return &TournamentHandler{
+		services:     service,
+		sessions:     sessions,
+		links:        links,
+		pending:      pending,
+		TransactOpts: tans,
+		CallOpts:     call,
+	}
+}
+
+// tournamentStatus maps tournament errors to a response status.
+func tournamentStatus(err error) int {
+	var invalid *services.ValidationError
+	switch {
+	case errors.Is(err, services.ErrTournamentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrEntryNotPaid):
+		return http.StatusPaymentRequired
+	case errors.Is(err, services.ErrNotRegistered), errors.Is(err, services.ErrWalletNotLinked):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTournamentClosed), errors.Is(err, services.ErrTournamentFull),
+		errors.Is(err, services.ErrAlreadyRegistered), errors.Is(err, services.ErrSessionLimit),
+		errors.Is(err, services.ErrTournamentNotEnded), errors.Is(err, services.ErrTournamentFinalized):
+		return http.StatusConflict
+	case errors.As(err, &invalid), errors.Is(err, services.ErrGameTypeNotFound):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+// CreateTournament godoc
+// @Summary      Create a tournament
+// @Description  creates a time boxed tournament on a game with its rules, entry fee in the stake token, pool shares in percent per rank and schedule.
+// @Tags         tournament
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body services.Tournament true  "Tournament"
+// @Success      201  {object}  handler.TournamentResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /tournament [post]
+func (t *TournamentHandler) CreateTournament(ctx *gin.Context) {
+	var tournament services.Tournament
+	if err := ctx.ShouldBindJSON(&tournament); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res, err := t.services.Create(tournament)
+	if err != nil {
+		log.Println("while creating tournament: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := TournamentResOk{
+		Status:     "success",
+		Tournament: res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// ListTournaments godoc
+// @Summary      List tournaments
+// @Description  lists every tournament, latest start first.
+// @Tags         tournament
+// @Produce      json
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Router       /tournament [get]
+func (t *TournamentHandler) ListTournaments(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   t.services.List(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetTournament godoc
+// @Summary      Show a tournament
+// @Description  shows a tournament with its entries and, once finalized, its standings and prizes.
+// @Tags         tournament
+// @Produce      json
+// @Param        id   path      string  true  "Tournament ID"
+// @Success      200  {object}  handler.TournamentResOk
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /tournament/{id} [get]
+func (t *TournamentHandler) GetTournament(ctx *gin.Context) {
+	res, found := t.services.Get(ctx.Param("id"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: services.ErrTournamentNotFound.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	response := TournamentResOk{
+		Status:     "success",
+		Tournament: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RegisterTournament godoc
+// @Summary      Register for a tournament
+// @Description  registers a player before the tournament ends. Entry fees are paid with the stake payment flow from the wallet linked to the player, any unused payment of at least the fee made after the tournament was created pays the entry. Players must be signed in with the wallet linked to the uid, game servers use an API key with the game:write scope for the tournament's game.
+// @Tags         tournament
+// @Accept       json
+// @Produce      json
+// @Param        Authorization  header    string  false  "Bearer session token, the session cookie does not change state"
+// @Param        X-API-Key  header    string  false  "API key with the game:write scope, when not signed in"
+// @Param        id   path      string  true  "Tournament ID"
+// @Param        data  body handler.TournamentRegisterReq true  "Player"
+// @Success      201  {object}  handler.TournamentEntryResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      402  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Router       /tournament/{id}/register [post]
+func (t *TournamentHandler) RegisterTournament(ctx *gin.Context) {
+	var req TournamentRegisterReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	tournament, found := t.services.Get(ctx.Param("id"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: services.ErrTournamentNotFound.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+	if session, found := middleware.RequestSession(ctx); found {
+		if link, linked := t.links.ByUid(req.Uid); !linked || link.Address != session.Address {
+			response := GameHistoryResFail{
+				Status:  "fail",
+				Message: "player is not linked to the signed in address",
+			}
+			ctx.JSON(http.StatusForbidden, response)
+			return
+		}
+	} else if !keyAllowsGid(ctx, tournament.Gid) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "api key is not bound to the tournament's game",
+		}
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	res, err := t.services.Register(t.CallOpts, tournament.ID, req.Uid)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(tournamentStatus(err), response)
+		return
+	}
+
+	response := TournamentEntryResOk{
+		Status: "success",
+		Entry:  res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// SubmitTournamentSession godoc
+// @Summary      Submit a tournament session
+// @Description  stores a session of a registered player while the tournament is running. The session is stored on the tournament's game with the server time, using a token from /game/session/start for that game and player.
+// @Tags         tournament
+// @Accept       json
+// @Produce      json
+// @Param        X-API-Key  header    string  true  "API key with the game:write scope"
+// @Param        id   path      string  true  "Tournament ID"
+// @Param        data  body handler.TournamentSessionReq true  "Session"
+// @Success      201  {object}  handler.GameHistoryStoreOk
+// @Success      202  {object}  handler.SessionHeldRes
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      403  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Failure      422  {object}  handler.ValidationResFail
+// @Router       /tournament/{id}/session [post]
+func (t *TournamentHandler) SubmitTournamentSession(ctx *gin.Context) {
+	var req TournamentSessionReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	tournament, found := t.services.Get(ctx.Param("id"))
+	if !found {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: services.ErrTournamentNotFound.Error(),
+		}
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+	if !keyAllowsGid(ctx, tournament.Gid) {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: "api key is not bound to the tournament's game",
+		}
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+	now := int(time.Now().Unix())
+	claims, err := t.sessions.Redeem(req.Token, tournament.Gid, req.Uid, req.Data, now)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(sessionTokenStatus(err), response)
+		return
+	}
+
+	tx, err := t.services.SubmitSession(t.TransactOpts, t.CallOpts, tournament.ID, req.Uid, req.Data, now)
+
+	var held *services.HeldError
+	if err != nil && !errors.As(err, &held) {
+		t.sessions.Release(claims.ID)
+	}
+	if held != nil {
+		response := SessionHeldRes{
+			Status:  "held",
+			Message: held.Error(),
+			Review:  held.Review,
+		}
+		ctx.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		response := ValidationResFail{
+			Status:  "fail",
+			Message: invalid.Error(),
+			Errors:  invalid.Fields,
+		}
+		ctx.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(tournamentStatus(err), response)
+		return
+	}
+
+	middleware.AuditTx(ctx, tx.Hash().Hex())
+	t.pending.Track(tx.Hash(), storage.GameHistoryGameSession{
+		Gid:  big.NewInt(int64(tournament.Gid)),
+		Gtid: tournament.Gtid,
+		Uid:  req.Uid,
+		Data: req.Data,
+		Time: big.NewInt(int64(now)),
+	})
+	response := GameHistoryStoreOk{
+		Status:  "success",
+		Message: "transaction hex " + tx.Hash().String(),
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// TournamentStandings godoc
+// @Summary      Show tournament standings
+// @Description  ranks the sessions registered players submitted during the tournament. Standings are frozen once the tournament is finalized.
+// @Tags         tournament
+// @Produce      json
+// @Param        id   path      string  true  "Tournament ID"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /tournament/{id}/standings [get]
+func (t *TournamentHandler) TournamentStandings(ctx *gin.Context) {
+	res, err := t.services.Standings(t.CallOpts, ctx.Param("id"))
+	if err != nil {
+		log.Println("while getting tournament standings: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(tournamentStatus(err), response)
+		return
+	}
+
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// FinalizeTournament godoc
+// @Summary      Finalize a tournament
+// @Description  freezes the standings of an ended tournament and splits the pool of entry fees between the ranks by their shares. Prizes are in the stake token and are paid out manually, the payout engine only pays leaderboard prizes in EGC.
+// @Tags         tournament
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Tournament ID"
+// @Success      200  {object}  handler.TournamentResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Failure      409  {object}  handler.GameHistoryResFail
+// @Router       /tournament/{id}/finalize [post]
+func (t *TournamentHandler) FinalizeTournament(ctx *gin.Context) {
+	res, err := t.services.Finalize(t.CallOpts, ctx.Param("id"))
+	if err != nil {
+		log.Println("while finalizing tournament: ", err.Error())
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(tournamentStatus(err), response)
+		return
+	}
+
+	response := TournamentResOk{
+		Status:     "success",
+		Tournament: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
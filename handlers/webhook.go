@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type WebhookHandler struct {
+	webhooks services.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler instance.
+//
+// Parameters:
+//
+//	webhooks: services.WebhookService
+//
+// Return Type:
+//
+//	*WebhookHandler
+func NewWebhookHandler(webhooks services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhooks: webhooks,
+	}
+}
+
+// ListWebhooks godoc
+// @Summary      List webhooks
+// @Description  lists every webhook with its events, games, addresses, failures in a row and when it was disabled. Secrets are never shown again after a webhook is created.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks [get]
+func (w *WebhookHandler) ListWebhooks(ctx *gin.Context) {
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   w.webhooks.List(),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateWebhook godoc
+// @Summary      Create a webhook
+// @Description  subscribes an http or https URL to session.mined, session.failed and stake.received events. Session events are sent for the listed gids (every game when empty) and stake events for the listed addresses. Deliveries are signed with the secret, which is only returned here.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        data  body handler.WebhookReq true  "Webhook"
+// @Success      201  {object}  handler.WebhookResOk
+// @Failure      400  {object}  handler.GameHistoryResFail
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks [post]
+func (w *WebhookHandler) CreateWebhook(ctx *gin.Context) {
+	var req WebhookReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	res, err := w.webhooks.Create(req.URL, req.Events, req.Gids, req.Addresses)
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := WebhookResOk{
+		Status:  "success",
+		Webhook: res,
+	}
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete a webhook
+// @Description  removes a webhook with its delivery log. Retries still pending are dropped.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  handler.GameHistoryStoreOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks/{id} [delete]
+func (w *WebhookHandler) DeleteWebhook(ctx *gin.Context) {
+	if err := w.webhooks.Delete(ctx.Param("id")); err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(webhookStatus(err), response)
+		return
+	}
+
+	response := GameHistoryStoreOk{
+		Status:  "success",
+		Message: "webhook deleted",
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// EnableWebhook godoc
+// @Summary      Enable a webhook
+// @Description  resumes the deliveries of a webhook disabled after failing too often and clears its failures. Events raised while it was disabled are not sent.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  handler.WebhookResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks/{id}/enable [post]
+func (w *WebhookHandler) EnableWebhook(ctx *gin.Context) {
+	res, err := w.webhooks.Enable(ctx.Param("id"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(webhookStatus(err), response)
+		return
+	}
+
+	response := WebhookResOk{
+		Status:  "success",
+		Webhook: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// TestWebhook godoc
+// @Summary      Test-fire a webhook
+// @Description  sends a signed webhook.test event once, even to a disabled webhook, and answers with how the endpoint responded. Test deliveries are logged but do not count towards disabling the webhook.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  handler.WebhookDeliveryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks/{id}/test [post]
+func (w *WebhookHandler) TestWebhook(ctx *gin.Context) {
+	res, err := w.webhooks.Test(ctx.Param("id"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(webhookStatus(err), response)
+		return
+	}
+
+	response := WebhookDeliveryResOk{
+		Status:   "success",
+		Delivery: res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// WebhookDeliveries godoc
+// @Summary      Show webhook deliveries
+// @Description  lists the last 100 delivery attempts of a webhook, newest first, with the status the endpoint answered, the error and when the next retry is due.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Token  header    string  true  "Admin token"
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  handler.GameHistoryResOk
+// @Failure      401  {object}  handler.GameHistoryResFail
+// @Failure      404  {object}  handler.GameHistoryResFail
+// @Router       /admin/webhooks/{id}/deliveries [get]
+func (w *WebhookHandler) WebhookDeliveries(ctx *gin.Context) {
+	res, err := w.webhooks.Deliveries(ctx.Param("id"))
+	if err != nil {
+		response := GameHistoryResFail{
+			Status:  "fail",
+			Message: err.Error(),
+		}
+		ctx.JSON(webhookStatus(err), response)
+		return
+	}
+
+	response := GameHistoryResOk{
+		Status: "success",
+		Page:   res,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// webhookStatus maps webhook errors to a response status.
+func webhookStatus(err error) int {
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
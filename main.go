@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"math/big"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -39,9 +44,38 @@ var (
 	stakeService        services.StackingContract
 	stakeHandler        handler.StakeHandler
 	stakeRouter         routes.StakeRouteController
+	priceService        services.PriceService
+	leaderboardService  services.LeaderboardService
+	leaderboardHandler  handler.LeaderboardHandler
+	leaderboardRouter   routes.LeaderboardRouteController
+	gameTypeRegistry    services.GameTypeRegistry
+	gameTypeHandler     handler.GameTypeHandler
+	gameTypeRouter      routes.GameTypeRouteController
+	playerStatsService  services.PlayerStatsService
+	walletLinkService   services.WalletLinkService
+	payoutHandler       handler.PayoutHandler
+	payoutRouter        routes.PayoutRouteController
+	tournamentHandler   handler.TournamentHandler
+	antiCheatService    services.AntiCheatService
+	antiCheatHandler    handler.AntiCheatHandler
+	antiCheatRouter     routes.AntiCheatRouteController
+	rateLimiter         *middleware.RateLimiter
+	rateLimitRouter     routes.RateLimitRouteController
+	auditLog            services.AuditLog
+	auditRouter         routes.AuditRouteController
+	apiKeyService       services.APIKeyService
+	apiKeyRouter        routes.APIKeyRouteController
+	siweService         services.SiweService
+	authRouter          routes.AuthRouteController
+	tournamentRouter    routes.TournamentRouteController
+	playerHandler       handler.PlayerHandler
+	playerRouter        routes.PlayerRouteController
 	cryptClient         *cryptapi.Crypt
 	server              *gin.Engine
-	cache               utils.Cache
+	cache               utils.CacheBackend
+	cacheRouter         routes.CacheRouteController
+	feedRouter          routes.FeedRouteController
+	webhookRouter       routes.WebhookRouteController
 )
 
 func main() {
@@ -53,8 +87,12 @@ func main() {
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{config.ORIGIN}
 	corsConfig.AllowCredentials = true
+	corsConfig.AddAllowHeaders("Authorization", middleware.APIKeyHeader, "X-Admin-Token")
+	corsConfig.AddExposeHeaders("Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "Link", "Content-Disposition", "X-Total-Count")
 	server.Use(cors.New(corsConfig))
 	server.Use(middleware.RecoveryWithFileLogger("logs/panic.log"))
+	server.Use(middleware.Audit(auditLog, "GET /api/stake/pay"))
+	server.Use(rateLimiter.Handler())
 
 	docs.SwaggerInfo.Title = "Easy Get Coin Leader Board API"
 	docs.SwaggerInfo.Description = "The leader board for easy get coin games."
@@ -66,8 +104,27 @@ func main() {
 	router.GET("/healthchecker", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "ok"})
 	})
-	gameHistoryRouter.GameDataRoute(router)
-	stakeRouter.StakeRoute(router)
+	gameRead := middleware.RequireScope(apiKeyService, services.ScopeGameRead)
+	gameWrite := middleware.RequireScope(apiKeyService, services.ScopeGameWrite)
+	adminAccess := middleware.AdminAccess(config.ADMIN_TOKEN, apiKeyService)
+	gameHistoryRouter.GameDataRoute(router, gameRead, gameWrite)
+	feedRouter.FeedRoute(router, gameRead)
+	stakeRead := middleware.RequireScope(apiKeyService, services.ScopeStakeRead)
+	stakeRouter.StakeRoute(router, middleware.ChangesState(middleware.RequireAddress(siweService, "", stakeRead)), middleware.RequireAddress(siweService, "address", stakeRead))
+	leaderboardRouter.LeaderboardRoute(router)
+	playerRouter.PlayerRoute(router, middleware.RequireAddress(siweService, "", gameRead), middleware.RequireAddress(siweService, "address", gameRead), middleware.RequireAddress(siweService, "", gameWrite))
+	authRouter.AuthRoute(router, middleware.RequireAddress(siweService, "", nil))
+	tournamentRouter.TournamentRoute(router, adminAccess, gameWrite, middleware.RequireAddress(siweService, "", gameWrite))
+
+	admin := router.Group("/admin", adminAccess)
+	apiKeyRouter.APIKeyRoute(admin)
+	gameTypeRouter.GameTypeRoute(admin)
+	payoutRouter.PayoutRoute(admin)
+	antiCheatRouter.AntiCheatRoute(admin)
+	rateLimitRouter.RateLimitRoute(admin)
+	auditRouter.AuditRoute(admin)
+	cacheRouter.CacheRoute(admin)
+	webhookRouter.WebhookRoute(admin)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	log.Fatal(server.Run(":" + config.PORT))
 }
@@ -79,6 +136,10 @@ func init() {
 	}
 
 	ctx = context.TODO()
+	dataDir := config.DATA_DIR
+	if dataDir == "" {
+		dataDir = "db"
+	}
 	client, err = ethclient.Dial(config.NODE_URL)
 	if err != nil {
 		panic("Failed to connect to the Ethereum client: " + err.Error())
@@ -110,7 +171,28 @@ func init() {
 	}
 
 	callOpts = &bind.CallOpts{Context: ctx}
-	cache = *utils.NewCache()
+	cacheEntries := config.CACHE_ENTRIES
+	if cacheEntries == 0 && config.CACHE_BYTES == 0 {
+		cacheEntries = utils.DefaultCacheEntries
+	}
+	cacheOptions := utils.CacheOptions{
+		MaxEntries: cacheEntries,
+		MaxBytes:   int64(config.CACHE_BYTES),
+		Policy:     config.CACHE_POLICY,
+		Janitor:    utils.DefaultCacheJanitor,
+	}
+	switch config.CACHE_BACKEND {
+	case "redis":
+		cache, err = utils.NewRedisCache(utils.RedisCacheOptions{URL: config.REDIS_URL, Local: cacheOptions})
+	case "", "memory":
+		cache, err = utils.NewBoundedCache(cacheOptions)
+	default:
+		err = errors.New("unknown cache backend " + config.CACHE_BACKEND)
+	}
+	if err != nil {
+		panic("Invalid cache settings: " + err.Error())
+	}
+	pages := utils.Pagination{MaxSize: config.MAX_PAGE_SIZE}
 
 	coin := "polygon/matic"
 	ownAddress := config.CONTRACT_ADDRESS
@@ -123,13 +205,260 @@ func init() {
 
 	cryptClient = cryptapi.InitCryptWrapper(coin, ownAddress, callBackUrl, nil, nil)
 
+	gameTypeRegistry, err = services.NewGameTypeRegistry(filepath.Join(dataDir, "game_types.json"), config.REQUIRE_TYPES)
+	if err != nil {
+		panic("Failed to load game types: " + err.Error())
+	}
+	gameTypeHandler = *handler.NewGameTypeHandler(gameTypeRegistry)
+	gameTypeRouter = routes.NewGameTypeRouteController(gameTypeHandler)
+
 	gameHistoryService = services.NewGameHistoryContract(client, gameHistoryContract)
-	gameHistoryHandler = *handler.NewGameHistoryHandler(gameHistoryService, &ctx, transactOpts, callOpts, &cache)
+
+	scoreRules, defaultScoreRule, err := services.ParseScoreRules(utils.ParseKeyValueList(config.SCORE_FIELDS), config.SCORE_ASCENDING, config.SCORE_DEFAULT)
+	if err != nil {
+		panic("Invalid leaderboard config: " + err.Error())
+	}
+	durationField := config.DURATION_FIELD
+	if durationField == "" {
+		durationField = "duration"
+	}
+	minDurations, err := services.ParseMinDurations(utils.ParseKeyValueList(config.MIN_DURATIONS))
+	if err != nil {
+		panic("Invalid anti-cheat durations: " + err.Error())
+	}
+	zScore, err := strconv.ParseFloat(config.ZSCORE, 64)
+	if err != nil {
+		zScore = services.DefaultAntiCheatZScore
+	}
+	antiCheatService, err = services.NewAntiCheatService(filepath.Join(dataDir, "anticheat.json"), gameHistoryService, services.AntiCheatConfig{
+		ZScore:        zScore,
+		DurationField: durationField,
+		MinDuration:   minDurations,
+		MaxPerHour:    config.MAX_PER_HOUR,
+		HoldRisk:      config.HOLD_RISK,
+		Rule: func(gid int) services.ScoreRule {
+			if rule, ok := scoreRules[gid]; ok {
+				return rule
+			}
+			return defaultScoreRule
+		},
+	})
+	if err != nil {
+		panic("Failed to load anti-cheat reviews: " + err.Error())
+	}
+	antiCheatGames, err := utils.ParseIntList(config.ANTICHEAT_GAMES)
+	if err != nil {
+		panic("Invalid anti-cheat games: " + err.Error())
+	}
+	services.StartAntiCheatScanner(ctx, antiCheatService, callOpts, antiCheatGames, 10*time.Minute)
+
+	sessionTTL, err := time.ParseDuration(config.SESSION_TTL)
+	if err != nil {
+		sessionTTL = time.Hour
+	}
+	if config.SESSION_SECRET == "" {
+		log.Println("SESSION_SECRET is not set, session tokens will not survive a restart")
+	}
+	gameSessionService, err := services.NewGameSessionService(filepath.Join(dataDir, "session_tokens.json"), config.SESSION_SECRET, sessionTTL, durationField)
+	if err != nil {
+		panic("Failed to load session tokens: " + err.Error())
+	}
+
+	screenedHistory := services.NewScreeningGameHistory(gameHistoryService, antiCheatService)
+	validatedHistory := services.NewValidatingGameHistory(screenedHistory, gameTypeRegistry)
+	cacheGrace, err := time.ParseDuration(config.CACHE_GRACE)
+	if err != nil {
+		cacheGrace = services.DefaultHistoryGrace
+	}
+	cachedHistory := services.NewGameHistoryCache(validatedHistory, cache, services.HistoryCacheOptions{
+		TTL:   services.DefaultHistoryTTL,
+		Grace: cacheGrace,
+	})
+	pendingSessions := services.NewPendingSessionService(client, services.DefaultPendingPoll, services.DefaultPendingTimeout)
+	pendingSessions.OnSettled(cachedHistory.Settled)
+	sessionFeed := services.NewSessionFeed(cachedHistory, callOpts, services.DefaultFeedBuffer)
+	pendingSessions.OnSettled(sessionFeed.Settled)
+	antiCheatHandler = *handler.NewAntiCheatHandler(antiCheatService, pendingSessions, transactOpts)
+	antiCheatRouter = routes.NewAntiCheatRouteController(antiCheatHandler)
+	feedRouter = routes.NewFeedRouteController(*handler.NewFeedHandler(sessionFeed, config.ORIGIN))
+	gameHistoryHandler = *handler.NewGameHistoryHandler(cachedHistory, gameSessionService, pendingSessions, &ctx, transactOpts, callOpts)
+	gameHistoryHandler.Pages = pages
+	cacheRouter = routes.NewCacheRouteController(*handler.NewCacheHandler(cache, cachedHistory))
 	gameHistoryRouter = routes.NewGameDataRouteController(gameHistoryHandler)
 
+	location, err := time.LoadLocation(config.LEADERBOARD_TZ)
+	if err != nil {
+		panic("Invalid leaderboard timezone: " + err.Error())
+	}
+	seasons, err := services.ParseSeasons(utils.ParseKeyValueList(config.SEASONS))
+	if err != nil {
+		panic("Invalid leaderboard seasons: " + err.Error())
+	}
+	archive, err := services.NewLeaderboardArchive(filepath.Join(dataDir, "leaderboard_archive.json"))
+	if err != nil {
+		panic("Failed to load leaderboard archive: " + err.Error())
+	}
+	archiveGames, err := utils.ParseIntList(config.ARCHIVE_GAMES)
+	if err != nil {
+		panic("Invalid leaderboard archive games: " + err.Error())
+	}
+	leaderboardService = services.NewLeaderboardService(screenedHistory, scoreRules, defaultScoreRule, services.NewLeaderboardCalendar(location, seasons), archive)
+	antiCheatService.OnChange(leaderboardService.Invalidate)
+	archiveGrace, err := time.ParseDuration(config.ARCHIVE_GRACE)
+	if err != nil {
+		archiveGrace = services.DefaultArchiveGrace
+	}
+	services.StartLeaderboardArchiver(ctx, leaderboardService, callOpts, archiveGames, time.Hour, archiveGrace)
+
+	playerStatsService = services.NewPlayerStatsService(screenedHistory, leaderboardService.Rule, leaderboardService.Calendar(), time.Minute)
+	leaderboardHandler = *handler.NewLeaderboardHandler(leaderboardService, callOpts, cache)
+	leaderboardHandler.Pages = pages
+	antiCheatService.OnChange(leaderboardHandler.Invalidate)
+	leaderboardRouter = routes.NewLeaderboardRouteController(leaderboardHandler)
+
+	priceTTL, err := time.ParseDuration(config.PRICE_TTL)
+	if err != nil {
+		priceTTL = time.Minute
+	}
+	stakeSymbol := config.STAKE_SYMBOL
+	if stakeSymbol == "" {
+		stakeSymbol = "MATIC"
+	}
+	priceService = services.NewPriceService(newPriceProvider(config), priceTTL, nil)
+
 	stakeService = services.NewStakingHistory(client, gameHistoryContract, cryptClient)
-	stakeHandler = *handler.NewStakingHandler(stakeService, &ctx, transactOpts, callOpts, &cache, config.CONTRACT_ADDRESS)
+	stakeHandler = *handler.NewStakingHandler(stakeService, &ctx, transactOpts, callOpts, cache, config.CONTRACT_ADDRESS, priceService, stakeSymbol)
+	stakeHandler.Pages = pages
 	stakeRouter = routes.NewStakeRouteController(stakeHandler)
+
+	webhookService, err := services.NewWebhookService(filepath.Join(dataDir, "webhooks.json"), services.WebhookOptions{})
+	if err != nil {
+		panic("Failed to load webhooks: " + err.Error())
+	}
+	pendingSessions.OnSettled(webhookService.Settled)
+	services.StartStakeWatcher(ctx, stakeService, webhookService, callOpts, time.Minute)
+	webhookRouter = routes.NewWebhookRouteController(*handler.NewWebhookHandler(webhookService))
+
+	walletLinkService, err = services.NewWalletLinkService(filepath.Join(dataDir, "wallet_links.json"), big.NewInt(num), 10*time.Minute)
+	if err != nil {
+		panic("Failed to load wallet links: " + err.Error())
+	}
+	playerOverviewService := services.NewPlayerOverviewService(gameHistoryService, stakeService, walletLinkService)
+	playerHandler = *handler.NewPlayerHandler(playerStatsService, walletLinkService, playerOverviewService, cachedHistory, callOpts)
+	playerRouter = routes.NewPlayerRouteController(playerHandler)
+
+	tokenAddress := common.HexToAddress(config.EGC_TOKEN)
+	if config.EGC_TOKEN == "" {
+		tokenAddress, err = gameHistoryContract.TokenAddressEGC(callOpts)
+		if err != nil {
+			panic("Failed to read the EGC token address: " + err.Error())
+		}
+	}
+	token, err := services.NewERC20Token(tokenAddress, client)
+	if err != nil {
+		panic(err)
+	}
+	prizes, err := services.ParsePrizeTable(utils.ParseKeyValueList(config.PAYOUT_PRIZES))
+	if err != nil {
+		panic("Invalid payout prizes: " + err.Error())
+	}
+	payoutOpts := transactOpts
+	if config.PAYOUT_KEY != "" {
+		payoutKey, err := crypto.HexToECDSA(config.PAYOUT_KEY)
+		if err != nil {
+			log.Fatalf("Failed to load payout private key: %v", err)
+		}
+		if payoutOpts, err = bind.NewKeyedTransactorWithChainID(payoutKey, big.NewInt(num)); err != nil {
+			panic(err)
+		}
+	}
+	payoutService, err := services.NewPayoutService(filepath.Join(dataDir, "payouts.json"), leaderboardService, walletLinkService, token, client, payoutOpts)
+	if err != nil {
+		panic("Failed to load payout ledger: " + err.Error())
+	}
+	payoutHandler = *handler.NewPayoutHandler(payoutService, leaderboardService, prizes, callOpts)
+	payoutRouter = routes.NewPayoutRouteController(payoutHandler)
+
+	tournamentService, err := services.NewTournamentService(filepath.Join(dataDir, "tournaments.json"), cachedHistory, stakeService, walletLinkService, leaderboardService.Rule, services.DefaultTokenDecimals[stakeSymbol])
+	if err != nil {
+		panic("Failed to load tournaments: " + err.Error())
+	}
+	tournamentHandler = *handler.NewTournamentHandler(tournamentService, gameSessionService, walletLinkService, pendingSessions, transactOpts, callOpts)
+	tournamentRouter = routes.NewTournamentRouteController(tournamentHandler)
+
+	apiKeyService, err = services.NewAPIKeyService(filepath.Join(dataDir, "api_keys.json"))
+	if err != nil {
+		panic("Failed to load api keys: " + err.Error())
+	}
+	apiKeyRouter = routes.NewAPIKeyRouteController(*handler.NewAPIKeyHandler(apiKeyService))
+
+	authTTL, err := time.ParseDuration(config.AUTH_TTL)
+	if err != nil {
+		authTTL = 24 * time.Hour
+	}
+	authDomain := config.AUTH_DOMAIN
+	if origin, err := url.Parse(config.ORIGIN); authDomain == "" && err == nil {
+		authDomain = origin.Host
+	}
+	if config.AUTH_SECRET == "" {
+		log.Println("AUTH_SECRET is not set, sign in sessions will not survive a restart")
+	}
+	siweService, err = services.NewSiweService(authDomain, big.NewInt(num), config.AUTH_SECRET, authTTL)
+	if err != nil {
+		panic(err)
+	}
+	authRouter = routes.NewAuthRouteController(*handler.NewAuthHandler(siweService))
+
+	rateLimitList := config.RATE_LIMITS
+	if rateLimitList == "" {
+		rateLimitList = "POST /api/game/store=30/1m,POST /api/game/session/start=30/1m,POST /api/tournament/:id/session=30/1m,GET /api/stake/pay=10/1m,GET /api/auth/nonce=30/1m"
+	}
+	rateLimits, err := middleware.ParseRateLimits(utils.ParseKeyValueList(rateLimitList))
+	if err != nil {
+		panic("Invalid rate limits: " + err.Error())
+	}
+	rateLimiter = middleware.NewRateLimiter(rateLimits, middleware.NewMemoryRateLimitStore())
+	rateLimitRouter = routes.NewRateLimitRouteController(*handler.NewRateLimitHandler(rateLimiter))
+
+	auditLog, err = services.NewAuditLog(filepath.Join(dataDir, "audit.log"))
+	if err != nil {
+		panic(err)
+	}
+	if verification, err := auditLog.Verify(); err != nil || !verification.Valid {
+		log.Printf("audit log does not verify: %+v %v", verification, err)
+	}
+	auditRouter = routes.NewAuditRouteController(*handler.NewAuditHandler(auditLog))
 	server = gin.Default()
+	// Only trusted proxies may set the client IP the rate limiter and audit
+	// log key on through X-Forwarded-For.
+	if err := server.SetTrustedProxies(utils.ParseList(config.TRUSTED_PROXIES)); err != nil {
+		panic("Invalid trusted proxies: " + err.Error())
+	}
 	gin.SetMode(config.MODE)
 }
+
+// newPriceProvider builds the price provider selected by PRICE_PROVIDER,
+// falling back to the STATIC_PRICES table.
+func newPriceProvider(config config.Config) services.PriceProvider {
+	switch config.PRICE_PROVIDER {
+	case "aggregator":
+		feeds := make(map[string]common.Address)
+		for symbol, address := range utils.ParseKeyValueList(config.PRICE_FEEDS) {
+			feeds[symbol] = common.HexToAddress(address)
+		}
+		return services.NewAggregatorPriceProvider(client, feeds)
+	case "http":
+		return services.NewHTTPPriceProvider(config.PRICE_URL, 10*time.Second)
+	}
+
+	prices := make(services.StaticPriceProvider)
+	for symbol, price := range utils.ParseKeyValueList(config.STATIC_PRICES) {
+		value, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			log.Printf("ignoring static price for %s: %v", symbol, err)
+			continue
+		}
+		prices[strings.ToUpper(symbol)] = value
+	}
+	return prices
+}
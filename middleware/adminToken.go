@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminToken returns a Gin middleware that only lets through requests carrying
+// the admin token in the X-Admin-Token header.
+//
+// token string: The shared admin secret, when empty every request is refused.
+// gin.HandlerFunc: The middleware function for Gin.
+func AdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := c.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "admin token required"})
+			return
+		}
+
+		c.Set(adminTokenContextKey, true)
+		c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "Valid Token", token: "secret", header: "secret", want: http.StatusOK},
+		{name: "Wrong Token", token: "secret", header: "guess", want: http.StatusUnauthorized},
+		{name: "Missing Token", token: "secret", header: "", want: http.StatusUnauthorized},
+		{name: "Admin Disabled", token: "", header: "", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(AdminToken(tt.token))
+			router.GET("/admin", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Admin-Token", tt.header)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, resp.Code)
+			}
+		})
+	}
+}
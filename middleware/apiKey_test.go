@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, _ := services.NewAPIKeyService("")
+	writer, _ := keys.Issue("writer", []string{services.ScopeGameWrite}, []int{1}, nil)
+	reader, _ := keys.Issue("reader", []string{services.ScopeGameRead}, nil, nil)
+	admin, _ := keys.Issue("admin", []string{services.ScopeAdmin}, nil, nil)
+
+	router := gin.New()
+	router.POST("/store", RequireScope(keys, services.ScopeGameWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/history/:gid", RequireScope(keys, services.ScopeGameRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/admin", AdminAccess("secret", keys), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		body   string
+		want   int
+	}{
+		{name: "Missing Key", method: "POST", path: "/store", body: `{"gid":1}`, want: http.StatusUnauthorized},
+		{name: "Bound Game", method: "POST", path: "/store", key: writer.Key, body: `{"gid":1}`, want: http.StatusOK},
+		{name: "Other Game", method: "POST", path: "/store", key: writer.Key, body: `{"gid":2}`, want: http.StatusForbidden},
+		{name: "Missing Scope", method: "POST", path: "/store", key: reader.Key, body: `{"gid":1}`, want: http.StatusForbidden},
+		{name: "Read Any Game", method: "GET", path: "/history/7", key: reader.Key, want: http.StatusOK},
+		{name: "Write Key Reading", method: "GET", path: "/history/1", key: writer.Key, want: http.StatusForbidden},
+		{name: "Admin Key", method: "GET", path: "/admin", key: admin.Key, want: http.StatusOK},
+		{name: "Non Admin Key", method: "GET", path: "/admin", key: reader.Key, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, resp.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+// auditTxContextKey is where handlers leave the transactions a request sent.
+const auditTxContextKey = "auditTx"
+
+// adminTokenContextKey marks requests let through with the admin token.
+const adminTokenContextKey = "adminToken"
+
+// AuditAppender appends entries to the audit log.
+type AuditAppender interface {
+	Append(entry services.AuditEntry) (services.AuditEntry, error)
+}
+
+// Audit returns a Gin middleware that appends every state changing request to
+// the audit log once it was handled: every POST, PUT, PATCH and DELETE, and the
+// GET routes in extra, e.g. "GET /api/stake/pay".
+//
+// The actor is the API key, the signed in address or the admin token the
+// request was let through with. Besides the client IP the entry keeps the
+// address of the connection, which a forwarded header cannot change. The request digest is the sha256 of the
+// method, URL and body.
+//
+// audit AuditAppender: The audit log.
+// extra []string: The "METHOD /path" routes to audit besides the writes.
+// gin.HandlerFunc: The middleware function for Gin.
+func Audit(audit AuditAppender, extra ...string) gin.HandlerFunc {
+	audited := make(map[string]bool, len(extra))
+	for _, route := range extra {
+		audited[route] = true
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		method := c.Request.Method
+		if route == "" || !isWrite(method) && !audited[method+" "+route] {
+			c.Next()
+			return
+		}
+
+		digest := requestDigest(c)
+		c.Next()
+
+		entry := services.AuditEntry{
+			Time:          time.Now(),
+			IP:            c.ClientIP(),
+			RemoteAddr:    c.Request.RemoteAddr,
+			Method:        method,
+			Route:         route,
+			Path:          c.Request.URL.Path,
+			RequestDigest: digest,
+			TxHashes:      c.GetStringSlice(auditTxContextKey),
+			Status:        c.Writer.Status(),
+			Outcome:       services.AuditOutcome(c.Writer.Status()),
+		}
+		entry.ActorType, entry.Actor = requestActor(c)
+		if _, err := audit.Append(entry); err != nil {
+			log.Println("while appending to the audit log: ", err.Error())
+		}
+	}
+}
+
+// AuditTx records a transaction a request sent in its audit entry.
+func AuditTx(c *gin.Context, hashes ...string) {
+	c.Set(auditTxContextKey, append(c.GetStringSlice(auditTxContextKey), hashes...))
+}
+
+// requestActor names who a request was let through as.
+func requestActor(c *gin.Context) (actorType string, actor string) {
+	if key, found := RequestAPIKey(c); found {
+		return services.ActorAPIKey, key.ID
+	}
+	if session, found := RequestSession(c); found {
+		return services.ActorAddress, session.Address.Hex()
+	}
+	if c.GetBool(adminTokenContextKey) {
+		return services.ActorAdminToken, "admin"
+	}
+	return services.ActorAnonymous, c.ClientIP()
+}
+
+// requestDigest hashes the method, URL and body of a request, putting the
+// body back for the handler.
+func requestDigest(c *gin.Context) string {
+	hash := sha256.New()
+	io.WriteString(hash, c.Request.Method+" "+c.Request.URL.RequestURI()+"\n")
+	if c.Request.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedBody))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if err == nil {
+			hash.Write(body)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type recordedAudit []services.AuditEntry
+
+func (r *recordedAudit) Append(entry services.AuditEntry) (services.AuditEntry, error) {
+	*r = append(*r, entry)
+	return entry, nil
+}
+
+func TestAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, _ := services.NewAPIKeyService("")
+	writer, _ := keys.Issue("writer", []string{services.ScopeGameWrite}, nil, nil)
+
+	var audit recordedAudit
+	router := gin.New()
+	router.SetTrustedProxies(nil)
+	router.Use(Audit(&audit, "GET /pay"))
+	router.POST("/store", RequireScope(keys, services.ScopeGameWrite), func(c *gin.Context) {
+		AuditTx(c, "0xabc")
+		c.Status(http.StatusCreated)
+	})
+	router.GET("/history", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/pay", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.DELETE("/keys", AdminToken("secret"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		key       string
+		admin     string
+		wantAudit bool
+		actorType string
+		actor     string
+		outcome   string
+		txHashes  int
+	}{
+		{name: "Write With Key", method: "POST", path: "/store", key: writer.Key, wantAudit: true, actorType: services.ActorAPIKey, actor: writer.ID, outcome: services.AuditSuccess, txHashes: 1},
+		{name: "Refused Write", method: "POST", path: "/store", wantAudit: true, actorType: services.ActorAnonymous, actor: "192.0.2.1", outcome: services.AuditRejected},
+		{name: "Read", method: "GET", path: "/history"},
+		{name: "Extra Read", method: "GET", path: "/pay", wantAudit: true, actorType: services.ActorAnonymous, actor: "192.0.2.1", outcome: services.AuditSuccess},
+		{name: "Admin Token", method: "DELETE", path: "/keys", admin: "secret", wantAudit: true, actorType: services.ActorAdminToken, actor: "admin", outcome: services.AuditSuccess},
+		{name: "Unknown Route", method: "POST", path: "/missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit = nil
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{"uid":"alice"}`))
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.admin != "" {
+				req.Header.Set("X-Admin-Token", tt.admin)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !tt.wantAudit {
+				if len(audit) != 0 {
+					t.Errorf("Expected no audit entry, got %d", len(audit))
+				}
+				return
+			}
+			if len(audit) != 1 {
+				t.Fatalf("Expected one audit entry, got %d", len(audit))
+			}
+			entry := audit[0]
+			if entry.ActorType != tt.actorType || entry.Actor != tt.actor {
+				t.Errorf("Expected actor %s %s, got %s %s", tt.actorType, tt.actor, entry.ActorType, entry.Actor)
+			}
+			if entry.Outcome != tt.outcome {
+				t.Errorf("Expected outcome %s, got %s", tt.outcome, entry.Outcome)
+			}
+			if len(entry.TxHashes) != tt.txHashes {
+				t.Errorf("Expected %d transactions, got %d", tt.txHashes, len(entry.TxHashes))
+			}
+			if entry.IP != "192.0.2.1" || entry.RemoteAddr != "192.0.2.1:1234" {
+				t.Errorf("Expected the client IP and connection address, got %s %s", entry.IP, entry.RemoteAddr)
+			}
+			if entry.Route != tt.path || len(entry.RequestDigest) != 64 {
+				t.Errorf("Expected route %s with a digest, got %s %q", tt.path, entry.Route, entry.RequestDigest)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header game servers send their API key in.
+const APIKeyHeader = "X-API-Key"
+
+// RateLimit is a token bucket holding Burst requests that refills completely every Per.
+type RateLimit struct {
+	Burst int           `json:"burst"`
+	Per   time.Duration `json:"per"`
+}
+
+// Rate returns how many tokens are added to the bucket per second.
+func (r RateLimit) Rate() float64 {
+	return float64(r.Burst) / r.Per.Seconds()
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", r.Burst, r.Per)
+}
+
+// ParseRateLimits parses per route limits configured as "METHOD /path=burst/period"
+// pairs, e.g. "POST /api/game/store=30/1m". Paths are the gin route patterns.
+func ParseRateLimits(list map[string]string) (map[string]RateLimit, error) {
+	res := make(map[string]RateLimit, len(list))
+	for route, value := range list {
+		burst, per, ok := strings.Cut(value, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate limit of %s must be burst/period", route)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(burst))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("rate limit of %s has an invalid burst %q", route, burst)
+		}
+		period, err := time.ParseDuration(strings.TrimSpace(per))
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("rate limit of %s has an invalid period %q", route, per)
+		}
+		method, path, _ := strings.Cut(strings.TrimSpace(route), " ")
+		res[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = RateLimit{Burst: count, Per: period}
+	}
+	return res, nil
+}
+
+// RateLimitStore keeps token buckets. The in-memory store serves one
+// instance, deployments running several instances share a store so a
+// client cannot spread its requests over them.
+type RateLimitStore interface {
+	// Take removes a token from every bucket in keys, or from none of them
+	// when one is empty.
+	//
+	// Returns:
+	//   - allowed: Whether the tokens were taken.
+	//   - remaining: The tokens left in the emptiest bucket.
+	//   - retryAfter: How long until every bucket has a token again, when not allowed.
+	//   - err: Any error reaching the store.
+	Take(keys []string, limit RateLimit, now time.Time) (allowed bool, remaining int, retryAfter time.Duration, err error)
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	per     time.Duration
+}
+
+// MemoryRateLimitStore keeps token buckets in process memory.
+type MemoryRateLimitStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// Take implements RateLimitStore.
+func (m *MemoryRateLimitStore) Take(keys []string, limit RateLimit, now time.Time) (allowed bool, remaining int, retryAfter time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sweep(now)
+
+	capacity := float64(limit.Burst)
+	lowest := capacity
+	buckets := make([]*tokenBucket, 0, len(keys))
+	for _, key := range keys {
+		bucket, found := m.buckets[key]
+		if !found {
+			bucket = &tokenBucket{tokens: capacity, updated: now, per: limit.Per}
+			m.buckets[key] = bucket
+		}
+		bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.Rate())
+		bucket.updated = now
+		buckets = append(buckets, bucket)
+		lowest = math.Min(lowest, bucket.tokens)
+	}
+
+	if lowest < 1 {
+		wait := time.Duration((1 - lowest) / limit.Rate() * float64(time.Second))
+		return false, 0, wait, nil
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, int(lowest - 1), 0, nil
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute.
+// The caller holds the lock.
+func (m *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.updated) > bucket.per {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// RateLimitCounter counts the requests a route let through and refused.
+type RateLimitCounter struct {
+	Route   string `json:"route"`
+	Limit   string `json:"limit"`
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+}
+
+// rateLimitContextKey is where Handler leaves the limit of the route, for the
+// authentication middleware to take the bucket of the caller's identity.
+const rateLimitContextKey = "rateLimit"
+
+// routeLimit is the limit Handler applied to a request.
+type routeLimit struct {
+	limiter *RateLimiter
+	route   string
+	limit   RateLimit
+	refused bool
+}
+
+// RateLimiter throttles the routes it has a limit for. Each request takes a
+// token from the buckets of its client IP and its API key, so a client cannot
+// get around the limit by changing one of them. Once RequireScope or
+// RequireAddress has authenticated the caller, it also takes a token from the
+// bucket of the uid an API key acts for or of the signed in address. Uids are
+// never keyed before that, so nobody can drain the bucket of someone else's
+// player.
+type RateLimiter struct {
+	limits   map[string]RateLimit
+	store    RateLimitStore
+	mutex    sync.Mutex
+	counters map[string]*RateLimitCounter
+}
+
+// NewRateLimiter creates a RateLimiter.
+//
+// limits map[string]RateLimit: The limit of each "METHOD /path" route, routes without one are not limited.
+// store RateLimitStore: Where the buckets are kept.
+func NewRateLimiter(limits map[string]RateLimit, store RateLimitStore) *RateLimiter {
+	counters := make(map[string]*RateLimitCounter, len(limits))
+	for route, limit := range limits {
+		counters[route] = &RateLimitCounter{Route: route, Limit: limit.String()}
+	}
+	return &RateLimiter{
+		limits:   limits,
+		store:    store,
+		counters: counters,
+	}
+}
+
+// Handler returns the Gin middleware enforcing the limits. Refused requests
+// get 429 with a Retry-After header, and requests are let through when the
+// store cannot be reached.
+func (r *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		limit, limited := r.limits[route]
+		if !limited {
+			c.Next()
+			return
+		}
+
+		keys := []string{route + "|ip:" + c.ClientIP()}
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			digest := sha256.Sum256([]byte(key))
+			keys = append(keys, route+"|key:"+hex.EncodeToString(digest[:8]))
+		}
+		if !r.take(c, limit, keys) {
+			r.count(route, false)
+			return
+		}
+
+		applied := &routeLimit{limiter: r, route: route, limit: limit}
+		c.Set(rateLimitContextKey, applied)
+		c.Next()
+		r.count(route, !applied.refused)
+	}
+}
+
+// take removes a token from the buckets in keys, setting the rate limit
+// headers, and aborts the request with 429 when one is empty. It reports
+// whether the request may go on.
+func (r *RateLimiter) take(c *gin.Context, limit RateLimit, keys []string) bool {
+	allowed, remaining, retryAfter, err := r.store.Take(keys, limit, time.Now())
+	if err != nil {
+		log.Println("while rate limiting: ", err.Error())
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"status": "fail", "message": "rate limit exceeded"})
+		return false
+	}
+	return true
+}
+
+// limitIdentity takes a token from the bucket of an authenticated identity,
+// e.g. "uid:alice", when the route is rate limited. It is called by the
+// authentication middleware once the caller is known and reports whether the
+// request may go on.
+func limitIdentity(c *gin.Context, identity string) bool {
+	value, found := c.Get(rateLimitContextKey)
+	if !found || identity == "" {
+		return true
+	}
+	limited := value.(*routeLimit)
+	limited.refused = !limited.limiter.take(c, limited.limit, []string{limited.route + "|" + identity})
+	return !limited.refused
+}
+
+// Stats returns the counters of every limited route.
+func (r *RateLimiter) Stats() []RateLimitCounter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	res := make([]RateLimitCounter, 0, len(r.counters))
+	for _, counter := range r.counters {
+		res = append(res, *counter)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Route < res[j].Route })
+	return res
+}
+
+func (r *RateLimiter) count(route string, allowed bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if allowed {
+		r.counters[route].Allowed++
+	} else {
+		r.counters[route].Limited++
+	}
+}
+
+// maxPeekedBody bounds how much of a JSON body middleware reads.
+const maxPeekedBody = 1 << 20
+
+// requestUid finds the uid a request acts for in its path, query or JSON body.
+func requestUid(c *gin.Context) string {
+	if uid := c.Param("uid"); uid != "" {
+		return uid
+	}
+	if uid := c.Query("uid"); uid != "" {
+		return uid
+	}
+
+	var payload struct {
+		Uid string `json:"uid"`
+	}
+	peekJSON(c, &payload)
+	return payload.Uid
+}
+
+// peekJSON decodes a JSON request body into v and puts the body back for the
+// handler. It reports whether the body was decoded.
+func peekJSON(c *gin.Context, v interface{}) bool {
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(body, v) == nil
+}
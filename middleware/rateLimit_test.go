@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits(map[string]string{"post /api/game/store": "30/1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["POST /api/game/store"] != (RateLimit{Burst: 30, Per: time.Minute}) {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+
+	for _, invalid := range []string{"30", "0/1m", "x/1m", "30/soon"} {
+		if _, err := ParseRateLimits(map[string]string{"GET /": invalid}); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Burst: 2, Per: 10 * time.Second}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _, _ := store.Take([]string{"ip", "uid"}, limit, now); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+	}
+	allowed, _, retryAfter, _ := store.Take([]string{"ip", "uid"}, limit, now)
+	if allowed || retryAfter != 5*time.Second {
+		t.Errorf("Expected the third request to wait 5s, got %v %s", allowed, retryAfter)
+	}
+	if allowed, _, _, _ := store.Take([]string{"other ip", "uid"}, limit, now); allowed {
+		t.Error("Expected a new ip with the same uid to be limited")
+	}
+	if allowed, _, _, _ := store.Take([]string{"ip", "uid"}, limit, now.Add(5*time.Second)); !allowed {
+		t.Error("Expected a token to be refilled after 5s")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(map[string]RateLimit{"POST /store": {Burst: 1, Per: time.Minute}}, NewMemoryRateLimitStore())
+	router := gin.New()
+	router.Use(limiter.Handler())
+	router.POST("/store", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	router.GET("/free", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "10.0.0.1:1234"
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send("POST", "/store", `{"uid":"alice"}`)
+	if resp.Code != http.StatusOK || resp.Body.String() != `{"uid":"alice"}` {
+		t.Errorf("Expected the body to reach the handler, got %d %s", resp.Code, resp.Body.String())
+	}
+	resp = send("POST", "/store", `{"uid":"bob"}`)
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60, got %d %q", resp.Code, resp.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 3; i++ {
+		if resp := send("GET", "/free", ""); resp.Code != http.StatusOK {
+			t.Errorf("Expected routes without a limit to pass, got %d", resp.Code)
+		}
+	}
+
+	stats := limiter.Stats()
+	if len(stats) != 1 || stats[0].Allowed != 1 || stats[0].Limited != 1 {
+		t.Errorf("Unexpected counters %+v", stats)
+	}
+}
+
+func TestRateLimiterKeysUidsOnlyWhenAuthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, _ := services.NewAPIKeyService("")
+	first, _ := keys.Issue("first", []string{services.ScopeGameWrite}, []int{1}, nil)
+	second, _ := keys.Issue("second", []string{services.ScopeGameWrite}, []int{1}, nil)
+	limiter := NewRateLimiter(map[string]RateLimit{"POST /store": {Burst: 1, Per: time.Minute}}, NewMemoryRateLimitStore())
+	router := gin.New()
+	router.Use(limiter.Handler())
+	router.POST("/store", RequireScope(keys, services.ScopeGameWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(ip string, key string) int {
+		req, _ := http.NewRequest("POST", "/store", bytes.NewBufferString(`{"gid":1,"uid":"alice"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, key)
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Requests failing authentication do not touch alice's bucket.
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if code := send(ip, "wrong"+ip); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 from %s, got %d", ip, code)
+		}
+	}
+	if code := send("10.0.0.4", first.Key); code != http.StatusOK {
+		t.Errorf("Expected the game server to store for alice, got %d", code)
+	}
+	if code := send("10.0.0.5", second.Key); code != http.StatusTooManyRequests {
+		t.Errorf("Expected alice to be limited across keys and IPs, got %d", code)
+	}
+
+	stats := limiter.Stats()
+	if len(stats) != 1 || stats[0].Allowed != 4 || stats[0].Limited != 1 {
+		t.Errorf("Unexpected counters %+v", stats)
+	}
+}
+
+func TestRateLimiterTrustsForwardedForOnlyFromProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(map[string]RateLimit{"POST /store": {Burst: 1, Per: time.Minute}}, NewMemoryRateLimitStore())
+	router := gin.New()
+	router.Use(limiter.Handler())
+	router.POST("/store", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(forwardedFor string) int {
+		req, _ := http.NewRequest("POST", "/store", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	router.SetTrustedProxies(nil)
+	if code := send("203.0.113.1"); code != http.StatusOK {
+		t.Errorf("Expected the first request to pass, got %d", code)
+	}
+	if code := send("203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a spoofed X-Forwarded-For to share the caller's bucket, got %d", code)
+	}
+
+	router.SetTrustedProxies([]string{"10.0.0.1"})
+	if code := send("203.0.113.3"); code != http.StatusOK {
+		t.Errorf("Expected a trusted proxy to forward another client, got %d", code)
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+// SessionCookie is the cookie a Sign-In with Ethereum session is kept in.
+const SessionCookie = "egc_session"
+
+// sessionContextKey is where RequireAddress leaves the session.
+const sessionContextKey = "siweSession"
+
+// changesStateContextKey marks GET routes ChangesState wraps.
+const changesStateContextKey = "changesState"
+
+// SessionAuthenticator resolves the Sign-In with Ethereum session of a token.
+type SessionAuthenticator interface {
+	Authenticate(token string) (services.SiweSession, error)
+}
+
+// SessionToken returns the session token of a request, from the Authorization
+// bearer header or the session cookie.
+func SessionToken(c *gin.Context) string {
+	token, _ := sessionToken(c)
+	return token
+}
+
+// sessionToken returns the session token of a request and whether it came
+// from the session cookie.
+func sessionToken(c *gin.Context) (token string, cookie bool) {
+	if bearer, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(bearer), false
+	}
+	token, _ = c.Cookie(SessionCookie)
+	return token, token != ""
+}
+
+// ChangesState wraps the middleware of a GET route that changes state, such as
+// a payment link, so RequireAddress refuses its cookie sessions like a write's.
+func ChangesState(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(changesStateContextKey, true)
+		next(c)
+	}
+}
+
+// isWrite reports whether a method changes state.
+func isWrite(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// RequireAddress returns a Gin middleware that only lets through requests
+// signed in with Sign-In with Ethereum. When param is set the signed in
+// address must match that path parameter.
+//
+// Requests without a session are handed to fallback when it is not nil, so
+// server integrations can keep authenticating with API keys. Writes and routes
+// wrapped in ChangesState must send the session as a bearer token, since a
+// cross site page can make the browser send the cookie but not the header.
+//
+// sessions SessionAuthenticator: The session issuer.
+// param string: The path parameter holding the address, empty for any address.
+// fallback gin.HandlerFunc: The middleware for requests without a session, or nil.
+// gin.HandlerFunc: The middleware function for Gin.
+func RequireAddress(sessions SessionAuthenticator, param string, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, cookie := sessionToken(c)
+		if token == "" && fallback != nil {
+			fallback(c)
+			return
+		}
+		if cookie && (isWrite(c.Request.Method) || c.GetBool(changesStateContextKey)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "send the session as an Authorization bearer token to change state"})
+			return
+		}
+
+		session, err := sessions.Authenticate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "sign in required"})
+			return
+		}
+		if param != "" {
+			address := c.Param(param)
+			if !common.IsHexAddress(address) || common.HexToAddress(address) != session.Address {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "signed in as another address"})
+				return
+			}
+		}
+
+		c.Set(sessionContextKey, session)
+		if !limitIdentity(c, "address:"+session.Address.Hex()) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequestSession returns the Sign-In with Ethereum session of the request.
+func RequestSession(c *gin.Context) (services.SiweSession, bool) {
+	value, found := c.Get(sessionContextKey)
+	if !found {
+		return services.SiweSession{}, false
+	}
+	session, ok := value.(services.SiweSession)
+	return session, ok
+}
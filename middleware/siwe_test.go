@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/joey1123455/easy_get_coin/services"
+)
+
+type fakeSessions map[string]services.SiweSession
+
+func (f fakeSessions) Authenticate(token string) (services.SiweSession, error) {
+	session, found := f[token]
+	if !found {
+		return session, errors.New("unknown token")
+	}
+	return session, nil
+}
+
+func TestRequireAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	alice := common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")
+	sessions := fakeSessions{"alice": {ID: "1", Address: alice}}
+	fallback := func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) != "key" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+
+	router := gin.New()
+	router.GET("/owner/:address", RequireAddress(sessions, "address", fallback), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/owner/:address", RequireAddress(sessions, "address", fallback), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/pay", ChangesState(RequireAddress(sessions, "", fallback)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/session", RequireAddress(sessions, "", nil), func(c *gin.Context) {
+		if _, found := RequestSession(c); !found {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		bearer string
+		cookie string
+		key    string
+		want   int
+	}{
+		{name: "Owner Bearer", path: "/owner/" + alice.Hex(), bearer: "alice", want: http.StatusOK},
+		{name: "Owner Lowercase", path: "/owner/0x2c7536e3605d9c16a7a3d7b1898e529396a65c23", bearer: "alice", want: http.StatusOK},
+		{name: "Owner Cookie", path: "/owner/" + alice.Hex(), cookie: "alice", want: http.StatusOK},
+		{name: "Other Address", path: "/owner/0x0000000000000000000000000000000000000001", bearer: "alice", want: http.StatusForbidden},
+		{name: "Unknown Token", path: "/owner/" + alice.Hex(), bearer: "mallory", key: "key", want: http.StatusUnauthorized},
+		{name: "API Key Fallback", path: "/owner/" + alice.Hex(), key: "key", want: http.StatusOK},
+		{name: "No Credentials", path: "/owner/" + alice.Hex(), want: http.StatusUnauthorized},
+		{name: "Write Bearer", method: "POST", path: "/owner/" + alice.Hex(), bearer: "alice", want: http.StatusOK},
+		{name: "Write Cookie", method: "POST", path: "/owner/" + alice.Hex(), cookie: "alice", want: http.StatusForbidden},
+		{name: "Write Cookie With Key", method: "POST", path: "/owner/" + alice.Hex(), cookie: "alice", key: "key", want: http.StatusForbidden},
+		{name: "Pay Bearer", path: "/pay", bearer: "alice", want: http.StatusOK},
+		{name: "Pay Cookie", path: "/pay", cookie: "alice", want: http.StatusForbidden},
+		{name: "Pay API Key", path: "/pay", key: "key", want: http.StatusOK},
+		{name: "Signed In", path: "/session", bearer: "alice", want: http.StatusOK},
+		{name: "Signed In Cookie", path: "/session", cookie: "alice", want: http.StatusOK},
+		{name: "Not Signed In", path: "/session", key: "key", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req, _ := http.NewRequest(method, tt.path, nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.cookie})
+			}
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, resp.Code)
+			}
+		})
+	}
+}
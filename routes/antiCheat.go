@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type AntiCheatRouteController struct {
+	antiCheatHandler handler.AntiCheatHandler
+}
+
+func NewAntiCheatRouteController(antiCheatHandler handler.AntiCheatHandler) AntiCheatRouteController {
+	return AntiCheatRouteController{antiCheatHandler}
+}
+
+// AntiCheatRoute handles the admin routes reviewing held and flagged sessions.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *AntiCheatRouteController) AntiCheatRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/anticheat")
+
+	router.GET("/reviews", r.antiCheatHandler.ListReviews)
+	router.POST("/reviews/:id/approve", r.antiCheatHandler.ApproveReview)
+	router.POST("/reviews/:id/reject", r.antiCheatHandler.RejectReview)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type APIKeyRouteController struct {
+	apiKeyHandler handler.APIKeyHandler
+}
+
+func NewAPIKeyRouteController(apiKeyHandler handler.APIKeyHandler) APIKeyRouteController {
+	return APIKeyRouteController{apiKeyHandler}
+}
+
+// APIKeyRoute handles the admin routes managing API keys.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *APIKeyRouteController) APIKeyRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/keys")
+
+	router.GET("", r.apiKeyHandler.ListAPIKeys)
+	router.POST("", r.apiKeyHandler.IssueAPIKey)
+	router.POST("/:id/rotate", r.apiKeyHandler.RotateAPIKey)
+	router.DELETE("/:id", r.apiKeyHandler.RevokeAPIKey)
+}
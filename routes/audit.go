@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type AuditRouteController struct {
+	auditHandler handler.AuditHandler
+}
+
+func NewAuditRouteController(auditHandler handler.AuditHandler) AuditRouteController {
+	return AuditRouteController{auditHandler}
+}
+
+// AuditRoute handles the admin routes reading the audit log.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *AuditRouteController) AuditRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/audit")
+
+	router.GET("", r.auditHandler.ListAudit)
+	router.GET("/verify", r.auditHandler.VerifyAudit)
+}
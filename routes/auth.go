@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type AuthRouteController struct {
+	authHandler handler.AuthHandler
+}
+
+func NewAuthRouteController(authHandler handler.AuthHandler) AuthRouteController {
+	return AuthRouteController{authHandler}
+}
+
+// AuthRoute handles the Sign-In with Ethereum routes.
+//
+// Takes in a gin.RouterGroup and the middleware requiring a session, and does
+// not return anything.
+func (r *AuthRouteController) AuthRoute(rg *gin.RouterGroup, signedIn gin.HandlerFunc) {
+	router := rg.Group("/auth")
+
+	router.GET("/nonce", r.authHandler.SiweNonce)
+	router.POST("/verify", r.authHandler.SiweVerify)
+	router.GET("/session", signedIn, r.authHandler.SiweSession)
+	router.POST("/logout", r.authHandler.SiweLogout)
+}
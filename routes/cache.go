@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type CacheRouteController struct {
+	cacheHandler handler.CacheHandler
+}
+
+func NewCacheRouteController(cacheHandler handler.CacheHandler) CacheRouteController {
+	return CacheRouteController{cacheHandler}
+}
+
+// CacheRoute handles the admin routes showing cache counters.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *CacheRouteController) CacheRoute(rg *gin.RouterGroup) {
+	rg.GET("/cache", r.cacheHandler.CacheStats)
+	rg.GET("/cache/refreshes", r.cacheHandler.HistoryRefreshes)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type FeedRouteController struct {
+	feedHandler handler.FeedHandler
+}
+
+func NewFeedRouteController(feedHandler handler.FeedHandler) FeedRouteController {
+	return FeedRouteController{feedHandler}
+}
+
+// FeedRoute handles the routes streaming newly stored sessions.
+//
+// Takes in a gin.RouterGroup and the middleware guarding reads, and does not
+// return anything.
+func (r *FeedRouteController) FeedRoute(rg *gin.RouterGroup, read gin.HandlerFunc) {
+	router := rg.Group("/feed")
+
+	router.GET("/game/:gid", read, r.feedHandler.GameFeed)
+	router.GET("/user/:uid", read, r.feedHandler.UserFeed)
+	router.GET("/ws", read, r.feedHandler.Socket)
+}
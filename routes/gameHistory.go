@@ -15,11 +15,15 @@ func NewGameDataRouteController(gameHistoryHandler handler.GameHistoryHandler) G
 
 // GameDataRoute handles the routes related to game data.
 //
-// Takes in a gin.RouterGroup as a parameter and does not return anything.
-func (r *GameDataRouteController) GameDataRoute(rg *gin.RouterGroup) {
+// Takes in a gin.RouterGroup and the middleware guarding reads and writes,
+// and does not return anything.
+func (r *GameDataRouteController) GameDataRoute(rg *gin.RouterGroup, read gin.HandlerFunc, write gin.HandlerFunc) {
 	router := rg.Group("/game")
 
-	router.POST("/store", r.gameHistoryHandler.StoreGameData)
-	router.GET("/history/:gid", r.gameHistoryHandler.GameHistory)
-	router.GET("/history/user/:uid", r.gameHistoryHandler.UserHistory)
+	router.POST("/session/start", write, r.gameHistoryHandler.StartSession)
+	router.POST("/store", write, r.gameHistoryHandler.StoreGameData)
+	router.GET("/history/:gid", read, r.gameHistoryHandler.GameHistory)
+	router.GET("/history/user/:uid", read, r.gameHistoryHandler.UserHistory)
+	router.GET("/export/:gid", read, r.gameHistoryHandler.GameHistoryExport)
+	router.GET("/export/user/:uid", read, r.gameHistoryHandler.UserHistoryExport)
 }
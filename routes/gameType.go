@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type GameTypeRouteController struct {
+	gameTypeHandler handler.GameTypeHandler
+}
+
+func NewGameTypeRouteController(gameTypeHandler handler.GameTypeHandler) GameTypeRouteController {
+	return GameTypeRouteController{gameTypeHandler}
+}
+
+// GameTypeRoute handles the admin routes managing game types.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *GameTypeRouteController) GameTypeRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/gametypes")
+
+	router.GET("", r.gameTypeHandler.ListGameTypes)
+	router.PUT("", r.gameTypeHandler.PutGameType)
+	router.GET("/:gid", r.gameTypeHandler.GetGameType)
+	router.DELETE("/:gid", r.gameTypeHandler.DeleteGameType)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type LeaderboardRouteController struct {
+	leaderboardHandler handler.LeaderboardHandler
+}
+
+func NewLeaderboardRouteController(leaderboardHandler handler.LeaderboardHandler) LeaderboardRouteController {
+	return LeaderboardRouteController{leaderboardHandler}
+}
+
+// LeaderboardRoute handles the routes related to game leaderboards.
+//
+// Takes in a gin.RouterGroup as a parameter and does not return anything.
+func (r *LeaderboardRouteController) LeaderboardRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/game/leaderboard")
+
+	router.GET("/:gid", r.leaderboardHandler.Leaderboard)
+	router.GET("/:gid/archive", r.leaderboardHandler.Archive)
+	router.GET("/:gid/player/:uid", r.leaderboardHandler.PlayerRank)
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type PayoutRouteController struct {
+	payoutHandler handler.PayoutHandler
+}
+
+func NewPayoutRouteController(payoutHandler handler.PayoutHandler) PayoutRouteController {
+	return PayoutRouteController{payoutHandler}
+}
+
+// PayoutRoute handles the admin routes paying leaderboard prizes.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *PayoutRouteController) PayoutRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/payouts")
+
+	router.GET("", r.payoutHandler.ListPayouts)
+	router.POST("", r.payoutHandler.CreatePayout)
+	router.POST("/preview", r.payoutHandler.PreviewPayout)
+	router.GET("/:id", r.payoutHandler.GetPayout)
+	router.POST("/:id/resolve", r.payoutHandler.ResolvePayout)
+	router.POST("/:id/execute", r.payoutHandler.ExecutePayout)
+}
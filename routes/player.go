@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type PlayerRouteController struct {
+	playerHandler handler.PlayerHandler
+}
+
+func NewPlayerRouteController(playerHandler handler.PlayerHandler) PlayerRouteController {
+	return PlayerRouteController{playerHandler}
+}
+
+// PlayerRoute handles the routes related to players.
+//
+// Takes in a gin.RouterGroup, the middleware requiring a signed in player,
+// the one requiring the player of the address in the path and the one
+// letting a signed in player or a game server link wallets, and does not
+// return anything.
+func (r *PlayerRouteController) PlayerRoute(rg *gin.RouterGroup, signedIn gin.HandlerFunc, owner gin.HandlerFunc, linker gin.HandlerFunc) {
+	router := rg.Group("/player")
+
+	router.GET("/:uid/stats", r.playerHandler.PlayerStats)
+	router.GET("/:uid/wallet", signedIn, r.playerHandler.PlayerWallet)
+	router.GET("/:uid/overview", signedIn, r.playerHandler.PlayerOverview)
+	router.GET("/wallet/:address", owner, r.playerHandler.WalletPlayer)
+	router.POST("/link/challenge", linker, r.playerHandler.LinkChallenge)
+	router.POST("/link", linker, r.playerHandler.LinkWallet)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type RateLimitRouteController struct {
+	rateLimitHandler handler.RateLimitHandler
+}
+
+func NewRateLimitRouteController(rateLimitHandler handler.RateLimitHandler) RateLimitRouteController {
+	return RateLimitRouteController{rateLimitHandler}
+}
+
+// RateLimitRoute handles the admin routes showing rate limit counters.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *RateLimitRouteController) RateLimitRoute(rg *gin.RouterGroup) {
+	rg.GET("/ratelimits", r.rateLimitHandler.RateLimitStats)
+}
@@ -13,13 +13,16 @@ func NewStakeRouteController(stakeHandler handler.StakeHandler) StakeRouteContro
 	return StakeRouteController{stakeHandler}
 }
 
-// GameDataRoute handles the routes related to game data.
+// StakeRoute handles the routes related to stakes.
 //
-// Takes in a gin.RouterGroup as a parameter and does not return anything.
-func (r *StakeRouteController) StakeRoute(rg *gin.RouterGroup) {
+// Takes in a gin.RouterGroup, the middleware requiring a signed in player and
+// the one requiring the player of the address in the path, and does not
+// return anything.
+func (r *StakeRouteController) StakeRoute(rg *gin.RouterGroup, signedIn gin.HandlerFunc, owner gin.HandlerFunc) {
 	router := rg.Group("/stake")
 
-	router.GET("/pay", r.stakeHandler.Stake)
-	router.GET("/history/user/:address", r.stakeHandler.UserStakeHistory)
-	router.GET("/total/user/:address", r.stakeHandler.UserTotalStake)
+	router.GET("/pay", signedIn, r.stakeHandler.Stake)
+	router.GET("/history/user/:address", owner, r.stakeHandler.UserStakeHistory)
+	router.GET("/export/user/:address", owner, r.stakeHandler.UserStakeExport)
+	router.GET("/total/user/:address", owner, r.stakeHandler.UserTotalStake)
 }
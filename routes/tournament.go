@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type TournamentRouteController struct {
+	tournamentHandler handler.TournamentHandler
+}
+
+func NewTournamentRouteController(tournamentHandler handler.TournamentHandler) TournamentRouteController {
+	return TournamentRouteController{tournamentHandler}
+}
+
+// TournamentRoute handles the routes related to tournaments.
+//
+// Takes in a gin.RouterGroup, the admin middleware guarding creation and
+// finalization, the middleware guarding session submission and the one
+// letting a signed in player or a game server register, and does not return
+// anything.
+func (r *TournamentRouteController) TournamentRoute(rg *gin.RouterGroup, admin gin.HandlerFunc, write gin.HandlerFunc, player gin.HandlerFunc) {
+	router := rg.Group("/tournament")
+
+	router.GET("", r.tournamentHandler.ListTournaments)
+	router.POST("", admin, r.tournamentHandler.CreateTournament)
+	router.GET("/:id", r.tournamentHandler.GetTournament)
+	router.GET("/:id/standings", r.tournamentHandler.TournamentStandings)
+	router.POST("/:id/register", player, r.tournamentHandler.RegisterTournament)
+	router.POST("/:id/session", write, r.tournamentHandler.SubmitTournamentSession)
+	router.POST("/:id/finalize", admin, r.tournamentHandler.FinalizeTournament)
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	handler "github.com/joey1123455/easy_get_coin/handlers"
+)
+
+type WebhookRouteController struct {
+	webhookHandler handler.WebhookHandler
+}
+
+func NewWebhookRouteController(webhookHandler handler.WebhookHandler) WebhookRouteController {
+	return WebhookRouteController{webhookHandler}
+}
+
+// WebhookRoute handles the admin routes managing webhooks.
+//
+// Takes in the admin gin.RouterGroup as a parameter and does not return anything.
+func (r *WebhookRouteController) WebhookRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/webhooks")
+
+	router.GET("", r.webhookHandler.ListWebhooks)
+	router.POST("", r.webhookHandler.CreateWebhook)
+	router.DELETE("/:id", r.webhookHandler.DeleteWebhook)
+	router.POST("/:id/enable", r.webhookHandler.EnableWebhook)
+	router.POST("/:id/test", r.webhookHandler.TestWebhook)
+	router.GET("/:id/deliveries", r.webhookHandler.WebhookDeliveries)
+}
@@ -0,0 +1,659 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Anti-cheat checks and the risk each adds to a session.
+const (
+	CheckZScore          = "zscore"
+	CheckIQR             = "iqr"
+	CheckDuration        = "duration"
+	CheckDurationMissing = "duration_missing"
+	CheckVelocity        = "velocity"
+)
+
+var checkRisk = map[string]int{
+	CheckZScore:          40,
+	CheckIQR:             30,
+	CheckDuration:        50,
+	CheckDurationMissing: 20,
+	CheckVelocity:        40,
+}
+
+// Review statuses. Held sessions were never stored, flagged sessions are
+// stored but left out of leaderboards until approved.
+const (
+	ReviewHeld     = "held"
+	ReviewFlagged  = "flagged"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+var (
+	ErrReviewNotFound = errors.New("session review not found")
+	ErrReviewDecided  = errors.New("session review was already decided")
+)
+
+// RiskReason is one failed check.
+type RiskReason struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+// RiskReport is the risk score of a session, 0 to 100, with the checks it failed.
+type RiskReport struct {
+	Score   int          `json:"score"`
+	Reasons []RiskReason `json:"reasons"`
+}
+
+// SessionReview is a held or flagged session waiting for, or past, review.
+type SessionReview struct {
+	ID         string     `json:"id"`
+	Gid        int        `json:"gid"`
+	Gtid       string     `json:"gtid"`
+	Uid        string     `json:"uid"`
+	Data       string     `json:"data"`
+	Time       int64      `json:"time"`
+	Risk       RiskReport `json:"risk"`
+	Status     string     `json:"status"`
+	Stored     bool       `json:"stored"`
+	TxHash     string     `json:"tx_hash,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// HeldError is returned instead of storing a session that needs review.
+type HeldError struct {
+	Review SessionReview
+}
+
+func (h *HeldError) Error() string {
+	return fmt.Sprintf("session held for review with risk %d", h.Review.Risk.Score)
+}
+
+// AntiCheatConfig tunes the anti-cheat checks.
+//
+// Score checks only run once a game has MinSamples scores. MinDuration is
+// keyed by gid and read from the DurationField of the session data in seconds.
+type AntiCheatConfig struct {
+	ZScore        float64
+	IQRFactor     float64
+	MinSamples    int
+	DurationField string
+	MinDuration   map[int]time.Duration
+	MaxPerHour    int
+	HoldRisk      int
+	Rule          func(gid int) ScoreRule
+}
+
+// Defaults used for AntiCheatConfig fields left at zero.
+const (
+	DefaultAntiCheatZScore     = 4
+	DefaultAntiCheatIQRFactor  = 3
+	DefaultAntiCheatMinSamples = 30
+	DefaultAntiCheatHoldRisk   = 70
+)
+
+// ParseMinDurations parses minimum session durations configured as gid=duration pairs.
+func ParseMinDurations(list map[string]string) (map[int]time.Duration, error) {
+	res := make(map[int]time.Duration, len(list))
+	for gid, value := range list {
+		id, err := strconv.Atoi(gid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %s", gid)
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("game %d minimum duration: %w", id, err)
+		}
+		res[id] = duration
+	}
+	return res, nil
+}
+
+type AntiCheatService interface {
+	Assess(session storage.GameHistoryGameSession) RiskReport
+	Observe(session storage.GameHistoryGameSession)
+	Hold(session storage.GameHistoryGameSession, risk RiskReport) (res SessionReview, err error)
+	Excluded(session storage.GameHistoryGameSession) bool
+	Reviews(status string) []SessionReview
+	Review(transactData *bind.TransactOpts, id string, approve bool) (res SessionReview, err error)
+	Scan(callData *bind.CallOpts, gid int) (flagged int, err error)
+	OnChange(func(gid int))
+	HoldRisk() int
+}
+
+type antiCheat struct {
+	path      string
+	contract  GameHistoryContract
+	config    AntiCheatConfig
+	mutex     sync.RWMutex
+	games     map[int]*scoreDistribution
+	players   map[string][]int64
+	observed  map[string]bool
+	scanned   map[int]int
+	reviews   map[string]SessionReview
+	listeners []func(gid int)
+}
+
+// NewAntiCheatService loads the session reviews stored at path.
+//
+// Parameters:
+//   - path: The file reviews are persisted to, an empty path keeps them in memory.
+//   - contract: The GameHistoryContract sessions are scanned from and approved held sessions are stored to.
+//   - config: The check thresholds, zero values fall back to the defaults.
+//
+// Returns:
+//   - res: An AntiCheatService instance.
+//   - err: An error if the stored reviews could not be read.
+func NewAntiCheatService(path string, contract GameHistoryContract, config AntiCheatConfig) (res AntiCheatService, err error) {
+	if config.ZScore <= 0 {
+		config.ZScore = DefaultAntiCheatZScore
+	}
+	if config.IQRFactor <= 0 {
+		config.IQRFactor = DefaultAntiCheatIQRFactor
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = DefaultAntiCheatMinSamples
+	}
+	if config.HoldRisk <= 0 {
+		config.HoldRisk = DefaultAntiCheatHoldRisk
+	}
+	if config.DurationField == "" {
+		config.DurationField = "duration"
+	}
+	service := &antiCheat{
+		path:     path,
+		contract: contract,
+		config:   config,
+		games:    make(map[int]*scoreDistribution),
+		players:  make(map[string][]int64),
+		observed: make(map[string]bool),
+		scanned:  make(map[int]int),
+		reviews:  make(map[string]SessionReview),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.reviews); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// SessionFingerprint identifies a session by its content.
+func SessionFingerprint(session storage.GameHistoryGameSession) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", session.Gid, session.Gtid, session.Uid, session.Data, session.Time)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// HoldRisk returns the risk score at which sessions are held or flagged.
+func (a *antiCheat) HoldRisk() int {
+	return a.config.HoldRisk
+}
+
+// OnChange registers a function called with the gid of every session that
+// is flagged or let back in, so rankings built from it can be dropped.
+func (a *antiCheat) OnChange(listener func(gid int)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.listeners = append(a.listeners, listener)
+}
+
+// Assess scores a session against what is known about its game and player.
+// It has no side effects.
+func (a *antiCheat) Assess(session storage.GameHistoryGameSession) RiskReport {
+	gid := int(session.Gid.Int64())
+	report := RiskReport{Reasons: []RiskReason{}}
+	fail := func(check string, detail string, args ...any) {
+		report.Reasons = append(report.Reasons, RiskReason{Check: check, Detail: fmt.Sprintf(detail, args...)})
+		report.Score += checkRisk[check]
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	rule := a.config.Rule(gid)
+	if score, err := ExtractScore(session.Data, rule.Field); err == nil {
+		if game := a.games[gid]; game != nil && game.Len() >= a.config.MinSamples {
+			// Direction only matters one way: a score worse than everyone's is not cheating.
+			better := func(delta float64) float64 {
+				if rule.Ascending {
+					return -delta
+				}
+				return delta
+			}
+			if stddev := game.StdDev(); stddev > 0 {
+				if z := better(score-game.mean) / stddev; z > a.config.ZScore {
+					fail(CheckZScore, "score %g is %.1f standard deviations better than the mean %g", score, z, game.mean)
+				}
+			}
+			q1, q3 := game.Quantile(0.25), game.Quantile(0.75)
+			fence := q3 + a.config.IQRFactor*(q3-q1)
+			if rule.Ascending {
+				fence = q1 - a.config.IQRFactor*(q3-q1)
+			}
+			if better(score-fence) > 0 {
+				fail(CheckIQR, "score %g is beyond the outlier fence %g", score, fence)
+			}
+		}
+	}
+
+	if minimum, ok := a.config.MinDuration[gid]; ok {
+		duration, err := ExtractScore(session.Data, a.config.DurationField)
+		switch {
+		case err != nil:
+			fail(CheckDurationMissing, "session data has no %s", a.config.DurationField)
+		case time.Duration(duration*float64(time.Second)) < minimum:
+			fail(CheckDuration, "session lasted %gs, the minimum is %s", duration, minimum)
+		}
+	}
+
+	if a.config.MaxPerHour > 0 {
+		at := SessionTime(session.Time).Unix()
+		times := a.players[session.Uid]
+		recent := sort.Search(len(times), func(i int) bool { return times[i] > at })
+		recent -= sort.Search(len(times), func(i int) bool { return times[i] > at-3600 })
+		if recent >= a.config.MaxPerHour {
+			fail(CheckVelocity, "player already has %d sessions in the hour before this one", recent)
+		}
+	}
+
+	report.Score = min(report.Score, 100)
+	return report
+}
+
+// Observe adds a session to its game's score distribution and its player's
+// session times. Sessions are only observed once.
+func (a *antiCheat) Observe(session storage.GameHistoryGameSession) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.observe(session)
+}
+
+func (a *antiCheat) observe(session storage.GameHistoryGameSession) {
+	fingerprint := SessionFingerprint(session)
+	if a.observed[fingerprint] {
+		return
+	}
+	a.observed[fingerprint] = true
+
+	gid := int(session.Gid.Int64())
+	if score, err := ExtractScore(session.Data, a.config.Rule(gid).Field); err == nil {
+		game, ok := a.games[gid]
+		if !ok {
+			game = &scoreDistribution{}
+			a.games[gid] = game
+		}
+		game.Add(score)
+	}
+
+	at := SessionTime(session.Time).Unix()
+	times := a.players[session.Uid]
+	index := sort.Search(len(times), func(i int) bool { return times[i] > at })
+	times = append(times, 0)
+	copy(times[index+1:], times[index:])
+	times[index] = at
+	a.players[session.Uid] = times
+}
+
+// Hold keeps a session off the chain until it is reviewed.
+func (a *antiCheat) Hold(session storage.GameHistoryGameSession, risk RiskReport) (res SessionReview, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	res = newSessionReview(session, risk, ReviewHeld)
+	return res, a.save(res)
+}
+
+func newSessionReview(session storage.GameHistoryGameSession, risk RiskReport, status string) SessionReview {
+	return SessionReview{
+		ID:        SessionFingerprint(session),
+		Gid:       int(session.Gid.Int64()),
+		Gtid:      session.Gtid,
+		Uid:       session.Uid,
+		Data:      session.Data,
+		Time:      session.Time.Int64(),
+		Risk:      risk,
+		Status:    status,
+		Stored:    status != ReviewHeld,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Excluded reports whether a stored session is flagged and not approved.
+func (a *antiCheat) Excluded(session storage.GameHistoryGameSession) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	review, found := a.reviews[SessionFingerprint(session)]
+	return found && review.Stored && review.Status != ReviewApproved
+}
+
+// Reviews lists the reviews with a status, or every review when status is
+// empty, oldest first.
+func (a *antiCheat) Reviews(status string) []SessionReview {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	res := make([]SessionReview, 0)
+	for _, review := range a.reviews {
+		if status == "" || review.Status == status {
+			res = append(res, review)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Review approves or rejects a held or flagged session.
+//
+// Approving a held session stores it, approving a flagged one lets it back
+// into leaderboards. Rejected sessions stay off the chain or out of
+// leaderboards. Approved sessions feed the score distributions. A review is
+// decided once: it is marked before a held session is stored, so concurrent
+// approvals store it only once, and restored if storing fails.
+//
+// Parameters:
+//   - transactData: Transaction options used to store approved held sessions.
+//   - id: The review ID.
+//   - approve: Approve rather than reject the session.
+//
+// Returns:
+//   - res: The updated review, its TxHash set when a held session was stored.
+//   - err: ErrReviewNotFound, ErrReviewDecided, an error storing the session or saving the review.
+func (a *antiCheat) Review(transactData *bind.TransactOpts, id string, approve bool) (res SessionReview, err error) {
+	a.mutex.Lock()
+	previous, found := a.reviews[id]
+	if !found {
+		a.mutex.Unlock()
+		return res, ErrReviewNotFound
+	}
+	if previous.Status == ReviewApproved || previous.Status == ReviewRejected {
+		a.mutex.Unlock()
+		return previous, ErrReviewDecided
+	}
+	review := previous
+	now := time.Now().UTC()
+	review.ReviewedAt = &now
+	review.Status = ReviewRejected
+	if approve {
+		review.Status = ReviewApproved
+	}
+	err = a.save(review)
+	a.mutex.Unlock()
+	if err != nil {
+		return previous, err
+	}
+
+	if approve && !review.Stored {
+		var tx *types.Transaction
+		tx, err = a.contract.StoreGameData(transactData, review.Gid, review.Gtid, review.Uid, review.Data, int(review.Time))
+		if err != nil {
+			a.mutex.Lock()
+			if err := a.save(previous); err != nil {
+				log.Printf("while reopening review %s: %v", id, err)
+			}
+			a.mutex.Unlock()
+			return previous, err
+		}
+		review.Stored, review.TxHash = true, tx.Hash().Hex()
+	}
+
+	session := storage.GameHistoryGameSession{
+		Gid:  big.NewInt(int64(review.Gid)),
+		Gtid: review.Gtid,
+		Uid:  review.Uid,
+		Data: review.Data,
+		Time: big.NewInt(review.Time),
+	}
+	a.mutex.Lock()
+	if review.TxHash != "" {
+		// The session is on chain, so the review keeps its hash even if it
+		// cannot be written.
+		if err := a.save(review); err != nil {
+			a.reviews[review.ID] = review
+			log.Printf("while saving review %s: %v", id, err)
+		}
+	}
+	if approve {
+		a.observe(session)
+	}
+	listeners := a.listeners
+	a.mutex.Unlock()
+
+	if review.Stored {
+		for _, listener := range listeners {
+			listener(review.Gid)
+		}
+	}
+	return review, nil
+}
+
+// Scan scores the sessions of a game stored since the last scan and flags
+// those at or above the hold risk. Flagged sessions are not observed.
+//
+// Returns:
+//   - flagged: How many sessions were flagged.
+//   - err: Any error reading the game history or saving the reviews.
+func (a *antiCheat) Scan(callData *bind.CallOpts, gid int) (flagged int, err error) {
+	sessions, err := a.contract.GetGameData(callData, gid)
+	if err != nil {
+		return 0, err
+	}
+
+	a.mutex.Lock()
+	seen := a.scanned[gid]
+	a.mutex.Unlock()
+	if seen > len(sessions) {
+		seen = 0
+	}
+
+	for _, session := range sessions[seen:] {
+		id := SessionFingerprint(session)
+		a.mutex.RLock()
+		_, reviewed := a.reviews[id]
+		a.mutex.RUnlock()
+		if reviewed {
+			continue
+		}
+
+		risk := a.Assess(session)
+		a.mutex.Lock()
+		if risk.Score >= a.config.HoldRisk {
+			err = a.save(newSessionReview(session, risk, ReviewFlagged))
+			flagged++
+		} else {
+			a.observe(session)
+		}
+		a.mutex.Unlock()
+		if err != nil {
+			return flagged, err
+		}
+	}
+
+	a.mutex.Lock()
+	a.scanned[gid] = len(sessions)
+	listeners := a.listeners
+	a.mutex.Unlock()
+
+	if flagged > 0 {
+		for _, listener := range listeners {
+			listener(gid)
+		}
+	}
+	return flagged, nil
+}
+
+// save stores a review and writes every review to disk, restoring the
+// previous copy if the write fails. The caller holds the lock.
+func (a *antiCheat) save(review SessionReview) error {
+	previous, existed := a.reviews[review.ID]
+	a.reviews[review.ID] = review
+	if a.path == "" {
+		return nil
+	}
+	if err := utils.SaveJSON(a.path, a.reviews); err != nil {
+		if existed {
+			a.reviews[review.ID] = previous
+		} else {
+			delete(a.reviews, review.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// StartAntiCheatScanner scans the sessions of the given games every interval
+// until ctx is cancelled.
+func StartAntiCheatScanner(ctx context.Context, service AntiCheatService, callData *bind.CallOpts, gids []int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			for _, gid := range gids {
+				flagged, err := service.Scan(callData, gid)
+				if err != nil {
+					log.Printf("while scanning sessions of game %d: %v", gid, err)
+				}
+				if flagged > 0 {
+					log.Printf("flagged %d sessions of game %d for review", flagged, gid)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// scoreDistribution keeps the running mean and variance of a game's scores
+// with the sorted scores for quantiles.
+type scoreDistribution struct {
+	mean   float64
+	m2     float64
+	scores []float64
+}
+
+func (d *scoreDistribution) Len() int {
+	return len(d.scores)
+}
+
+func (d *scoreDistribution) Add(score float64) {
+	index := sort.SearchFloat64s(d.scores, score)
+	d.scores = append(d.scores, 0)
+	copy(d.scores[index+1:], d.scores[index:])
+	d.scores[index] = score
+
+	delta := score - d.mean
+	d.mean += delta / float64(len(d.scores))
+	d.m2 += delta * (score - d.mean)
+}
+
+func (d *scoreDistribution) StdDev() float64 {
+	if len(d.scores) < 2 {
+		return 0
+	}
+	return math.Sqrt(d.m2 / float64(len(d.scores)-1))
+}
+
+// Quantile interpolates between the closest ranks.
+func (d *scoreDistribution) Quantile(q float64) float64 {
+	if len(d.scores) == 0 {
+		return 0
+	}
+	position := q * float64(len(d.scores)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return d.scores[lower] + (d.scores[upper]-d.scores[lower])*(position-float64(lower))
+}
+
+type screeningGameHistory struct {
+	GameHistoryContract
+	antiCheat AntiCheatService
+}
+
+// NewScreeningGameHistory wraps a GameHistoryContract so StoreGameData holds
+// sessions at or above the hold risk for review instead of storing them,
+// and reads leave out flagged sessions.
+func NewScreeningGameHistory(contract GameHistoryContract, antiCheat AntiCheatService) GameHistoryContract {
+	return &screeningGameHistory{
+		GameHistoryContract: contract,
+		antiCheat:           antiCheat,
+	}
+}
+
+// StoreGameData scores the session and stores it when its risk is below the hold risk.
+//
+// Returns:
+//   - res: The transaction storing the session.
+//   - err: A *HeldError when the session was held for review, or any error storing it.
+func (s *screeningGameHistory) StoreGameData(transactData *bind.TransactOpts, gid int, gtid string, uid string, data string, time int) (res *types.Transaction, err error) {
+	session := storage.GameHistoryGameSession{
+		Gid:  big.NewInt(int64(gid)),
+		Gtid: gtid,
+		Uid:  uid,
+		Data: data,
+		Time: big.NewInt(int64(time)),
+	}
+	if risk := s.antiCheat.Assess(session); risk.Score >= s.antiCheat.HoldRisk() {
+		review, err := s.antiCheat.Hold(session, risk)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &HeldError{Review: review}
+	}
+
+	res, err = s.GameHistoryContract.StoreGameData(transactData, gid, gtid, uid, data, time)
+	if err == nil {
+		s.antiCheat.Observe(session)
+	}
+	return res, err
+}
+
+// GetGameData returns the sessions of a game that are not flagged.
+func (s *screeningGameHistory) GetGameData(callData *bind.CallOpts, gid int) (res []storage.GameHistoryGameSession, err error) {
+	sessions, err := s.GameHistoryContract.GetGameData(callData, gid)
+	return s.screen(sessions), err
+}
+
+// GetUserGameData returns the sessions of a user that are not flagged.
+func (s *screeningGameHistory) GetUserGameData(callData *bind.CallOpts, uid string) (res []storage.GameHistoryGameSession, err error) {
+	sessions, err := s.GameHistoryContract.GetUserGameData(callData, uid)
+	return s.screen(sessions), err
+}
+
+func (s *screeningGameHistory) screen(sessions []storage.GameHistoryGameSession) []storage.GameHistoryGameSession {
+	res := make([]storage.GameHistoryGameSession, 0, len(sessions))
+	for _, session := range sessions {
+		if !s.antiCheat.Excluded(session) {
+			res = append(res, session)
+		}
+	}
+	return res
+}
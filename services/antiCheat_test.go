@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAntiCheatScreening(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	history := &fakeGameHistory{}
+	for i := 0; i < 40; i++ {
+		uid := fmt.Sprintf("player%d", i)
+		history.sessions = append(history.sessions, session(1, "", uid, fmt.Sprintf(`{"score":%d,"duration":60}`, 100+i%10), int(base.Unix())+i))
+	}
+	path := filepath.Join(t.TempDir(), "anticheat.json")
+	config := AntiCheatConfig{
+		MinDuration: map[int]time.Duration{1: 30 * time.Second},
+		MaxPerHour:  2,
+		Rule:        func(int) ScoreRule { return ScoreRule{Field: "score"} },
+	}
+	service, err := NewAntiCheatService(path, history, config)
+	require.NoError(t, err)
+	invalidated := 0
+	service.OnChange(func(int) { invalidated++ })
+
+	flagged, err := service.Scan(nil, 1)
+	assert.NoError(t, err)
+	assert.Zero(t, flagged)
+
+	now := int(time.Now().Unix())
+	risk := service.Assess(session(1, "", "alice", `{"score":106,"duration":60}`, now))
+	assert.Zero(t, risk.Score)
+	risk = service.Assess(session(1, "", "alice", `{"score":50,"duration":60}`, now))
+	assert.Zero(t, risk.Score, "a score far below the others is not suspicious")
+	risk = service.Assess(session(1, "", "alice", `{"score":900,"duration":5}`, now))
+	assert.Equal(t, 100, risk.Score)
+	assert.Len(t, risk.Reasons, 3)
+	risk = service.Assess(session(1, "", "alice", `{"score":105}`, now))
+	assert.Equal(t, CheckDurationMissing, risk.Reasons[0].Check)
+
+	screened := NewScreeningGameHistory(history, service)
+	_, err = screened.StoreGameData(nil, 1, "", "alice", `{"score":105,"duration":60}`, now-120)
+	assert.NoError(t, err)
+	_, err = screened.StoreGameData(nil, 1, "", "alice", `{"score":105,"duration":60}`, now-60)
+	assert.NoError(t, err)
+	_, err = screened.StoreGameData(nil, 1, "", "alice", `{"score":900,"duration":5}`, now)
+	var held *HeldError
+	require.True(t, errors.As(err, &held))
+	assert.Contains(t, reasonChecks(held.Review.Risk), CheckVelocity, "two sessions in the last hour reach the limit")
+	assert.Len(t, history.sessions, 42, "held sessions are not stored")
+
+	// A cheat stored straight on the contract is flagged by the next scan and screened out.
+	history.sessions = append(history.sessions, session(1, "", "mallory", `{"score":5000,"duration":60}`, now))
+	flagged, err = service.Scan(nil, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, flagged)
+	assert.Equal(t, 1, invalidated)
+	sessions, _ := screened.GetGameData(nil, 1)
+	assert.Len(t, sessions, 42)
+	sessions, _ = screened.GetUserGameData(nil, "mallory")
+	assert.Empty(t, sessions)
+
+	reviews := service.Reviews("")
+	require.Len(t, reviews, 2)
+	assert.Equal(t, ReviewHeld, reviews[0].Status)
+	assert.Equal(t, ReviewFlagged, reviews[1].Status)
+
+	_, err = service.Review(nil, "missing", true)
+	assert.ErrorIs(t, err, ErrReviewNotFound)
+	approved, err := service.Review(nil, held.Review.ID, true)
+	assert.NoError(t, err)
+	assert.True(t, approved.Stored)
+	assert.NotEmpty(t, approved.TxHash)
+	assert.Len(t, history.sessions, 44, "approving a held session stores it")
+	_, err = service.Review(nil, held.Review.ID, true)
+	assert.ErrorIs(t, err, ErrReviewDecided)
+	assert.Len(t, history.sessions, 44, "a held session is stored once")
+	_, err = service.Review(nil, reviews[1].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, invalidated)
+
+	reloaded, err := NewAntiCheatService(path, history, config)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.Reviews(ReviewApproved), 1)
+	assert.True(t, reloaded.Excluded(session(1, "", "mallory", `{"score":5000,"duration":60}`, now)), "rejected sessions stay excluded")
+}
+
+func TestScoreDistribution(t *testing.T) {
+	d := &scoreDistribution{}
+	for _, score := range []float64{4, 1, 3, 2, 5} {
+		d.Add(score)
+	}
+	assert.Equal(t, 3.0, d.mean)
+	assert.InDelta(t, 1.5811, d.StdDev(), 0.0001)
+	assert.Equal(t, 2.0, d.Quantile(0.25))
+	assert.Equal(t, 4.0, d.Quantile(0.75))
+}
+
+func reasonChecks(risk RiskReport) []string {
+	res := make([]string, 0, len(risk.Reasons))
+	for _, reason := range risk.Reasons {
+		res = append(res, reason.Check)
+	}
+	return res
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// API key scopes. ScopeAdmin grants every other scope.
+const (
+	ScopeGameWrite = "game:write"
+	ScopeGameRead  = "game:read"
+	ScopeStakeRead = "stake:read"
+	ScopeAdmin     = "admin"
+)
+
+// APIKeyPrefix starts every issued key so leaked keys are easy to scan for.
+const APIKeyPrefix = "egc_"
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyInvalid  = errors.New("api key is invalid or revoked")
+	ErrAPIKeyExpired  = errors.New("api key expired")
+)
+
+var knownScopes = map[string]bool{
+	ScopeGameWrite: true,
+	ScopeGameRead:  true,
+	ScopeStakeRead: true,
+	ScopeAdmin:     true,
+}
+
+// APIKey is an issued key. Only the sha256 hash of the key is stored, and
+// Hint keeps its last characters to tell keys apart.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Hint      string     `json:"hint"`
+	Scopes    []string   `json:"scopes"`
+	Gids      []int      `json:"gids"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Allows reports whether the key has a scope.
+func (k APIKey) Allows(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGid reports whether the key may act on a game. Keys without gids
+// may act on every game.
+func (k APIKey) AllowsGid(gid int) bool {
+	if len(k.Gids) == 0 {
+		return true
+	}
+	for _, allowed := range k.Gids {
+		if allowed == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuedAPIKey is an APIKey with the plain key, which is only shown once.
+type IssuedAPIKey struct {
+	Key string `json:"key,omitempty"`
+	APIKey
+}
+
+type APIKeyService interface {
+	Issue(name string, scopes []string, gids []int, expiresAt *time.Time) (res IssuedAPIKey, err error)
+	Rotate(id string) (res IssuedAPIKey, err error)
+	Revoke(id string) (res APIKey, err error)
+	List() []APIKey
+	Authenticate(key string) (res APIKey, err error)
+}
+
+type apiKeys struct {
+	path   string
+	mutex  sync.RWMutex
+	keys   map[string]APIKey
+	byHash map[string]string
+}
+
+// NewAPIKeyService loads the API keys stored at path.
+//
+// Parameters:
+//   - path: The file keys are persisted to, an empty path keeps them in memory.
+//
+// Returns:
+//   - res: An APIKeyService instance.
+//   - err: An error if the stored keys could not be read.
+func NewAPIKeyService(path string) (res APIKeyService, err error) {
+	service := &apiKeys{
+		path:   path,
+		keys:   make(map[string]APIKey),
+		byHash: make(map[string]string),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.keys); err != nil {
+			return nil, err
+		}
+	}
+	for id, key := range service.keys {
+		service.byHash[key.Hash] = id
+	}
+	return service, nil
+}
+
+// Issue creates a key.
+//
+// Parameters:
+//   - name: What the key is for.
+//   - scopes: The scopes granted, at least one.
+//   - gids: The games the key may act on, empty for every game.
+//   - expiresAt: When the key stops working, nil for never.
+//
+// Returns:
+//   - res: The key with its plain value.
+//   - err: An error for unknown scopes, a past expiry or a storage error.
+func (a *apiKeys) Issue(name string, scopes []string, gids []int, expiresAt *time.Time) (res IssuedAPIKey, err error) {
+	if len(scopes) == 0 {
+		return res, errors.New("an api key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !knownScopes[scope] {
+			return res, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return res, errors.New("expiry is in the past")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return res, err
+	}
+	if gids == nil {
+		gids = []int{}
+	}
+	res.APIKey = APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		Gids:      gids,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.assignSecret(res.APIKey)
+}
+
+// Rotate replaces the secret of a key. The old secret stops working at once.
+func (a *apiKeys) Rotate(id string) (res IssuedAPIKey, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key, found := a.keys[id]
+	if !found {
+		return res, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return res, ErrAPIKeyInvalid
+	}
+	now := time.Now().UTC()
+	key.RotatedAt = &now
+	return a.assignSecret(key)
+}
+
+// assignSecret gives a key a new secret and saves it. The caller holds the lock.
+func (a *apiKeys) assignSecret(key APIKey) (res IssuedAPIKey, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return res, err
+	}
+	plain := APIKeyPrefix + hex.EncodeToString(secret)
+	previousHash := key.Hash
+	key.Hash = hashAPIKey(plain)
+	key.Hint = plain[len(plain)-4:]
+
+	if err := a.save(key); err != nil {
+		return res, err
+	}
+	delete(a.byHash, previousHash)
+	a.byHash[key.Hash] = key.ID
+	return IssuedAPIKey{Key: plain, APIKey: key}, nil
+}
+
+// Revoke disables a key for good.
+func (a *apiKeys) Revoke(id string) (res APIKey, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key, found := a.keys[id]
+	if !found {
+		return res, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := a.save(key); err != nil {
+			return res, err
+		}
+	}
+	return key, nil
+}
+
+// List returns every key, oldest first.
+func (a *apiKeys) List() []APIKey {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	res := make([]APIKey, 0, len(a.keys))
+	for _, key := range a.keys {
+		res = append(res, key)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res
+}
+
+// Authenticate finds the key a request presented.
+//
+// Returns:
+//   - res: The key.
+//   - err: ErrAPIKeyInvalid for unknown or revoked keys, ErrAPIKeyExpired for expired ones.
+func (a *apiKeys) Authenticate(plain string) (res APIKey, err error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	id, found := a.byHash[hashAPIKey(plain)]
+	if !found {
+		return res, ErrAPIKeyInvalid
+	}
+	res = a.keys[id]
+	if res.RevokedAt != nil {
+		return res, ErrAPIKeyInvalid
+	}
+	if res.ExpiresAt != nil && time.Now().After(*res.ExpiresAt) {
+		return res, ErrAPIKeyExpired
+	}
+	return res, nil
+}
+
+// save stores a key and writes every key to disk, restoring the previous
+// copy if the write fails. The caller holds the lock.
+func (a *apiKeys) save(key APIKey) error {
+	previous, existed := a.keys[key.ID]
+	a.keys[key.ID] = key
+	if a.path == "" {
+		return nil
+	}
+	if err := utils.SaveJSON(a.path, a.keys); err != nil {
+		if existed {
+			a.keys[key.ID] = previous
+		} else {
+			delete(a.keys, key.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	service, err := NewAPIKeyService(path)
+	require.NoError(t, err)
+
+	_, err = service.Issue("bad", []string{"game:delete"}, nil, nil)
+	assert.Error(t, err)
+	past := time.Now().Add(-time.Hour)
+	_, err = service.Issue("bad", []string{ScopeGameRead}, nil, &past)
+	assert.Error(t, err)
+
+	issued, err := service.Issue("arcade server", []string{ScopeGameWrite}, []int{1, 2}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(issued.Key, APIKeyPrefix))
+	assert.NotContains(t, issued.Hash, issued.Key)
+
+	key, err := service.Authenticate(issued.Key)
+	assert.NoError(t, err)
+	assert.True(t, key.Allows(ScopeGameWrite))
+	assert.False(t, key.Allows(ScopeStakeRead))
+	assert.True(t, key.AllowsGid(2))
+	assert.False(t, key.AllowsGid(3))
+	_, err = service.Authenticate("egc_guess")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+
+	rotated, err := service.Rotate(issued.ID)
+	require.NoError(t, err)
+	_, err = service.Authenticate(issued.Key)
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid, "the old secret stops working")
+	_, err = service.Authenticate(rotated.Key)
+	assert.NoError(t, err)
+
+	reloaded, err := NewAPIKeyService(path)
+	require.NoError(t, err)
+	_, err = reloaded.Authenticate(rotated.Key)
+	assert.NoError(t, err, "keys survive a restart")
+	_, err = reloaded.Revoke(issued.ID)
+	assert.NoError(t, err)
+	_, err = reloaded.Authenticate(rotated.Key)
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	_, err = reloaded.Rotate(issued.ID)
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	_, err = reloaded.Revoke("missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	soon := time.Now().Add(time.Millisecond)
+	expiring, _ := service.Issue("trial", []string{ScopeAdmin}, nil, &soon)
+	time.Sleep(2 * time.Millisecond)
+	_, err = service.Authenticate(expiring.Key)
+	assert.ErrorIs(t, err, ErrAPIKeyExpired)
+	assert.True(t, expiring.Allows(ScopeStakeRead), "admin grants every scope")
+}
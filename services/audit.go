@@ -0,0 +1,313 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Audit outcomes, from the response status of the request.
+const (
+	AuditSuccess  = "success"
+	AuditRejected = "rejected"
+	AuditError    = "error"
+)
+
+// Audit actor types.
+const (
+	ActorAPIKey     = "api_key"
+	ActorAddress    = "address"
+	ActorAdminToken = "admin_token"
+	ActorAnonymous  = "anonymous"
+)
+
+// AuditGenesis is the previous hash of the first entry of a log.
+const AuditGenesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// maxAuditLine bounds the length of one entry in the log file.
+const maxAuditLine = 1 << 20
+
+// AuditEntry records one state changing request. Hash is the sha256 of the
+// previous entry's hash and the entry itself, so changing, dropping or
+// reordering entries breaks every hash after it.
+//
+// IP is the client IP, read from X-Forwarded-For when the request came
+// through a trusted proxy, and RemoteAddr the peer the connection came from.
+type AuditEntry struct {
+	Seq           int64     `json:"seq"`
+	Time          time.Time `json:"time"`
+	ActorType     string    `json:"actor_type"`
+	Actor         string    `json:"actor"`
+	IP            string    `json:"ip"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	Method        string    `json:"method"`
+	Route         string    `json:"route"`
+	Path          string    `json:"path"`
+	RequestDigest string    `json:"request_digest"`
+	TxHashes      []string  `json:"tx_hashes,omitempty"`
+	Status        int       `json:"status"`
+	Outcome       string    `json:"outcome"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// AuditOutcome returns the outcome of a response status.
+func AuditOutcome(status int) string {
+	switch {
+	case status < 400:
+		return AuditSuccess
+	case status < 500:
+		return AuditRejected
+	default:
+		return AuditError
+	}
+}
+
+// digest hashes the entry chained to its previous hash.
+func (e AuditEntry) digest() string {
+	e.Hash = ""
+	payload, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), payload...))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects entries. Zero fields match every entry.
+type AuditFilter struct {
+	Actor   string
+	Route   string
+	Outcome string
+	TxHash  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	switch {
+	case f.Actor != "" && entry.Actor != f.Actor:
+		return false
+	case f.Route != "" && entry.Route != f.Route:
+		return false
+	case f.Outcome != "" && entry.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Time.Before(f.Until):
+		return false
+	}
+	if f.TxHash == "" {
+		return true
+	}
+	for _, hash := range entry.TxHashes {
+		if hash == f.TxHash {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditVerification is the result of checking a log's hash chain. Head is the
+// hash of the last entry, which operators can record elsewhere to also detect
+// entries cut from the end.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AuditLog interface {
+	Append(entry AuditEntry) (res AuditEntry, err error)
+	Query(filter AuditFilter) (res []AuditEntry, err error)
+	Verify() (res AuditVerification, err error)
+}
+
+type auditLog struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+	seq   int64
+	head  string
+}
+
+// NewAuditLog opens the append only audit log at path, creating it when missing.
+//
+// Parameters:
+//   - path: The JSON lines file entries are appended to.
+//
+// Returns:
+//   - res: An AuditLog instance continuing the chain of the stored entries.
+//   - err: An error if the log could not be opened or read.
+func NewAuditLog(path string) (res AuditLog, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &auditLog{path: path, file: file, head: AuditGenesis}
+	err = scanAuditLog(path, func(entry AuditEntry) bool {
+		service.seq = entry.Seq
+		service.head = entry.Hash
+		return true
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return service, nil
+}
+
+// Append chains an entry to the log and writes it to disk before returning.
+// Seq, PrevHash and Hash are set by the log.
+func (a *auditLog) Append(entry AuditEntry) (res AuditEntry, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry.Seq = a.seq + 1
+	entry.Time = entry.Time.UTC()
+	entry.PrevHash = a.head
+	entry.Hash = entry.digest()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return res, err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return res, err
+	}
+	if err := a.file.Sync(); err != nil {
+		return res, err
+	}
+	a.seq = entry.Seq
+	a.head = entry.Hash
+	return entry, nil
+}
+
+// Query returns the entries matching filter, newest first.
+func (a *auditLog) Query(filter AuditFilter) (res []AuditEntry, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	res = []AuditEntry{}
+	err = scanAuditLog(a.path, func(entry AuditEntry) bool {
+		if filter.matches(entry) {
+			res = append(res, entry)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+
+// Verify checks the hash chain of the log.
+func (a *auditLog) Verify() (res AuditVerification, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return VerifyAuditLog(a.path)
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at path. It stops at
+// the first entry that was changed, removed, inserted or reordered.
+//
+// Parameters:
+//   - path: The audit log file.
+//
+// Returns:
+//   - res: Whether the chain holds, with the entry it breaks at otherwise.
+//   - err: An error if the file could not be read.
+func VerifyAuditLog(path string) (res AuditVerification, err error) {
+	res = AuditVerification{Valid: true, Head: AuditGenesis}
+	line := int64(0)
+	err = scanRawAuditLog(path, func(raw []byte) bool {
+		line++
+		var entry AuditEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			res.Valid, res.BrokenAt, res.Reason = false, line, "entry is not valid JSON"
+			return false
+		}
+		switch {
+		case entry.Seq != line:
+			res.Reason = fmt.Sprintf("expected entry %d, found %d", line, entry.Seq)
+		case entry.PrevHash != res.Head:
+			res.Reason = "previous hash does not match the entry before"
+		case entry.Hash != entry.digest():
+			res.Reason = "hash does not match the entry"
+		default:
+			res.Entries = line
+			res.Head = entry.Hash
+			return true
+		}
+		res.Valid, res.BrokenAt = false, line
+		return false
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return res, nil
+	}
+	return res, err
+}
+
+// scanAuditLog calls fn with every entry of the log until it returns false.
+func scanAuditLog(path string, fn func(entry AuditEntry) bool) error {
+	return scanRawAuditLog(path, func(raw []byte) bool {
+		var entry AuditEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return true
+		}
+		return fn(entry)
+	})
+}
+
+func scanRawAuditLog(path string, fn func(raw []byte) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if !fn(scanner.Bytes()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// AuditLogContains reports whether an entry with the hash is in the audit log
+// at path. A head recorded earlier that is missing means entries were cut.
+func AuditLogContains(path string, hash string) (bool, error) {
+	found := false
+	err := scanAuditLog(path, func(entry AuditEntry) bool {
+		found = entry.Hash == hash
+		return !found
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return found, err
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAuditLog(t *testing.T, path string) []AuditEntry {
+	audit, err := NewAuditLog(path)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{Time: start, ActorType: ActorAPIKey, Actor: "k1", Method: "POST", Route: "/api/game/store", Status: 201, TxHashes: []string{"0xaa"}},
+		{Time: start.Add(time.Minute), ActorType: ActorAddress, Actor: "0xAlice", Method: "GET", Route: "/api/stake/pay", Status: 200},
+		{Time: start.Add(2 * time.Minute), ActorType: ActorAPIKey, Actor: "k1", Method: "POST", Route: "/api/game/store", Status: 422},
+	}
+	res := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Outcome = AuditOutcome(entry.Status)
+		appended, err := audit.Append(entry)
+		require.NoError(t, err)
+		res = append(res, appended)
+	}
+	return res
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	entries := writeAuditLog(t, path)
+	assert.Equal(t, AuditGenesis, entries[0].PrevHash)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(t, int64(3), entries[2].Seq)
+
+	reopened, err := NewAuditLog(path)
+	require.NoError(t, err)
+	next, err := reopened.Append(AuditEntry{Time: time.Now(), Method: "DELETE", Route: "/api/admin/keys/:id", Status: 500})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), next.Seq)
+	assert.Equal(t, entries[2].Hash, next.PrevHash, "a reopened log continues the chain")
+
+	res, err := reopened.Verify()
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Equal(t, int64(4), res.Entries)
+	assert.Equal(t, next.Hash, res.Head)
+
+	found, err := reopened.Query(AuditFilter{Actor: "k1"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, int64(3), found[0].Seq, "newest first")
+
+	found, _ = reopened.Query(AuditFilter{Outcome: AuditRejected})
+	assert.Len(t, found, 1)
+	found, _ = reopened.Query(AuditFilter{TxHash: "0xaa"})
+	assert.Len(t, found, 1)
+	found, _ = reopened.Query(AuditFilter{Since: entries[1].Time, Until: entries[2].Time})
+	assert.Len(t, found, 1)
+	found, _ = reopened.Query(AuditFilter{Limit: 2})
+	assert.Len(t, found, 2)
+
+	contains, err := AuditLogContains(path, entries[1].Hash)
+	require.NoError(t, err)
+	assert.True(t, contains)
+}
+
+func TestVerifyAuditLogTampering(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(lines []string) []string
+		brokenAt int64
+	}{
+		{name: "Changed Entry", tamper: func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], "0xAlice", "0xMallory", 1)
+			return lines
+		}, brokenAt: 2},
+		{name: "Removed Entry", tamper: func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, brokenAt: 2},
+		{name: "Reordered Entries", tamper: func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, brokenAt: 2},
+		{name: "Rehashed Entry", tamper: func(lines []string) []string {
+			lines[0] = strings.Replace(lines[0], `"status":201`, `"status":500`, 1)
+			return lines
+		}, brokenAt: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeAuditLog(t, path)
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(content)), "\n"))
+			require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+			res, err := VerifyAuditLog(path)
+			require.NoError(t, err)
+			assert.False(t, res.Valid)
+			assert.Equal(t, tt.brokenAt, res.BrokenAt)
+			assert.Equal(t, tt.brokenAt-1, res.Entries)
+		})
+	}
+
+	res, err := VerifyAuditLog(filepath.Join(t.TempDir(), "missing.log"))
+	require.NoError(t, err)
+	assert.True(t, res.Valid, "an empty log verifies")
+}
@@ -66,6 +66,10 @@ func (g *gameHistory) StoreGameData(transactData *bind.TransactOpts, gid int, gt
 	transactData.GasLimit = uint64(3000000)
 	transactData.GasPrice = suggestedFee
 
+	lock := SignerLock(transactData.From)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// res, err = g.contract.StoreGameData(transactData, big.NewInt(int64(gid)), gtid, uid, data, big.NewInt(int64(time)))
 	res, err = g.contract.StoreGameData(transactData, big.NewInt(int64(gid)), gtid, uid, data, big.NewInt(int64(time)))
 	if err != nil {
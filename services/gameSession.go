@@ -0,0 +1,231 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// SessionClockSkew is how far a reported session time or duration may run
+// past what the server measured since the session started.
+const SessionClockSkew = 5 * time.Second
+
+// MinSessionDuration is the shortest a session may last, from its start to the
+// time it reports.
+const MinSessionDuration = time.Second
+
+var (
+	ErrSessionTokenInvalid  = errors.New("session token is invalid")
+	ErrSessionTokenExpired  = errors.New("session token expired")
+	ErrSessionTokenUsed     = errors.New("session token was already used")
+	ErrSessionTokenMismatch = errors.New("session token was issued for another game or player")
+	ErrSessionDuration      = errors.New("session does not fit the time since it started")
+)
+
+// GameSessionToken is a signed, single use proof that the server started a
+// game session for gid and uid at StartedAt.
+type GameSessionToken struct {
+	ID        string    `json:"id"`
+	Gid       int       `json:"gid"`
+	Uid       string    `json:"uid"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"token,omitempty"`
+}
+
+type GameSessionService interface {
+	Start(gid int, uid string) (res GameSessionToken, err error)
+	Redeem(token string, gid int, uid string, data string, at int) (res GameSessionToken, err error)
+	Release(id string)
+}
+
+type gameSessions struct {
+	path          string
+	secret        []byte
+	ttl           time.Duration
+	durationField string
+	mutex         sync.Mutex
+	used          map[string]time.Time
+}
+
+// NewGameSessionService loads the used session tokens stored at path.
+//
+// Parameters:
+//   - path: The file used tokens are persisted to, an empty path keeps them in memory.
+//   - secret: The HMAC key tokens are signed with. A random key is used when empty, so tokens do not survive a restart.
+//   - ttl: How long a session can run before its token expires.
+//   - durationField: The session data field holding the duration in seconds.
+//
+// Returns:
+//   - res: A GameSessionService instance.
+//   - err: An error if the used tokens could not be read.
+func NewGameSessionService(path string, secret string, ttl time.Duration, durationField string) (res GameSessionService, err error) {
+	service := &gameSessions{
+		path:          path,
+		secret:        []byte(secret),
+		ttl:           ttl,
+		durationField: durationField,
+		used:          make(map[string]time.Time),
+	}
+	if secret == "" {
+		service.secret = make([]byte, 32)
+		if _, err := rand.Read(service.secret); err != nil {
+			return nil, err
+		}
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.used); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// Start issues a token for a new session of gid played by uid.
+func (g *gameSessions) Start(gid int, uid string) (res GameSessionToken, err error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return res, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	res = GameSessionToken{
+		ID:        hex.EncodeToString(id),
+		Gid:       gid,
+		Uid:       uid,
+		StartedAt: now,
+		ExpiresAt: now.Add(g.ttl),
+	}
+
+	payload, err := json.Marshal(res)
+	if err != nil {
+		return res, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	res.Token = encoded + "." + base64.RawURLEncoding.EncodeToString(g.sign(encoded))
+	return res, nil
+}
+
+// Redeem checks a session token against the session it is used to store and
+// marks it used.
+//
+// The session time must fall between the start and now and be at least
+// MinSessionDuration after the start, whether or not the session data reports
+// a duration. A duration reported in the data must also be at least
+// MinSessionDuration and cannot be longer than the time from the start to the
+// session time.
+//
+// Parameters:
+//   - token: The token returned by Start.
+//   - gid, uid: The game and player of the session.
+//   - data: The session data.
+//   - at: The unix time the session reports, in seconds or milliseconds.
+//
+// Returns:
+//   - res: The claims of the token.
+//   - err: ErrSessionTokenInvalid, ErrSessionTokenExpired, ErrSessionTokenMismatch,
+//     ErrSessionTokenUsed, an error wrapping ErrSessionDuration or a storage error.
+func (g *gameSessions) Redeem(token string, gid int, uid string, data string, at int) (res GameSessionToken, err error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return res, ErrSessionTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, g.sign(encoded)) {
+		return res, ErrSessionTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return res, ErrSessionTokenInvalid
+	}
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return res, ErrSessionTokenInvalid
+	}
+
+	now := time.Now()
+	if now.After(res.ExpiresAt) {
+		return res, ErrSessionTokenExpired
+	}
+	if res.Gid != gid || res.Uid != uid {
+		return res, ErrSessionTokenMismatch
+	}
+	reported := SessionTime(big.NewInt(int64(at)))
+	if reported.Before(res.StartedAt.Add(-SessionClockSkew)) || reported.After(now.Add(SessionClockSkew)) {
+		return res, fmt.Errorf("%w: time %d is outside %s to %s", ErrSessionDuration, at, res.StartedAt.Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	}
+	// The server measures the duration itself, so leaving the duration field
+	// out of the data does not skip the bound.
+	if measured := reported.Sub(res.StartedAt); measured < MinSessionDuration {
+		return res, fmt.Errorf("%w: the session ended %s after it started, sessions last at least %s", ErrSessionDuration, measured, MinSessionDuration)
+	}
+	if seconds, err := ExtractScore(data, g.durationField); err == nil {
+		// A session cannot have lasted longer than the time from its start
+		// to the end it reports.
+		end := reported
+		if end.After(now) {
+			end = now
+		}
+		elapsed := end.Sub(res.StartedAt)
+		duration := time.Duration(seconds * float64(time.Second))
+		if duration < MinSessionDuration {
+			return res, fmt.Errorf("%w: reported %gs, sessions last at least %s", ErrSessionDuration, seconds, MinSessionDuration)
+		}
+		if duration > elapsed+SessionClockSkew {
+			return res, fmt.Errorf("%w: reported %gs but the session started %s before it ended", ErrSessionDuration, seconds, elapsed.Truncate(time.Second))
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, used := g.used[res.ID]; used {
+		return res, ErrSessionTokenUsed
+	}
+	for id, expiresAt := range g.used {
+		if now.After(expiresAt) {
+			delete(g.used, id)
+		}
+	}
+	g.used[res.ID] = res.ExpiresAt
+	if err := g.save(); err != nil {
+		delete(g.used, res.ID)
+		return res, err
+	}
+	return res, nil
+}
+
+// Release lets a redeemed token be used again, for when storing its session failed.
+func (g *gameSessions) Release(id string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, used := g.used[id]; !used {
+		return
+	}
+	delete(g.used, id)
+	_ = g.save()
+}
+
+func (g *gameSessions) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// save writes the used tokens to disk. The caller holds the lock.
+func (g *gameSessions) save() error {
+	if g.path == "" {
+		return nil
+	}
+	return utils.SaveJSON(g.path, g.used)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameSessionToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session_tokens.json")
+	service, err := NewGameSessionService(path, "secret", time.Hour, "duration")
+	require.NoError(t, err)
+	now := int(time.Now().Unix())
+
+	started, err := service.Start(1, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, started.StartedAt.Add(time.Hour), started.ExpiresAt)
+	// end is when the sessions report they ended, the minimum duration after
+	// their start and within the clock skew.
+	end := int(started.StartedAt.Add(MinSessionDuration).Unix())
+
+	_, err = service.Redeem("garbage", 1, "alice", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenInvalid)
+	payload, signature, _ := strings.Cut(started.Token, ".")
+	_, err = service.Redeem(payload+"x."+signature, 1, "alice", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenInvalid, "the payload cannot be edited")
+	other, _ := NewGameSessionService("", "other secret", time.Hour, "duration")
+	_, err = other.Redeem(started.Token, 1, "alice", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenInvalid)
+
+	_, err = service.Redeem(started.Token, 2, "alice", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenMismatch)
+	_, err = service.Redeem(started.Token, 1, "bob", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenMismatch)
+	_, err = service.Redeem(started.Token, 1, "alice", `{}`, now-3600)
+	assert.ErrorIs(t, err, ErrSessionDuration, "sessions cannot predate their start")
+	_, err = service.Redeem(started.Token, 1, "alice", `{"duration":600}`, now)
+	assert.ErrorIs(t, err, ErrSessionDuration, "a ten minute session cannot end right after it started")
+	_, err = service.Redeem(started.Token, 1, "alice", `{"duration":0}`, end)
+	assert.ErrorIs(t, err, ErrSessionDuration, "sessions last at least MinSessionDuration")
+	_, err = service.Redeem(started.Token, 1, "alice", `{}`, int(started.StartedAt.Unix()))
+	assert.ErrorIs(t, err, ErrSessionDuration, "the server measures the duration without the field")
+	_, err = service.Redeem(started.Token, 1, "alice", `{"duration":1}`, int(started.StartedAt.Unix()))
+	assert.ErrorIs(t, err, ErrSessionDuration, "the reported duration does not replace the measured one")
+
+	claims, err := service.Redeem(started.Token, 1, "alice", `{"duration":1}`, end)
+	assert.NoError(t, err)
+	assert.Equal(t, started.ID, claims.ID)
+	_, err = service.Redeem(started.Token, 1, "alice", `{"duration":1}`, end)
+	assert.ErrorIs(t, err, ErrSessionTokenUsed)
+
+	service.Release(claims.ID)
+	_, err = service.Redeem(started.Token, 1, "alice", `{"duration":1}`, end*1000)
+	assert.NoError(t, err, "a released token can be used again, with the time in milliseconds")
+
+	reloaded, err := NewGameSessionService(path, "secret", time.Hour, "duration")
+	require.NoError(t, err)
+	_, err = reloaded.Redeem(started.Token, 1, "alice", `{"duration":1}`, end)
+	assert.ErrorIs(t, err, ErrSessionTokenUsed, "used tokens survive a restart")
+
+	expiring, _ := NewGameSessionService("", "secret", -time.Second, "duration")
+	started, _ = expiring.Start(1, "alice")
+	_, err = expiring.Redeem(started.Token, 1, "alice", `{}`, now)
+	assert.ErrorIs(t, err, ErrSessionTokenExpired)
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// ErrGameTypeNotFound is returned when no game type is registered for a session.
+var ErrGameTypeNotFound = errors.New("game type not found")
+
+// GameType describes the session data a game submits.
+//
+// A game type with an empty Gtid applies to every gtid of the game that has
+// no game type of its own.
+type GameType struct {
+	Gid         int             `json:"gid" binding:"required"`
+	Gtid        string          `json:"gtid"`
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" binding:"required" swaggertype:"object"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ValidationError is returned when session data does not match its game type.
+type ValidationError struct {
+	Gid    int
+	Gtid   string
+	Fields []utils.FieldError
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("session data does not match the schema of game %d type %q", v.Gid, v.Gtid)
+}
+
+type GameTypeRegistry interface {
+	List() []GameType
+	Get(gid int, gtid string) (GameType, bool)
+	Put(gameType GameType) (GameType, error)
+	Delete(gid int, gtid string) (bool, error)
+	Validate(gid int, gtid string, data string) error
+}
+
+type gameTypeRegistry struct {
+	path     string
+	required bool
+	mutex    sync.RWMutex
+	types    map[string]GameType
+	schemas  map[string]*utils.JSONSchema
+}
+
+// NewGameTypeRegistry loads the game type registry stored at path.
+//
+// Parameters:
+//   - path: The file the registry is persisted to, an empty path keeps it in memory.
+//   - required: Reject sessions of games without a registered game type.
+//
+// Returns:
+//   - res: A GameTypeRegistry instance.
+//   - err: An error if the stored registry could not be read or holds an invalid schema.
+func NewGameTypeRegistry(path string, required bool) (res GameTypeRegistry, err error) {
+	registry := &gameTypeRegistry{
+		path:     path,
+		required: required,
+		types:    make(map[string]GameType),
+		schemas:  make(map[string]*utils.JSONSchema),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &registry.types); err != nil {
+			return nil, err
+		}
+	}
+	for key, gameType := range registry.types {
+		schema, err := utils.CompileJSONSchema(gameType.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("game type %s: %w", key, err)
+		}
+		registry.schemas[key] = schema
+	}
+	return registry, nil
+}
+
+func gameTypeKey(gid int, gtid string) string {
+	return fmt.Sprintf("%d|%s", gid, gtid)
+}
+
+// List returns every registered game type ordered by gid and gtid.
+func (r *gameTypeRegistry) List() []GameType {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]GameType, 0, len(r.types))
+	for _, gameType := range r.types {
+		res = append(res, gameType)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Gid != res[j].Gid {
+			return res[i].Gid < res[j].Gid
+		}
+		return res[i].Gtid < res[j].Gtid
+	})
+	return res
+}
+
+// Get returns the game type registered for exactly gid and gtid.
+func (r *gameTypeRegistry) Get(gid int, gtid string) (GameType, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	gameType, found := r.types[gameTypeKey(gid, gtid)]
+	return gameType, found
+}
+
+// Put registers or replaces a game type after checking its schema compiles.
+//
+// Parameters:
+//   - gameType: The game type to store.
+//
+// Returns:
+//   - res: The stored game type with its timestamps set.
+//   - err: An error if the schema is invalid or the registry could not be saved.
+func (r *gameTypeRegistry) Put(gameType GameType) (res GameType, err error) {
+	schema, err := utils.CompileJSONSchema(gameType.Schema)
+	if err != nil {
+		return res, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := gameTypeKey(gameType.Gid, gameType.Gtid)
+	previous, existed := r.types[key]
+	now := time.Now().UTC()
+	gameType.CreatedAt = now
+	if existed {
+		gameType.CreatedAt = previous.CreatedAt
+	}
+	gameType.UpdatedAt = now
+
+	r.types[key] = gameType
+	if err := r.save(); err != nil {
+		if existed {
+			r.types[key] = previous
+		} else {
+			delete(r.types, key)
+		}
+		return res, err
+	}
+	r.schemas[key] = schema
+	return gameType, nil
+}
+
+// Delete removes the game type registered for exactly gid and gtid.
+func (r *gameTypeRegistry) Delete(gid int, gtid string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := gameTypeKey(gid, gtid)
+	previous, found := r.types[key]
+	if !found {
+		return false, nil
+	}
+	delete(r.types, key)
+	if err := r.save(); err != nil {
+		r.types[key] = previous
+		return false, err
+	}
+	delete(r.schemas, key)
+	return true, nil
+}
+
+// Validate checks session data against the schema of its game type.
+//
+// The game type registered for the gtid is used, falling back to the game
+// wide type. Sessions without any game type pass unless the registry was
+// created with required set.
+//
+// Returns:
+//   - err: A *ValidationError listing the failing fields, ErrGameTypeNotFound, or nil.
+func (r *gameTypeRegistry) Validate(gid int, gtid string, data string) error {
+	r.mutex.RLock()
+	schema, found := r.schemas[gameTypeKey(gid, gtid)]
+	if !found {
+		schema, found = r.schemas[gameTypeKey(gid, "")]
+	}
+	r.mutex.RUnlock()
+
+	if !found {
+		if r.required {
+			return fmt.Errorf("%w: game %d type %q", ErrGameTypeNotFound, gid, gtid)
+		}
+		return nil
+	}
+
+	if fields := schema.ValidateJSON(data); len(fields) > 0 {
+		return &ValidationError{Gid: gid, Gtid: gtid, Fields: fields}
+	}
+	return nil
+}
+
+func (r *gameTypeRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	return utils.SaveJSON(r.path, r.types)
+}
+
+type validatingGameHistory struct {
+	GameHistoryContract
+	registry GameTypeRegistry
+}
+
+// NewValidatingGameHistory wraps a GameHistoryContract so StoreGameData checks
+// session data against the game type registry before any transaction is sent.
+func NewValidatingGameHistory(contract GameHistoryContract, registry GameTypeRegistry) GameHistoryContract {
+	return &validatingGameHistory{
+		GameHistoryContract: contract,
+		registry:            registry,
+	}
+}
+
+// StoreGameData validates the session data and stores it when it conforms.
+func (v *validatingGameHistory) StoreGameData(transactData *bind.TransactOpts, gid int, gtid string, uid string, data string, time int) (res *types.Transaction, err error) {
+	if err := v.registry.Validate(gid, gtid, data); err != nil {
+		return nil, err
+	}
+	return v.GameHistoryContract.StoreGameData(transactData, gid, gtid, uid, data, time)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGameTypeRegistryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game_types.json")
+	registry, err := NewGameTypeRegistry(path, false)
+	assert.NoError(t, err)
+
+	_, err = registry.Put(GameType{Gid: 1, Name: "bad", Schema: json.RawMessage(`{"type":"text"}`)})
+	assert.Error(t, err, "invalid schemas should be rejected")
+
+	stored, err := registry.Put(GameType{Gid: 1, Name: "runner", Schema: json.RawMessage(`{"type":"object","required":["score"]}`)})
+	assert.NoError(t, err)
+	assert.False(t, stored.CreatedAt.IsZero())
+
+	reloaded, err := NewGameTypeRegistry(path, false)
+	assert.NoError(t, err)
+	gameType, found := reloaded.Get(1, "")
+	assert.True(t, found)
+	assert.Equal(t, "runner", gameType.Name)
+	assert.Len(t, reloaded.List(), 1)
+
+	deleted, err := reloaded.Delete(1, "")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = reloaded.Delete(1, "")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestGameTypeRegistryValidate(t *testing.T) {
+	registry, _ := NewGameTypeRegistry("", false)
+	registry.Put(GameType{Gid: 1, Name: "game", Schema: json.RawMessage(`{"type":"object","required":["score"]}`)})
+	registry.Put(GameType{Gid: 1, Gtid: "timed", Name: "timed", Schema: json.RawMessage(`{"type":"object","required":["ms"]}`)})
+
+	assert.NoError(t, registry.Validate(1, "classic", `{"score":1}`))
+	assert.NoError(t, registry.Validate(1, "timed", `{"ms":1}`))
+	assert.NoError(t, registry.Validate(2, "any", `not json`), "unregistered games pass by default")
+
+	var invalid *ValidationError
+	err := registry.Validate(1, "timed", `{"score":1}`)
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "ms", invalid.Fields[0].Field)
+
+	strict, _ := NewGameTypeRegistry("", true)
+	assert.True(t, errors.Is(strict.Validate(2, "any", `{}`), ErrGameTypeNotFound))
+}
+
+func TestValidatingGameHistory(t *testing.T) {
+	history := &fakeGameHistory{}
+	registry, _ := NewGameTypeRegistry("", false)
+	registry.Put(GameType{Gid: 1, Name: "game", Schema: json.RawMessage(`{"type":"object","required":["score"]}`)})
+	contract := NewValidatingGameHistory(history, registry)
+
+	_, err := contract.StoreGameData(nil, 1, "t", "alice", `{"points":1}`, 1)
+	assert.Error(t, err)
+	assert.Empty(t, history.sessions, "no transaction should be sent for invalid data")
+
+	_, err = contract.StoreGameData(nil, 1, "t", "alice", `{"score":1}`, 1)
+	assert.NoError(t, err)
+	assert.Len(t, history.sessions, 1)
+}
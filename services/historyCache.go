@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// History cache defaults.
+const (
+	// DefaultHistoryTTL is how long a history is served without reading the contract.
+	DefaultHistoryTTL = 6 * time.Minute
+	// DefaultHistoryGrace is how long a stale history is still served while it is refreshed.
+	DefaultHistoryGrace = 2 * time.Minute
+	// DefaultHistoryReadTimeout bounds one contract read.
+	DefaultHistoryReadTimeout = 30 * time.Second
+)
+
+// Namespaces of the histories in the cache backend.
+const (
+	gamesNamespace = "games"
+	usersNamespace = "users"
+)
+
+// maxRefreshStates is how many refresh records are kept before the records of
+// expired histories are dropped.
+const maxRefreshStates = 10000
+
+// HistoryCacheOptions configures a GameHistoryCache.
+type HistoryCacheOptions struct {
+	// TTL is how long a history is fresh, DefaultHistoryTTL when zero.
+	TTL time.Duration
+	// Grace is how long a history is still served once stale while one
+	// background read refreshes it, DefaultHistoryGrace when zero.
+	Grace time.Duration
+	// ReadTimeout bounds a contract read, DefaultHistoryReadTimeout when zero.
+	ReadTimeout time.Duration
+}
+
+// CachedHistory is a history held by the GameHistoryCache, newest session
+// first.
+type CachedHistory struct {
+	Sessions   []storage.GameHistoryGameSession `json:"sessions"`
+	FreshUntil time.Time                        `json:"fresh_until"`
+}
+
+// RefreshState is the read bookkeeping of one cached history, such as
+// "games:7" or "users:alice".
+type RefreshState struct {
+	Key        string     `json:"key"`
+	Refreshing bool       `json:"refreshing"`
+	Reads      uint64     `json:"reads"`
+	Coalesced  uint64     `json:"coalesced"`
+	StaleHits  uint64     `json:"stale_hits"`
+	Failures   uint64     `json:"failures"`
+	Discarded  uint64     `json:"discarded"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+
+	generation uint64
+}
+
+// GameHistoryCache is a GameHistoryContract whose game and user histories are
+// cached and sorted newest first.
+type GameHistoryCache interface {
+	GameHistoryContract
+	Settled(session storage.GameHistoryGameSession, mined bool)
+	Refreshes() []RefreshState
+}
+
+type historyCache struct {
+	GameHistoryContract
+	games   *utils.Cache[utils.Gid, CachedHistory]
+	users   *utils.Cache[utils.Uid, CachedHistory]
+	options HistoryCacheOptions
+	flight  singleflight.Group
+	mutex   sync.Mutex
+	states  map[string]*RefreshState
+}
+
+// NewGameHistoryCache wraps a GameHistoryContract so GetGameData and
+// GetUserGameData are served from a cache.
+//
+// Concurrent misses of a history share one contract read. Once a history is
+// stale it is still served for the grace period while a single background
+// read refreshes it.
+//
+// Parameters:
+//   - contract: The GameHistoryContract histories are read from.
+//   - backend: The cache backend holding the "games" and "users" namespaces.
+//   - options: The freshness, grace period and read timeout.
+//
+// Returns:
+//   - res: A GameHistoryCache instance.
+func NewGameHistoryCache(contract GameHistoryContract, backend utils.CacheBackend, options HistoryCacheOptions) GameHistoryCache {
+	if options.TTL <= 0 {
+		options.TTL = DefaultHistoryTTL
+	}
+	if options.Grace <= 0 {
+		options.Grace = DefaultHistoryGrace
+	}
+	if options.ReadTimeout <= 0 {
+		options.ReadTimeout = DefaultHistoryReadTimeout
+	}
+	return &historyCache{
+		GameHistoryContract: contract,
+		games:               utils.NewNamespace[utils.Gid, CachedHistory](backend, gamesNamespace),
+		users:               utils.NewNamespace[utils.Uid, CachedHistory](backend, usersNamespace),
+		options:             options,
+		states:              make(map[string]*RefreshState),
+	}
+}
+
+// GetGameData returns the sessions of a game, newest first.
+func (h *historyCache) GetGameData(callData *bind.CallOpts, gid int) (res []storage.GameHistoryGameSession, err error) {
+	return loadHistory(h, h.games, gamesNamespace, utils.Gid(gid), callData, func(opts *bind.CallOpts) ([]storage.GameHistoryGameSession, error) {
+		return h.GameHistoryContract.GetGameData(opts, gid)
+	})
+}
+
+// GetUserGameData returns the sessions of a player, newest first.
+func (h *historyCache) GetUserGameData(callData *bind.CallOpts, uid string) (res []storage.GameHistoryGameSession, err error) {
+	return loadHistory(h, h.users, usersNamespace, utils.Uid(uid), callData, func(opts *bind.CallOpts) ([]storage.GameHistoryGameSession, error) {
+		return h.GameHistoryContract.GetUserGameData(opts, uid)
+	})
+}
+
+// Settled writes a mined session through to the cached histories of its game
+// and player. A transaction that was not mined may still be mined later, so
+// those histories are dropped instead. Reads in flight when a session settles
+// are not cached, as they may predate it.
+//
+// It is meant to be registered with PendingSessionService.OnSettled.
+func (h *historyCache) Settled(session storage.GameHistoryGameSession, mined bool) {
+	if mined {
+		addSession(h, h.games, gamesNamespace, utils.Gid(session.Gid.Int64()), session)
+		addSession(h, h.users, usersNamespace, utils.Uid(session.Uid), session)
+		return
+	}
+	h.invalidate(historyKey(gamesNamespace, session.Gid.Int64()))
+	h.games.Delete(utils.Gid(session.Gid.Int64()))
+	h.invalidate(historyKey(usersNamespace, session.Uid))
+	h.users.Delete(utils.Uid(session.Uid))
+}
+
+// Refreshes returns the read bookkeeping of every history, sorted by key.
+func (h *historyCache) Refreshes() []RefreshState {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	res := make([]RefreshState, 0, len(h.states))
+	for _, state := range h.states {
+		res = append(res, *state)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+// loadHistory serves a history from the cache, reading the contract on a miss
+// and refreshing it in the background once stale.
+func loadHistory[K utils.CacheKey](h *historyCache, cache *utils.Cache[K, CachedHistory], namespace string, key K, callData *bind.CallOpts, read func(opts *bind.CallOpts) ([]storage.GameHistoryGameSession, error)) ([]storage.GameHistoryGameSession, error) {
+	name := historyKey(namespace, key)
+	reload := func() (interface{}, error) {
+		return h.reload(name, callData, read, func(history CachedHistory) {
+			cache.Set(key, history, h.options.TTL+h.options.Grace)
+		})
+	}
+
+	if cached, found := cache.Get(key); found {
+		if time.Now().Before(cached.FreshUntil) {
+			return cached.Sessions, nil
+		}
+		h.update(name, func(state *RefreshState) { state.StaleHits++ })
+		h.flight.DoChan(name, reload)
+		return cached.Sessions, nil
+	}
+
+	led := false
+	res, err, _ := h.flight.Do(name, func() (interface{}, error) {
+		led = true
+		return reload()
+	})
+	if !led {
+		h.update(name, func(state *RefreshState) { state.Coalesced++ })
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.([]storage.GameHistoryGameSession), nil
+}
+
+// addSession adds a mined session to a cached history, unless the history
+// was read after the session was mined and already holds it.
+func addSession[K utils.CacheKey](h *historyCache, cache *utils.Cache[K, CachedHistory], namespace string, key K, session storage.GameHistoryGameSession) {
+	h.invalidate(historyKey(namespace, key))
+	cached, found := cache.Get(key)
+	if !found {
+		return
+	}
+
+	fingerprint := SessionFingerprint(session)
+	for _, stored := range cached.Sessions {
+		if SessionFingerprint(stored) == fingerprint {
+			return
+		}
+	}
+	sessions := append([]storage.GameHistoryGameSession{session}, cached.Sessions...)
+	SessionsNewestFirst.Sort(sessions)
+	cache.Set(key, CachedHistory{Sessions: sessions, FreshUntil: cached.FreshUntil}, time.Until(cached.FreshUntil)+h.options.Grace)
+}
+
+// reload reads a history from the contract and stores it, unless a session
+// settled during the read.
+func (h *historyCache) reload(name string, callData *bind.CallOpts, read func(opts *bind.CallOpts) ([]storage.GameHistoryGameSession, error), store func(history CachedHistory)) ([]storage.GameHistoryGameSession, error) {
+	generation := h.start(name)
+
+	// The read is shared by every waiting request, so it does not stop when
+	// the request that started it is cancelled.
+	opts := bind.CallOpts{}
+	if callData != nil {
+		opts = *callData
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.ReadTimeout)
+	defer cancel()
+	opts.Context = ctx
+
+	sessions, err := read(&opts)
+	if err == nil {
+		sessions = append([]storage.GameHistoryGameSession(nil), sessions...)
+		SessionsNewestFirst.Sort(sessions)
+	}
+	if h.finish(name, generation, err) {
+		store(CachedHistory{Sessions: sessions, FreshUntil: time.Now().Add(h.options.TTL)})
+	}
+	return sessions, err
+}
+
+// start records the start of a read and returns the generation it reads.
+func (h *historyCache) start(name string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.states) >= maxRefreshStates {
+		h.prune()
+	}
+	state := h.state(name)
+	now := time.Now().UTC()
+	state.Refreshing = true
+	state.Reads++
+	state.StartedAt = &now
+	return state.generation
+}
+
+// finish records the end of a read and reports whether its result can be
+// cached.
+func (h *historyCache) finish(name string, generation uint64, err error) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state := h.state(name)
+	now := time.Now().UTC()
+	state.Refreshing = false
+	state.FinishedAt = &now
+	state.LastError = ""
+	if err != nil {
+		state.Failures++
+		state.LastError = err.Error()
+		return false
+	}
+	if state.generation != generation {
+		state.Discarded++
+		return false
+	}
+	return true
+}
+
+// invalidate stops the reads in flight for a history from being cached.
+func (h *historyCache) invalidate(name string) {
+	h.update(name, func(state *RefreshState) { state.generation++ })
+}
+
+func (h *historyCache) update(name string, change func(state *RefreshState)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	change(h.state(name))
+}
+
+// state returns the record of a history. The caller holds the lock.
+func (h *historyCache) state(name string) *RefreshState {
+	state, found := h.states[name]
+	if !found {
+		state = &RefreshState{Key: name}
+		h.states[name] = state
+	}
+	return state
+}
+
+// prune drops the records of histories not read within the cache lifetime.
+// The caller holds the lock.
+func (h *historyCache) prune() {
+	cutoff := time.Now().Add(-h.options.TTL - h.options.Grace)
+	for name, state := range h.states {
+		if !state.Refreshing && (state.FinishedAt == nil || state.FinishedAt.Before(cutoff)) {
+			delete(h.states, name)
+		}
+	}
+}
+
+func historyKey(namespace string, key interface{}) string {
+	return fmt.Sprintf("%s:%v", namespace, key)
+}
+
+// SessionsNewestFirst orders sessions by descending time.
+var SessionsNewestFirst = utils.ByBig(func(session storage.GameHistoryGameSession) *big.Int {
+	return session.Time
+}).Reverse()
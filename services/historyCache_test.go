@@ -0,0 +1,143 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedHistory counts the reads of a fakeGameHistory and holds them until
+// the gate is opened.
+type gatedHistory struct {
+	fakeGameHistory
+	gate  chan struct{}
+	reads atomic.Int32
+}
+
+func newGatedHistory(sessions ...storage.GameHistoryGameSession) *gatedHistory {
+	gate := make(chan struct{})
+	close(gate)
+	return &gatedHistory{fakeGameHistory: fakeGameHistory{sessions: sessions}, gate: gate}
+}
+
+func (g *gatedHistory) GetGameData(callData *bind.CallOpts, gid int) ([]storage.GameHistoryGameSession, error) {
+	g.reads.Add(1)
+	<-g.gate
+	return g.fakeGameHistory.GetGameData(callData, gid)
+}
+
+func refreshOf(t *testing.T, cache GameHistoryCache, key string) RefreshState {
+	for _, state := range cache.Refreshes() {
+		if state.Key == key {
+			return state
+		}
+	}
+	t.Fatalf("no refresh recorded for %s", key)
+	return RefreshState{}
+}
+
+func TestHistoryCacheCoalescesMisses(t *testing.T) {
+	history := newGatedHistory(session(1, "a", "alice", "{}", 10), session(1, "b", "bob", "{}", 20))
+	history.gate = make(chan struct{})
+	cache := NewGameHistoryCache(history, utils.NewCache(), HistoryCacheOptions{})
+
+	var wg sync.WaitGroup
+	results := make([][]storage.GameHistoryGameSession, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.GetGameData(nil, 1)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(history.gate)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), history.reads.Load())
+	for _, res := range results {
+		require.Len(t, res, 2)
+		assert.Equal(t, "bob", res[0].Uid, "sessions are sorted newest first")
+	}
+	state := refreshOf(t, cache, "games:1")
+	assert.Equal(t, uint64(1), state.Reads)
+	assert.Equal(t, uint64(9), state.Coalesced)
+	assert.False(t, state.Refreshing)
+}
+
+func TestHistoryCacheServesStaleWhileRefreshing(t *testing.T) {
+	history := newGatedHistory(session(1, "a", "alice", "{}", 10))
+	cache := NewGameHistoryCache(history, utils.NewCache(), HistoryCacheOptions{TTL: 20 * time.Millisecond, Grace: time.Hour})
+
+	res, err := cache.GetGameData(nil, 1)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+
+	history.sessions = append(history.sessions, session(1, "b", "bob", "{}", 20))
+	history.gate = make(chan struct{})
+	time.Sleep(30 * time.Millisecond)
+
+	res, err = cache.GetGameData(nil, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1, "the stale history is served without waiting")
+	require.Eventually(t, func() bool { return refreshOf(t, cache, "games:1").Refreshing }, time.Second, time.Millisecond)
+
+	res, _ = cache.GetGameData(nil, 1)
+	assert.Len(t, res, 1)
+	close(history.gate)
+
+	require.Eventually(t, func() bool {
+		res, _ := cache.GetGameData(nil, 1)
+		return len(res) == 2
+	}, time.Second, 5*time.Millisecond)
+	state := refreshOf(t, cache, "games:1")
+	assert.Equal(t, uint64(2), state.StaleHits)
+	assert.Equal(t, int32(2), history.reads.Load(), "one background read refreshes the history")
+}
+
+func TestHistoryCacheSettled(t *testing.T) {
+	older := session(7, "a", "alice", "{}", 10)
+	newer := session(7, "b", "alice", "{}", 20)
+	history := newGatedHistory(older)
+	cache := NewGameHistoryCache(history, utils.NewCache(), HistoryCacheOptions{})
+
+	_, err := cache.GetGameData(nil, 7)
+	require.NoError(t, err)
+
+	cache.Settled(newer, true)
+	cache.Settled(newer, true)
+	res, _ := cache.GetGameData(nil, 7)
+	assert.Equal(t, []storage.GameHistoryGameSession{newer, older}, res)
+	assert.Equal(t, int32(1), history.reads.Load(), "mined sessions are written through")
+
+	cache.Settled(newer, false)
+	_, _ = cache.GetGameData(nil, 7)
+	assert.Equal(t, int32(2), history.reads.Load(), "sessions given up on drop the history")
+}
+
+func TestHistoryCacheDiscardsReadsOverlappingSettled(t *testing.T) {
+	history := newGatedHistory(session(7, "a", "alice", "{}", 10))
+	history.gate = make(chan struct{})
+	cache := NewGameHistoryCache(history, utils.NewCache(), HistoryCacheOptions{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cache.GetGameData(nil, 7)
+	}()
+	require.Eventually(t, func() bool { return history.reads.Load() == 1 }, time.Second, time.Millisecond)
+	cache.Settled(session(7, "b", "alice", "{}", 20), true)
+	close(history.gate)
+	<-done
+
+	assert.Equal(t, uint64(1), refreshOf(t, cache, "games:7").Discarded)
+	_, _ = cache.GetGameData(nil, 7)
+	assert.Equal(t, int32(2), history.reads.Load(), "a read that may predate the session is not cached")
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+// ScoreRule describes how a game's sessions are scored.
+//
+// Field is a dot separated path into the JSON session data, eg "result.points".
+// Ascending games rank the lowest score first, which suits time based games.
+type ScoreRule struct {
+	Field     string
+	Ascending bool
+}
+
+// LeaderboardEntry is the best result of one player on a leaderboard.
+type LeaderboardEntry struct {
+	Rank  int      `json:"rank"`
+	Uid   string   `json:"uid"`
+	Score float64  `json:"score"`
+	Time  *big.Int `json:"time"`
+}
+
+type LeaderboardService interface {
+	Leaderboard(callData *bind.CallOpts, gid int) (res []LeaderboardEntry, err error)
+	PlayerRank(callData *bind.CallOpts, gid int, uid string, neighbors int) (res PlayerRank, found bool, err error)
+	WindowLeaderboard(callData *bind.CallOpts, gid int, window LeaderboardWindow) (res []LeaderboardEntry, err error)
+	ArchiveClosed(callData *bind.CallOpts, gid int, now time.Time, grace time.Duration) error
+	Archived(gid int) []ArchivedLeaderboard
+	Calendar() *LeaderboardCalendar
+	Rule(gid int) ScoreRule
+	Invalidate(gid int)
+}
+
+type leaderboard struct {
+	history     GameHistoryContract
+	rules       map[int]ScoreRule
+	defaultRule ScoreRule
+	calendar    *LeaderboardCalendar
+	archive     *LeaderboardArchive
+	mutex       sync.Mutex
+	indexes     map[int]*LeaderboardIndex
+}
+
+// NewLeaderboardService creates a new LeaderboardService reading sessions from the game history contract.
+//
+// Parameters:
+//   - history: The GameHistoryContract sessions are read from.
+//   - rules: Score rules keyed by game id.
+//   - defaultRule: The rule for games without an entry in rules.
+//   - calendar: The calendar windows are computed with.
+//   - archive: Where the rankings of closed windows are kept.
+//
+// Returns:
+//
+//	A LeaderboardService instance.
+func NewLeaderboardService(history GameHistoryContract, rules map[int]ScoreRule, defaultRule ScoreRule, calendar *LeaderboardCalendar, archive *LeaderboardArchive) LeaderboardService {
+	return &leaderboard{
+		history:     history,
+		rules:       rules,
+		defaultRule: defaultRule,
+		calendar:    calendar,
+		archive:     archive,
+		indexes:     make(map[int]*LeaderboardIndex),
+	}
+}
+
+// Calendar returns the calendar windows are computed with.
+func (l *leaderboard) Calendar() *LeaderboardCalendar {
+	return l.calendar
+}
+
+// Rule returns the score rule for a game.
+func (l *leaderboard) Rule(gid int) ScoreRule {
+	if rule, ok := l.rules[gid]; ok {
+		return rule
+	}
+	return l.defaultRule
+}
+
+// Leaderboard ranks the players of a game by their best score.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - gid: The game ID to rank.
+//
+// Returns:
+//   - res: The ranked entries, best first.
+//   - err: Any error that occurred while reading the game history.
+func (l *leaderboard) Leaderboard(callData *bind.CallOpts, gid int) (res []LeaderboardEntry, err error) {
+	index, err := l.index(callData, gid)
+	if err != nil {
+		return nil, err
+	}
+	return index.Range(1, index.Len()), nil
+}
+
+// PlayerRank looks up a player's all time rank with the entries around them.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - gid: The game ID.
+//   - uid: The player to look up.
+//   - neighbors: How many entries to return above and below the player.
+//
+// Returns:
+//   - res: The player's rank.
+//   - found: False when the player has no ranked session in the game.
+//   - err: Any error that occurred while reading the game history.
+func (l *leaderboard) PlayerRank(callData *bind.CallOpts, gid int, uid string, neighbors int) (res PlayerRank, found bool, err error) {
+	index, err := l.index(callData, gid)
+	if err != nil {
+		return res, false, err
+	}
+	res, found = index.Player(uid, neighbors)
+	return res, found, nil
+}
+
+// index returns the game's ranking index brought up to date with the contract.
+func (l *leaderboard) index(callData *bind.CallOpts, gid int) (*LeaderboardIndex, error) {
+	sessions, err := l.history.GetGameData(callData, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	index, ok := l.indexes[gid]
+	if !ok {
+		index = NewLeaderboardIndex(l.Rule(gid))
+		l.indexes[gid] = index
+	}
+	l.mutex.Unlock()
+
+	index.Update(sessions)
+	return index, nil
+}
+
+// Invalidate drops the ranking index of a game so the next read rebuilds it,
+// for when sessions already ranked are excluded or let back in.
+func (l *leaderboard) Invalidate(gid int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.indexes, gid)
+}
+
+// WindowLeaderboard ranks the players of a game over a window.
+//
+// Closed windows are served from the archive once the archiver has stored
+// them, until then they are ranked like open ones.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - gid: The game ID to rank.
+//   - window: The window sessions must fall in.
+//
+// Returns:
+//   - res: The ranked entries, best first.
+//   - err: Any error that occurred while reading the game history.
+func (l *leaderboard) WindowLeaderboard(callData *bind.CallOpts, gid int, window LeaderboardWindow) (res []LeaderboardEntry, err error) {
+	if board, found := l.archive.Get(gid, window.Key); found {
+		return board.Entries, nil
+	}
+
+	sessions, err := l.history.GetGameData(callData, gid)
+	if err != nil {
+		return nil, err
+	}
+	return RankSessions(FilterWindow(sessions, window), l.Rule(gid)), nil
+}
+
+// ArchiveClosed archives every daily, weekly and monthly window and every
+// season of a game that closed at least grace ago and is not archived yet.
+//
+// Windows are walked back from the last closed one until an archived window
+// or the first session of the game, so windows missed while the server was
+// down are archived too. The grace lets sessions mined or approved after the
+// boundary still count.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - gid: The game ID to archive.
+//   - now: The current time.
+//   - grace: How long after closing a window is archived.
+//
+// Returns:
+//   - err: Any error that occurred while reading the game history or writing the archive.
+func (l *leaderboard) ArchiveClosed(callData *bind.CallOpts, gid int, now time.Time, grace time.Duration) error {
+	cutoff := now.Add(-grace)
+	var (
+		sessions []storage.GameHistoryGameSession
+		first    time.Time
+		pending  []LeaderboardWindow
+	)
+	load := func() error {
+		if sessions != nil {
+			return nil
+		}
+		var err error
+		if sessions, err = l.history.GetGameData(callData, gid); err != nil {
+			return err
+		}
+		first = cutoff
+		for _, session := range sessions {
+			if at := SessionTime(session.Time); at.Before(first) {
+				first = at
+			}
+		}
+		return nil
+	}
+
+	for _, kind := range []string{WindowDaily, WindowWeekly, WindowMonthly} {
+		window, err := l.calendar.Window(kind, cutoff, "")
+		if err != nil {
+			return err
+		}
+		for latest := true; ; latest = false {
+			if window, err = l.calendar.Previous(window); err != nil {
+				return err
+			}
+			if _, found := l.archive.Get(gid, window.Key); found {
+				break
+			}
+			if err := load(); err != nil {
+				return err
+			}
+			// the last closed window is archived even when empty, so the
+			// next run stops at it without reading the history
+			if !latest && !window.End.After(first) {
+				break
+			}
+			pending = append(pending, window)
+		}
+	}
+	for _, season := range l.calendar.Seasons() {
+		window, _ := l.calendar.Window(WindowSeason, now, season.Name)
+		if !window.Closed(cutoff) {
+			continue
+		}
+		if _, found := l.archive.Get(gid, window.Key); !found {
+			pending = append(pending, window)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+
+	boards := make([]ArchivedLeaderboard, 0, len(pending))
+	for _, window := range pending {
+		boards = append(boards, ArchivedLeaderboard{
+			Gid:        gid,
+			Window:     window,
+			Entries:    RankSessions(FilterWindow(sessions, window), l.Rule(gid)),
+			ArchivedAt: now,
+		})
+	}
+	return l.archive.Put(boards...)
+}
+
+// Archived returns the archived rankings of a game, most recent first.
+func (l *leaderboard) Archived(gid int) []ArchivedLeaderboard {
+	return l.archive.List(gid)
+}
+
+// FilterWindow returns the sessions whose time falls inside the window.
+func FilterWindow(sessions []storage.GameHistoryGameSession, window LeaderboardWindow) []storage.GameHistoryGameSession {
+	if window.Kind == WindowAllTime {
+		return sessions
+	}
+	res := make([]storage.GameHistoryGameSession, 0, len(sessions))
+	for _, session := range sessions {
+		if window.Contains(SessionTime(session.Time)) {
+			res = append(res, session)
+		}
+	}
+	return res
+}
+
+// RankSessions keeps the best scoring session of every uid and ranks them.
+//
+// Sessions whose data does not hold a numeric score at the rule's field are
+// skipped. Equal scores are ordered by who reached them first, then by uid.
+func RankSessions(sessions []storage.GameHistoryGameSession, rule ScoreRule) []LeaderboardEntry {
+	best := make(map[string]LeaderboardEntry)
+	for _, session := range sessions {
+		score, err := ExtractScore(session.Data, rule.Field)
+		if err != nil {
+			continue
+		}
+		entry := LeaderboardEntry{Uid: session.Uid, Score: score, Time: session.Time}
+		if current, ok := best[session.Uid]; !ok || rule.Better(entry, current) {
+			best[session.Uid] = entry
+		}
+	}
+
+	res := make([]LeaderboardEntry, 0, len(best))
+	for _, entry := range best {
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return rule.Better(res[i], res[j])
+	})
+	for i := range res {
+		res[i].Rank = i + 1
+	}
+	return res
+}
+
+// Better reports whether entry a ranks above entry b under the rule.
+func (r ScoreRule) Better(a, b LeaderboardEntry) bool {
+	if a.Score != b.Score {
+		if r.Ascending {
+			return a.Score < b.Score
+		}
+		return a.Score > b.Score
+	}
+	if c := compareTime(a.Time, b.Time); c != 0 {
+		return c < 0
+	}
+	return a.Uid < b.Uid
+}
+
+// compareTime compares two session timestamps, treating nil as zero.
+func compareTime(a, b *big.Int) int {
+	if a == nil {
+		a = new(big.Int)
+	}
+	if b == nil {
+		b = new(big.Int)
+	}
+	return a.Cmp(b)
+}
+
+// ExtractScore reads a numeric score from JSON session data.
+//
+// Parameters:
+//   - data: The session data, a JSON object.
+//   - field: A dot separated path to the score, eg "result.points".
+//
+// Returns:
+//   - res: The score, numbers and numeric strings are accepted.
+//   - err: An error if the data is not JSON or the field is missing, not
+//     numeric, infinite or NaN.
+func ExtractScore(data string, field string) (res float64, err error) {
+	value, err := lookupField(data, field)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		res, err = v.Float64()
+	case string:
+		res, err = strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("field %s is not numeric", field)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// ParseFloat accepts "Inf" and "NaN", which would take the top rank for
+	// good or break the ordering of the ranking.
+	if math.IsInf(res, 0) || math.IsNaN(res) {
+		return 0, fmt.Errorf("field %s is not a finite number", field)
+	}
+	return res, nil
+}
+
+// lookupField walks a dot separated path through JSON data.
+func lookupField(data string, field string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("session data is not json: %w", err)
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %s not found", field)
+		}
+		if value, ok = object[key]; !ok {
+			return nil, fmt.Errorf("field %s not found", field)
+		}
+	}
+	return value, nil
+}
+
+// ParseScoreRules builds score rules from their configuration.
+//
+// Parameters:
+//   - fields: gid=path pairs as parsed by utils.ParseKeyValueList.
+//   - ascending: A comma separated list of gids that rank the lowest score first.
+//   - defaultField: The path used by games missing from fields.
+//
+// Returns:
+//   - rules: The rules keyed by gid.
+//   - defaultRule: The rule for games without their own entry.
+//   - err: An error if a gid is not a number.
+func ParseScoreRules(fields map[string]string, ascending string, defaultField string) (rules map[int]ScoreRule, defaultRule ScoreRule, err error) {
+	if defaultField == "" {
+		defaultField = "score"
+	}
+	defaultRule = ScoreRule{Field: defaultField}
+	rules = make(map[int]ScoreRule)
+
+	for key, field := range fields {
+		gid, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, defaultRule, fmt.Errorf("invalid gid %q in score fields", key)
+		}
+		rules[gid] = ScoreRule{Field: field}
+	}
+
+	for _, key := range strings.Split(ascending, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		gid, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, defaultRule, fmt.Errorf("invalid gid %q in ascending games", key)
+		}
+		rule, ok := rules[gid]
+		if !ok {
+			rule = ScoreRule{Field: defaultField}
+		}
+		rule.Ascending = true
+		rules[gid] = rule
+	}
+	return rules, defaultRule, nil
+}
+
+// StartLeaderboardArchiver archives the windows of the given games that closed
+// at least grace ago every interval until ctx is cancelled.
+func StartLeaderboardArchiver(ctx context.Context, service LeaderboardService, callData *bind.CallOpts, gids []int, interval time.Duration, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			for _, gid := range gids {
+				if err := service.ArchiveClosed(callData, gid, time.Now(), grace); err != nil {
+					log.Printf("while archiving leaderboards of game %d: %v", gid, err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// PlayerRank is a player's position on a leaderboard with the players around them.
+type PlayerRank struct {
+	Rank       int                `json:"rank"`
+	Total      int                `json:"total"`
+	Percentile float64            `json:"percentile"`
+	Entry      LeaderboardEntry   `json:"entry"`
+	Above      []LeaderboardEntry `json:"above"`
+	Below      []LeaderboardEntry `json:"below"`
+}
+
+// LeaderboardIndex keeps the best entry of every uid of a game in rank order.
+//
+// The game history contract only ever appends sessions, so the index
+// remembers how many sessions it has seen and only scores the new ones on
+// each update instead of ranking the whole history again.
+type LeaderboardIndex struct {
+	mutex sync.RWMutex
+	rule  ScoreRule
+	list  *utils.SkipList[LeaderboardEntry]
+	best  map[string]LeaderboardEntry
+	seen  int
+}
+
+// NewLeaderboardIndex creates an empty index ranking by rule.
+func NewLeaderboardIndex(rule ScoreRule) *LeaderboardIndex {
+	return &LeaderboardIndex{
+		rule: rule,
+		list: utils.NewSkipList(rule.Better),
+		best: make(map[string]LeaderboardEntry),
+	}
+}
+
+// Update folds the sessions the index has not seen yet into the ranking.
+//
+// sessions must be the full history of the game in contract order. A history
+// shorter than the one already seen means the contract was replaced, and the
+// index is rebuilt from scratch.
+func (x *LeaderboardIndex) Update(sessions []storage.GameHistoryGameSession) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if len(sessions) < x.seen {
+		x.list = utils.NewSkipList(x.rule.Better)
+		x.best = make(map[string]LeaderboardEntry)
+		x.seen = 0
+	}
+
+	for _, session := range sessions[x.seen:] {
+		x.add(session)
+	}
+	x.seen = len(sessions)
+}
+
+func (x *LeaderboardIndex) add(session storage.GameHistoryGameSession) {
+	score, err := ExtractScore(session.Data, x.rule.Field)
+	if err != nil {
+		return
+	}
+	entry := LeaderboardEntry{Uid: session.Uid, Score: score, Time: session.Time}
+	current, ok := x.best[session.Uid]
+	if ok && !x.rule.Better(entry, current) {
+		return
+	}
+	if ok {
+		x.list.Delete(current)
+	}
+	x.best[session.Uid] = entry
+	x.list.Insert(entry)
+}
+
+// Len returns the number of ranked players.
+func (x *LeaderboardIndex) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	return x.list.Len()
+}
+
+// Range returns up to count entries starting at the 1 based rank start.
+func (x *LeaderboardIndex) Range(start int, count int) []LeaderboardEntry {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	return x.rank(x.list.Range(start, count), start)
+}
+
+// Player returns the rank of uid with up to neighbors entries above and below.
+// The second result is false when uid has no ranked session.
+func (x *LeaderboardIndex) Player(uid string, neighbors int) (PlayerRank, bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	entry, ok := x.best[uid]
+	if !ok {
+		return PlayerRank{}, false
+	}
+
+	rank := x.list.Rank(entry)
+	total := x.list.Len()
+	entry.Rank = rank
+	above := x.list.Range(rank-neighbors, neighbors)
+	return PlayerRank{
+		Rank:       rank,
+		Total:      total,
+		Percentile: 100 * float64(total-rank+1) / float64(total),
+		Entry:      entry,
+		Above:      x.rank(above, rank-len(above)),
+		Below:      x.rank(x.list.Range(rank+1, neighbors), rank+1),
+	}, true
+}
+
+// rank numbers entries that start at the 1 based rank start.
+func (x *LeaderboardIndex) rank(entries []LeaderboardEntry, start int) []LeaderboardEntry {
+	for i := range entries {
+		entries[i].Rank = start + i
+	}
+	return entries
+}
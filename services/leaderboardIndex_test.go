@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderboardIndexMatchesRankSessions(t *testing.T) {
+	rule := ScoreRule{Field: "score"}
+	index := NewLeaderboardIndex(rule)
+	sessions := make([]storage.GameHistoryGameSession, 0)
+
+	// feed the history in batches like successive contract reads
+	for batch := 0; batch < 5; batch++ {
+		for i := 0; i < 40; i++ {
+			n := batch*40 + i
+			uid := fmt.Sprintf("uid%d", n%25)
+			sessions = append(sessions, session(1, "t", uid, fmt.Sprintf(`{"score":%d}`, (n*37)%101), 1000+n))
+		}
+		index.Update(sessions)
+		assert.Equal(t, RankSessions(sessions, rule), index.Range(1, index.Len()))
+	}
+}
+
+func TestLeaderboardIndexPlayer(t *testing.T) {
+	index := NewLeaderboardIndex(ScoreRule{Field: "score"})
+	sessions := make([]storage.GameHistoryGameSession, 0)
+	for i := 1; i <= 10; i++ {
+		sessions = append(sessions, session(1, "t", fmt.Sprintf("uid%d", i), fmt.Sprintf(`{"score":%d}`, i*10), i))
+	}
+	index.Update(sessions)
+
+	// uid7 has the 4th best score
+	res, found := index.Player("uid7", 2)
+	assert.True(t, found)
+	assert.Equal(t, 4, res.Rank)
+	assert.Equal(t, 10, res.Total)
+	assert.Equal(t, 70.0, res.Percentile)
+	assert.Equal(t, 70.0, res.Entry.Score)
+	assert.Equal(t, []string{"uid9", "uid8"}, uids(res.Above))
+	assert.Equal(t, 2, res.Above[0].Rank)
+	assert.Equal(t, []string{"uid6", "uid5"}, uids(res.Below))
+	assert.Equal(t, 6, res.Below[1].Rank)
+
+	// the leader has nobody above
+	res, _ = index.Player("uid10", 3)
+	assert.Empty(t, res.Above)
+	assert.Len(t, res.Below, 3)
+
+	// a better session moves the player up
+	index.Update(append(sessions, session(1, "t", "uid1", `{"score":1000}`, 11)))
+	res, _ = index.Player("uid1", 1)
+	assert.Equal(t, 1, res.Rank)
+	assert.Equal(t, 10, res.Total)
+
+	_, found = index.Player("nobody", 1)
+	assert.False(t, found)
+}
+
+func uids(entries []LeaderboardEntry) []string {
+	res := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, entry.Uid)
+	}
+	return res
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Leaderboard window kinds.
+const (
+	WindowAllTime = "all"
+	WindowDaily   = "daily"
+	WindowWeekly  = "weekly"
+	WindowMonthly = "monthly"
+	WindowSeason  = "season"
+)
+
+// DefaultArchiveGrace is how long after closing a window is archived, so
+// sessions mined or approved late still count.
+const DefaultArchiveGrace = time.Hour
+
+// millisecondThreshold separates second from millisecond session timestamps.
+// Unix seconds stay below it until the year 33658.
+const millisecondThreshold = 1_000_000_000_000
+
+// LeaderboardWindow is the period a leaderboard ranks sessions over.
+// Sessions count when Start <= time < End. The all time window has zero bounds.
+type LeaderboardWindow struct {
+	Kind  string    `json:"kind"`
+	Key   string    `json:"key"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Season is a named competition with fixed bounds.
+type Season struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains reports whether a session time falls inside the window.
+func (w LeaderboardWindow) Contains(t time.Time) bool {
+	if w.Kind == WindowAllTime {
+		return true
+	}
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Closed reports whether the window has ended, which makes its ranking final.
+func (w LeaderboardWindow) Closed(now time.Time) bool {
+	if w.Kind == WindowAllTime {
+		return false
+	}
+	return !now.Before(w.End)
+}
+
+// SessionTime converts an on-chain session time into a time.Time.
+//
+// Games submit either unix seconds or unix milliseconds, values at or above
+// one trillion are read as milliseconds.
+func SessionTime(t *big.Int) time.Time {
+	if t == nil {
+		return time.Unix(0, 0)
+	}
+	value := t.Int64()
+	if value >= millisecondThreshold {
+		return time.UnixMilli(value)
+	}
+	return time.Unix(value, 0)
+}
+
+// LeaderboardCalendar computes window boundaries in a configured timezone.
+type LeaderboardCalendar struct {
+	location *time.Location
+	seasons  map[string]Season
+}
+
+// NewLeaderboardCalendar creates a new LeaderboardCalendar.
+//
+// Parameters:
+//   - location: The timezone days, weeks and months start in, UTC when nil.
+//   - seasons: The custom seasons that can be ranked.
+//
+// Returns:
+//
+//	A *LeaderboardCalendar instance.
+func NewLeaderboardCalendar(location *time.Location, seasons []Season) *LeaderboardCalendar {
+	if location == nil {
+		location = time.UTC
+	}
+	byName := make(map[string]Season, len(seasons))
+	for _, season := range seasons {
+		byName[season.Name] = season
+	}
+	return &LeaderboardCalendar{location: location, seasons: byName}
+}
+
+// Window returns the window of a kind that contains at.
+//
+// Parameters:
+//   - kind: One of the Window* kinds.
+//   - at: A time inside the wanted window, ignored for seasons and all time.
+//   - season: The season name when kind is WindowSeason.
+//
+// Returns:
+//   - res: The window.
+//   - err: An error if the kind or season is unknown.
+func (c *LeaderboardCalendar) Window(kind string, at time.Time, season string) (res LeaderboardWindow, err error) {
+	at = at.In(c.location)
+	year, month, day := at.Date()
+
+	switch kind {
+	case "", WindowAllTime:
+		return LeaderboardWindow{Kind: WindowAllTime, Key: WindowAllTime}, nil
+	case WindowDaily:
+		start := time.Date(year, month, day, 0, 0, 0, 0, c.location)
+		return LeaderboardWindow{
+			Kind:  WindowDaily,
+			Key:   WindowDaily + ":" + start.Format("2006-01-02"),
+			Start: start,
+			End:   start.AddDate(0, 0, 1),
+		}, nil
+	case WindowWeekly:
+		// weeks start on monday like ISO weeks
+		offset := (int(at.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-offset, 0, 0, 0, 0, c.location)
+		isoYear, week := start.ISOWeek()
+		return LeaderboardWindow{
+			Kind:  WindowWeekly,
+			Key:   fmt.Sprintf("%s:%d-W%02d", WindowWeekly, isoYear, week),
+			Start: start,
+			End:   start.AddDate(0, 0, 7),
+		}, nil
+	case WindowMonthly:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, c.location)
+		return LeaderboardWindow{
+			Kind:  WindowMonthly,
+			Key:   WindowMonthly + ":" + start.Format("2006-01"),
+			Start: start,
+			End:   start.AddDate(0, 1, 0),
+		}, nil
+	case WindowSeason:
+		found, ok := c.seasons[season]
+		if !ok {
+			return res, fmt.Errorf("unknown season %q", season)
+		}
+		return LeaderboardWindow{
+			Kind:  WindowSeason,
+			Key:   WindowSeason + ":" + found.Name,
+			Start: found.Start,
+			End:   found.End,
+		}, nil
+	}
+	return res, fmt.Errorf("unknown leaderboard window %q", kind)
+}
+
+// Previous returns the window of the same kind that ended when w started.
+func (c *LeaderboardCalendar) Previous(w LeaderboardWindow) (LeaderboardWindow, error) {
+	return c.Window(w.Kind, w.Start.Add(-time.Nanosecond), "")
+}
+
+// Seasons returns the configured seasons ordered by start.
+func (c *LeaderboardCalendar) Seasons() []Season {
+	res := make([]Season, 0, len(c.seasons))
+	for _, season := range c.seasons {
+		res = append(res, season)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+	return res
+}
+
+// ParseSeasons parses seasons configured as name=start/end pairs with RFC3339 times.
+func ParseSeasons(list map[string]string) ([]Season, error) {
+	res := make([]Season, 0, len(list))
+	for name, bounds := range list {
+		from, to, ok := strings.Cut(bounds, "/")
+		if !ok {
+			return nil, fmt.Errorf("season %s must be start/end", name)
+		}
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("season %s start: %w", name, err)
+		}
+		end, err := time.Parse(time.RFC3339, strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("season %s end: %w", name, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("season %s ends before it starts", name)
+		}
+		res = append(res, Season{Name: name, Start: start, End: end})
+	}
+	return res, nil
+}
+
+// ArchivedLeaderboard is the final ranking of a closed window.
+type ArchivedLeaderboard struct {
+	Gid        int                `json:"gid"`
+	Window     LeaderboardWindow  `json:"window"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	ArchivedAt time.Time          `json:"archived_at"`
+}
+
+// LeaderboardArchive keeps the rankings of closed windows on disk.
+type LeaderboardArchive struct {
+	path   string
+	mutex  sync.RWMutex
+	boards map[string]ArchivedLeaderboard
+}
+
+// NewLeaderboardArchive loads the archive stored at path.
+// An empty path keeps the archive in memory only.
+func NewLeaderboardArchive(path string) (*LeaderboardArchive, error) {
+	archive := &LeaderboardArchive{
+		path:   path,
+		boards: make(map[string]ArchivedLeaderboard),
+	}
+	if path == "" {
+		return archive, nil
+	}
+	if err := utils.LoadJSON(path, &archive.boards); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func archiveKey(gid int, windowKey string) string {
+	return fmt.Sprintf("%d|%s", gid, windowKey)
+}
+
+// Get returns the archived ranking of a window.
+func (a *LeaderboardArchive) Get(gid int, windowKey string) (ArchivedLeaderboard, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	board, found := a.boards[archiveKey(gid, windowKey)]
+	return board, found
+}
+
+// Put archives rankings and persists the archive once.
+func (a *LeaderboardArchive) Put(boards ...ArchivedLeaderboard) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, board := range boards {
+		a.boards[archiveKey(board.Gid, board.Window.Key)] = board
+	}
+	if a.path == "" {
+		return nil
+	}
+	return utils.SaveJSON(a.path, a.boards)
+}
+
+// List returns the archived rankings of a game, most recent window first.
+func (a *LeaderboardArchive) List(gid int) []ArchivedLeaderboard {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	res := make([]ArchivedLeaderboard, 0)
+	for _, board := range a.boards {
+		if board.Gid == gid {
+			res = append(res, board)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Window.End.Equal(res[j].Window.End) {
+			return res[i].Window.End.After(res[j].Window.End)
+		}
+		return res[i].Window.Key < res[j].Window.Key
+	})
+	return res
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarWindowsRespectTimezone(t *testing.T) {
+	lagos := time.FixedZone("WAT", 3600)
+	calendar := NewLeaderboardCalendar(lagos, nil)
+	// 23:30 UTC on sunday 5 may 2024 is already monday 00:30 in WAT
+	at := time.Date(2024, 5, 5, 23, 30, 0, 0, time.UTC)
+
+	daily, err := calendar.Window(WindowDaily, at, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "daily:2024-05-06", daily.Key)
+	assert.True(t, daily.Start.Equal(time.Date(2024, 5, 5, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, daily.End.Equal(daily.Start.Add(24*time.Hour)))
+
+	weekly, err := calendar.Window(WindowWeekly, at, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "weekly:2024-W19", weekly.Key)
+	assert.Equal(t, time.Monday, weekly.Start.Weekday())
+
+	monthly, err := calendar.Window(WindowMonthly, at, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "monthly:2024-05", monthly.Key)
+
+	previous, err := calendar.Previous(monthly)
+	assert.NoError(t, err)
+	assert.Equal(t, "monthly:2024-04", previous.Key)
+
+	_, err = calendar.Window("yearly", at, "")
+	assert.Error(t, err)
+}
+
+func TestCalendarSeasons(t *testing.T) {
+	seasons, err := ParseSeasons(map[string]string{"s1": "2024-01-01T00:00:00Z/2024-04-01T00:00:00Z"})
+	assert.NoError(t, err)
+	calendar := NewLeaderboardCalendar(nil, seasons)
+
+	window, err := calendar.Window(WindowSeason, time.Now(), "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, "season:s1", window.Key)
+	assert.True(t, window.Closed(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, window.Closed(time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)))
+
+	_, err = calendar.Window(WindowSeason, time.Now(), "s2")
+	assert.Error(t, err)
+
+	_, err = ParseSeasons(map[string]string{"bad": "2024-04-01T00:00:00Z/2024-01-01T00:00:00Z"})
+	assert.Error(t, err)
+}
+
+func TestSessionTime(t *testing.T) {
+	assert.True(t, SessionTime(big.NewInt(1714953600)).Equal(time.Unix(1714953600, 0)))
+	assert.True(t, SessionTime(big.NewInt(1714953600123)).Equal(time.UnixMilli(1714953600123)))
+}
+
+func TestWindowLeaderboardServesArchive(t *testing.T) {
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, int(day.Add(time.Hour).Unix())),
+		session(1, "t", "bob", `{"score":20}`, int(day.Add(2*time.Hour).Unix())),
+		session(1, "t", "carol", `{"score":99}`, int(day.Add(25*time.Hour).Unix())),
+	}}
+	path := filepath.Join(t.TempDir(), "archive.json")
+	archive, err := NewLeaderboardArchive(path)
+	assert.NoError(t, err)
+	calendar := NewLeaderboardCalendar(nil, nil)
+	service := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, calendar, archive)
+
+	window, _ := calendar.Window(WindowDaily, day, "")
+	res, err := service.WindowLeaderboard(nil, 1, window)
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "bob", res[0].Uid)
+	assert.Empty(t, service.Archived(1), "reading a closed window does not archive it")
+
+	assert.NoError(t, service.ArchiveClosed(nil, 1, day.Add(48*time.Hour), 0))
+
+	// data rolling on does not change the archived result
+	history.sessions = nil
+	reloaded, err := NewLeaderboardArchive(path)
+	assert.NoError(t, err)
+	service = NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, calendar, reloaded)
+	res, err = service.WindowLeaderboard(nil, 1, window)
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+}
+
+func TestArchiveClosed(t *testing.T) {
+	now := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, int(now.Add(-24*time.Hour).Unix())),
+	}}
+	archive, _ := NewLeaderboardArchive("")
+	seasons, _ := ParseSeasons(map[string]string{"s1": "2024-01-01T00:00:00Z/2024-04-01T00:00:00Z"})
+	service := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, NewLeaderboardCalendar(nil, seasons), archive)
+
+	assert.NoError(t, service.ArchiveClosed(nil, 1, now, time.Hour))
+	keys := make([]string, 0)
+	for _, board := range service.Archived(1) {
+		keys = append(keys, board.Window.Key)
+	}
+	assert.ElementsMatch(t, []string{"daily:2024-05-06", "weekly:2024-W18", "monthly:2024-04", "season:s1"}, keys)
+
+	daily, _ := archive.Get(1, "daily:2024-05-06")
+	assert.Len(t, daily.Entries, 1)
+	assert.Equal(t, "alice", daily.Entries[0].Uid)
+}
+
+func TestArchiveClosedWaitsForGrace(t *testing.T) {
+	midnight := time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, int(midnight.Add(-time.Hour).Unix())),
+	}}
+	archive, _ := NewLeaderboardArchive("")
+	service := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, NewLeaderboardCalendar(nil, nil), archive)
+
+	assert.NoError(t, service.ArchiveClosed(nil, 1, midnight.Add(30*time.Minute), time.Hour))
+	_, found := archive.Get(1, "daily:2024-05-06")
+	assert.False(t, found, "the window closed less than the grace ago")
+
+	// a session mined late still makes the archive
+	history.sessions = append(history.sessions, session(1, "t", "bob", `{"score":20}`, int(midnight.Add(-time.Minute).Unix())))
+	assert.NoError(t, service.ArchiveClosed(nil, 1, midnight.Add(90*time.Minute), time.Hour))
+	daily, found := archive.Get(1, "daily:2024-05-06")
+	assert.True(t, found)
+	assert.Len(t, daily.Entries, 2)
+}
+
+func TestArchiveClosedCatchesUpMissedWindows(t *testing.T) {
+	first := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, int(first.Unix())),
+		session(1, "t", "bob", `{"score":20}`, int(first.Add(72*time.Hour).Unix())),
+	}}
+	archive, _ := NewLeaderboardArchive("")
+	service := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, NewLeaderboardCalendar(nil, nil), archive)
+
+	assert.NoError(t, service.ArchiveClosed(nil, 1, time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC), 0))
+	// down from the 3rd to the 7th
+	assert.NoError(t, service.ArchiveClosed(nil, 1, time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC), 0))
+
+	days := make([]string, 0)
+	for _, board := range service.Archived(1) {
+		if board.Window.Kind == WindowDaily {
+			days = append(days, board.Window.Key)
+		}
+	}
+	assert.Equal(t, []string{"daily:2024-05-06", "daily:2024-05-05", "daily:2024-05-04", "daily:2024-05-03", "daily:2024-05-02"}, days)
+}
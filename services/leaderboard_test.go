@@ -0,0 +1,151 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGameHistory is an in-memory GameHistoryContract.
+type fakeGameHistory struct {
+	sessions []storage.GameHistoryGameSession
+}
+
+func (f *fakeGameHistory) StoreGameData(_ *bind.TransactOpts, gid int, gtid string, uid string, data string, time int) (*types.Transaction, error) {
+	f.sessions = append(f.sessions, session(gid, gtid, uid, data, time))
+	return types.NewTx(&types.LegacyTx{Nonce: uint64(len(f.sessions))}), nil
+}
+
+func (f *fakeGameHistory) GetGameData(_ *bind.CallOpts, gid int) (res []storage.GameHistoryGameSession, err error) {
+	for _, s := range f.sessions {
+		if s.Gid.Int64() == int64(gid) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeGameHistory) GetUserGameData(_ *bind.CallOpts, uid string) (res []storage.GameHistoryGameSession, err error) {
+	for _, s := range f.sessions {
+		if s.Uid == uid {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func session(gid int, gtid string, uid string, data string, time int) storage.GameHistoryGameSession {
+	return storage.GameHistoryGameSession{
+		Gid:  big.NewInt(int64(gid)),
+		Gtid: gtid,
+		Uid:  uid,
+		Data: data,
+		Time: big.NewInt(int64(time)),
+	}
+}
+
+func TestExtractScore(t *testing.T) {
+	score, err := ExtractScore(`{"score":42}`, "score")
+	assert.NoError(t, err)
+	assert.Equal(t, 42.0, score)
+
+	score, err = ExtractScore(`{"result":{"ms":"1234.5"}}`, "result.ms")
+	assert.NoError(t, err)
+	assert.Equal(t, 1234.5, score)
+
+	_, err = ExtractScore(`{"score":"high"}`, "score")
+	assert.Error(t, err)
+	_, err = ExtractScore(`{"points":1}`, "score")
+	assert.Error(t, err)
+	_, err = ExtractScore(`not json`, "score")
+	assert.Error(t, err)
+
+	for _, value := range []string{`"Infinity"`, `"+Inf"`, `"-inf"`, `"NaN"`, `"1e400"`, `1e400`} {
+		_, err = ExtractScore(`{"score":`+value+`}`, "score")
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRankSessionsSkipsNonFiniteScores(t *testing.T) {
+	sessions := []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, 100),
+		session(1, "t", "mallory", `{"score":"Infinity"}`, 101),
+		session(1, "t", "eve", `{"score":"NaN"}`, 102),
+		session(1, "t", "bob", `{"score":20}`, 103),
+	}
+
+	res := RankSessions(sessions, ScoreRule{Field: "score"})
+	assert.Len(t, res, 2)
+	assert.Equal(t, "bob", res[0].Uid)
+	assert.Equal(t, "alice", res[1].Uid)
+}
+
+func TestRankSessionsKeepsBestPerUid(t *testing.T) {
+	sessions := []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, 100),
+		session(1, "t", "bob", `{"score":30}`, 101),
+		session(1, "t", "alice", `{"score":50}`, 102),
+		session(1, "t", "carol", `{"score":30}`, 99),
+		session(1, "t", "dave", `broken`, 103),
+	}
+
+	res := RankSessions(sessions, ScoreRule{Field: "score"})
+	assert.Len(t, res, 3)
+	assert.Equal(t, LeaderboardEntry{Rank: 1, Uid: "alice", Score: 50, Time: big.NewInt(102)}, res[0])
+	// carol reached 30 before bob
+	assert.Equal(t, "carol", res[1].Uid)
+	assert.Equal(t, 2, res[1].Rank)
+	assert.Equal(t, "bob", res[2].Uid)
+	assert.Equal(t, 3, res[2].Rank)
+}
+
+func TestRankSessionsAscending(t *testing.T) {
+	sessions := []storage.GameHistoryGameSession{
+		session(2, "t", "alice", `{"time":12.5}`, 100),
+		session(2, "t", "bob", `{"time":9.1}`, 101),
+		session(2, "t", "alice", `{"time":8.7}`, 102),
+	}
+
+	res := RankSessions(sessions, ScoreRule{Field: "time", Ascending: true})
+	assert.Len(t, res, 2)
+	assert.Equal(t, "alice", res[0].Uid)
+	assert.Equal(t, 8.7, res[0].Score)
+	assert.Equal(t, "bob", res[1].Uid)
+}
+
+func TestLeaderboardUsesGameRule(t *testing.T) {
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":1,"time":5}`, 100),
+		session(1, "t", "bob", `{"score":2,"time":9}`, 101),
+		session(2, "t", "alice", `{"score":1,"time":5}`, 100),
+		session(2, "t", "bob", `{"score":2,"time":9}`, 101),
+	}}
+	rules, defaultRule, err := ParseScoreRules(map[string]string{"2": "time"}, "2", "")
+	assert.NoError(t, err)
+	archive, _ := NewLeaderboardArchive("")
+	service := NewLeaderboardService(history, rules, defaultRule, NewLeaderboardCalendar(nil, nil), archive)
+
+	res, err := service.Leaderboard(nil, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", res[0].Uid)
+
+	res, err = service.Leaderboard(nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", res[0].Uid)
+	assert.Equal(t, 5.0, res[0].Score)
+}
+
+func TestParseScoreRules(t *testing.T) {
+	rules, defaultRule, err := ParseScoreRules(map[string]string{"7": "result.points"}, "8, 7", "points")
+	assert.NoError(t, err)
+	assert.Equal(t, ScoreRule{Field: "points"}, defaultRule)
+	assert.Equal(t, ScoreRule{Field: "result.points", Ascending: true}, rules[7])
+	assert.Equal(t, ScoreRule{Field: "points", Ascending: true}, rules[8])
+
+	_, _, err = ParseScoreRules(map[string]string{"abc": "score"}, "", "")
+	assert.Error(t, err)
+}
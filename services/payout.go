@@ -0,0 +1,563 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Payout item statuses.
+//
+// An item is signed and saved as sent before it is broadcast, so a resumed
+// batch only ever rebroadcasts the same transaction and cannot pay twice.
+// Failed items lost their nonce to another transaction without a transfer
+// found on chain, they are left to be checked and paid by hand.
+const (
+	PayoutPending  = "pending"
+	PayoutUnlinked = "unlinked"
+	PayoutSent     = "sent"
+	PayoutPaid     = "paid"
+	PayoutFailed   = "failed"
+)
+
+// Payout batch statuses.
+const (
+	BatchPending   = "pending"
+	BatchExecuting = "executing"
+	BatchCompleted = "completed"
+)
+
+var (
+	ErrPayoutNotFound = errors.New("payout batch not found")
+	ErrPayoutExists   = errors.New("payout batch already exists for this window")
+	ErrWindowOpen     = errors.New("leaderboard window has not closed yet")
+)
+
+// MaxPrizeRanks is how many ranks a prize table can pay.
+const MaxPrizeRanks = 10_000
+
+// PrizeTable maps a rank to its prize in whole tokens, such as "12.5".
+type PrizeTable map[int]string
+
+// ParsePrizeTable reads a prize table from rank=amount pairs. A rank can be a
+// range such as 4-10 to give every rank in it the same prize. Tables paying
+// more than MaxPrizeRanks ranks are rejected before they are expanded.
+func ParsePrizeTable(prizes map[string]string) (PrizeTable, error) {
+	res := make(PrizeTable)
+	count := 0
+	for ranks, amount := range prizes {
+		first, last, isRange := strings.Cut(ranks, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("invalid prize rank %q", ranks)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || to < from {
+				return nil, fmt.Errorf("invalid prize rank %q", ranks)
+			}
+		}
+		if count += to - from + 1; count > MaxPrizeRanks {
+			return nil, fmt.Errorf("prize table pays more than %d ranks", MaxPrizeRanks)
+		}
+		for rank := from; rank <= to; rank++ {
+			res[rank] = amount
+		}
+	}
+	return res, nil
+}
+
+// PayoutItem is the prize of one ranked player.
+type PayoutItem struct {
+	Rank    int        `json:"rank"`
+	Uid     string     `json:"uid"`
+	Address string     `json:"address"`
+	Amount  *big.Int   `json:"amount" swaggertype:"string"`
+	Tokens  string     `json:"tokens"`
+	Status  string     `json:"status"`
+	TxHash  string     `json:"tx_hash,omitempty"`
+	RawTx   string     `json:"raw_tx,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	SentAt  *time.Time `json:"sent_at,omitempty"`
+	// SentBlock is the latest block when the transfer was signed, where the
+	// search for its Transfer event starts.
+	SentBlock uint64     `json:"sent_block,omitempty"`
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+}
+
+// PayoutBatch pays the prizes of one closed leaderboard window.
+// Balance is only set on previews and holds the hot wallet token balance.
+type PayoutBatch struct {
+	ID        string            `json:"id"`
+	Gid       int               `json:"gid"`
+	Window    LeaderboardWindow `json:"window"`
+	Token     string            `json:"token"`
+	Decimals  uint8             `json:"decimals"`
+	Total     *big.Int          `json:"total" swaggertype:"string"`
+	Balance   *big.Int          `json:"balance,omitempty" swaggertype:"string"`
+	DryRun    bool              `json:"dry_run"`
+	Status    string            `json:"status"`
+	Items     []PayoutItem      `json:"items"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PayoutBackend sends signed transactions and reads their receipts, the
+// confirmed nonces of the hot wallet and token Transfer events.
+// *ethclient.Client implements it.
+type PayoutBackend interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// transferTopic is the topic of the ERC20 Transfer event.
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+type PayoutService interface {
+	Preview(callData *bind.CallOpts, gid int, window LeaderboardWindow, prizes PrizeTable) (res PayoutBatch, err error)
+	Create(callData *bind.CallOpts, gid int, window LeaderboardWindow, prizes PrizeTable) (res PayoutBatch, err error)
+	Execute(ctx context.Context, id string) (res PayoutBatch, err error)
+	Resolve(id string) (res PayoutBatch, err error)
+	Get(id string) (PayoutBatch, bool)
+	List() []PayoutBatch
+}
+
+type payouts struct {
+	path        string
+	leaderboard LeaderboardService
+	links       WalletLinkService
+	token       Token
+	backend     PayoutBackend
+	transactor  *bind.TransactOpts
+	execute     sync.Mutex
+	mutex       sync.RWMutex
+	batches     map[string]PayoutBatch
+}
+
+// NewPayoutService loads the payout ledger stored at path.
+//
+// Parameters:
+//   - path: The file the ledger is persisted to, an empty path keeps it in memory.
+//   - leaderboard: The LeaderboardService winners are read from.
+//   - links: The WalletLinkService that resolves winners to wallets.
+//   - token: The token prizes are paid in.
+//   - backend: The backend transfers are sent through.
+//   - transactor: The hot wallet transfers are signed with. Nonces are taken
+//     under its SignerLock, so it can be shared with game stores.
+//
+// Returns:
+//   - res: A PayoutService instance.
+//   - err: An error if the stored ledger could not be read.
+func NewPayoutService(path string, leaderboard LeaderboardService, links WalletLinkService, token Token, backend PayoutBackend, transactor *bind.TransactOpts) (res PayoutService, err error) {
+	service := &payouts{
+		path:        path,
+		leaderboard: leaderboard,
+		links:       links,
+		token:       token,
+		backend:     backend,
+		transactor:  transactor,
+		batches:     make(map[string]PayoutBatch),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.batches); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+func payoutID(gid int, window LeaderboardWindow) string {
+	return fmt.Sprintf("%d:%s", gid, window.Key)
+}
+
+// Preview computes the batch a window would pay without storing it.
+//
+// Parameters:
+//   - callData: Call options for the contract calls.
+//   - gid: The game the leaderboard belongs to.
+//   - window: A closed leaderboard window.
+//   - prizes: The prize of each rank.
+//
+// Returns:
+//   - res: The batch with the hot wallet balance set.
+//   - err: ErrWindowOpen, an invalid prize or any error reading the chain.
+func (p *payouts) Preview(callData *bind.CallOpts, gid int, window LeaderboardWindow, prizes PrizeTable) (res PayoutBatch, err error) {
+	res, err = p.build(callData, gid, window, prizes)
+	if err != nil {
+		return res, err
+	}
+	res.DryRun = true
+	res.Balance, err = p.token.BalanceOf(callData, p.transactor.From)
+	return res, err
+}
+
+// Create stores the batch of a window so it can be executed.
+//
+// Returns:
+//   - res: The stored batch, or the existing batch with ErrPayoutExists.
+//   - err: ErrPayoutExists, ErrWindowOpen, an invalid prize or any error reading the chain.
+func (p *payouts) Create(callData *bind.CallOpts, gid int, window LeaderboardWindow, prizes PrizeTable) (res PayoutBatch, err error) {
+	if existing, found := p.Get(payoutID(gid, window)); found {
+		return existing, ErrPayoutExists
+	}
+
+	res, err = p.build(callData, gid, window, prizes)
+	if err != nil {
+		return res, err
+	}
+
+	p.execute.Lock()
+	defer p.execute.Unlock()
+
+	if existing, found := p.Get(res.ID); found {
+		return existing, ErrPayoutExists
+	}
+	return res, p.save(&res)
+}
+
+func (p *payouts) build(callData *bind.CallOpts, gid int, window LeaderboardWindow, prizes PrizeTable) (res PayoutBatch, err error) {
+	if !window.Closed(time.Now()) {
+		return res, ErrWindowOpen
+	}
+	decimals, err := p.token.Decimals(callData)
+	if err != nil {
+		return res, err
+	}
+	entries, err := p.leaderboard.WindowLeaderboard(callData, gid, window)
+	if err != nil {
+		return res, err
+	}
+
+	ranks := make([]int, 0, len(prizes))
+	for rank := range prizes {
+		ranks = append(ranks, rank)
+	}
+	sort.Ints(ranks)
+
+	now := time.Now().UTC()
+	res = PayoutBatch{
+		ID:        payoutID(gid, window),
+		Gid:       gid,
+		Window:    window,
+		Token:     p.token.Address().Hex(),
+		Decimals:  decimals,
+		Total:     new(big.Int),
+		Items:     make([]PayoutItem, 0, len(ranks)),
+		CreatedAt: now,
+	}
+	for _, rank := range ranks {
+		if rank > len(entries) {
+			break
+		}
+		amount, err := ParseTokenAmount(prizes[rank], decimals)
+		if err != nil {
+			return PayoutBatch{}, fmt.Errorf("prize of rank %d: %w", rank, err)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+
+		entry := entries[rank-1]
+		item := PayoutItem{
+			Rank:   rank,
+			Uid:    entry.Uid,
+			Amount: amount,
+			Tokens: FormatTokenAmount(amount, decimals),
+			Status: PayoutUnlinked,
+		}
+		if link, found := p.links.ByUid(entry.Uid); found {
+			item.Address = link.Address.Hex()
+			item.Status = PayoutPending
+		}
+		res.Total.Add(res.Total, amount)
+		res.Items = append(res.Items, item)
+	}
+	res.Status = batchStatus(res.Items)
+	return res, nil
+}
+
+// Execute pays every item of a batch that is not paid yet.
+//
+// Execute can be called again after a failure or a restart. Items already
+// sent are never signed again: their receipt is checked and the same signed
+// transaction is rebroadcast while it is not mined. Only a reverted transfer is
+// signed again, one whose nonce was taken without a Transfer event is failed. Items are paid to the
+// wallet stored on the batch, winners without one stay unpaid until Resolve
+// approves their wallet. Execution stops at the first transfer that could not
+// be sent so hot wallet nonces stay in order.
+//
+// Parameters:
+//   - ctx: The context transactions are sent with.
+//   - id: The batch to execute.
+//
+// Returns:
+//   - res: The batch after execution.
+//   - err: ErrPayoutNotFound or the error that stopped execution.
+func (p *payouts) Execute(ctx context.Context, id string) (res PayoutBatch, err error) {
+	p.execute.Lock()
+	defer p.execute.Unlock()
+
+	res, found := p.Get(id)
+	if !found {
+		return res, ErrPayoutNotFound
+	}
+	for i := range res.Items {
+		if err := p.settle(ctx, &res, &res.Items[i]); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Resolve stores the wallets winners without one linked since the batch was
+// created, approving them to be paid by the next Execute.
+//
+// Parameters:
+//   - id: The batch to resolve.
+//
+// Returns:
+//   - res: The batch with the newly linked wallets.
+//   - err: ErrPayoutNotFound or a storage error.
+func (p *payouts) Resolve(id string) (res PayoutBatch, err error) {
+	p.execute.Lock()
+	defer p.execute.Unlock()
+
+	res, found := p.Get(id)
+	if !found {
+		return res, ErrPayoutNotFound
+	}
+	resolved := false
+	for i := range res.Items {
+		item := &res.Items[i]
+		if item.Status != PayoutUnlinked {
+			continue
+		}
+		if link, found := p.links.ByUid(item.Uid); found {
+			item.Address, item.Status = link.Address.Hex(), PayoutPending
+			resolved = true
+		}
+	}
+	if !resolved {
+		return res, nil
+	}
+	return res, p.save(&res)
+}
+
+// settle moves one item as far towards paid as it can go.
+func (p *payouts) settle(ctx context.Context, batch *PayoutBatch, item *PayoutItem) error {
+	if item.Status == PayoutSent {
+		receipt, err := p.backend.TransactionReceipt(ctx, common.HexToHash(item.TxHash))
+		switch {
+		case err == nil && receipt.Status == types.ReceiptStatusSuccessful:
+			now := time.Now().UTC()
+			item.Status, item.PaidAt, item.Error = PayoutPaid, &now, ""
+			return p.save(batch)
+		case err == nil:
+			// A reverted transfer moved no tokens, so it is signed again.
+			item.Status, item.Error = PayoutPending, "transfer "+item.TxHash+" reverted"
+		case errors.Is(err, ethereum.NotFound):
+			return p.rebroadcast(ctx, batch, item)
+		default:
+			return err
+		}
+	}
+
+	if item.Status != PayoutPending {
+		return nil
+	}
+
+	lock := SignerLock(p.transactor.From)
+	lock.Lock()
+	defer lock.Unlock()
+
+	opts := *p.transactor
+	opts.Context = ctx
+	opts.NoSend = true
+	block, err := p.backend.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := p.token.Transfer(&opts, common.HexToAddress(item.Address), item.Amount)
+	if err != nil {
+		return err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	previous := *item
+	now := time.Now().UTC()
+	item.Status, item.TxHash, item.RawTx, item.SentAt, item.SentBlock = PayoutSent, tx.Hash().Hex(), hexutil.Encode(raw), &now, block
+	if err := p.save(batch); err != nil {
+		*item = previous
+		return err
+	}
+	if err := p.backend.SendTransaction(ctx, tx); err != nil {
+		item.Error = err.Error()
+		return errors.Join(err, p.save(batch))
+	}
+	return nil
+}
+
+// rebroadcast sends the stored transaction of an item that is not mined yet.
+func (p *payouts) rebroadcast(ctx context.Context, batch *PayoutBatch, item *PayoutItem) error {
+	raw, err := hexutil.Decode(item.RawTx)
+	if err != nil {
+		return err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return err
+	}
+
+	err = p.backend.SendTransaction(ctx, tx)
+	if err != nil && strings.Contains(err.Error(), "already known") {
+		err = nil
+	}
+	if err != nil && strings.Contains(err.Error(), "nonce too low") {
+		return p.nonceTaken(ctx, batch, item, tx, err)
+	}
+	item.Error = ""
+	if err != nil {
+		item.Error = err.Error()
+	}
+	return errors.Join(err, p.save(batch))
+}
+
+// nonceTaken settles an item whose transfer the node no longer takes because
+// its nonce was used. A lagging or pruned node can miss the receipt of a mined
+// transfer, so the item is never signed again: it is paid when its Transfer
+// event is found once the nonce is confirmed, and failed for an operator to
+// check otherwise.
+func (p *payouts) nonceTaken(ctx context.Context, batch *PayoutBatch, item *PayoutItem, tx *types.Transaction, sendErr error) error {
+	confirmed, err := p.backend.NonceAt(ctx, p.transactor.From, nil)
+	if err == nil && confirmed <= tx.Nonce() {
+		// The nonce is only taken by a pending transaction, which may
+		// still be the transfer itself.
+		err = sendErr
+	}
+	var logs []types.Log
+	if err == nil {
+		logs, err = p.backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(item.SentBlock),
+			Addresses: []common.Address{p.token.Address()},
+			Topics: [][]common.Hash{
+				{transferTopic},
+				{common.BytesToHash(p.transactor.From.Bytes())},
+				{common.BytesToHash(common.HexToAddress(item.Address).Bytes())},
+			},
+		})
+	}
+	if err != nil {
+		item.Error = err.Error()
+		return errors.Join(err, p.save(batch))
+	}
+
+	for _, event := range logs {
+		if new(big.Int).SetBytes(event.Data).Cmp(item.Amount) == 0 {
+			now := time.Now().UTC()
+			item.Status, item.TxHash, item.PaidAt, item.Error = PayoutPaid, event.TxHash.Hex(), &now, ""
+			return p.save(batch)
+		}
+	}
+	item.Status = PayoutFailed
+	item.Error = fmt.Sprintf("nonce %d of transfer %s was used by another transaction and no transfer of the prize was found, check the wallet and pay it by hand", tx.Nonce(), item.TxHash)
+	return p.save(batch)
+}
+
+// Get returns a stored batch.
+func (p *payouts) Get(id string) (PayoutBatch, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	batch, found := p.batches[id]
+	if found {
+		batch.Items = append([]PayoutItem(nil), batch.Items...)
+	}
+	return batch, found
+}
+
+// List returns every stored batch, newest first.
+func (p *payouts) List() []PayoutBatch {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	res := make([]PayoutBatch, 0, len(p.batches))
+	for _, batch := range p.batches {
+		res = append(res, batch)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.After(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// save writes batch to the ledger, keeping the previous copy if the write fails.
+func (p *payouts) save(batch *PayoutBatch) error {
+	batch.Status = batchStatus(batch.Items)
+	batch.UpdatedAt = time.Now().UTC()
+	stored := *batch
+	stored.Items = append([]PayoutItem(nil), batch.Items...)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, existed := p.batches[batch.ID]
+	p.batches[batch.ID] = stored
+	if p.path == "" {
+		return nil
+	}
+	if err := utils.SaveJSON(p.path, p.batches); err != nil {
+		if existed {
+			p.batches[batch.ID] = previous
+		} else {
+			delete(p.batches, batch.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// batchStatus is completed when every linked winner is paid, executing once
+// any transfer was sent and pending before that.
+func batchStatus(items []PayoutItem) string {
+	unpaid, started := false, false
+	for _, item := range items {
+		switch item.Status {
+		case PayoutPending:
+			unpaid = true
+		case PayoutSent, PayoutFailed:
+			unpaid, started = true, true
+		case PayoutPaid:
+			started = true
+		}
+	}
+	switch {
+	case !unpaid:
+		return BatchCompleted
+	case started:
+		return BatchExecuting
+	}
+	return BatchPending
+}
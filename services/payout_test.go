@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHotWallet is the sender of every transaction of a fakeChain.
+var fakeHotWallet = common.HexToAddress("0x401")
+
+// fakeChain is a Token and PayoutBackend that keeps a transaction pool with
+// hot wallet nonces and credits transfers when they are mined, one block each.
+type fakeChain struct {
+	nonce     uint64
+	confirmed uint64
+	signed    int
+	pool      map[common.Hash]*types.Transaction
+	receipts  map[common.Hash]*types.Receipt
+	paid      map[common.Address]*big.Int
+	logs      []types.Log
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{
+		pool:     make(map[common.Hash]*types.Transaction),
+		receipts: make(map[common.Hash]*types.Receipt),
+		paid:     make(map[common.Address]*big.Int),
+	}
+}
+
+func (c *fakeChain) Address() common.Address { return common.HexToAddress("0xe6c") }
+
+func (c *fakeChain) Decimals(*bind.CallOpts) (uint8, error) { return 18, nil }
+
+func (c *fakeChain) BalanceOf(*bind.CallOpts, common.Address) (*big.Int, error) {
+	return big.NewInt(1e18), nil
+}
+
+func (c *fakeChain) Transfer(opts *bind.TransactOpts, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	c.signed++
+	tx := types.NewTx(&types.LegacyTx{Nonce: c.nonce, To: &to, Value: amount, Gas: uint64(c.signed)})
+	if !opts.NoSend {
+		return tx, c.SendTransaction(opts.Context, tx)
+	}
+	return tx, nil
+}
+
+func (c *fakeChain) SendTransaction(_ context.Context, tx *types.Transaction) error {
+	if _, known := c.pool[tx.Hash()]; known {
+		return errors.New("already known")
+	}
+	if tx.Nonce() != c.nonce {
+		return errors.New("nonce too low")
+	}
+	c.pool[tx.Hash()] = tx
+	c.nonce++
+	return nil
+}
+
+func (c *fakeChain) TransactionReceipt(_ context.Context, hash common.Hash) (*types.Receipt, error) {
+	if receipt, found := c.receipts[hash]; found {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (c *fakeChain) BlockNumber(context.Context) (uint64, error) {
+	return c.confirmed, nil
+}
+
+func (c *fakeChain) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return c.confirmed, nil
+}
+
+func (c *fakeChain) FilterLogs(_ context.Context, query ethereum.FilterQuery) (res []types.Log, err error) {
+	for _, event := range c.logs {
+		if event.BlockNumber >= query.FromBlock.Uint64() && event.Topics[1] == query.Topics[1][0] && event.Topics[2] == query.Topics[2][0] {
+			res = append(res, event)
+		}
+	}
+	return res, nil
+}
+
+func (c *fakeChain) mine() {
+	for hash, tx := range c.pool {
+		if _, mined := c.receipts[hash]; mined {
+			continue
+		}
+		c.receipts[hash] = &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: hash}
+		if c.paid[*tx.To()] == nil {
+			c.paid[*tx.To()] = new(big.Int)
+		}
+		c.paid[*tx.To()].Add(c.paid[*tx.To()], tx.Value())
+		c.logs = append(c.logs, types.Log{
+			Address:     c.Address(),
+			Topics:      []common.Hash{transferTopic, common.BytesToHash(fakeHotWallet.Bytes()), common.BytesToHash(tx.To().Bytes())},
+			Data:        common.LeftPadBytes(tx.Value().Bytes(), 32),
+			BlockNumber: c.confirmed,
+			TxHash:      hash,
+		})
+		c.confirmed++
+	}
+}
+
+func linkWallet(t *testing.T, links WalletLinkService, uid string, key string) common.Address {
+	challenge, err := links.Challenge("", uid, keyAddress(t, key))
+	require.NoError(t, err)
+	link, err := links.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, key), SignPersonal, "")
+	require.NoError(t, err)
+	return link.Address
+}
+
+func TestParsePrizeTable(t *testing.T) {
+	prizes, err := ParsePrizeTable(map[string]string{"1": "100", "2-4": "5"})
+	assert.NoError(t, err)
+	assert.Equal(t, PrizeTable{1: "100", 2: "5", 3: "5", 4: "5"}, prizes)
+
+	for _, rank := range []string{"0", "x", "4-2", "1-2000000000", "10-10010"} {
+		_, err := ParsePrizeTable(map[string]string{rank: "1"})
+		assert.Error(t, err, rank)
+	}
+}
+
+func TestTokenAmount(t *testing.T) {
+	amount, err := ParseTokenAmount("12.5", 18)
+	assert.NoError(t, err)
+	assert.Equal(t, "12500000000000000000", amount.String())
+	assert.Equal(t, "12.5", FormatTokenAmount(amount, 18))
+	assert.Equal(t, "0.000001", FormatTokenAmount(big.NewInt(1), 6))
+
+	for _, invalid := range []string{"", "-1", "1.0000001", "abc", ".5"} {
+		_, err := ParseTokenAmount(invalid, 6)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPayoutResumeNeverDoublePays(t *testing.T) {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Truncate(24 * time.Hour).Add(time.Hour)
+	at := int(yesterday.Unix())
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":30}`, at),
+		session(1, "t", "bob", `{"score":20}`, at),
+		session(1, "t", "carol", `{"score":10}`, at),
+		session(1, "t", "dave", `{"score":5}`, at),
+	}}
+	calendar := NewLeaderboardCalendar(time.UTC, nil)
+	archive, _ := NewLeaderboardArchive("")
+	leaderboard := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, calendar, archive)
+	window, _ := calendar.Window(WindowDaily, yesterday, "")
+
+	links, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := linkWallet(t, links, "alice", aliceKey)
+	bob := linkWallet(t, links, "bob", bobKey)
+
+	chain := newFakeChain()
+	path := filepath.Join(t.TempDir(), "payouts.json")
+	hotWallet := &bind.TransactOpts{From: fakeHotWallet}
+	service, err := NewPayoutService(path, leaderboard, links, chain, chain, hotWallet)
+	require.NoError(t, err)
+	prizes := PrizeTable{1: "10", 2: "2.5", 3: "1"}
+
+	preview, err := service.Preview(nil, 1, window, prizes)
+	assert.NoError(t, err)
+	assert.True(t, preview.DryRun)
+	assert.Len(t, preview.Items, 3)
+	assert.Equal(t, "13500000000000000000", preview.Total.String())
+	assert.Equal(t, PayoutUnlinked, preview.Items[2].Status)
+	assert.Empty(t, service.List(), "previews are not stored")
+
+	current, _ := calendar.Window(WindowDaily, time.Now(), "")
+	_, err = service.Create(nil, 1, current, prizes)
+	assert.ErrorIs(t, err, ErrWindowOpen)
+
+	batch, err := service.Create(nil, 1, window, prizes)
+	require.NoError(t, err)
+	assert.Equal(t, BatchPending, batch.Status)
+	_, err = service.Create(nil, 1, window, prizes)
+	assert.ErrorIs(t, err, ErrPayoutExists)
+
+	// The second transfer cannot be sent, so execution stops there.
+	service, _ = NewPayoutService(path, leaderboard, links, chain, &failAfter{chain: chain, after: 1}, hotWallet)
+	batch, err = service.Execute(context.Background(), batch.ID)
+	assert.Error(t, err)
+	assert.Equal(t, PayoutSent, batch.Items[0].Status)
+	assert.Equal(t, PayoutSent, batch.Items[1].Status)
+	assert.NotEmpty(t, batch.Items[1].Error)
+
+	// A restart loads the ledger and rebroadcasts the signed transfers.
+	service, err = NewPayoutService(path, leaderboard, links, chain, chain, hotWallet)
+	require.NoError(t, err)
+	batch, err = service.Execute(context.Background(), batch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, BatchExecuting, batch.Status)
+	assert.Equal(t, 2, chain.signed, "sent transfers are never signed again")
+
+	chain.mine()
+	batch, err = service.Execute(context.Background(), batch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, BatchCompleted, batch.Status)
+	assert.Equal(t, PayoutPaid, batch.Items[0].Status)
+	assert.Equal(t, PayoutUnlinked, batch.Items[2].Status)
+
+	// A wallet linked after the batch was approved is only paid once resolved.
+	carol := linkWallet(t, links, "carol", "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	batch, err = service.Execute(context.Background(), batch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, PayoutUnlinked, batch.Items[2].Status)
+	batch, err = service.Resolve(batch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, carol.Hex(), batch.Items[2].Address)
+	_, err = service.Execute(context.Background(), batch.ID)
+	assert.NoError(t, err)
+	chain.mine()
+	batch, err = service.Execute(context.Background(), batch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, BatchCompleted, batch.Status)
+	assert.Equal(t, PayoutPaid, batch.Items[2].Status)
+
+	assert.Equal(t, "10000000000000000000", chain.paid[alice].String())
+	assert.Equal(t, "2500000000000000000", chain.paid[bob].String())
+	assert.Equal(t, "1000000000000000000", chain.paid[carol].String())
+	assert.Equal(t, 3, chain.signed)
+}
+
+// failAfter lets the first sends through and fails the rest.
+type failAfter struct {
+	chain *fakeChain
+	after int
+}
+
+func (f *failAfter) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if f.after == 0 {
+		return errors.New("insufficient funds for gas")
+	}
+	f.after--
+	return f.chain.SendTransaction(ctx, tx)
+}
+
+func (f *failAfter) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return f.chain.TransactionReceipt(ctx, hash)
+}
+
+func (f *failAfter) BlockNumber(ctx context.Context) (uint64, error) {
+	return f.chain.BlockNumber(ctx)
+}
+
+func (f *failAfter) NonceAt(ctx context.Context, account common.Address, block *big.Int) (uint64, error) {
+	return f.chain.NonceAt(ctx, account, block)
+}
+
+func (f *failAfter) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return f.chain.FilterLogs(ctx, query)
+}
+
+// laggingNode has lost the receipts of mined transactions and refuses their
+// nonces, like a pruned or lagging node behind a load balancer.
+type laggingNode struct {
+	*fakeChain
+}
+
+func (l laggingNode) SendTransaction(context.Context, *types.Transaction) error {
+	return errors.New("nonce too low")
+}
+
+func (l laggingNode) TransactionReceipt(context.Context, common.Hash) (*types.Receipt, error) {
+	return nil, ethereum.NotFound
+}
+
+func TestPayoutNeverResignsTakenNonces(t *testing.T) {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Truncate(24 * time.Hour).Add(time.Hour)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":30}`, int(yesterday.Unix())),
+	}}
+	calendar := NewLeaderboardCalendar(time.UTC, nil)
+	archive, _ := NewLeaderboardArchive("")
+	leaderboard := NewLeaderboardService(history, nil, ScoreRule{Field: "score"}, calendar, archive)
+	window, _ := calendar.Window(WindowDaily, yesterday, "")
+	links, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := linkWallet(t, links, "alice", aliceKey)
+	hotWallet := &bind.TransactOpts{From: fakeHotWallet}
+
+	t.Run("Mined Transfer Behind A Lagging Node", func(t *testing.T) {
+		chain := newFakeChain()
+		service, _ := NewPayoutService("", leaderboard, links, chain, chain, hotWallet)
+		batch, err := service.Create(nil, 1, window, PrizeTable{1: "1"})
+		require.NoError(t, err)
+		batch, err = service.Execute(context.Background(), batch.ID)
+		require.NoError(t, err)
+		chain.mine()
+
+		service, _ = NewPayoutService("", leaderboard, links, chain, laggingNode{chain}, hotWallet)
+		require.NoError(t, service.(*payouts).save(&batch))
+		batch, err = service.Execute(context.Background(), batch.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, PayoutPaid, batch.Items[0].Status, "the Transfer event proves the payment")
+		assert.Equal(t, 1, chain.signed)
+		assert.Equal(t, "1000000000000000000", chain.paid[alice].String())
+	})
+
+	t.Run("Nonce Taken By A Game Store", func(t *testing.T) {
+		chain := newFakeChain()
+		path := filepath.Join(t.TempDir(), "payouts.json")
+		service, _ := NewPayoutService(path, leaderboard, links, chain, &failAfter{chain: chain}, hotWallet)
+		batch, err := service.Create(nil, 1, window, PrizeTable{1: "1"})
+		require.NoError(t, err)
+		_, err = service.Execute(context.Background(), batch.ID)
+		assert.Error(t, err)
+
+		// A game store takes the nonce the unsent transfer was signed with.
+		require.NoError(t, chain.SendTransaction(context.Background(), types.NewTx(&types.LegacyTx{Nonce: chain.nonce, To: &common.Address{}})))
+		service, _ = NewPayoutService(path, leaderboard, links, chain, chain, hotWallet)
+		batch, err = service.Execute(context.Background(), batch.ID)
+		assert.Error(t, err, "the nonce is only pending")
+		assert.Equal(t, PayoutSent, batch.Items[0].Status)
+
+		chain.mine()
+		batch, err = service.Execute(context.Background(), batch.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, PayoutFailed, batch.Items[0].Status)
+		assert.Contains(t, batch.Items[0].Error, "by hand")
+		assert.Equal(t, BatchExecuting, batch.Status)
+
+		_, err = service.Execute(context.Background(), batch.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, chain.signed, "failed transfers are never signed again")
+		assert.Nil(t, chain.paid[alice])
+	})
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+// Pending session defaults.
+const (
+	// DefaultPendingPoll is how often the receipt of a pending session is checked.
+	DefaultPendingPoll = 2 * time.Second
+	// DefaultPendingTimeout is how long a transaction is waited for before it
+	// is given up on.
+	DefaultPendingTimeout = 10 * time.Minute
+)
+
+// ReceiptReader reads transaction receipts. *ethclient.Client implements it.
+type ReceiptReader interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// PendingSession is a session sent to the contract whose transaction is not
+// mined yet.
+type PendingSession struct {
+	TxHash  string
+	Session storage.GameHistoryGameSession
+	SentAt  time.Time
+}
+
+type PendingSessionService interface {
+	Track(txHash common.Hash, session storage.GameHistoryGameSession)
+	ByGid(gid int) []PendingSession
+	ByUid(uid string) []PendingSession
+	OnSettled(func(session storage.GameHistoryGameSession, mined bool))
+}
+
+type pendingSessions struct {
+	receipts  ReceiptReader
+	poll      time.Duration
+	timeout   time.Duration
+	mutex     sync.RWMutex
+	pending   map[string]PendingSession
+	listeners []func(session storage.GameHistoryGameSession, mined bool)
+}
+
+// NewPendingSessionService creates a service following stored sessions until
+// their transaction is mined.
+//
+// Parameters:
+//   - receipts: The ReceiptReader transactions are followed with, usually the ethclient.
+//   - poll: How often receipts are checked, DefaultPendingPoll when zero.
+//   - timeout: How long a transaction is waited for, DefaultPendingTimeout when zero.
+//
+// Returns:
+//   - res: A PendingSessionService instance.
+func NewPendingSessionService(receipts ReceiptReader, poll, timeout time.Duration) PendingSessionService {
+	if poll <= 0 {
+		poll = DefaultPendingPoll
+	}
+	if timeout <= 0 {
+		timeout = DefaultPendingTimeout
+	}
+	return &pendingSessions{
+		receipts: receipts,
+		poll:     poll,
+		timeout:  timeout,
+		pending:  make(map[string]PendingSession),
+	}
+}
+
+// Track records a session as pending and follows its transaction in the
+// background. The listeners are told once it is mined, reverted or given up
+// on.
+//
+// Parameters:
+//   - txHash: The transaction storing the session.
+//   - session: The stored session.
+func (p *pendingSessions) Track(txHash common.Hash, session storage.GameHistoryGameSession) {
+	p.mutex.Lock()
+	p.pending[txHash.Hex()] = PendingSession{
+		TxHash:  txHash.Hex(),
+		Session: session,
+		SentAt:  time.Now().UTC(),
+	}
+	p.mutex.Unlock()
+
+	go p.follow(txHash)
+}
+
+// ByGid returns the pending sessions of a game, newest first.
+func (p *pendingSessions) ByGid(gid int) []PendingSession {
+	return p.filter(func(session storage.GameHistoryGameSession) bool {
+		return session.Gid != nil && session.Gid.Int64() == int64(gid)
+	})
+}
+
+// ByUid returns the pending sessions of a player, newest first.
+func (p *pendingSessions) ByUid(uid string) []PendingSession {
+	return p.filter(func(session storage.GameHistoryGameSession) bool {
+		return session.Uid == uid
+	})
+}
+
+// OnSettled registers a function called when a pending session stops being
+// pending. mined reports whether the session made it into the contract; it is
+// false for reverted transactions and ones given up on after the timeout.
+func (p *pendingSessions) OnSettled(listener func(session storage.GameHistoryGameSession, mined bool)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.listeners = append(p.listeners, listener)
+}
+
+func (p *pendingSessions) filter(match func(session storage.GameHistoryGameSession) bool) []PendingSession {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	res := make([]PendingSession, 0)
+	for _, pending := range p.pending {
+		if match(pending.Session) {
+			res = append(res, pending)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SentAt.After(res[j].SentAt)
+	})
+	return res
+}
+
+// follow waits for the receipt of a transaction and settles its session.
+func (p *pendingSessions) follow(txHash common.Hash) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(p.poll)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := p.receipts.TransactionReceipt(ctx, txHash)
+		switch {
+		case err == nil:
+			p.settle(txHash, receipt.Status == types.ReceiptStatusSuccessful)
+			return
+		case !errors.Is(err, ethereum.NotFound) && ctx.Err() == nil:
+			log.Println("while reading the receipt of "+txHash.Hex()+": ", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("gave up waiting for session transaction " + txHash.Hex())
+			p.settle(txHash, false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *pendingSessions) settle(txHash common.Hash, mined bool) {
+	p.mutex.Lock()
+	pending, found := p.pending[txHash.Hex()]
+	delete(p.pending, txHash.Hex())
+	listeners := p.listeners
+	p.mutex.Unlock()
+
+	if !found {
+		return
+	}
+	for _, listener := range listeners {
+		listener(pending.Session, mined)
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReceipts is a ReceiptReader whose receipts are added by the test.
+type fakeReceipts struct {
+	mutex    sync.Mutex
+	receipts map[common.Hash]*types.Receipt
+}
+
+func (f *fakeReceipts) TransactionReceipt(_ context.Context, hash common.Hash) (*types.Receipt, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if receipt, found := f.receipts[hash]; found {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *fakeReceipts) mine(hash common.Hash, status uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.receipts[hash] = &types.Receipt{Status: status, TxHash: hash}
+}
+
+type settlement struct {
+	session storage.GameHistoryGameSession
+	mined   bool
+}
+
+func TestPendingSessions(t *testing.T) {
+	receipts := &fakeReceipts{receipts: make(map[common.Hash]*types.Receipt)}
+	service := NewPendingSessionService(receipts, time.Millisecond, 200*time.Millisecond)
+	settled := make(chan settlement, 3)
+	service.OnSettled(func(session storage.GameHistoryGameSession, mined bool) {
+		settled <- settlement{session, mined}
+	})
+
+	first := storage.GameHistoryGameSession{Gid: big.NewInt(1), Uid: "alice", Time: big.NewInt(10)}
+	second := storage.GameHistoryGameSession{Gid: big.NewInt(2), Uid: "alice", Time: big.NewInt(20)}
+	third := storage.GameHistoryGameSession{Gid: big.NewInt(1), Uid: "bob", Time: big.NewInt(30)}
+	service.Track(common.HexToHash("0x1"), first)
+	service.Track(common.HexToHash("0x2"), second)
+	service.Track(common.HexToHash("0x3"), third)
+
+	require.Len(t, service.ByGid(1), 2)
+	assert.Equal(t, "bob", service.ByGid(1)[0].Session.Uid)
+	require.Len(t, service.ByUid("alice"), 2)
+	assert.Equal(t, common.HexToHash("0x2").Hex(), service.ByUid("alice")[0].TxHash)
+
+	receipts.mine(common.HexToHash("0x1"), types.ReceiptStatusSuccessful)
+	receipts.mine(common.HexToHash("0x2"), types.ReceiptStatusFailed)
+
+	outcomes := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case s := <-settled:
+			outcomes[s.session.Uid+s.session.Gid.String()] = s.mined
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected every session to settle")
+		}
+	}
+	assert.Equal(t, map[string]bool{"alice1": true, "alice2": false, "bob1": false}, outcomes)
+	assert.Empty(t, service.ByGid(1))
+	assert.Empty(t, service.ByUid("alice"))
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+// PlayerOverview combines a player's game sessions with the stakes of their
+// linked wallet. Wallet, Stakes and TotalStaked are empty when no wallet is linked.
+type PlayerOverview struct {
+	Uid         string                           `json:"uid"`
+	Wallet      *WalletLink                      `json:"wallet"`
+	Sessions    []storage.GameHistoryGameSession `json:"sessions"`
+	Stakes      []storage.GameHistoryPayment     `json:"stakes"`
+	TotalStaked *big.Int                         `json:"total_staked"`
+}
+
+type PlayerOverviewService interface {
+	Overview(callData *bind.CallOpts, uid string, limit int) (res PlayerOverview, err error)
+}
+
+type playerOverview struct {
+	history GameHistoryContract
+	stakes  StackingContract
+	links   WalletLinkService
+}
+
+// NewPlayerOverviewService creates a new PlayerOverviewService.
+//
+// Parameters:
+//   - history: The GameHistoryContract sessions are read from.
+//   - stakes: The StackingContract payments are read from.
+//   - links: The WalletLinkService that resolves a uid to its wallet.
+//
+// Returns:
+//
+//	A PlayerOverviewService instance.
+func NewPlayerOverviewService(history GameHistoryContract, stakes StackingContract, links WalletLinkService) PlayerOverviewService {
+	return &playerOverview{
+		history: history,
+		stakes:  stakes,
+		links:   links,
+	}
+}
+
+// Overview returns the latest sessions of a player and, when a wallet is
+// linked, the stake history and stake total of that wallet.
+//
+// Parameters:
+//   - callData: Call options for the contract calls.
+//   - uid: The player.
+//   - limit: The most sessions and stakes to return, newest first. 0 returns all.
+//
+// Returns:
+//   - res: The combined view.
+//   - err: Any error that occurred while reading the contract.
+func (p *playerOverview) Overview(callData *bind.CallOpts, uid string, limit int) (res PlayerOverview, err error) {
+	res.Uid = uid
+
+	sessions, err := p.history.GetUserGameData(callData, uid)
+	if err != nil {
+		return res, err
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return compareTime(sessions[i].Time, sessions[j].Time) > 0
+	})
+	res.Sessions = truncate(sessions, limit)
+
+	link, found := p.links.ByUid(uid)
+	if !found {
+		return res, nil
+	}
+	res.Wallet = &link
+
+	address := link.Address.Hex()
+	stakes, err := p.stakes.UserStakeHistory(callData, address)
+	if err != nil {
+		return res, err
+	}
+	sort.SliceStable(stakes, func(i, j int) bool {
+		return compareTime(stakes[i].Time, stakes[j].Time) > 0
+	})
+	res.Stakes = truncate(stakes, limit)
+
+	if res.TotalStaked, err = p.stakes.UserTotal(callData, address); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func truncate[T any](items []T, limit int) []T {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// playerStatsIdle is how long the aggregate of a player nobody asks about is
+// kept before it is dropped.
+const playerStatsIdle = time.Hour
+
+// GameStats summarises a player's sessions of one game.
+// Score fields are nil when none of the sessions held a score.
+type GameStats struct {
+	Gid         int       `json:"gid"`
+	Played      int       `json:"played"`
+	Scored      int       `json:"scored"`
+	FirstPlayed time.Time `json:"first_played"`
+	LastPlayed  time.Time `json:"last_played"`
+	Best        *float64  `json:"best"`
+	Average     *float64  `json:"average"`
+	Median      *float64  `json:"median"`
+}
+
+// WeeklySessions counts the sessions played in one week.
+type WeeklySessions struct {
+	Week     string `json:"week"`
+	Sessions int    `json:"sessions"`
+}
+
+// PlayerStats summarises every session of a player.
+//
+// Streaks count consecutive calendar days with at least one session. The
+// current streak is 0 unless the player played today or yesterday.
+type PlayerStats struct {
+	Uid           string           `json:"uid"`
+	TotalSessions int              `json:"total_sessions"`
+	FirstPlayed   time.Time        `json:"first_played"`
+	LastPlayed    time.Time        `json:"last_played"`
+	CurrentStreak int              `json:"current_streak"`
+	LongestStreak int              `json:"longest_streak"`
+	Games         []GameStats      `json:"games"`
+	Weekly        []WeeklySessions `json:"weekly"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+type PlayerStatsService interface {
+	Stats(callData *bind.CallOpts, uid string) (res PlayerStats, err error)
+}
+
+type playerStats struct {
+	history  GameHistoryContract
+	rule     func(gid int) ScoreRule
+	calendar *LeaderboardCalendar
+	ttl      time.Duration
+	mutex    sync.Mutex
+	players  *utils.Cache[utils.Uid, *playerAggregate]
+}
+
+// NewPlayerStatsService creates a new PlayerStatsService.
+//
+// Parameters:
+//   - history: The GameHistoryContract sessions are read from.
+//   - rule: Returns the score rule of a game, usually LeaderboardService.Rule.
+//   - calendar: The calendar days and weeks are counted in.
+//   - ttl: How long a player's stats are served before new sessions are read.
+//
+// Returns:
+//
+//	A PlayerStatsService instance.
+func NewPlayerStatsService(history GameHistoryContract, rule func(gid int) ScoreRule, calendar *LeaderboardCalendar, ttl time.Duration) PlayerStatsService {
+	return &playerStats{
+		history:  history,
+		rule:     rule,
+		calendar: calendar,
+		ttl:      ttl,
+		players:  utils.NewNamespace[utils.Uid, *playerAggregate](utils.NewCache(), "players"),
+	}
+}
+
+// Stats returns the statistics of a player.
+//
+// Each player's aggregate is kept in a bounded cache between calls and only
+// the sessions not folded in yet are added. When a folded session is gone,
+// eg flagged by anti-cheat, the aggregate is rebuilt.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - uid: The player.
+//
+// Returns:
+//   - res: The player's statistics.
+//   - err: Any error that occurred while reading the user history.
+func (p *playerStats) Stats(callData *bind.CallOpts, uid string) (res PlayerStats, err error) {
+	p.mutex.Lock()
+	aggregate, ok := p.players.Get(utils.Uid(uid))
+	if !ok {
+		aggregate = newPlayerAggregate(uid)
+	}
+	p.players.Set(utils.Uid(uid), aggregate, playerStatsIdle)
+	p.mutex.Unlock()
+
+	aggregate.mutex.Lock()
+	defer aggregate.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(aggregate.refreshed) >= p.ttl {
+		sessions, err := p.history.GetUserGameData(callData, uid)
+		if err != nil {
+			return res, err
+		}
+		aggregate.update(sessions, p.rule, p.calendar)
+		aggregate.refreshed = now
+	}
+	return aggregate.snapshot(p.rule, p.calendar, now), nil
+}
+
+type gameAggregate struct {
+	played int
+	first  time.Time
+	last   time.Time
+	sum    float64
+	scores []float64
+}
+
+type playerAggregate struct {
+	mutex     sync.Mutex
+	uid       string
+	folded    map[string]int
+	refreshed time.Time
+	total     int
+	first     time.Time
+	last      time.Time
+	games     map[int]*gameAggregate
+	days      map[int]bool
+	weeks     map[string]int
+}
+
+func newPlayerAggregate(uid string) *playerAggregate {
+	aggregate := &playerAggregate{uid: uid}
+	aggregate.reset()
+	return aggregate
+}
+
+// reset forgets every session folded in so far.
+func (a *playerAggregate) reset() {
+	a.folded = make(map[string]int)
+	a.total = 0
+	a.first = time.Time{}
+	a.last = time.Time{}
+	a.games = make(map[int]*gameAggregate)
+	a.days = make(map[int]bool)
+	a.weeks = make(map[string]int)
+}
+
+// dayNumber numbers calendar days so consecutive days differ by one.
+func dayNumber(calendar *LeaderboardCalendar, at time.Time) int {
+	day, _ := calendar.Window(WindowDaily, at, "")
+	year, month, date := day.Start.Date()
+	return int(time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// update folds in the sessions not folded in yet, counted by fingerprint. It
+// starts over when a folded session is missing from sessions.
+func (a *playerAggregate) update(sessions []storage.GameHistoryGameSession, rule func(gid int) ScoreRule, calendar *LeaderboardCalendar) {
+	fingerprints := make([]string, len(sessions))
+	current := make(map[string]int, len(sessions))
+	for i, session := range sessions {
+		fingerprints[i] = SessionFingerprint(session)
+		current[fingerprints[i]]++
+	}
+	for fingerprint, count := range a.folded {
+		if current[fingerprint] < count {
+			a.reset()
+			break
+		}
+	}
+
+	pending := make(map[string]int, len(current))
+	for fingerprint, count := range current {
+		pending[fingerprint] = count - a.folded[fingerprint]
+	}
+	for i, session := range sessions {
+		if pending[fingerprints[i]] == 0 {
+			continue
+		}
+		pending[fingerprints[i]]--
+		a.folded[fingerprints[i]]++
+		a.add(session, rule, calendar)
+	}
+}
+
+func (a *playerAggregate) add(session storage.GameHistoryGameSession, rule func(gid int) ScoreRule, calendar *LeaderboardCalendar) {
+	at := SessionTime(session.Time)
+	gid := int(session.Gid.Int64())
+
+	a.total++
+	if a.first.IsZero() || at.Before(a.first) {
+		a.first = at
+	}
+	if at.After(a.last) {
+		a.last = at
+	}
+
+	a.days[dayNumber(calendar, at)] = true
+	week, _ := calendar.Window(WindowWeekly, at, "")
+	a.weeks[week.Key[len(WindowWeekly)+1:]]++
+
+	game, ok := a.games[gid]
+	if !ok {
+		game = &gameAggregate{first: at}
+		a.games[gid] = game
+	}
+	game.played++
+	if at.Before(game.first) {
+		game.first = at
+	}
+	if at.After(game.last) {
+		game.last = at
+	}
+
+	score, err := ExtractScore(session.Data, rule(gid).Field)
+	if err != nil {
+		return
+	}
+	game.sum += score
+	index := sort.SearchFloat64s(game.scores, score)
+	game.scores = append(game.scores, 0)
+	copy(game.scores[index+1:], game.scores[index:])
+	game.scores[index] = score
+}
+
+func (a *playerAggregate) snapshot(rule func(gid int) ScoreRule, calendar *LeaderboardCalendar, now time.Time) PlayerStats {
+	res := PlayerStats{
+		Uid:           a.uid,
+		TotalSessions: a.total,
+		FirstPlayed:   a.first,
+		LastPlayed:    a.last,
+		Games:         make([]GameStats, 0, len(a.games)),
+		Weekly:        make([]WeeklySessions, 0, len(a.weeks)),
+		UpdatedAt:     a.refreshed,
+	}
+
+	for gid, game := range a.games {
+		stats := GameStats{
+			Gid:         gid,
+			Played:      game.played,
+			Scored:      len(game.scores),
+			FirstPlayed: game.first,
+			LastPlayed:  game.last,
+		}
+		if n := len(game.scores); n > 0 {
+			best := game.scores[n-1]
+			if rule(gid).Ascending {
+				best = game.scores[0]
+			}
+			average := game.sum / float64(n)
+			median := game.scores[n/2]
+			if n%2 == 0 {
+				median = (game.scores[n/2-1] + game.scores[n/2]) / 2
+			}
+			stats.Best, stats.Average, stats.Median = &best, &average, &median
+		}
+		res.Games = append(res.Games, stats)
+	}
+	sort.Slice(res.Games, func(i, j int) bool {
+		return res.Games[i].Gid < res.Games[j].Gid
+	})
+
+	for week, sessions := range a.weeks {
+		res.Weekly = append(res.Weekly, WeeklySessions{Week: week, Sessions: sessions})
+	}
+	sort.Slice(res.Weekly, func(i, j int) bool {
+		return res.Weekly[i].Week < res.Weekly[j].Week
+	})
+
+	res.CurrentStreak, res.LongestStreak = a.streaks(calendar, now)
+	return res
+}
+
+// streaks walks the played days in order to find the longest run of
+// consecutive days and the run that is still going.
+func (a *playerAggregate) streaks(calendar *LeaderboardCalendar, now time.Time) (current int, longest int) {
+	days := make([]int, 0, len(a.days))
+	for day := range a.days {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+
+	run := 0
+	for i, day := range days {
+		if i > 0 && days[i-1]+1 == day {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	if len(days) == 0 {
+		return 0, 0
+	}
+	today := dayNumber(calendar, now)
+	if last := days[len(days)-1]; last == today || last+1 == today {
+		current = run
+	}
+	return current, longest
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayerStats(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	day := func(offset int) int { return int(today.AddDate(0, 0, offset).Unix()) }
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, day(-10)),
+		session(1, "t", "alice", `{"score":30}`, day(-9)),
+		session(1, "t", "alice", `{"score":20}`, day(-8)),
+		session(2, "t", "alice", `{"ms":900}`, day(-1)),
+		session(2, "t", "alice", `{"ms":700}`, day(0)),
+		session(2, "t", "alice", `no score`, day(0)),
+		session(1, "t", "bob", `{"score":99}`, day(0)),
+	}}
+	rules := map[int]ScoreRule{2: {Field: "ms", Ascending: true}}
+	rule := func(gid int) ScoreRule {
+		if r, ok := rules[gid]; ok {
+			return r
+		}
+		return ScoreRule{Field: "score"}
+	}
+	service := NewPlayerStatsService(history, rule, NewLeaderboardCalendar(nil, nil), 0)
+
+	res, err := service.Stats(nil, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, res.TotalSessions)
+	assert.Equal(t, 3, res.LongestStreak)
+	assert.Equal(t, 2, res.CurrentStreak)
+	assert.Len(t, res.Games, 2)
+
+	first := res.Games[0]
+	assert.Equal(t, 1, first.Gid)
+	assert.Equal(t, 3, first.Played)
+	assert.Equal(t, 30.0, *first.Best)
+	assert.Equal(t, 20.0, *first.Average)
+	assert.Equal(t, 20.0, *first.Median)
+
+	second := res.Games[1]
+	assert.Equal(t, 3, second.Played)
+	assert.Equal(t, 2, second.Scored)
+	assert.Equal(t, 700.0, *second.Best, "ascending games keep the lowest score")
+	assert.Equal(t, 800.0, *second.Median)
+
+	total := 0
+	for _, week := range res.Weekly {
+		total += week.Sessions
+	}
+	assert.Equal(t, 6, total)
+
+	// new sessions are folded into the kept aggregate
+	history.sessions = append(history.sessions, session(1, "t", "alice", `{"score":50}`, day(0)))
+	res, err = service.Stats(nil, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, res.TotalSessions)
+	assert.Equal(t, 50.0, *res.Games[0].Best)
+	assert.Equal(t, 25.0, *res.Games[0].Median)
+}
+
+func TestPlayerStatsServesCachedAggregate(t *testing.T) {
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, 100),
+	}}
+	service := NewPlayerStatsService(history, func(int) ScoreRule { return ScoreRule{Field: "score"} }, NewLeaderboardCalendar(nil, nil), time.Hour)
+
+	res, _ := service.Stats(nil, "alice")
+	assert.Equal(t, 1, res.TotalSessions)
+
+	history.sessions = append(history.sessions, session(1, "t", "alice", `{"score":20}`, 200))
+	res, _ = service.Stats(nil, "alice")
+	assert.Equal(t, 1, res.TotalSessions, "stats should be served from the cached aggregate until the ttl passes")
+}
+
+func TestPlayerStatsRebuildsWhenSessionsAreExcluded(t *testing.T) {
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, 100),
+		session(1, "t", "alice", `{"score":900}`, 200),
+	}}
+	service := NewPlayerStatsService(history, func(int) ScoreRule { return ScoreRule{Field: "score"} }, NewLeaderboardCalendar(nil, nil), 0)
+
+	res, _ := service.Stats(nil, "alice")
+	assert.Equal(t, 900.0, *res.Games[0].Best)
+
+	// the suspicious session is flagged while a new one arrives, so the
+	// history keeps its length
+	history.sessions = []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":10}`, 100),
+		session(1, "t", "alice", `{"score":30}`, 300),
+	}
+	res, _ = service.Stats(nil, "alice")
+	assert.Equal(t, 2, res.TotalSessions)
+	assert.Equal(t, 30.0, *res.Games[0].Best)
+	assert.Equal(t, 20.0, *res.Games[0].Average)
+}
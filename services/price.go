@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// ErrPriceNotFound is returned when a provider has no quote for a symbol.
+var ErrPriceNotFound = errors.New("price not found")
+
+// DefaultTokenDecimals holds the on-chain decimals of the tokens the api values.
+var DefaultTokenDecimals = map[string]uint8{
+	"EGC":   18,
+	"MATIC": 18,
+	"USDT":  6,
+	"USDC":  6,
+	"DAI":   18,
+}
+
+// PriceProvider quotes the fiat price of one whole unit of a token.
+type PriceProvider interface {
+	Price(ctx context.Context, symbol string) (float64, error)
+}
+
+// PriceService quotes token prices through a provider, caching them, and
+// values raw token amounts in fiat.
+type PriceService interface {
+	Price(ctx context.Context, symbol string) (float64, error)
+	Value(ctx context.Context, symbol string, amount *big.Int) (*FiatValue, error)
+}
+
+// FiatValue is the fiat valuation of a raw token amount.
+type FiatValue struct {
+	Symbol   string  `json:"symbol"`
+	Currency string  `json:"currency"`
+	Price    float64 `json:"price"`
+	Value    string  `json:"value"`
+}
+
+type priceService struct {
+	provider PriceProvider
+	cache    *utils.Cache[string, float64]
+	ttl      time.Duration
+	decimals map[string]uint8
+}
+
+// NewPriceService creates a new PriceService backed by the given provider.
+//
+// Parameters:
+//   - provider: The PriceProvider used on a cache miss.
+//   - ttl: How long a quote is served from the cache before it is refreshed.
+//   - decimals: Token decimals keyed by symbol, DefaultTokenDecimals is used when nil.
+//
+// Returns:
+//
+//	A PriceService instance.
+func NewPriceService(provider PriceProvider, ttl time.Duration, decimals map[string]uint8) PriceService {
+	if decimals == nil {
+		decimals = DefaultTokenDecimals
+	}
+	return &priceService{
+		provider: provider,
+		cache:    utils.NewNamespace[string, float64](utils.NewCache(), "prices"),
+		ttl:      ttl,
+		decimals: decimals,
+	}
+}
+
+// Price returns the fiat price of a token, serving cached quotes while they are fresh.
+//
+// Parameters:
+//   - ctx: The context for the provider call.
+//   - symbol: The token ticker, matched case insensitively.
+//
+// Returns:
+//   - res: The price of one whole token.
+//   - err: An error if the provider could not quote the token.
+func (p *priceService) Price(ctx context.Context, symbol string) (res float64, err error) {
+	symbol = strings.ToUpper(symbol)
+	if cached, found := p.cache.Get(symbol); found {
+		return cached, nil
+	}
+
+	res, err = p.provider.Price(ctx, symbol)
+	if err != nil {
+		return 0, err
+	}
+	p.cache.Set(symbol, res, p.ttl)
+	return res, nil
+}
+
+// Value converts a raw on-chain amount of a token into its fiat value.
+//
+// Parameters:
+//   - ctx: The context for the provider call.
+//   - symbol: The token ticker.
+//   - amount: The amount in the token's smallest unit.
+//
+// Returns:
+//   - res: The valuation, with the value rendered to two decimal places.
+//   - err: An error if the token is unknown or could not be priced.
+func (p *priceService) Value(ctx context.Context, symbol string, amount *big.Int) (res *FiatValue, err error) {
+	symbol = strings.ToUpper(symbol)
+	decimals, ok := p.decimals[symbol]
+	if !ok {
+		return nil, fmt.Errorf("unknown token %s", symbol)
+	}
+
+	price, err := p.Price(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	res = &FiatValue{
+		Symbol:   symbol,
+		Currency: "USD",
+		Price:    price,
+		Value:    FiatAmount(amount, decimals, price),
+	}
+	return res, nil
+}
+
+// FiatAmount multiplies a raw token amount by a unit price and renders the
+// result with two decimal places.
+func FiatAmount(amount *big.Int, decimals uint8, price float64) string {
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	value := new(big.Float).SetPrec(256).SetInt(amount)
+	value.Quo(value, unit)
+	value.Mul(value, big.NewFloat(price))
+	return value.Text('f', 2)
+}
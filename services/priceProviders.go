@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// aggregatorABI is the subset of the Chainlink AggregatorV3Interface read by the api.
+const aggregatorABI = `[{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"latestRoundData","outputs":[{"internalType":"uint80","name":"roundId","type":"uint80"},{"internalType":"int256","name":"answer","type":"int256"},{"internalType":"uint256","name":"startedAt","type":"uint256"},{"internalType":"uint256","name":"updatedAt","type":"uint256"},{"internalType":"uint80","name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}]`
+
+// StaticPriceProvider quotes prices from a fixed table.
+type StaticPriceProvider map[string]float64
+
+// Price returns the table price for symbol.
+func (s StaticPriceProvider) Price(_ context.Context, symbol string) (float64, error) {
+	price, ok := s[strings.ToUpper(symbol)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrPriceNotFound, symbol)
+	}
+	return price, nil
+}
+
+type aggregatorPriceProvider struct {
+	caller bind.ContractCaller
+	feeds  map[string]common.Address
+}
+
+// NewAggregatorPriceProvider creates a PriceProvider that reads Chainlink style
+// USD price feeds.
+//
+// Parameters:
+//   - caller: The contract caller used for the eth_calls, usually the ethclient.
+//   - feeds: The aggregator contract address keyed by token symbol.
+//
+// Returns:
+//
+//	A PriceProvider instance.
+func NewAggregatorPriceProvider(caller bind.ContractCaller, feeds map[string]common.Address) PriceProvider {
+	upper := make(map[string]common.Address, len(feeds))
+	for symbol, address := range feeds {
+		upper[strings.ToUpper(symbol)] = address
+	}
+	return &aggregatorPriceProvider{caller: caller, feeds: upper}
+}
+
+// Price reads the latest round of the symbol's aggregator and scales it by the feed decimals.
+func (a *aggregatorPriceProvider) Price(ctx context.Context, symbol string) (float64, error) {
+	address, ok := a.feeds[strings.ToUpper(symbol)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrPriceNotFound, symbol)
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(aggregatorABI))
+	if err != nil {
+		return 0, err
+	}
+	feed := bind.NewBoundContract(address, parsed, a.caller, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	var decimals []interface{}
+	if err := feed.Call(opts, &decimals, "decimals"); err != nil {
+		return 0, err
+	}
+	var round []interface{}
+	if err := feed.Call(opts, &round, "latestRoundData"); err != nil {
+		return 0, err
+	}
+
+	answer := round[1].(*big.Int)
+	if answer.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid answer %s from feed %s", answer, address.Hex())
+	}
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals[0].(uint8))), nil))
+	price, _ := new(big.Float).Quo(new(big.Float).SetInt(answer), unit).Float64()
+	return price, nil
+}
+
+// httpPriceQuote is the body returned by a price api and by FakePriceHandler.
+type httpPriceQuote struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+type httpPriceProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPPriceProvider creates a PriceProvider that queries a price api.
+//
+// The api is called as GET {baseURL}?symbol=EGC and must answer with
+// {"symbol":"EGC","price":0.01}, or 404 when the symbol is unknown.
+//
+// Parameters:
+//   - baseURL: The price endpoint.
+//   - timeout: The timeout of each request.
+//
+// Returns:
+//
+//	A PriceProvider instance.
+func NewHTTPPriceProvider(baseURL string, timeout time.Duration) PriceProvider {
+	return &httpPriceProvider{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Price requests the quote for symbol from the price api.
+func (h *httpPriceProvider) Price(ctx context.Context, symbol string) (float64, error) {
+	endpoint := h.baseURL + "?symbol=" + url.QueryEscape(strings.ToUpper(symbol))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("%w: %s", ErrPriceNotFound, symbol)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("price api responded with %s", resp.Status)
+	}
+
+	var quote httpPriceQuote
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		return 0, err
+	}
+	return quote.Price, nil
+}
+
+// FakePriceHandler serves prices from a fixed table using the protocol expected
+// by NewHTTPPriceProvider. It stands in for the price api in tests and local runs.
+func FakePriceHandler(prices map[string]float64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.ToUpper(r.URL.Query().Get("symbol"))
+		price, ok := prices[symbol]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(httpPriceQuote{Symbol: symbol, Price: price})
+	})
+}
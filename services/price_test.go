@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingProvider counts the calls that reach the underlying provider.
+type countingProvider struct {
+	PriceProvider
+	calls int
+}
+
+func (c *countingProvider) Price(ctx context.Context, symbol string) (float64, error) {
+	c.calls++
+	return c.PriceProvider.Price(ctx, symbol)
+}
+
+// fakeAggregator answers eth_calls like a Chainlink aggregator with 8 decimals.
+type fakeAggregator struct {
+	answer *big.Int
+}
+
+func (f *fakeAggregator) CodeAt(_ context.Context, _ common.Address, _ *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (f *fakeAggregator) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	parsed, _ := abi.JSON(strings.NewReader(aggregatorABI))
+	method, err := parsed.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if method.Name == "decimals" {
+		return method.Outputs.Pack(uint8(8))
+	}
+	return method.Outputs.Pack(big.NewInt(1), f.answer, big.NewInt(0), big.NewInt(0), big.NewInt(1))
+}
+
+func TestStaticPriceProvider(t *testing.T) {
+	provider := StaticPriceProvider{"EGC": 0.01}
+
+	price, err := provider.Price(context.Background(), "egc")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.01, price)
+
+	_, err = provider.Price(context.Background(), "BTC")
+	assert.True(t, errors.Is(err, ErrPriceNotFound))
+}
+
+func TestAggregatorPriceProvider(t *testing.T) {
+	feed := common.HexToAddress("0x1")
+	provider := NewAggregatorPriceProvider(&fakeAggregator{answer: big.NewInt(71_500_000)}, map[string]common.Address{"matic": feed})
+
+	price, err := provider.Price(context.Background(), "MATIC")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.715, price)
+
+	_, err = provider.Price(context.Background(), "EGC")
+	assert.True(t, errors.Is(err, ErrPriceNotFound))
+
+	bad := NewAggregatorPriceProvider(&fakeAggregator{answer: big.NewInt(0)}, map[string]common.Address{"MATIC": feed})
+	_, err = bad.Price(context.Background(), "MATIC")
+	assert.Error(t, err)
+}
+
+func TestHTTPPriceProvider(t *testing.T) {
+	server := httptest.NewServer(FakePriceHandler(map[string]float64{"USDT": 1}))
+	defer server.Close()
+	provider := NewHTTPPriceProvider(server.URL, time.Second)
+
+	price, err := provider.Price(context.Background(), "usdt")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, price)
+
+	_, err = provider.Price(context.Background(), "EGC")
+	assert.True(t, errors.Is(err, ErrPriceNotFound))
+}
+
+func TestPriceServiceCachesQuotes(t *testing.T) {
+	provider := &countingProvider{PriceProvider: StaticPriceProvider{"EGC": 0.5}}
+	service := NewPriceService(provider, time.Minute, nil)
+
+	for i := 0; i < 3; i++ {
+		price, err := service.Price(context.Background(), "EGC")
+		assert.NoError(t, err)
+		assert.Equal(t, 0.5, price)
+	}
+	assert.Equal(t, 1, provider.calls, "quotes should be served from the cache")
+
+	expiring := NewPriceService(provider, time.Millisecond, nil)
+	expiring.Price(context.Background(), "EGC")
+	time.Sleep(5 * time.Millisecond)
+	expiring.Price(context.Background(), "EGC")
+	assert.Equal(t, 3, provider.calls, "expired quotes should be refreshed")
+}
+
+func TestPriceServiceValue(t *testing.T) {
+	service := NewPriceService(StaticPriceProvider{"MATIC": 0.7, "USDT": 1}, time.Minute, nil)
+
+	// 2.5 MATIC
+	amount, _ := new(big.Int).SetString("2500000000000000000", 10)
+	value, err := service.Value(context.Background(), "matic", amount)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.75", value.Value)
+	assert.Equal(t, "USD", value.Currency)
+
+	// 12.345678 USDT with 6 decimals
+	value, err = service.Value(context.Background(), "USDT", big.NewInt(12_345_678))
+	assert.NoError(t, err)
+	assert.Equal(t, "12.35", value.Value)
+
+	_, err = service.Value(context.Background(), "DOGE", big.NewInt(1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Session feed defaults.
+const (
+	// DefaultFeedBuffer is how many live sessions a subscriber may fall behind
+	// by before it is dropped.
+	DefaultFeedBuffer = 64
+	// MaxFeedReplay is how many stored sessions a resumed subscription replays
+	// at most, the newest ones.
+	MaxFeedReplay = 1000
+)
+
+// FeedTopic names the sessions a feed subscriber follows: those of a player
+// when Uid is set, otherwise those of a game.
+type FeedTopic struct {
+	Gid int
+	Uid string
+}
+
+// GameTopic follows the sessions of a game.
+func GameTopic(gid int) FeedTopic {
+	return FeedTopic{Gid: gid}
+}
+
+// UserTopic follows the sessions of a player.
+func UserTopic(uid string) FeedTopic {
+	return FeedTopic{Uid: uid}
+}
+
+// String names the topic as "games:7" or "users:alice".
+func (t FeedTopic) String() string {
+	if t.Uid != "" {
+		return historyKey(usersNamespace, t.Uid)
+	}
+	return historyKey(gamesNamespace, t.Gid)
+}
+
+// Matches reports whether a session belongs to the topic.
+func (t FeedTopic) Matches(session storage.GameHistoryGameSession) bool {
+	if t.Uid != "" {
+		return session.Uid == t.Uid
+	}
+	return session.Gid != nil && session.Gid.Int64() == int64(t.Gid)
+}
+
+// FeedEvent is a session pushed to feed subscribers. Cursor is the position
+// of the session, which a subscription resumes after.
+type FeedEvent struct {
+	Topic   string                         `json:"topic"`
+	Cursor  string                         `json:"cursor"`
+	Session storage.GameHistoryGameSession `json:"session"`
+}
+
+// FeedSubscription delivers the sessions of a topic.
+type FeedSubscription struct {
+	// Topic is what the subscription follows.
+	Topic FeedTopic
+	// Events delivers the replayed sessions and then the live ones, oldest
+	// first. It is closed once the subscription is closed or dropped.
+	Events <-chan FeedEvent
+
+	feed    *sessionFeed
+	live    chan FeedEvent
+	events  chan FeedEvent
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Bool
+}
+
+// Close ends the subscription.
+func (s *FeedSubscription) Close() {
+	s.once.Do(func() {
+		s.feed.remove(s)
+		close(s.done)
+	})
+}
+
+// Dropped reports whether the subscription ended because it fell behind the
+// live sessions. Its subscriber should resume from the last cursor it got.
+func (s *FeedSubscription) Dropped() bool {
+	return s.dropped.Load()
+}
+
+// SessionFeed pushes sessions to subscribers as they are confirmed.
+type SessionFeed interface {
+	Settled(session storage.GameHistoryGameSession, mined bool)
+	Subscribe(topic FeedTopic, cursor *utils.Cursor) (*FeedSubscription, error)
+}
+
+type sessionFeed struct {
+	history  GameHistoryContract
+	callOpts *bind.CallOpts
+	buffer   int
+	mutex    sync.Mutex
+	subs     map[*FeedSubscription]bool
+}
+
+// NewSessionFeed creates a SessionFeed resuming subscriptions from a history.
+//
+// Parameters:
+//   - history: The GameHistoryContract resumed subscriptions replay from.
+//   - callOpts: The options of the history reads.
+//   - buffer: How many live sessions a subscriber may fall behind by,
+//     DefaultFeedBuffer when zero.
+//
+// Returns:
+//   - res: A SessionFeed instance.
+func NewSessionFeed(history GameHistoryContract, callOpts *bind.CallOpts, buffer int) SessionFeed {
+	if buffer <= 0 {
+		buffer = DefaultFeedBuffer
+	}
+	return &sessionFeed{
+		history:  history,
+		callOpts: callOpts,
+		buffer:   buffer,
+		subs:     make(map[*FeedSubscription]bool),
+	}
+}
+
+// Settled pushes a mined session to the subscribers of its game and player.
+// Sessions that were not mined are not pushed. A subscriber whose buffer is
+// full is dropped rather than holding up the others.
+//
+// It is meant to be registered with PendingSessionService.OnSettled.
+func (f *sessionFeed) Settled(session storage.GameHistoryGameSession, mined bool) {
+	if !mined {
+		return
+	}
+	cursor := feedCursor(session)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for sub := range f.subs {
+		if !sub.Topic.Matches(session) {
+			continue
+		}
+		select {
+		case sub.live <- FeedEvent{Topic: sub.Topic.String(), Cursor: cursor, Session: session}:
+		default:
+			sub.dropped.Store(true)
+			delete(f.subs, sub)
+			close(sub.live)
+		}
+	}
+}
+
+// Subscribe follows the sessions of a topic. With a cursor the sessions
+// stored after it are replayed first, up to MaxFeedReplay of them.
+//
+// Parameters:
+//   - topic: The game or player to follow.
+//   - cursor: The cursor of the last session the subscriber saw, or nil to
+//     only get live sessions.
+//
+// Returns:
+//   - res: The subscription, to be closed by the subscriber.
+//   - err: An error when the history to replay cannot be read.
+func (f *sessionFeed) Subscribe(topic FeedTopic, cursor *utils.Cursor) (res *FeedSubscription, err error) {
+	events := make(chan FeedEvent)
+	sub := &FeedSubscription{
+		Topic:  topic,
+		Events: events,
+		feed:   f,
+		live:   make(chan FeedEvent, f.buffer),
+		events: events,
+		done:   make(chan struct{}),
+	}
+
+	// Sessions settling while the history is read are held in the live
+	// buffer and skipped when already replayed.
+	f.mutex.Lock()
+	f.subs[sub] = true
+	f.mutex.Unlock()
+
+	var replay []FeedEvent
+	if cursor != nil {
+		replay, err = f.replay(topic, *cursor)
+		if err != nil {
+			f.remove(sub)
+			return nil, err
+		}
+	}
+	go sub.forward(replay)
+	return sub, nil
+}
+
+// replay lists the stored sessions of a topic after a cursor, oldest first.
+func (f *sessionFeed) replay(topic FeedTopic, cursor utils.Cursor) ([]FeedEvent, error) {
+	var history []storage.GameHistoryGameSession
+	var err error
+	if topic.Uid != "" {
+		history, err = f.history.GetUserGameData(f.callOpts, topic.Uid)
+	} else {
+		history, err = f.history.GetGameData(f.callOpts, topic.Gid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	history = append([]storage.GameHistoryGameSession(nil), history...)
+	SessionsNewestFirst.Sort(history)
+
+	// Newer sessions lead the history; they end at the cursor session, or
+	// at the first one not after it once that session is gone.
+	end := -1
+	for i, session := range history {
+		if SessionFingerprint(session) == cursor.ID {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		end = 0
+		for end < len(history) && history[end].Time != nil && history[end].Time.Int64() > cursor.Position {
+			end++
+		}
+	}
+	end = min(end, MaxFeedReplay)
+
+	res := make([]FeedEvent, 0, end)
+	for i := end - 1; i >= 0; i-- {
+		res = append(res, FeedEvent{Topic: topic.String(), Cursor: feedCursor(history[i]), Session: history[i]})
+	}
+	return res, nil
+}
+
+func (f *sessionFeed) remove(sub *FeedSubscription) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.subs[sub] {
+		delete(f.subs, sub)
+		close(sub.live)
+	}
+}
+
+// forward delivers the replayed sessions and then the live ones.
+func (s *FeedSubscription) forward(replay []FeedEvent) {
+	defer close(s.events)
+
+	replayed := make(map[string]bool, len(replay))
+	for _, event := range replay {
+		replayed[event.Cursor] = true
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+	for {
+		select {
+		case event, open := <-s.live:
+			if !open {
+				return
+			}
+			if replayed[event.Cursor] {
+				continue
+			}
+			select {
+			case s.events <- event:
+			case <-s.done:
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// feedCursor positions a session by its time, as history pages do.
+func feedCursor(session storage.GameHistoryGameSession) string {
+	cursor := utils.Cursor{ID: SessionFingerprint(session)}
+	if session.Time != nil {
+		cursor.Position = session.Time.Int64()
+	}
+	return cursor.Encode()
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent waits for the next event of a subscription.
+func nextEvent(t *testing.T, sub *FeedSubscription) FeedEvent {
+	t.Helper()
+	select {
+	case event, open := <-sub.Events:
+		require.True(t, open, "subscription ended")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+	}
+	return FeedEvent{}
+}
+
+func TestSessionFeedPushesMinedSessions(t *testing.T) {
+	feed := NewSessionFeed(&fakeGameHistory{}, nil, 0)
+	game, err := feed.Subscribe(GameTopic(1), nil)
+	require.NoError(t, err)
+	defer game.Close()
+	player, err := feed.Subscribe(UserTopic("bob"), nil)
+	require.NoError(t, err)
+	defer player.Close()
+
+	feed.Settled(session(1, "a", "alice", "{}", 10), false)
+	feed.Settled(session(2, "b", "bob", "{}", 11), true)
+	feed.Settled(session(1, "c", "bob", "{}", 12), true)
+
+	event := nextEvent(t, game)
+	assert.Equal(t, "games:1", event.Topic)
+	assert.Equal(t, "c", event.Session.Gtid)
+
+	assert.Equal(t, "b", nextEvent(t, player).Session.Gtid)
+	event = nextEvent(t, player)
+	assert.Equal(t, "users:bob", event.Topic)
+	assert.Equal(t, "c", event.Session.Gtid)
+}
+
+func TestSessionFeedResumesFromCursor(t *testing.T) {
+	stored := []storage.GameHistoryGameSession{
+		session(1, "a", "alice", "{}", 10),
+		session(1, "b", "alice", "{}", 20),
+		session(1, "c", "alice", "{}", 30),
+	}
+	history := &fakeGameHistory{sessions: stored}
+	feed := NewSessionFeed(history, nil, 0)
+
+	cursor, err := utils.DecodeCursor(feedCursor(stored[0]))
+	require.NoError(t, err)
+	sub, err := feed.Subscribe(GameTopic(1), &cursor)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// A session replayed from the history is not pushed twice.
+	feed.Settled(stored[2], true)
+	feed.Settled(session(1, "d", "alice", "{}", 40), true)
+
+	for _, gtid := range []string{"b", "c", "d"} {
+		assert.Equal(t, gtid, nextEvent(t, sub).Session.Gtid)
+	}
+
+	// A cursor whose session is gone resumes after its time.
+	gone, _ := utils.DecodeCursor(feedCursor(session(1, "x", "alice", "{}", 25)))
+	resumed, err := feed.Subscribe(GameTopic(1), &gone)
+	require.NoError(t, err)
+	defer resumed.Close()
+	assert.Equal(t, "c", nextEvent(t, resumed).Session.Gtid)
+}
+
+func TestSessionFeedDropsSlowSubscribers(t *testing.T) {
+	feed := NewSessionFeed(&fakeGameHistory{}, nil, 2)
+	slow, err := feed.Subscribe(GameTopic(1), nil)
+	require.NoError(t, err)
+	defer slow.Close()
+
+	// The first session is taken by the forwarder, two more fill the buffer.
+	for i := 0; i < 5; i++ {
+		feed.Settled(session(1, "t", "alice", "{}", i), true)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	delivered := 0
+	for range slow.Events {
+		delivered++
+	}
+	assert.True(t, slow.Dropped())
+	assert.Less(t, delivered, 5)
+
+	closed, err := feed.Subscribe(GameTopic(1), nil)
+	require.NoError(t, err)
+	closed.Close()
+	_, open := <-closed.Events
+	assert.False(t, open)
+	assert.False(t, closed.Dropped())
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// signerLocks holds one lock per signing address.
+var signerLocks = struct {
+	sync.Mutex
+	locks map[common.Address]*sync.Mutex
+}{locks: make(map[common.Address]*sync.Mutex)}
+
+// SignerLock returns the lock of a signing address. It is held from fetching
+// the nonce of a transaction until the transaction is sent, so game stores
+// and payouts signed by the same hot wallet never take the same nonce.
+func SignerLock(from common.Address) *sync.Mutex {
+	signerLocks.Lock()
+	defer signerLocks.Unlock()
+
+	lock, found := signerLocks.locks[from]
+	if !found {
+		lock = new(sync.Mutex)
+		signerLocks.locks[from] = lock
+	}
+	return lock
+}
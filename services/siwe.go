@@ -0,0 +1,384 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// siweNonceLength is the length of a decoded nonce: 8 random bytes, the 8 byte
+// unix expiry and the first 16 bytes of their HMAC.
+const siweNonceLength = 32
+
+var (
+	ErrSiweMessage   = errors.New("invalid sign in message")
+	ErrSiweNonce     = errors.New("sign in nonce not found or expired")
+	ErrSiweSignature = errors.New("sign in message was not signed by its address")
+	ErrSessionEnded  = errors.New("session expired or signed out")
+)
+
+// SiweMessage is an EIP-4361 Sign-In with Ethereum message.
+type SiweMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSiweMessage parses the text of an EIP-4361 message. The address must
+// be EIP-55 checksummed.
+func ParseSiweMessage(text string) (res SiweMessage, err error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeader) {
+		return res, fmt.Errorf("%w: missing header", ErrSiweMessage)
+	}
+	res.Domain = strings.TrimSuffix(lines[0], siweHeader)
+	if _, host, found := strings.Cut(res.Domain, "://"); found {
+		res.Domain = host
+	}
+	if !common.IsHexAddress(lines[1]) || common.HexToAddress(lines[1]).Hex() != lines[1] {
+		return res, fmt.Errorf("%w: address must be EIP-55 checksummed", ErrSiweMessage)
+	}
+	res.Address = common.HexToAddress(lines[1])
+
+	rest := lines[2:]
+	for len(rest) > 0 && rest[0] == "" {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && !strings.HasPrefix(rest[0], "URI: ") {
+		res.Statement = rest[0]
+		rest = rest[1:]
+	}
+
+	inResources := false
+	for _, line := range rest {
+		if line == "" {
+			continue
+		}
+		if inResources && strings.HasPrefix(line, "- ") {
+			res.Resources = append(res.Resources, strings.TrimPrefix(line, "- "))
+			continue
+		}
+		tag, value, found := strings.Cut(line, ": ")
+		if line == "Resources:" {
+			inResources = true
+			continue
+		}
+		if !found {
+			return res, fmt.Errorf("%w: unexpected line %q", ErrSiweMessage, line)
+		}
+		switch tag {
+		case "URI":
+			res.URI = value
+		case "Version":
+			res.Version = value
+		case "Chain ID":
+			if res.ChainID, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return res, fmt.Errorf("%w: chain id %q", ErrSiweMessage, value)
+			}
+		case "Nonce":
+			res.Nonce = value
+		case "Issued At":
+			if res.IssuedAt, err = time.Parse(time.RFC3339, value); err != nil {
+				return res, fmt.Errorf("%w: issued at %q", ErrSiweMessage, value)
+			}
+		case "Expiration Time":
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return res, fmt.Errorf("%w: expiration time %q", ErrSiweMessage, value)
+			}
+			res.ExpirationTime = &at
+		case "Not Before":
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return res, fmt.Errorf("%w: not before %q", ErrSiweMessage, value)
+			}
+			res.NotBefore = &at
+		case "Request ID":
+			res.RequestID = value
+		default:
+			return res, fmt.Errorf("%w: unknown field %q", ErrSiweMessage, tag)
+		}
+	}
+
+	switch {
+	case res.URI == "":
+		return res, fmt.Errorf("%w: missing URI", ErrSiweMessage)
+	case res.Version != "1":
+		return res, fmt.Errorf("%w: version must be 1", ErrSiweMessage)
+	case res.ChainID == 0:
+		return res, fmt.Errorf("%w: missing chain id", ErrSiweMessage)
+	case len(res.Nonce) < 8:
+		return res, fmt.Errorf("%w: nonce must be at least 8 characters", ErrSiweMessage)
+	case res.IssuedAt.IsZero():
+		return res, fmt.Errorf("%w: missing issued at", ErrSiweMessage)
+	}
+	return res, nil
+}
+
+// String formats the message the way wallets display and sign it.
+func (m SiweMessage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s\n%s\n\n", m.Domain, siweHeader, m.Address.Hex())
+	if m.Statement != "" {
+		fmt.Fprintf(&b, "%s\n", m.Statement)
+	}
+	fmt.Fprintf(&b, "\nURI: %s\nVersion: %s\nChain ID: %d\nNonce: %s\nIssued At: %s",
+		m.URI, m.Version, m.ChainID, m.Nonce, m.IssuedAt.Format(time.RFC3339))
+	if m.ExpirationTime != nil {
+		fmt.Fprintf(&b, "\nExpiration Time: %s", m.ExpirationTime.Format(time.RFC3339))
+	}
+	if m.NotBefore != nil {
+		fmt.Fprintf(&b, "\nNot Before: %s", m.NotBefore.Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		fmt.Fprintf(&b, "\nRequest ID: %s", m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, resource := range m.Resources {
+			fmt.Fprintf(&b, "\n- %s", resource)
+		}
+	}
+	return b.String()
+}
+
+// SiweSession is a signed in wallet. Token is the HS256 JWT carrying it.
+type SiweSession struct {
+	ID        string         `json:"jti"`
+	Address   common.Address `json:"sub" swaggertype:"string"`
+	ChainID   int64          `json:"chain_id"`
+	IssuedAt  int64          `json:"iat"`
+	ExpiresAt int64          `json:"exp"`
+	Token     string         `json:"-"`
+}
+
+type SiweService interface {
+	Nonce() (string, error)
+	Verify(message string, signature string) (res SiweSession, err error)
+	Authenticate(token string) (res SiweSession, err error)
+	Logout(token string) error
+	Domain() string
+	ChainID() int64
+}
+
+type siwe struct {
+	domain   string
+	chainID  *big.Int
+	secret   []byte
+	ttl      time.Duration
+	nonceTTL time.Duration
+	mutex    sync.Mutex
+	used     map[string]time.Time
+	revoked  map[string]int64
+}
+
+// NewSiweService creates a SiweService.
+//
+// Parameters:
+//   - domain: The domain sign in messages must be issued for, any domain when empty.
+//   - chainID: The chain sign in messages must be issued for.
+//   - secret: The HMAC key sessions are signed with. A random key is used when empty, so sessions do not survive a restart.
+//   - ttl: How long a session lasts.
+//
+// Returns:
+//   - res: A SiweService instance.
+//   - err: An error if no random key could be made.
+func NewSiweService(domain string, chainID *big.Int, secret string, ttl time.Duration) (res SiweService, err error) {
+	service := &siwe{
+		domain:   domain,
+		chainID:  chainID,
+		secret:   []byte(secret),
+		ttl:      ttl,
+		nonceTTL: 10 * time.Minute,
+		used:     make(map[string]time.Time),
+		revoked:  make(map[string]int64),
+	}
+	if secret == "" {
+		service.secret = make([]byte, 32)
+		if _, err := rand.Read(service.secret); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// Domain returns the domain sign in messages are issued for.
+func (s *siwe) Domain() string {
+	return s.domain
+}
+
+// ChainID returns the chain sign in messages are issued for.
+func (s *siwe) ChainID() int64 {
+	return s.chainID.Int64()
+}
+
+// Nonce issues a single use nonce to put in a sign in message.
+//
+// Nonces are signed with their expiry instead of being stored, so issuing
+// them keeps no state and cannot be exhausted. Verify remembers the nonces it
+// consumed until they expire.
+func (s *siwe) Nonce() (string, error) {
+	nonce := make([]byte, 16, siweNonceLength)
+	if _, err := rand.Read(nonce[:8]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint64(nonce[8:], uint64(time.Now().Add(s.nonceTTL).Unix()))
+	nonce = append(nonce, s.signNonce(nonce)...)
+	return hex.EncodeToString(nonce), nil
+}
+
+// consumeNonce checks the signature and expiry of a nonce and marks it used.
+func (s *siwe) consumeNonce(nonce string, now time.Time) error {
+	decoded, err := hex.DecodeString(nonce)
+	if err != nil || len(decoded) != siweNonceLength || !hmac.Equal(decoded[16:], s.signNonce(decoded[:16])) {
+		return ErrSiweNonce
+	}
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(decoded[8:16])), 0)
+	if now.After(expiresAt) {
+		return ErrSiweNonce
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, used := s.used[nonce]; used {
+		return ErrSiweNonce
+	}
+	for used, usedExpiresAt := range s.used {
+		if now.After(usedExpiresAt) {
+			delete(s.used, used)
+		}
+	}
+	s.used[nonce] = expiresAt
+	return nil
+}
+
+// signNonce returns the truncated HMAC of the random part and expiry of a nonce.
+func (s *siwe) signNonce(payload []byte) []byte {
+	return hs256(s.secret, "siwe nonce "+hex.EncodeToString(payload))[:16]
+}
+
+// Verify checks a signed sign in message and starts a session for its address.
+//
+// The nonce is consumed whether or not the message verifies. The session
+// ends at the message expiration time when that comes first.
+//
+// Parameters:
+//   - message: The EIP-4361 message text.
+//   - signature: The 65 byte hex personal_sign signature of the message.
+//
+// Returns:
+//   - res: The session with its token.
+//   - err: An error wrapping ErrSiweMessage, ErrSiweNonce or ErrSiweSignature.
+func (s *siwe) Verify(message string, signature string) (res SiweSession, err error) {
+	parsed, err := ParseSiweMessage(message)
+	if err != nil {
+		return res, err
+	}
+
+	now := time.Now()
+	if err := s.consumeNonce(parsed.Nonce, now); err != nil {
+		return res, err
+	}
+	switch {
+	case s.domain != "" && parsed.Domain != s.domain:
+		return res, fmt.Errorf("%w: issued for %s", ErrSiweMessage, parsed.Domain)
+	case parsed.ChainID != s.chainID.Int64():
+		return res, fmt.Errorf("%w: issued for chain %d", ErrSiweMessage, parsed.ChainID)
+	case parsed.IssuedAt.After(now.Add(SessionClockSkew)):
+		return res, fmt.Errorf("%w: issued in the future", ErrSiweMessage)
+	case parsed.ExpirationTime != nil && now.After(*parsed.ExpirationTime):
+		return res, fmt.Errorf("%w: expired", ErrSiweMessage)
+	case parsed.NotBefore != nil && now.Before(*parsed.NotBefore):
+		return res, fmt.Errorf("%w: not valid yet", ErrSiweMessage)
+	}
+
+	signer, err := RecoverSigner(accounts.TextHash([]byte(message)), signature)
+	if err != nil || signer != parsed.Address {
+		return res, ErrSiweSignature
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return res, err
+	}
+	ends := now.Add(s.ttl)
+	if parsed.ExpirationTime != nil && parsed.ExpirationTime.Before(ends) {
+		ends = *parsed.ExpirationTime
+	}
+	res = SiweSession{
+		ID:        hex.EncodeToString(id),
+		Address:   parsed.Address,
+		ChainID:   parsed.ChainID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: ends.Unix(),
+	}
+	res.Token, err = signJWT(s.secret, res)
+	return res, err
+}
+
+// Authenticate returns the session of a token.
+//
+// Returns:
+//   - res: The session.
+//   - err: ErrTokenInvalid for tokens not signed by this service, ErrSessionEnded
+//     for expired or signed out sessions.
+func (s *siwe) Authenticate(token string) (res SiweSession, err error) {
+	if err := parseJWT(s.secret, token, &res); err != nil {
+		return res, err
+	}
+	if time.Now().Unix() >= res.ExpiresAt {
+		return res, ErrSessionEnded
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, revoked := s.revoked[res.ID]; revoked {
+		return res, ErrSessionEnded
+	}
+	res.Token = token
+	return res, nil
+}
+
+// Logout ends the session of a token before it expires.
+func (s *siwe) Logout(token string) error {
+	session, err := s.Authenticate(token)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().Unix()
+	for id, expiresAt := range s.revoked {
+		if now >= expiresAt {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[session.ID] = session.ExpiresAt
+	return nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func siweMessage(t *testing.T, key string, domain string, chainID int64, nonce string) string {
+	return SiweMessage{
+		Domain:    domain,
+		Address:   common.HexToAddress(keyAddress(t, key)),
+		Statement: "Sign in to Easy Get Coin.",
+		URI:       "https://" + domain,
+		Version:   "1",
+		ChainID:   chainID,
+		Nonce:     nonce,
+		IssuedAt:  time.Now().UTC().Truncate(time.Second),
+	}.String()
+}
+
+func signSiwe(t *testing.T, message string, key string) string {
+	privateKey, err := crypto.HexToECDSA(key)
+	require.NoError(t, err)
+	sig, err := crypto.Sign(accounts.TextHash([]byte(message)), privateKey)
+	require.NoError(t, err)
+	sig[crypto.RecoveryIDOffset] += 27
+	return hexutil.Encode(sig)
+}
+
+func TestParseSiweMessage(t *testing.T) {
+	text := siweMessage(t, aliceKey, "egc.example", 80002, "abcdef123456")
+	parsed, err := ParseSiweMessage(text)
+	require.NoError(t, err)
+	assert.Equal(t, "egc.example", parsed.Domain)
+	assert.Equal(t, keyAddress(t, aliceKey), parsed.Address.Hex())
+	assert.Equal(t, "Sign in to Easy Get Coin.", parsed.Statement)
+	assert.Equal(t, int64(80002), parsed.ChainID)
+	assert.Equal(t, text, parsed.String())
+
+	_, err = ParseSiweMessage(strings.Replace(text, keyAddress(t, aliceKey), strings.ToLower(keyAddress(t, aliceKey)), 1))
+	assert.ErrorIs(t, err, ErrSiweMessage, "addresses must be checksummed")
+	_, err = ParseSiweMessage(strings.Replace(text, "Version: 1", "Version: 2", 1))
+	assert.ErrorIs(t, err, ErrSiweMessage)
+	_, err = ParseSiweMessage(strings.Replace(text, "Nonce: abcdef123456", "Nonce: abc", 1))
+	assert.ErrorIs(t, err, ErrSiweMessage)
+}
+
+func TestSiweVerify(t *testing.T) {
+	service, err := NewSiweService("egc.example", big.NewInt(80002), "secret", time.Hour)
+	require.NoError(t, err)
+
+	nonce, err := service.Nonce()
+	require.NoError(t, err)
+	message := siweMessage(t, aliceKey, "egc.example", 80002, nonce)
+	session, err := service.Verify(message, signSiwe(t, message, aliceKey))
+	require.NoError(t, err)
+	assert.Equal(t, keyAddress(t, aliceKey), session.Address.Hex())
+	assert.NotEmpty(t, session.Token)
+
+	_, err = service.Verify(message, signSiwe(t, message, aliceKey))
+	assert.ErrorIs(t, err, ErrSiweNonce, "a nonce can only be used once")
+
+	authenticated, err := service.Authenticate(session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, authenticated.ID)
+	assert.Equal(t, session.Address, authenticated.Address)
+
+	other, _ := NewSiweService("egc.example", big.NewInt(80002), "other secret", time.Hour)
+	_, err = other.Authenticate(session.Token)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	parts := strings.Split(session.Token, ".")
+	_, err = service.Authenticate(parts[0] + "." + parts[1] + "x." + parts[2])
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	require.NoError(t, service.Logout(session.Token))
+	_, err = service.Authenticate(session.Token)
+	assert.ErrorIs(t, err, ErrSessionEnded)
+}
+
+func TestSiweVerifyRejects(t *testing.T) {
+	service, _ := NewSiweService("egc.example", big.NewInt(80002), "secret", time.Hour)
+
+	tests := []struct {
+		name    string
+		domain  string
+		chainID int64
+		signer  string
+		want    error
+	}{
+		{name: "Other Domain", domain: "evil.example", chainID: 80002, signer: aliceKey, want: ErrSiweMessage},
+		{name: "Other Chain", domain: "egc.example", chainID: 1, signer: aliceKey, want: ErrSiweMessage},
+		{name: "Other Signer", domain: "egc.example", chainID: 80002, signer: bobKey, want: ErrSiweSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce, err := service.Nonce()
+			require.NoError(t, err)
+			message := siweMessage(t, aliceKey, tt.domain, tt.chainID, nonce)
+			_, err = service.Verify(message, signSiwe(t, message, tt.signer))
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	message := siweMessage(t, aliceKey, "egc.example", 80002, "neverissued")
+	_, err := service.Verify(message, signSiwe(t, message, aliceKey))
+	assert.ErrorIs(t, err, ErrSiweNonce)
+}
+
+func TestSiweNonce(t *testing.T) {
+	service, err := NewSiweService("egc.example", big.NewInt(80002), "secret", time.Hour)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		_, err = service.Nonce()
+		require.NoError(t, err)
+	}
+	assert.Empty(t, service.(*siwe).used, "issuing nonces keeps no state")
+
+	nonce, err := service.Nonce()
+	require.NoError(t, err)
+	forged := nonce[:20] + "f" + nonce[21:]
+	if forged == nonce {
+		forged = nonce[:20] + "e" + nonce[21:]
+	}
+	message := siweMessage(t, aliceKey, "egc.example", 80002, forged)
+	_, err = service.Verify(message, signSiwe(t, message, aliceKey))
+	assert.ErrorIs(t, err, ErrSiweNonce, "the expiry cannot be edited")
+
+	other, _ := NewSiweService("egc.example", big.NewInt(80002), "other secret", time.Hour)
+	message = siweMessage(t, aliceKey, "egc.example", 80002, nonce)
+	_, err = other.Verify(message, signSiwe(t, message, aliceKey))
+	assert.ErrorIs(t, err, ErrSiweNonce)
+
+	service.(*siwe).nonceTTL = -time.Second
+	nonce, err = service.Nonce()
+	require.NoError(t, err)
+	message = siweMessage(t, aliceKey, "egc.example", 80002, nonce)
+	_, err = service.Verify(message, signSiwe(t, message, aliceKey))
+	assert.ErrorIs(t, err, ErrSiweNonce, "expired nonces are refused")
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
 	cryptapi "github.com/joey1123455/go-crypt-api"
 )
 
@@ -78,3 +82,14 @@ func (g *stakeHistory) GeneratePaymentLink(value string) (map[string]interface{}
 	paymentAddress, err := g.cryptApi.GenQR("", "250")
 	return paymentAddress, err
 }
+
+// PaymentsNewestFirst orders stake payments by descending time.
+var PaymentsNewestFirst = utils.ByBig(func(payment storage.GameHistoryPayment) *big.Int {
+	return payment.Time
+}).Reverse()
+
+// PaymentFingerprint identifies a stake payment by its content.
+func PaymentFingerprint(payment storage.GameHistoryPayment) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", payment.Sender.Hex(), payment.Amount, payment.Time)))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const erc20ABI = `[
+	{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+	{"inputs":[{"internalType":"address","name":"account","type":"address"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[{"internalType":"address","name":"to","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}
+]`
+
+// Token is the part of an ERC20 token the payout engine uses.
+type Token interface {
+	Address() common.Address
+	Decimals(callData *bind.CallOpts) (uint8, error)
+	BalanceOf(callData *bind.CallOpts, account common.Address) (*big.Int, error)
+	Transfer(transactData *bind.TransactOpts, to common.Address, amount *big.Int) (*types.Transaction, error)
+}
+
+type erc20 struct {
+	address  common.Address
+	contract *bind.BoundContract
+}
+
+// NewERC20Token binds the ERC20 token deployed at address.
+//
+// Parameters:
+//   - address: The token contract address.
+//   - backend: The backend calls and transactions are sent through, usually the ethclient.
+//
+// Returns:
+//   - res: A Token instance.
+//   - err: An error if the ABI could not be parsed.
+func NewERC20Token(address common.Address, backend bind.ContractBackend) (res Token, err error) {
+	parsed, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		return nil, err
+	}
+	return &erc20{
+		address:  address,
+		contract: bind.NewBoundContract(address, parsed, backend, backend, backend),
+	}, nil
+}
+
+// Address returns the token contract address.
+func (e *erc20) Address() common.Address {
+	return e.address
+}
+
+// Decimals reads the number of decimals of the token.
+func (e *erc20) Decimals(callData *bind.CallOpts) (uint8, error) {
+	var out []interface{}
+	if err := e.contract.Call(callData, &out, "decimals"); err != nil {
+		return 0, err
+	}
+	return *abi.ConvertType(out[0], new(uint8)).(*uint8), nil
+}
+
+// BalanceOf reads the token balance of account.
+func (e *erc20) BalanceOf(callData *bind.CallOpts, account common.Address) (*big.Int, error) {
+	var out []interface{}
+	if err := e.contract.Call(callData, &out, "balanceOf", account); err != nil {
+		return nil, err
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// Transfer sends amount tokens from the transactor to to.
+func (e *erc20) Transfer(transactData *bind.TransactOpts, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return e.contract.Transact(transactData, "transfer", to, amount)
+}
+
+// ParseTokenAmount converts a decimal amount such as "12.5" to the token's
+// smallest unit. Amounts with more fractional digits than decimals are rejected.
+func ParseTokenAmount(amount string, decimals uint8) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", amount, decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	res, ok := new(big.Int).SetString(digits, 10)
+	if !ok || res.Sign() < 0 || whole == "" {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return res, nil
+}
+
+// FormatTokenAmount renders an amount in the token's smallest unit as an
+// exact decimal string without trailing zeros.
+func FormatTokenAmount(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, fraction := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit, new(big.Int))
+
+	res := whole.String()
+	if fraction.Sign() != 0 {
+		digits := fraction.String()
+		digits = strings.Repeat("0", int(decimals)-len(digits)) + digits
+		res += "." + strings.TrimRight(digits, "0")
+	}
+	if amount.Sign() < 0 {
+		res = "-" + res
+	}
+	return res
+}
@@ -0,0 +1,531 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Tournament statuses. Every status but finalized follows from the schedule.
+const (
+	TournamentScheduled = "scheduled"
+	TournamentRunning   = "running"
+	TournamentEnded     = "ended"
+	TournamentFinalized = "finalized"
+)
+
+var (
+	ErrTournamentNotFound  = errors.New("tournament not found")
+	ErrTournamentClosed    = errors.New("tournament is not running")
+	ErrTournamentFull      = errors.New("tournament is full")
+	ErrTournamentNotEnded  = errors.New("tournament has not ended yet")
+	ErrTournamentFinalized = errors.New("tournament is already finalized")
+	ErrAlreadyRegistered   = errors.New("player is already registered")
+	ErrNotRegistered       = errors.New("player is not registered")
+	ErrWalletNotLinked     = errors.New("player has no linked wallet")
+	ErrEntryNotPaid        = errors.New("no unused entry payment found for the player's wallet")
+	ErrSessionLimit        = errors.New("player has no sessions left in this tournament")
+)
+
+// TournamentEntry is a registered player and the stake payment that paid the entry.
+type TournamentEntry struct {
+	Uid          string    `json:"uid"`
+	Address      string    `json:"address"`
+	Paid         *big.Int  `json:"paid" swaggertype:"string"`
+	PaidAt       *big.Int  `json:"paid_at" swaggertype:"integer"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// TournamentPrize is the share of the prize pool won by a rank.
+type TournamentPrize struct {
+	Rank    int      `json:"rank"`
+	Uid     string   `json:"uid"`
+	Address string   `json:"address"`
+	Amount  *big.Int `json:"amount" swaggertype:"string"`
+	Tokens  string   `json:"tokens"`
+}
+
+// Tournament is a time boxed competition on one game.
+//
+// EntryFee is in whole stake tokens and Shares maps ranks, or ranges such as
+// 4-10, to their percentage of the pool of entry fees. Only sessions of
+// registered players submitted between StartsAt and EndsAt are ranked and
+// with MaxSessions set only each player's first sessions count.
+type Tournament struct {
+	ID          string             `json:"id"`
+	Gid         int                `json:"gid" binding:"required"`
+	Gtid        string             `json:"gtid"`
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	ScoreField  string             `json:"score_field"`
+	Ascending   bool               `json:"ascending"`
+	MaxEntries  int                `json:"max_entries"`
+	MaxSessions int                `json:"max_sessions"`
+	EntryFee    string             `json:"entry_fee"`
+	Shares      map[string]string  `json:"shares"`
+	StartsAt    time.Time          `json:"starts_at" binding:"required"`
+	EndsAt      time.Time          `json:"ends_at" binding:"required"`
+	Status      string             `json:"status"`
+	Entries     []TournamentEntry  `json:"entries"`
+	Pool        *big.Int           `json:"pool,omitempty" swaggertype:"string"`
+	Standings   []LeaderboardEntry `json:"standings,omitempty"`
+	Prizes      []TournamentPrize  `json:"prizes,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	FinalizedAt *time.Time         `json:"finalized_at,omitempty"`
+}
+
+// Window returns the schedule of the tournament as a leaderboard window.
+func (t Tournament) Window() LeaderboardWindow {
+	return LeaderboardWindow{Kind: "tournament", Key: "tournament:" + t.ID, Start: t.StartsAt, End: t.EndsAt}
+}
+
+func (t Tournament) status(now time.Time) string {
+	switch {
+	case t.FinalizedAt != nil:
+		return TournamentFinalized
+	case now.Before(t.StartsAt):
+		return TournamentScheduled
+	case now.Before(t.EndsAt):
+		return TournamentRunning
+	}
+	return TournamentEnded
+}
+
+func (t Tournament) entry(uid string) (TournamentEntry, bool) {
+	for _, entry := range t.Entries {
+		if entry.Uid == uid {
+			return entry, true
+		}
+	}
+	return TournamentEntry{}, false
+}
+
+type TournamentService interface {
+	Create(tournament Tournament) (res Tournament, err error)
+	List() []Tournament
+	Get(id string) (Tournament, bool)
+	Register(callData *bind.CallOpts, id string, uid string) (res TournamentEntry, err error)
+	SubmitSession(transactData *bind.TransactOpts, callData *bind.CallOpts, id string, uid string, data string, at int) (res *types.Transaction, err error)
+	Standings(callData *bind.CallOpts, id string) (res []LeaderboardEntry, err error)
+	Finalize(callData *bind.CallOpts, id string) (res Tournament, err error)
+}
+
+type tournaments struct {
+	path        string
+	history     GameHistoryContract
+	stakes      StackingContract
+	links       WalletLinkService
+	rule        func(gid int) ScoreRule
+	decimals    uint8
+	mutex       sync.RWMutex
+	tournaments map[string]Tournament
+}
+
+// NewTournamentService loads the tournaments stored at path.
+//
+// Parameters:
+//   - path: The file tournaments are persisted to, an empty path keeps them in memory.
+//   - history: The GameHistoryContract sessions are stored in and read from.
+//   - stakes: The StackingContract entry payments are read from.
+//   - links: The WalletLinkService that resolves players to the wallets they pay from.
+//   - rule: Returns the score rule of a game, usually LeaderboardService.Rule.
+//   - decimals: The decimals of the stake token entry fees are paid in.
+//
+// Returns:
+//   - res: A TournamentService instance.
+//   - err: An error if the stored tournaments could not be read.
+func NewTournamentService(path string, history GameHistoryContract, stakes StackingContract, links WalletLinkService, rule func(gid int) ScoreRule, decimals uint8) (res TournamentService, err error) {
+	service := &tournaments{
+		path:        path,
+		history:     history,
+		stakes:      stakes,
+		links:       links,
+		rule:        rule,
+		decimals:    decimals,
+		tournaments: make(map[string]Tournament),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.tournaments); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// Create validates the rules of a tournament and stores it.
+//
+// Returns:
+//   - res: The stored tournament with its ID set.
+//   - err: An error if the schedule, entry fee or shares are invalid or it could not be saved.
+func (s *tournaments) Create(tournament Tournament) (res Tournament, err error) {
+	if !tournament.EndsAt.After(tournament.StartsAt) {
+		return res, errors.New("tournament must end after it starts")
+	}
+	if tournament.EntryFee == "" {
+		tournament.EntryFee = "0"
+	}
+	if _, err := ParseTokenAmount(tournament.EntryFee, s.decimals); err != nil {
+		return res, fmt.Errorf("entry fee: %w", err)
+	}
+	if _, err := s.shares(tournament); err != nil {
+		return res, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return res, err
+	}
+	tournament.ID = hex.EncodeToString(id)
+	tournament.Entries = []TournamentEntry{}
+	tournament.Pool, tournament.Standings, tournament.Prizes, tournament.FinalizedAt = nil, nil, nil, nil
+	tournament.CreatedAt = time.Now().UTC()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.withStatus(tournament), s.save(tournament)
+}
+
+// shares returns the pool share of every rank in basis points.
+func (s *tournaments) shares(tournament Tournament) (map[int]int64, error) {
+	table, err := ParsePrizeTable(tournament.Shares)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int]int64, len(table))
+	total := int64(0)
+	for rank, share := range table {
+		points, err := ParseTokenAmount(share, 2)
+		if err != nil {
+			return nil, fmt.Errorf("share of rank %d: %w", rank, err)
+		}
+		res[rank] = points.Int64()
+		total += points.Int64()
+	}
+	if total > 10000 {
+		return nil, errors.New("shares add up to more than 100 percent")
+	}
+	return res, nil
+}
+
+// List returns every tournament, latest start first.
+func (s *tournaments) List() []Tournament {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	res := make([]Tournament, 0, len(s.tournaments))
+	for _, tournament := range s.tournaments {
+		res = append(res, s.withStatus(tournament))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].StartsAt.Equal(res[j].StartsAt) {
+			return res[i].StartsAt.After(res[j].StartsAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Get returns a tournament.
+func (s *tournaments) Get(id string) (Tournament, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tournament, found := s.tournaments[id]
+	return s.withStatus(tournament), found
+}
+
+// Register enters a player who paid the entry fee.
+//
+// The entry is paid through the staking payment flow from the wallet linked
+// to the player. Any stake payment of at least the entry fee made after the
+// tournament was created counts, as long as it did not pay another entry.
+//
+// Parameters:
+//   - callData: Call options for the contract call.
+//   - id: The tournament.
+//   - uid: The player to register.
+//
+// Returns:
+//   - res: The new entry.
+//   - err: ErrTournamentNotFound, ErrTournamentClosed, ErrTournamentFull, ErrAlreadyRegistered,
+//     ErrWalletNotLinked, ErrEntryNotPaid or any error reading the contract.
+func (s *tournaments) Register(callData *bind.CallOpts, id string, uid string) (res TournamentEntry, err error) {
+	tournament, found := s.Get(id)
+	if !found {
+		return res, ErrTournamentNotFound
+	}
+	if err := s.canRegister(tournament, uid); err != nil {
+		return res, err
+	}
+
+	fee, _ := ParseTokenAmount(tournament.EntryFee, s.decimals)
+	res = TournamentEntry{Uid: uid, Paid: new(big.Int), PaidAt: new(big.Int)}
+	if link, linked := s.links.ByUid(uid); linked {
+		res.Address = link.Address.Hex()
+	} else if fee.Sign() > 0 {
+		return res, ErrWalletNotLinked
+	}
+
+	var payments []storage.GameHistoryPayment
+	if fee.Sign() > 0 {
+		if payments, err = s.stakes.UserStakeHistory(callData, res.Address); err != nil {
+			return res, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tournament = s.tournaments[id]
+	if err := s.canRegister(tournament, uid); err != nil {
+		return res, err
+	}
+	if fee.Sign() > 0 {
+		payment, found := s.unusedPayment(payments, fee, tournament.CreatedAt)
+		if !found {
+			return res, ErrEntryNotPaid
+		}
+		res.Paid, res.PaidAt = payment.Amount, payment.Time
+	}
+	res.RegisteredAt = time.Now().UTC()
+
+	tournament.Entries = append(append([]TournamentEntry(nil), tournament.Entries...), res)
+	return res, s.save(tournament)
+}
+
+func (s *tournaments) canRegister(tournament Tournament, uid string) error {
+	if status := tournament.status(time.Now()); status != TournamentScheduled && status != TournamentRunning {
+		return ErrTournamentClosed
+	}
+	if _, registered := tournament.entry(uid); registered {
+		return ErrAlreadyRegistered
+	}
+	if tournament.MaxEntries > 0 && len(tournament.Entries) >= tournament.MaxEntries {
+		return ErrTournamentFull
+	}
+	return nil
+}
+
+// unusedPayment finds the earliest payment of at least fee made since
+// created that paid no other entry. The caller holds the lock.
+func (s *tournaments) unusedPayment(payments []storage.GameHistoryPayment, fee *big.Int, created time.Time) (storage.GameHistoryPayment, bool) {
+	used := make(map[string]bool)
+	for _, tournament := range s.tournaments {
+		for _, entry := range tournament.Entries {
+			used[paymentKey(entry.Address, entry.PaidAt, entry.Paid)] = true
+		}
+	}
+
+	sorted := append([]storage.GameHistoryPayment(nil), payments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareTime(sorted[i].Time, sorted[j].Time) < 0
+	})
+	for _, payment := range sorted {
+		if payment.Amount == nil || payment.Amount.Cmp(fee) < 0 || SessionTime(payment.Time).Before(created.Truncate(time.Second)) {
+			continue
+		}
+		if !used[paymentKey(payment.Sender.Hex(), payment.Time, payment.Amount)] {
+			return payment, true
+		}
+	}
+	return storage.GameHistoryPayment{}, false
+}
+
+func paymentKey(address string, at *big.Int, amount *big.Int) string {
+	return fmt.Sprintf("%s|%s|%s", address, at, amount)
+}
+
+// SubmitSession stores a session of a registered player while the
+// tournament is running. The session is stored with the server time at,
+// in unix seconds.
+//
+// Returns:
+//   - res: The transaction storing the session.
+//   - err: ErrTournamentNotFound, ErrTournamentClosed, ErrNotRegistered, ErrSessionLimit
+//     or any error from the GameHistoryContract.
+func (s *tournaments) SubmitSession(transactData *bind.TransactOpts, callData *bind.CallOpts, id string, uid string, data string, at int) (res *types.Transaction, err error) {
+	tournament, found := s.Get(id)
+	if !found {
+		return nil, ErrTournamentNotFound
+	}
+	now := time.Now()
+	if tournament.status(now) != TournamentRunning {
+		return nil, ErrTournamentClosed
+	}
+	if _, registered := tournament.entry(uid); !registered {
+		return nil, ErrNotRegistered
+	}
+
+	if tournament.MaxSessions > 0 {
+		sessions, err := s.history.GetUserGameData(callData, uid)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.filter(tournament, sessions)) >= tournament.MaxSessions {
+			return nil, ErrSessionLimit
+		}
+	}
+	return s.history.StoreGameData(transactData, tournament.Gid, tournament.Gtid, uid, data, at)
+}
+
+// Standings ranks the sessions of a tournament. Finalized tournaments return
+// the standings frozen when they were finalized.
+func (s *tournaments) Standings(callData *bind.CallOpts, id string) (res []LeaderboardEntry, err error) {
+	tournament, found := s.Get(id)
+	if !found {
+		return nil, ErrTournamentNotFound
+	}
+	if tournament.FinalizedAt != nil {
+		return tournament.Standings, nil
+	}
+	return s.standings(callData, tournament)
+}
+
+func (s *tournaments) standings(callData *bind.CallOpts, tournament Tournament) ([]LeaderboardEntry, error) {
+	sessions, err := s.history.GetGameData(callData, tournament.Gid)
+	if err != nil {
+		return nil, err
+	}
+	return RankSessions(s.filter(tournament, sessions), s.scoreRule(tournament)), nil
+}
+
+// filter keeps the sessions of registered players played in the window,
+// only the first MaxSessions of each player when set.
+func (s *tournaments) filter(tournament Tournament, sessions []storage.GameHistoryGameSession) []storage.GameHistoryGameSession {
+	window := tournament.Window()
+	res := make([]storage.GameHistoryGameSession, 0)
+	for _, session := range FilterWindow(sessions, window) {
+		if session.Gid.Int64() != int64(tournament.Gid) || (tournament.Gtid != "" && session.Gtid != tournament.Gtid) {
+			continue
+		}
+		if _, registered := tournament.entry(session.Uid); registered {
+			res = append(res, session)
+		}
+	}
+	if tournament.MaxSessions <= 0 {
+		return res
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return compareTime(res[i].Time, res[j].Time) < 0
+	})
+	played := make(map[string]int)
+	limited := res[:0]
+	for _, session := range res {
+		if played[session.Uid] < tournament.MaxSessions {
+			played[session.Uid]++
+			limited = append(limited, session)
+		}
+	}
+	return limited
+}
+
+func (s *tournaments) scoreRule(tournament Tournament) ScoreRule {
+	if tournament.ScoreField == "" {
+		return s.rule(tournament.Gid)
+	}
+	return ScoreRule{Field: tournament.ScoreField, Ascending: tournament.Ascending}
+}
+
+// Finalize freezes the standings of an ended tournament and splits the pool
+// of entry fees between the ranks by their shares. Whatever the shares do
+// not assign, including rounding, stays with the house.
+//
+// Prizes are in the stake token while the payout engine pays EGC, so they
+// are only listed and paid out manually.
+//
+// Returns:
+//   - res: The finalized tournament with its standings and prizes.
+//   - err: ErrTournamentNotFound, ErrTournamentNotEnded, ErrTournamentFinalized or any error reading the contract.
+func (s *tournaments) Finalize(callData *bind.CallOpts, id string) (res Tournament, err error) {
+	tournament, found := s.Get(id)
+	if !found {
+		return res, ErrTournamentNotFound
+	}
+	switch tournament.status(time.Now()) {
+	case TournamentFinalized:
+		return tournament, ErrTournamentFinalized
+	case TournamentScheduled, TournamentRunning:
+		return tournament, ErrTournamentNotEnded
+	}
+
+	standings, err := s.standings(callData, tournament)
+	if err != nil {
+		return res, err
+	}
+	shares, err := s.shares(tournament)
+	if err != nil {
+		return res, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tournament = s.tournaments[id]
+	if tournament.FinalizedAt != nil {
+		return s.withStatus(tournament), ErrTournamentFinalized
+	}
+
+	fee, _ := ParseTokenAmount(tournament.EntryFee, s.decimals)
+	tournament.Pool = new(big.Int).Mul(fee, big.NewInt(int64(len(tournament.Entries))))
+	tournament.Standings = standings
+	tournament.Prizes = make([]TournamentPrize, 0, len(shares))
+	for _, standing := range standings {
+		points, won := shares[standing.Rank]
+		if !won {
+			continue
+		}
+		amount := new(big.Int).Mul(tournament.Pool, big.NewInt(points))
+		amount.Quo(amount, big.NewInt(10000))
+		entry, _ := tournament.entry(standing.Uid)
+		tournament.Prizes = append(tournament.Prizes, TournamentPrize{
+			Rank:    standing.Rank,
+			Uid:     standing.Uid,
+			Address: entry.Address,
+			Amount:  amount,
+			Tokens:  FormatTokenAmount(amount, s.decimals),
+		})
+	}
+	now := time.Now().UTC()
+	tournament.FinalizedAt = &now
+
+	if err := s.save(tournament); err != nil {
+		return res, err
+	}
+	return s.withStatus(tournament), nil
+}
+
+func (s *tournaments) withStatus(tournament Tournament) Tournament {
+	tournament.Status = tournament.status(time.Now())
+	return tournament
+}
+
+// save stores tournament and writes every tournament to disk, restoring the
+// previous copy if the write fails. The caller holds the lock.
+func (s *tournaments) save(tournament Tournament) error {
+	previous, existed := s.tournaments[tournament.ID]
+	s.tournaments[tournament.ID] = tournament
+	if s.path == "" {
+		return nil
+	}
+	if err := utils.SaveJSON(s.path, s.tournaments); err != nil {
+		if existed {
+			s.tournaments[tournament.ID] = previous
+		} else {
+			delete(s.tournaments, tournament.ID)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTournament(t *testing.T) {
+	now := time.Now()
+	links, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := linkWallet(t, links, "alice", aliceKey)
+	bob := linkWallet(t, links, "bob", bobKey)
+	fee, _ := ParseTokenAmount("2", 18)
+	paid := big.NewInt(now.Unix() + 1)
+	stakes := &fakeStakes{payments: map[string][]storage.GameHistoryPayment{
+		alice.Hex(): {
+			{Sender: alice, Amount: fee, Time: big.NewInt(now.Unix() - 3600)},
+			{Sender: alice, Amount: fee, Time: paid},
+		},
+		bob.Hex(): {{Sender: bob, Amount: big.NewInt(1), Time: paid}},
+	}}
+	history := &fakeGameHistory{}
+	rule := func(int) ScoreRule { return ScoreRule{Field: "score"} }
+	path := filepath.Join(t.TempDir(), "tournaments.json")
+	service, err := NewTournamentService(path, history, stakes, links, rule, 18)
+	require.NoError(t, err)
+
+	_, err = service.Create(Tournament{Gid: 1, Name: "bad", StartsAt: now, EndsAt: now.Add(-time.Hour)})
+	assert.Error(t, err)
+	_, err = service.Create(Tournament{Gid: 1, Name: "bad", StartsAt: now, EndsAt: now.Add(time.Hour), Shares: map[string]string{"1": "80", "2": "30"}})
+	assert.Error(t, err, "shares above 100 percent are rejected")
+
+	tournament, err := service.Create(Tournament{
+		Gid:         1,
+		Name:        "weekend cup",
+		EntryFee:    "2",
+		MaxSessions: 2,
+		Shares:      map[string]string{"1": "70", "2": "20.5"},
+		StartsAt:    now.Add(-2 * time.Hour),
+		EndsAt:      now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TournamentRunning, tournament.Status)
+
+	_, err = service.Register(nil, tournament.ID, "carol")
+	assert.ErrorIs(t, err, ErrWalletNotLinked)
+	_, err = service.Register(nil, tournament.ID, "bob")
+	assert.ErrorIs(t, err, ErrEntryNotPaid, "a payment below the fee does not pay the entry")
+
+	entry, err := service.Register(nil, tournament.ID, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, paid, entry.PaidAt, "payments made before the tournament was created do not count")
+	_, err = service.Register(nil, tournament.ID, "alice")
+	assert.ErrorIs(t, err, ErrAlreadyRegistered)
+
+	stakes.payments[bob.Hex()] = append(stakes.payments[bob.Hex()], storage.GameHistoryPayment{Sender: bob, Amount: fee, Time: paid})
+	_, err = service.Register(nil, tournament.ID, "bob")
+	assert.NoError(t, err)
+
+	other, _ := service.Create(Tournament{Gid: 1, Name: "next cup", EntryFee: "2", StartsAt: now, EndsAt: now.Add(time.Hour)})
+	_, err = service.Register(nil, other.ID, "bob")
+	assert.ErrorIs(t, err, ErrEntryNotPaid, "one payment pays one entry")
+
+	_, err = service.SubmitSession(nil, nil, tournament.ID, "carol", `{"score":1}`, int(time.Now().Unix()))
+	assert.ErrorIs(t, err, ErrNotRegistered)
+	_, err = service.SubmitSession(nil, nil, tournament.ID, "bob", `{"score":40}`, int(time.Now().Unix()))
+	assert.NoError(t, err)
+
+	at := func(offset time.Duration) int { return int(now.Add(offset).Unix()) }
+	history.sessions = append(history.sessions,
+		session(1, "", "alice", `{"score":10}`, at(-90*time.Minute)),
+		session(1, "", "alice", `{"score":20}`, at(-80*time.Minute)),
+		session(1, "", "alice", `{"score":99}`, at(-70*time.Minute)),
+		session(1, "", "alice", `{"score":500}`, at(-3*time.Hour)),
+		session(1, "", "carol", `{"score":900}`, at(-time.Hour)),
+		session(2, "", "bob", `{"score":900}`, at(-time.Hour)),
+	)
+	_, err = service.SubmitSession(nil, nil, tournament.ID, "alice", `{"score":1}`, int(time.Now().Unix()))
+	assert.ErrorIs(t, err, ErrSessionLimit)
+
+	standings, err := service.Standings(nil, tournament.ID)
+	assert.NoError(t, err)
+	require.Len(t, standings, 2)
+	assert.Equal(t, "bob", standings[0].Uid)
+	assert.Equal(t, "alice", standings[1].Uid)
+	assert.Equal(t, 20.0, standings[1].Score, "only the first two sessions of a player count")
+
+	_, err = service.Finalize(nil, tournament.ID)
+	assert.ErrorIs(t, err, ErrTournamentNotEnded)
+
+	internal := service.(*tournaments)
+	ended := internal.tournaments[tournament.ID]
+	ended.EndsAt = time.Now()
+	internal.tournaments[tournament.ID] = ended
+
+	final, err := service.Finalize(nil, tournament.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, TournamentFinalized, final.Status)
+	assert.Equal(t, "4000000000000000000", final.Pool.String())
+	require.Len(t, final.Prizes, 2)
+	assert.Equal(t, "2.8", final.Prizes[0].Tokens)
+	assert.Equal(t, bob.Hex(), final.Prizes[0].Address)
+	assert.Equal(t, "0.82", final.Prizes[1].Tokens)
+	_, err = service.Finalize(nil, tournament.ID)
+	assert.ErrorIs(t, err, ErrTournamentFinalized)
+
+	reloaded, err := NewTournamentService(path, history, stakes, links, rule, 18)
+	require.NoError(t, err)
+	frozen, err := reloaded.Standings(nil, tournament.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, standings, frozen)
+	assert.Len(t, reloaded.List(), 2)
+	assert.Equal(t, common.HexToAddress(final.Prizes[1].Address), alice)
+}
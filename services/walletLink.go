@@ -0,0 +1,329 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// MaxLinkChallenges is how many unanswered link challenges are kept at once.
+const MaxLinkChallenges = 10_000
+
+// Signature methods accepted when linking a wallet.
+const (
+	SignPersonal = "personal_sign"
+	SignTypedV4  = "eip712"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("link challenge not found or expired")
+	ErrSignatureMismatch = errors.New("signature was not made by the challenged address")
+	ErrAddressLinked     = errors.New("address is already linked to another uid")
+	ErrLinkSignOff       = errors.New("the currently linked wallet must sign the challenge to replace the link")
+	ErrTooManyChallenges = errors.New("too many open link challenges, try again later")
+)
+
+// LinkChallenge is the nonce a player signs to prove they own a wallet.
+// Message is signed with personal_sign and TypedData with eth_signTypedData_v4.
+//
+// Replaces is the wallet the uid is linked to when the challenge was issued,
+// which has to sign the challenge as well for the link to be replaced.
+type LinkChallenge struct {
+	Uid       string             `json:"uid"`
+	Address   string             `json:"address"`
+	Replaces  string             `json:"replaces,omitempty"`
+	Nonce     string             `json:"nonce"`
+	Message   string             `json:"message"`
+	TypedData apitypes.TypedData `json:"typed_data" swaggertype:"object"`
+	IssuedAt  time.Time          `json:"issued_at"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	requester string
+}
+
+// WalletLink is a verified binding between a uid and a wallet address.
+type WalletLink struct {
+	Uid      string         `json:"uid"`
+	Address  common.Address `json:"address" swaggertype:"string"`
+	Method   string         `json:"method"`
+	LinkedAt time.Time      `json:"linked_at"`
+}
+
+type WalletLinkService interface {
+	Challenge(requester string, uid string, address string) (res LinkChallenge, err error)
+	Link(requester string, nonce string, signature string, method string, currentSignature string) (res WalletLink, err error)
+	ByUid(uid string) (WalletLink, bool)
+	ByAddress(address string) (WalletLink, bool)
+}
+
+type walletLinks struct {
+	path       string
+	chainID    *big.Int
+	ttl        time.Duration
+	mutex      sync.Mutex
+	challenges map[string]LinkChallenge
+	links      map[string]WalletLink
+	byAddress  map[common.Address]string
+}
+
+// NewWalletLinkService loads the wallet links stored at path.
+//
+// Parameters:
+//   - path: The file links are persisted to, an empty path keeps them in memory.
+//   - chainID: The chain id put in the EIP-712 domain.
+//   - ttl: How long a challenge can be answered.
+//
+// Returns:
+//   - res: A WalletLinkService instance.
+//   - err: An error if the stored links could not be read.
+func NewWalletLinkService(path string, chainID *big.Int, ttl time.Duration) (res WalletLinkService, err error) {
+	service := &walletLinks{
+		path:       path,
+		chainID:    chainID,
+		ttl:        ttl,
+		challenges: make(map[string]LinkChallenge),
+		links:      make(map[string]WalletLink),
+		byAddress:  make(map[common.Address]string),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.links); err != nil {
+			return nil, err
+		}
+	}
+	for uid, link := range service.links {
+		service.byAddress[link.Address] = uid
+	}
+	return service, nil
+}
+
+// Challenge issues a single use nonce for uid to sign with address.
+//
+// Parameters:
+//   - requester: Who asked for the challenge, only they can answer it.
+//   - uid: The player id to link.
+//   - address: The wallet that will sign the challenge.
+//
+// Returns:
+//   - res: The challenge with the message and typed data to sign.
+//   - err: An error if the address is not a hex address, or ErrTooManyChallenges.
+func (w *walletLinks) Challenge(requester string, uid string, address string) (res LinkChallenge, err error) {
+	if !common.IsHexAddress(address) {
+		return res, fmt.Errorf("invalid address %q", address)
+	}
+	checksummed := common.HexToAddress(address).Hex()
+	current, linked := w.ByUid(uid)
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return res, err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	res = LinkChallenge{
+		Uid:       uid,
+		Address:   checksummed,
+		Nonce:     nonce,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(w.ttl),
+		Message: fmt.Sprintf("Easy Get Coin wants you to link your wallet to your player account.\n\nUid: %s\nAddress: %s\nNonce: %s\nIssued At: %s",
+			uid, checksummed, nonce, now.Format(time.RFC3339)),
+		requester: requester,
+	}
+	if linked && current.Address.Hex() != checksummed {
+		res.Replaces = current.Address.Hex()
+		res.Message += "\nReplaces: " + res.Replaces
+	}
+	res.TypedData = apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"LinkWallet": {
+				{Name: "uid", Type: "string"},
+				{Name: "wallet", Type: "address"},
+				{Name: "nonce", Type: "string"},
+				{Name: "issuedAt", Type: "string"},
+			},
+		},
+		PrimaryType: "LinkWallet",
+		Domain: apitypes.TypedDataDomain{
+			Name:    "Easy Get Coin",
+			Version: "1",
+			ChainId: (*math.HexOrDecimal256)(w.chainID),
+		},
+		Message: apitypes.TypedDataMessage{
+			"uid":      uid,
+			"wallet":   checksummed,
+			"nonce":    nonce,
+			"issuedAt": now.Format(time.RFC3339),
+		},
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.dropExpired(now)
+	if len(w.challenges) >= MaxLinkChallenges {
+		return LinkChallenge{}, ErrTooManyChallenges
+	}
+	w.challenges[nonce] = res
+	return res, nil
+}
+
+// Link verifies the signature of a challenge and stores the uid and address link.
+//
+// The challenge is consumed whether or not the signature verifies, so every
+// nonce can only be tried once. A uid linked to another wallet is only
+// relinked when that wallet signed the same challenge.
+//
+// Parameters:
+//   - requester: Who answers, it must be who asked for the challenge.
+//   - nonce: The nonce of the answered challenge.
+//   - signature: The 65 byte hex signature of the wallet to link.
+//   - method: SignPersonal or SignTypedV4.
+//   - currentSignature: The signature of the currently linked wallet, when replacing it.
+//
+// Returns:
+//   - res: The stored link.
+//   - err: ErrChallengeNotFound, ErrSignatureMismatch, ErrLinkSignOff, ErrAddressLinked or a storage error.
+func (w *walletLinks) Link(requester string, nonce string, signature string, method string, currentSignature string) (res WalletLink, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	challenge, found := w.challenges[nonce]
+	delete(w.challenges, nonce)
+	if !found || time.Now().After(challenge.ExpiresAt) || challenge.requester != requester {
+		return res, ErrChallengeNotFound
+	}
+
+	var hash []byte
+	switch method {
+	case SignPersonal:
+		hash = accounts.TextHash([]byte(challenge.Message))
+	case SignTypedV4:
+		if hash, _, err = apitypes.TypedDataAndHash(challenge.TypedData); err != nil {
+			return res, err
+		}
+	default:
+		return res, fmt.Errorf("unknown signature method %q", method)
+	}
+
+	signer, err := RecoverSigner(hash, signature)
+	if err != nil {
+		return res, err
+	}
+	address := common.HexToAddress(challenge.Address)
+	if signer != address {
+		return res, ErrSignatureMismatch
+	}
+	if owner, linked := w.byAddress[address]; linked && owner != challenge.Uid {
+		return res, ErrAddressLinked
+	}
+	// the link may have changed since the challenge was issued
+	if current, linked := w.links[challenge.Uid]; linked && current.Address != address {
+		if currentSignature == "" {
+			return res, ErrLinkSignOff
+		}
+		if signer, err := RecoverSigner(hash, currentSignature); err != nil || signer != current.Address {
+			return res, ErrLinkSignOff
+		}
+	}
+
+	res = WalletLink{
+		Uid:      challenge.Uid,
+		Address:  address,
+		Method:   method,
+		LinkedAt: time.Now().UTC(),
+	}
+	previous, existed := w.links[res.Uid]
+	w.links[res.Uid] = res
+	if err := w.save(); err != nil {
+		if existed {
+			w.links[res.Uid] = previous
+		} else {
+			delete(w.links, res.Uid)
+		}
+		return WalletLink{}, err
+	}
+	if existed {
+		delete(w.byAddress, previous.Address)
+	}
+	w.byAddress[address] = res.Uid
+	return res, nil
+}
+
+// ByUid returns the wallet linked to uid.
+func (w *walletLinks) ByUid(uid string) (WalletLink, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	link, found := w.links[uid]
+	return link, found
+}
+
+// ByAddress returns the uid linked to a wallet address.
+func (w *walletLinks) ByAddress(address string) (WalletLink, bool) {
+	if !common.IsHexAddress(address) {
+		return WalletLink{}, false
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	uid, found := w.byAddress[common.HexToAddress(address)]
+	if !found {
+		return WalletLink{}, false
+	}
+	return w.links[uid], true
+}
+
+func (w *walletLinks) dropExpired(now time.Time) {
+	for nonce, challenge := range w.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(w.challenges, nonce)
+		}
+	}
+}
+
+func (w *walletLinks) save() error {
+	if w.path == "" {
+		return nil
+	}
+	return utils.SaveJSON(w.path, w.links)
+}
+
+// RecoverSigner returns the address that produced a 65 byte hex signature over hash.
+// Both the 0/1 and the 27/28 recovery id conventions are accepted.
+func RecoverSigner(hash []byte, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(strings.TrimSpace(signature))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(sig))
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signChallenge(t *testing.T, challenge LinkChallenge, method string, key string) string {
+	privateKey, err := crypto.HexToECDSA(key)
+	require.NoError(t, err)
+
+	hash := accounts.TextHash([]byte(challenge.Message))
+	if method == SignTypedV4 {
+		hash, _, err = apitypes.TypedDataAndHash(challenge.TypedData)
+		require.NoError(t, err)
+	}
+	sig, err := crypto.Sign(hash, privateKey)
+	require.NoError(t, err)
+	sig[crypto.RecoveryIDOffset] += 27
+	return hexutil.Encode(sig)
+}
+
+const (
+	aliceKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	bobKey   = "8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f"
+)
+
+func keyAddress(t *testing.T, key string) string {
+	privateKey, err := crypto.HexToECDSA(key)
+	require.NoError(t, err)
+	return crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+}
+
+func TestWalletLink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	service, err := NewWalletLinkService(path, big.NewInt(80002), time.Minute)
+	require.NoError(t, err)
+	alice := keyAddress(t, aliceKey)
+
+	for _, method := range []string{SignPersonal, SignTypedV4} {
+		challenge, err := service.Challenge("", "alice", alice)
+		require.NoError(t, err)
+
+		link, err := service.Link("", challenge.Nonce, signChallenge(t, challenge, method, aliceKey), method, "")
+		assert.NoError(t, err, method)
+		assert.Equal(t, alice, link.Address.Hex())
+		assert.Equal(t, method, link.Method)
+
+		_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, method, aliceKey), method, "")
+		assert.ErrorIs(t, err, ErrChallengeNotFound, "a nonce can only be used once")
+	}
+
+	byAddress, found := service.ByAddress(strings.ToLower(alice))
+	assert.True(t, found)
+	assert.Equal(t, "alice", byAddress.Uid)
+
+	reloaded, err := NewWalletLinkService(path, big.NewInt(80002), time.Minute)
+	require.NoError(t, err)
+	byUid, found := reloaded.ByUid("alice")
+	assert.True(t, found)
+	assert.Equal(t, alice, byUid.Address.Hex())
+}
+
+func TestWalletLinkRejects(t *testing.T) {
+	service, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := keyAddress(t, aliceKey)
+
+	_, err := service.Challenge("", "alice", "not an address")
+	assert.Error(t, err)
+
+	challenge, _ := service.Challenge("", "alice", alice)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, bobKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	challenge, _ = service.Challenge("", "alice", alice)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignTypedV4, aliceKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrSignatureMismatch, "a typed data signature does not verify as personal_sign")
+
+	challenge, _ = service.Challenge("", "alice", alice)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	assert.NoError(t, err)
+
+	challenge, _ = service.Challenge("", "mallory", alice)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrAddressLinked)
+
+	expired, _ := NewWalletLinkService("", big.NewInt(1), -time.Second)
+	challenge, _ = expired.Challenge("", "alice", alice)
+	_, err = expired.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrChallengeNotFound)
+}
+
+func TestWalletRelink(t *testing.T) {
+	service, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice, bob := keyAddress(t, aliceKey), keyAddress(t, bobKey)
+
+	challenge, _ := service.Challenge("", "alice", alice)
+	_, err := service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	require.NoError(t, err)
+	challenge, _ = service.Challenge("", "alice", bob)
+	assert.Equal(t, alice, challenge.Replaces)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, bobKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrLinkSignOff, "the linked wallet has to sign off")
+	link, _ := service.ByUid("alice")
+	assert.Equal(t, alice, link.Address.Hex())
+
+	challenge, _ = service.Challenge("", "alice", bob)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, bobKey), SignPersonal, signChallenge(t, challenge, SignPersonal, bobKey))
+	assert.ErrorIs(t, err, ErrLinkSignOff, "the new wallet cannot sign off for the old one")
+
+	challenge, _ = service.Challenge("", "alice", bob)
+	_, err = service.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, bobKey), SignPersonal, signChallenge(t, challenge, SignPersonal, aliceKey))
+	require.NoError(t, err)
+
+	_, found := service.ByAddress(alice)
+	assert.False(t, found, "relinking releases the previous wallet")
+	link, _ = service.ByUid("alice")
+	assert.Equal(t, bob, link.Address.Hex())
+}
+
+func TestWalletLinkChallenges(t *testing.T) {
+	service, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := keyAddress(t, aliceKey)
+
+	challenge, _ := service.Challenge("key:1", "alice", alice)
+	_, err := service.Link("key:2", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	assert.ErrorIs(t, err, ErrChallengeNotFound, "only the requester can answer a challenge")
+
+	for i := 0; i < MaxLinkChallenges; i++ {
+		_, err = service.Challenge("key:1", "alice", alice)
+		require.NoError(t, err)
+	}
+	_, err = service.Challenge("key:1", "alice", alice)
+	assert.ErrorIs(t, err, ErrTooManyChallenges)
+}
+
+type fakeStakes struct {
+	payments map[string][]storage.GameHistoryPayment
+}
+
+func (f *fakeStakes) UserTotal(callData *bind.CallOpts, address string) (*big.Int, error) {
+	total := new(big.Int)
+	for _, payment := range f.payments[address] {
+		total.Add(total, payment.Amount)
+	}
+	return total, nil
+}
+
+func (f *fakeStakes) UserStakeHistory(callData *bind.CallOpts, address string) ([]storage.GameHistoryPayment, error) {
+	return f.payments[address], nil
+}
+
+func (f *fakeStakes) GeneratePaymentLink(value string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func TestPlayerOverview(t *testing.T) {
+	links, _ := NewWalletLinkService("", big.NewInt(1), time.Minute)
+	alice := keyAddress(t, aliceKey)
+	history := &fakeGameHistory{sessions: []storage.GameHistoryGameSession{
+		session(1, "t", "alice", `{"score":1}`, 100),
+		session(1, "t", "alice", `{"score":2}`, 300),
+		session(2, "t", "alice", `{"score":3}`, 200),
+		session(1, "t", "bob", `{"score":4}`, 400),
+	}}
+	stakes := &fakeStakes{payments: map[string][]storage.GameHistoryPayment{
+		alice: {
+			{Amount: big.NewInt(5), Time: big.NewInt(10)},
+			{Amount: big.NewInt(7), Time: big.NewInt(20)},
+		},
+	}}
+	service := NewPlayerOverviewService(history, stakes, links)
+
+	res, err := service.Overview(nil, "alice", 2)
+	assert.NoError(t, err)
+	assert.Nil(t, res.Wallet)
+	assert.Nil(t, res.TotalStaked)
+	assert.Len(t, res.Sessions, 2)
+	assert.Equal(t, int64(300), res.Sessions[0].Time.Int64())
+	assert.Equal(t, int64(200), res.Sessions[1].Time.Int64())
+
+	challenge, _ := links.Challenge("", "alice", alice)
+	_, err = links.Link("", challenge.Nonce, signChallenge(t, challenge, SignPersonal, aliceKey), SignPersonal, "")
+	require.NoError(t, err)
+
+	res, err = service.Overview(nil, "alice", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, res.Wallet.Address.Hex())
+	assert.Len(t, res.Sessions, 3)
+	assert.Equal(t, int64(12), res.TotalStaked.Int64())
+	assert.Equal(t, int64(20), res.Stakes[0].Time.Int64())
+}
@@ -0,0 +1,636 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/joey1123455/easy_get_coin/utils"
+)
+
+// Webhook event types. EventWebhookTest is only sent by Test.
+const (
+	EventSessionMined  = "session.mined"
+	EventSessionFailed = "session.failed"
+	EventStakeReceived = "stake.received"
+	EventWebhookTest   = "webhook.test"
+)
+
+// Headers of webhook deliveries.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookSecretPrefix starts every webhook secret.
+const WebhookSecretPrefix = "whsec_"
+
+// Webhook delivery defaults.
+const (
+	// DefaultWebhookAttempts is how many times an event is sent before it is
+	// given up on.
+	DefaultWebhookAttempts = 5
+	// DefaultWebhookBackoff is the wait before the first retry, doubled for
+	// every later one.
+	DefaultWebhookBackoff = 30 * time.Second
+	// DefaultWebhookTimeout bounds one delivery.
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookDisableAfter is how many failed deliveries in a row
+	// disable a webhook.
+	DefaultWebhookDisableAfter = 20
+)
+
+// maxWebhookDeliveries is how many deliveries are kept in the log of each
+// webhook.
+const maxWebhookDeliveries = 100
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+var knownWebhookEvents = map[string]bool{
+	EventSessionMined:  true,
+	EventSessionFailed: true,
+	EventStakeReceived: true,
+}
+
+// Webhook is a subscription of an endpoint to events. Session events are
+// sent for the sessions of Gids, or of every game when empty, and stake
+// events for the payments to Addresses.
+type Webhook struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	Events     []string   `json:"events"`
+	Gids       []int      `json:"gids"`
+	Addresses  []string   `json:"addresses"`
+	Secret     string     `json:"secret,omitempty"`
+	Failures   int        `json:"failures"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribed to an event type.
+func (w Webhook) Wants(event string) bool {
+	for _, wanted := range w.Events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGid reports whether the webhook follows a game.
+func (w Webhook) AllowsGid(gid int) bool {
+	if len(w.Gids) == 0 {
+		return true
+	}
+	for _, allowed := range w.Gids {
+		if allowed == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// Watches reports whether the webhook follows the payments to an address.
+func (w Webhook) Watches(address string) bool {
+	for _, watched := range w.Addresses {
+		if watched == address {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the body of a delivery.
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// StakeReceived is the data of a stake.received event.
+type StakeReceived struct {
+	Address string                     `json:"address"`
+	Payment storage.GameHistoryPayment `json:"payment"`
+}
+
+// WebhookDelivery is one attempt at sending an event to a webhook.
+type WebhookDelivery struct {
+	WebhookID     string     `json:"webhook_id"`
+	EventID       string     `json:"event_id"`
+	Event         string     `json:"event"`
+	Attempt       int        `json:"attempt"`
+	StatusCode    int        `json:"status_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	Succeeded     bool       `json:"succeeded"`
+	DurationMs    int64      `json:"duration_ms"`
+	At            time.Time  `json:"at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+// WebhookOptions configures the deliveries of a WebhookService.
+type WebhookOptions struct {
+	// Client sends the deliveries, one with DefaultWebhookTimeout when nil.
+	Client *http.Client
+	// Attempts is how many times an event is sent, DefaultWebhookAttempts
+	// when zero.
+	Attempts int
+	// Backoff is the wait before the first retry, DefaultWebhookBackoff when
+	// zero.
+	Backoff time.Duration
+	// DisableAfter is how many failed deliveries in a row disable a webhook,
+	// DefaultWebhookDisableAfter when zero.
+	DisableAfter int
+}
+
+type WebhookService interface {
+	Create(endpoint string, events []string, gids []int, addresses []string) (res Webhook, err error)
+	List() []Webhook
+	Delete(id string) error
+	Enable(id string) (res Webhook, err error)
+	Test(id string) (res WebhookDelivery, err error)
+	Deliveries(id string) (res []WebhookDelivery, err error)
+	Settled(session storage.GameHistoryGameSession, mined bool)
+	Received(address string, payment storage.GameHistoryPayment)
+	Addresses() []string
+}
+
+type webhooks struct {
+	path       string
+	options    WebhookOptions
+	mutex      sync.RWMutex
+	hooks      map[string]Webhook
+	deliveries map[string][]WebhookDelivery
+}
+
+// NewWebhookService loads the webhooks stored at path.
+//
+// Parameters:
+//   - path: The file webhooks are persisted to, an empty path keeps them in memory.
+//   - options: The client, retries and disabling threshold of deliveries.
+//
+// Returns:
+//   - res: A WebhookService instance.
+//   - err: An error if the stored webhooks could not be read.
+func NewWebhookService(path string, options WebhookOptions) (res WebhookService, err error) {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	if options.Attempts <= 0 {
+		options.Attempts = DefaultWebhookAttempts
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = DefaultWebhookBackoff
+	}
+	if options.DisableAfter <= 0 {
+		options.DisableAfter = DefaultWebhookDisableAfter
+	}
+	service := &webhooks{
+		path:       path,
+		options:    options,
+		hooks:      make(map[string]Webhook),
+		deliveries: make(map[string][]WebhookDelivery),
+	}
+	if path != "" {
+		if err := utils.LoadJSON(path, &service.hooks); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// Create subscribes an endpoint to events.
+//
+// Parameters:
+//   - endpoint: The http or https URL deliveries are posted to.
+//   - events: The event types sent, at least one.
+//   - gids: The games whose session events are sent, empty for every game.
+//   - addresses: The wallets whose stake payments are sent.
+//
+// Returns:
+//   - res: The webhook with the secret its deliveries are signed with.
+//   - err: An error for a malformed URL, unknown events or addresses, or a storage error.
+func (w *webhooks) Create(endpoint string, events []string, gids []int, addresses []string) (res Webhook, err error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return res, fmt.Errorf("invalid webhook url %q", endpoint)
+	}
+	if len(events) == 0 {
+		return res, errors.New("a webhook needs at least one event")
+	}
+	for _, event := range events {
+		if !knownWebhookEvents[event] {
+			return res, fmt.Errorf("unknown event %q", event)
+		}
+	}
+	watched := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			return res, fmt.Errorf("invalid address %q", address)
+		}
+		watched = append(watched, common.HexToAddress(address).Hex())
+	}
+	if gids == nil {
+		gids = []int{}
+	}
+
+	id, err := newWebhookID()
+	if err != nil {
+		return res, err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return res, err
+	}
+	res = Webhook{
+		ID:        id,
+		URL:       endpoint,
+		Events:    events,
+		Gids:      gids,
+		Addresses: watched,
+		Secret:    WebhookSecretPrefix + hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return res, w.save(res)
+}
+
+// List returns every webhook without its secret, oldest first.
+func (w *webhooks) List() []Webhook {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	res := make([]Webhook, 0, len(w.hooks))
+	for _, hook := range w.hooks {
+		hook.Secret = ""
+		res = append(res, hook)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res
+}
+
+// Delete removes a webhook and its delivery log. Retries in flight are
+// dropped.
+func (w *webhooks) Delete(id string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	hook, found := w.hooks[id]
+	if !found {
+		return ErrWebhookNotFound
+	}
+	delete(w.hooks, id)
+	if w.path != "" {
+		if err := utils.SaveJSON(w.path, w.hooks); err != nil {
+			w.hooks[id] = hook
+			return err
+		}
+	}
+	delete(w.deliveries, id)
+	return nil
+}
+
+// Enable resumes the deliveries of a disabled webhook and clears its
+// failures.
+func (w *webhooks) Enable(id string) (res Webhook, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	hook, found := w.hooks[id]
+	if !found {
+		return res, ErrWebhookNotFound
+	}
+	hook.DisabledAt = nil
+	hook.Failures = 0
+	if err := w.save(hook); err != nil {
+		return res, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+// Test sends a webhook.test event once, even to a disabled webhook, and
+// returns how it went. It does not count towards disabling the webhook.
+func (w *webhooks) Test(id string) (res WebhookDelivery, err error) {
+	w.mutex.RLock()
+	hook, found := w.hooks[id]
+	w.mutex.RUnlock()
+	if !found {
+		return res, ErrWebhookNotFound
+	}
+
+	event, err := newWebhookEvent(EventWebhookTest, map[string]string{"webhook_id": id})
+	if err != nil {
+		return res, err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return res, err
+	}
+	res = w.send(hook, event, body, 1)
+	w.record(res, false)
+	return res, nil
+}
+
+// Deliveries returns the logged deliveries of a webhook, newest first.
+func (w *webhooks) Deliveries(id string) (res []WebhookDelivery, err error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if _, found := w.hooks[id]; !found {
+		return nil, ErrWebhookNotFound
+	}
+	logged := w.deliveries[id]
+	res = make([]WebhookDelivery, 0, len(logged))
+	for i := len(logged) - 1; i >= 0; i-- {
+		res = append(res, logged[i])
+	}
+	return res, nil
+}
+
+// Settled sends session.mined or session.failed to the webhooks following the
+// game of a session.
+//
+// It is meant to be registered with PendingSessionService.OnSettled.
+func (w *webhooks) Settled(session storage.GameHistoryGameSession, mined bool) {
+	event := EventSessionMined
+	if !mined {
+		event = EventSessionFailed
+	}
+	gid := int(session.Gid.Int64())
+	w.publish(event, session, func(hook Webhook) bool { return hook.AllowsGid(gid) })
+}
+
+// Received sends stake.received to the webhooks watching an address.
+func (w *webhooks) Received(address string, payment storage.GameHistoryPayment) {
+	address = common.HexToAddress(address).Hex()
+	w.publish(EventStakeReceived, StakeReceived{Address: address, Payment: payment}, func(hook Webhook) bool {
+		return hook.Watches(address)
+	})
+}
+
+// Addresses returns the addresses enabled webhooks watch for stake payments.
+func (w *webhooks) Addresses() []string {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, hook := range w.hooks {
+		if hook.DisabledAt != nil || !hook.Wants(EventStakeReceived) {
+			continue
+		}
+		for _, address := range hook.Addresses {
+			if !seen[address] {
+				seen[address] = true
+				res = append(res, address)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// publish sends an event to the enabled webhooks subscribed to it that
+// match, each in the background.
+func (w *webhooks) publish(eventType string, data any, match func(hook Webhook) bool) {
+	w.mutex.RLock()
+	targets := make([]string, 0)
+	for id, hook := range w.hooks {
+		if hook.DisabledAt == nil && hook.Wants(eventType) && match(hook) {
+			targets = append(targets, id)
+		}
+	}
+	w.mutex.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	event, err := newWebhookEvent(eventType, data)
+	if err != nil {
+		log.Println("while creating webhook event: ", err.Error())
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Println("while encoding webhook event: ", err.Error())
+		return
+	}
+	for _, id := range targets {
+		go w.deliver(id, event, body)
+	}
+}
+
+// deliver sends an event to a webhook, retrying with a doubling backoff
+// until it succeeds, the attempts run out or the webhook is disabled or
+// deleted.
+func (w *webhooks) deliver(id string, event WebhookEvent, body []byte) {
+	backoff := w.options.Backoff
+	for attempt := 1; ; attempt++ {
+		w.mutex.RLock()
+		hook, found := w.hooks[id]
+		w.mutex.RUnlock()
+		if !found || hook.DisabledAt != nil {
+			return
+		}
+
+		delivery := w.send(hook, event, body, attempt)
+		retry := !delivery.Succeeded && attempt < w.options.Attempts
+		if retry {
+			next := time.Now().UTC().Add(backoff)
+			delivery.NextAttemptAt = &next
+		}
+		if !w.record(delivery, true) || !retry {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts an event to a webhook once, signed with its secret.
+func (w *webhooks) send(hook Webhook, event WebhookEvent, body []byte, attempt int) WebhookDelivery {
+	start := time.Now()
+	res := WebhookDelivery{
+		WebhookID: hook.ID,
+		EventID:   event.ID,
+		Event:     event.Type,
+		Attempt:   attempt,
+		At:        start.UTC(),
+	}
+
+	request, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	timestamp := start.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventHeader, event.Type)
+	request.Header.Set(WebhookDeliveryHeader, event.ID)
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, timestamp, body))
+
+	response, err := w.options.Client.Do(request)
+	res.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	response.Body.Close()
+
+	res.StatusCode = response.StatusCode
+	res.Succeeded = response.StatusCode >= 200 && response.StatusCode < 300
+	if !res.Succeeded {
+		res.Error = "endpoint answered " + response.Status
+	}
+	return res
+}
+
+// record logs a delivery and, when counted, updates the failures of its
+// webhook, disabling it once too many failed in a row. It reports whether
+// the webhook is still enabled.
+func (w *webhooks) record(delivery WebhookDelivery, counted bool) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	hook, found := w.hooks[delivery.WebhookID]
+	if !found {
+		return false
+	}
+	logged := append(w.deliveries[hook.ID], delivery)
+	if len(logged) > maxWebhookDeliveries {
+		logged = logged[len(logged)-maxWebhookDeliveries:]
+	}
+	w.deliveries[hook.ID] = logged
+	if !counted {
+		return hook.DisabledAt == nil
+	}
+
+	if delivery.Succeeded {
+		if hook.Failures == 0 {
+			return true
+		}
+		hook.Failures = 0
+	} else {
+		hook.Failures++
+		if hook.Failures >= w.options.DisableAfter && hook.DisabledAt == nil {
+			now := time.Now().UTC()
+			hook.DisabledAt = &now
+			log.Printf("disabled webhook %s after %d failed deliveries", hook.ID, hook.Failures)
+		}
+	}
+	if err := w.save(hook); err != nil {
+		log.Println("while saving webhook: ", err.Error())
+	}
+	return hook.DisabledAt == nil
+}
+
+// save stores a webhook. The caller holds the lock.
+func (w *webhooks) save(hook Webhook) error {
+	previous, existed := w.hooks[hook.ID]
+	w.hooks[hook.ID] = hook
+	if w.path == "" {
+		return nil
+	}
+	if err := utils.SaveJSON(w.path, w.hooks); err != nil {
+		if existed {
+			w.hooks[hook.ID] = previous
+		} else {
+			delete(w.hooks, hook.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// SignWebhook returns the X-Webhook-Signature of a delivery: "sha256=" and
+// the hex HMAC-SHA256, keyed with the webhook secret, of the timestamp, a dot
+// and the body.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartStakeWatcher reads the stake history of every address a webhook
+// watches each interval until ctx is cancelled, passing new payments to
+// webhooks.Received. The payments found on the first read of an address are
+// taken as already known.
+func StartStakeWatcher(ctx context.Context, stakes StackingContract, webhooks WebhookService, callData *bind.CallOpts, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		known := make(map[string]map[string]bool)
+		for {
+			for _, address := range webhooks.Addresses() {
+				payments, err := stakes.UserStakeHistory(callData, address)
+				if err != nil {
+					log.Printf("while watching the stakes of %s: %v", address, err)
+					continue
+				}
+				seen, watched := known[address]
+				if !watched {
+					seen = make(map[string]bool, len(payments))
+					known[address] = seen
+				}
+				for _, payment := range payments {
+					fingerprint := PaymentFingerprint(payment)
+					if !seen[fingerprint] {
+						seen[fingerprint] = true
+						if watched {
+							webhooks.Received(address, payment)
+						}
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func newWebhookEvent(eventType string, data any) (WebhookEvent, error) {
+	id, err := newWebhookID()
+	if err != nil {
+		return WebhookEvent{}, err
+	}
+	return WebhookEvent{ID: id, Type: eventType, CreatedAt: time.Now().UTC(), Data: data}, nil
+}
+
+func newWebhookID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joey1123455/easy_get_coin/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookEndpoint records the deliveries it gets and answers them with the
+// statuses queued in answers, then 200.
+type webhookEndpoint struct {
+	mutex    sync.Mutex
+	answers  []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.received = append(e.received, r)
+	e.bodies = append(e.bodies, body)
+	status := http.StatusOK
+	if len(e.answers) > 0 {
+		status, e.answers = e.answers[0], e.answers[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (e *webhookEndpoint) count() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return len(e.received)
+}
+
+func newTestWebhooks(t *testing.T, path string) WebhookService {
+	service, err := NewWebhookService(path, WebhookOptions{Attempts: 3, Backoff: 10 * time.Millisecond, DisableAfter: 4})
+	require.NoError(t, err)
+	return service
+}
+
+func TestWebhookCreateValidates(t *testing.T) {
+	service := newTestWebhooks(t, "")
+	tests := []struct {
+		name      string
+		url       string
+		events    []string
+		addresses []string
+	}{
+		{name: "Relative URL", url: "/hook", events: []string{EventSessionMined}},
+		{name: "Other Scheme", url: "ftp://partner.example/hook", events: []string{EventSessionMined}},
+		{name: "No Events", url: "https://partner.example/hook"},
+		{name: "Unknown Event", url: "https://partner.example/hook", events: []string{"session.deleted"}},
+		{name: "Test Event", url: "https://partner.example/hook", events: []string{EventWebhookTest}},
+		{name: "Bad Address", url: "https://partner.example/hook", events: []string{EventStakeReceived}, addresses: []string{"0x12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Create(tt.url, tt.events, nil, tt.addresses)
+			assert.Error(t, err)
+		})
+	}
+	assert.Empty(t, service.List())
+}
+
+func TestWebhookSignsSessionEvents(t *testing.T) {
+	endpoint := &webhookEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	service := newTestWebhooks(t, path)
+	hook, err := service.Create(server.URL, []string{EventSessionMined}, []int{7}, nil)
+	require.NoError(t, err)
+	require.Contains(t, hook.Secret, WebhookSecretPrefix)
+
+	service.Settled(session(8, "other", "alice", "{}", 1), true)
+	service.Settled(session(7, "failed", "alice", "{}", 2), false)
+	service.Settled(session(7, "mined", "alice", "{}", 3), true)
+	require.Eventually(t, func() bool { return endpoint.count() == 1 }, time.Second, 5*time.Millisecond)
+
+	request, body := endpoint.received[0], endpoint.bodies[0]
+	timestamp, err := strconv.ParseInt(request.Header.Get(WebhookTimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, SignWebhook(hook.Secret, timestamp, body), request.Header.Get(WebhookSignatureHeader))
+	assert.Equal(t, EventSessionMined, request.Header.Get(WebhookEventHeader))
+
+	var event struct {
+		ID   string                         `json:"id"`
+		Type string                         `json:"type"`
+		Data storage.GameHistoryGameSession `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, request.Header.Get(WebhookDeliveryHeader), event.ID)
+	assert.Equal(t, "mined", event.Data.Gtid)
+
+	// Secrets are only shown on creation but survive a restart.
+	assert.Empty(t, service.List()[0].Secret)
+	reloaded := newTestWebhooks(t, path)
+	delivery, err := reloaded.Test(hook.ID)
+	require.NoError(t, err)
+	assert.True(t, delivery.Succeeded)
+	assert.Equal(t, EventWebhookTest, endpoint.received[1].Header.Get(WebhookEventHeader))
+	timestamp, _ = strconv.ParseInt(endpoint.received[1].Header.Get(WebhookTimestampHeader), 10, 64)
+	assert.Equal(t, SignWebhook(hook.Secret, timestamp, endpoint.bodies[1]), endpoint.received[1].Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookRetriesAndDisables(t *testing.T) {
+	endpoint := &webhookEndpoint{answers: []int{500, 503}}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	service := newTestWebhooks(t, "")
+	watched := "0x00000000000000000000000000000000000abcde"
+	address := common.HexToAddress(watched).Hex()
+	hook, err := service.Create(server.URL, []string{EventStakeReceived}, nil, []string{watched})
+	require.NoError(t, err)
+	assert.Equal(t, []string{address}, service.Addresses())
+
+	// Two failures are retried with a backoff until the third attempt works.
+	service.Received(address, storage.GameHistoryPayment{Sender: common.HexToAddress("0x1"), Amount: big.NewInt(5), Time: big.NewInt(1)})
+	require.Eventually(t, func() bool { return endpoint.count() == 3 }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		deliveries, _ := service.Deliveries(hook.ID)
+		return len(deliveries) == 3
+	}, time.Second, 5*time.Millisecond)
+	deliveries, _ := service.Deliveries(hook.ID)
+	assert.True(t, deliveries[0].Succeeded)
+	assert.Equal(t, 3, deliveries[0].Attempt)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[2].StatusCode)
+	assert.NotNil(t, deliveries[2].NextAttemptAt)
+	assert.Zero(t, service.List()[0].Failures)
+
+	// Four failures in a row disable the webhook, ending the retries of the
+	// second event.
+	endpoint.mutex.Lock()
+	endpoint.answers = []int{500, 500, 500, 500, 500, 500}
+	endpoint.mutex.Unlock()
+	service.Received(address, storage.GameHistoryPayment{Sender: common.HexToAddress("0x1"), Amount: big.NewInt(6), Time: big.NewInt(2)})
+	require.Eventually(t, func() bool { return service.List()[0].Failures == 3 }, time.Second, 5*time.Millisecond)
+	service.Received(address, storage.GameHistoryPayment{Sender: common.HexToAddress("0x1"), Amount: big.NewInt(7), Time: big.NewInt(3)})
+	require.Eventually(t, func() bool { return service.List()[0].DisabledAt != nil }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 7, endpoint.count())
+	assert.Empty(t, service.Addresses())
+
+	enabled, err := service.Enable(hook.ID)
+	require.NoError(t, err)
+	assert.Nil(t, enabled.DisabledAt)
+	assert.Zero(t, enabled.Failures)
+
+	require.NoError(t, service.Delete(hook.ID))
+	assert.ErrorIs(t, service.Delete(hook.ID), ErrWebhookNotFound)
+	_, err = service.Deliveries(hook.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+}
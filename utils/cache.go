@@ -1,69 +1,331 @@
 package utils
 
 import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Cache eviction policies.
+const (
+	// EvictLRU evicts the least recently used item first.
+	EvictLRU = "lru"
+	// EvictLFU evicts the least frequently used item first, the least recently
+	// used of them on a tie.
+	EvictLFU = "lfu"
+)
+
+// Cache defaults used by NewCache.
+const (
+	DefaultCacheEntries = 10000
+	DefaultCacheJanitor = time.Minute
+)
+
 // CacheItem represents an item in the cache.
 type CacheItem struct {
 	Value      interface{}
 	Expiration int64
+
+	key   string
+	size  int64
+	hits  uint64
+	tick  uint64
+	index int
+}
+
+// CacheOptions bounds a cache. Zero limits are unlimited, but a cache needs at
+// least one of them.
+type CacheOptions struct {
+	// MaxEntries is how many items the cache holds.
+	MaxEntries int
+	// MaxBytes is the total size of the items the cache holds.
+	MaxBytes int64
+	// Policy is EvictLRU or EvictLFU, EvictLRU when empty.
+	Policy string
+	// Janitor is how often expired items are swept, never when zero.
+	Janitor time.Duration
+	// Sizer returns the size of a value, the length of its JSON encoding when nil.
+	Sizer func(value interface{}) int64
+}
+
+// CacheStats counts what the cache did since it was created.
+type CacheStats struct {
+	Policy      string `json:"policy"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+	MaxEntries  int    `json:"max_entries"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Errors      uint64 `json:"errors,omitempty"`
+}
+
+// CacheStore is a bounded in-memory cache, safe for concurrent use. When it
+// is full the item the policy ranks lowest is evicted, and expired items are
+// removed by a background janitor as well as when read.
+//
+// Callers read and write it through typed Cache namespaces.
+type CacheStore struct {
+	options CacheOptions
+	mutex   sync.Mutex
+	items   map[string]*CacheItem
+	order   cacheOrder
+	bytes   int64
+	tick    uint64
+	stats   CacheStats
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewCache creates a least recently used cache of DefaultCacheEntries items,
+// swept every DefaultCacheJanitor.
+func NewCache() *CacheStore {
+	cache, _ := NewBoundedCache(CacheOptions{
+		MaxEntries: DefaultCacheEntries,
+		Policy:     EvictLRU,
+		Janitor:    DefaultCacheJanitor,
+	})
+	return cache
 }
 
-// Cache is a simple in-memory cache.
-type Cache struct {
-	items map[string]CacheItem
-	mutex sync.RWMutex
+// NewBoundedCache creates a cache with the given bounds.
+//
+// Parameters:
+//   - options: The limits, eviction policy and janitor interval.
+//
+// Returns:
+//   - res: The cache. Call Close to stop its janitor.
+//   - err: An error for an unknown policy, negative limits or no limit at all.
+func NewBoundedCache(options CacheOptions) (res *CacheStore, err error) {
+	options.Policy = strings.ToLower(options.Policy)
+	if options.Policy == "" {
+		options.Policy = EvictLRU
+	}
+	switch {
+	case options.Policy != EvictLRU && options.Policy != EvictLFU:
+		return nil, fmt.Errorf("unknown cache policy %q", options.Policy)
+	case options.MaxEntries < 0 || options.MaxBytes < 0:
+		return nil, fmt.Errorf("cache limits cannot be negative")
+	case options.MaxEntries == 0 && options.MaxBytes == 0:
+		return nil, fmt.Errorf("a cache needs a maximum entry count or byte size")
+	}
+	if options.Sizer == nil {
+		options.Sizer = JSONSize
+	}
+
+	res = &CacheStore{
+		options: options,
+		items:   make(map[string]*CacheItem),
+		stop:    make(chan struct{}),
+	}
+	res.order.lfu = options.Policy == EvictLFU
+	res.stats.Policy = options.Policy
+	res.stats.MaxEntries = options.MaxEntries
+	res.stats.MaxBytes = options.MaxBytes
+	if options.Janitor > 0 {
+		go res.janitor(options.Janitor)
+	}
+	return res, nil
 }
 
-// NewCache creates a new cache.
-func NewCache() *Cache {
-	return &Cache{
-		items: make(map[string]CacheItem),
+// JSONSize returns the length of the JSON encoding of a value, or 0 when it
+// cannot be encoded.
+func JSONSize(value interface{}) int64 {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return 0
 	}
+	return int64(len(encoded))
 }
 
-// Set adds an item to the cache.
-func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+// Set adds an item to the cache, evicting items until it fits. Items larger
+// than the byte budget are not cached.
+func (c *CacheStore) Set(key string, value interface{}, ttl time.Duration) {
+	size := int64(0)
+	if c.options.MaxBytes > 0 {
+		size = c.options.Sizer(value)
+		if size > c.options.MaxBytes {
+			c.Delete(key)
+			return
+		}
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	expiration := time.Now().Add(ttl).UnixNano()
-	c.items[key] = CacheItem{Value: value, Expiration: expiration}
+	c.tick++
+	hits := uint64(0)
+	if item, found := c.items[key]; found {
+		hits = item.hits
+		c.remove(item)
+	}
+	for c.needsRoom(size) {
+		c.remove(c.order.items[0])
+		c.stats.Evictions++
+	}
+
+	item := &CacheItem{
+		Value:      value,
+		Expiration: time.Now().Add(ttl).UnixNano(),
+		key:        key,
+		size:       size,
+		hits:       hits,
+		tick:       c.tick,
+	}
+	c.items[key] = item
+	c.bytes += size
+	heap.Push(&c.order, item)
+}
+
+// needsRoom reports whether items must be evicted to add one of size. The
+// caller holds the lock.
+func (c *CacheStore) needsRoom(size int64) bool {
+	if len(c.items) == 0 {
+		return false
+	}
+	return c.options.MaxEntries > 0 && len(c.items) >= c.options.MaxEntries ||
+		c.options.MaxBytes > 0 && c.bytes+size > c.options.MaxBytes
 }
 
 // Get retrieves an item from the cache.
-func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+func (c *CacheStore) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
 	item, found := c.items[key]
 	if !found {
+		c.stats.Misses++
 		return nil, false
 	}
 
 	if time.Now().UnixNano() > item.Expiration {
-		// Item has expired.
-		delete(c.items, key)
+		c.remove(item)
+		c.stats.Expirations++
+		c.stats.Misses++
 		return nil, false
 	}
 
+	c.tick++
+	item.hits++
+	item.tick = c.tick
+	heap.Fix(&c.order, item.index)
+	c.stats.Hits++
 	return item.Value, true
 }
 
+// Fetch implements CacheBackend. Values are kept as they are, so decode is
+// not used.
+func (c *CacheStore) Fetch(key string, decode func(data []byte) (interface{}, error)) (interface{}, bool) {
+	return c.Get(key)
+}
+
 // Delete removes an item from the cache.
-func (c *Cache) Delete(key string) {
+func (c *CacheStore) Delete(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.items, key)
+	if item, found := c.items[key]; found {
+		c.remove(item)
+	}
 }
 
 // Clear removes all items from the cache.
-func (c *Cache) Clear() {
+func (c *CacheStore) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[string]*CacheItem)
+	c.order.items = nil
+	c.bytes = 0
+}
+
+// Stats returns the counters of the cache.
+func (c *CacheStore) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	res := c.stats
+	res.Entries = len(c.items)
+	res.Bytes = c.bytes
+	return res
+}
+
+// DeleteExpired removes every expired item.
+func (c *CacheStore) DeleteExpired() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.items = make(map[string]CacheItem)
+	now := time.Now().UnixNano()
+	for _, item := range c.items {
+		if now > item.Expiration {
+			c.remove(item)
+			c.stats.Expirations++
+		}
+	}
+}
+
+// Close stops the janitor. The cache can still be used.
+func (c *CacheStore) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+func (c *CacheStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// remove drops an item. The caller holds the lock.
+func (c *CacheStore) remove(item *CacheItem) {
+	heap.Remove(&c.order, item.index)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
+
+// cacheOrder is a heap of items with the next one to evict on top.
+type cacheOrder struct {
+	items []*CacheItem
+	lfu   bool
+}
+
+func (o cacheOrder) Len() int { return len(o.items) }
+
+func (o cacheOrder) Less(i, j int) bool {
+	a, b := o.items[i], o.items[j]
+	if o.lfu && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.tick < b.tick
+}
+
+func (o cacheOrder) Swap(i, j int) {
+	o.items[i], o.items[j] = o.items[j], o.items[i]
+	o.items[i].index = i
+	o.items[j].index = j
+}
+
+func (o *cacheOrder) Push(x interface{}) {
+	item := x.(*CacheItem)
+	item.index = len(o.items)
+	o.items = append(o.items, item)
+}
+
+func (o *cacheOrder) Pop() interface{} {
+	last := o.items[len(o.items)-1]
+	o.items[len(o.items)-1] = nil
+	o.items = o.items[:len(o.items)-1]
+	return last
 }
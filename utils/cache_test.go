@@ -67,3 +67,134 @@ func TestCacheClear(t *testing.T) {
 	}
 
 }
+
+func TestCacheEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CacheOptions
+		want    []string
+		evicted []string
+	}{
+		{
+			name:    "LRU",
+			options: CacheOptions{MaxEntries: 2, Policy: EvictLRU},
+			want:    []string{"b", "c"},
+			evicted: []string{"a"},
+		},
+		{
+			name:    "LFU",
+			options: CacheOptions{MaxEntries: 2, Policy: EvictLFU},
+			want:    []string{"a", "c"},
+			evicted: []string{"b"},
+		},
+		{
+			name:    "Byte Budget",
+			options: CacheOptions{MaxBytes: 10, Sizer: func(value interface{}) int64 { return int64(len(value.(string))) }},
+			want:    []string{"c"},
+			evicted: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewBoundedCache(tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cache.Close()
+
+			cache.Set("a", "aaaa", time.Minute)
+			cache.Set("b", "bbbb", time.Minute)
+			cache.Get("a")
+			cache.Get("a")
+			cache.Get("b")
+			cache.Set("c", "cccccccc", time.Minute)
+
+			for _, key := range tt.want {
+				if _, found := cache.Get(key); !found {
+					t.Errorf("Expected to find %s", key)
+				}
+			}
+			for _, key := range tt.evicted {
+				if _, found := cache.Get(key); found {
+					t.Errorf("Expected %s to be evicted", key)
+				}
+			}
+			if stats := cache.Stats(); stats.Evictions != uint64(len(tt.evicted)) {
+				t.Errorf("Expected %d evictions, got %d", len(tt.evicted), stats.Evictions)
+			}
+		})
+	}
+}
+
+func TestCacheLFUKeepsNewItem(t *testing.T) {
+	cache, _ := NewBoundedCache(CacheOptions{MaxEntries: 2, Policy: EvictLFU})
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Get("a")
+	cache.Get("b")
+
+	cache.Set("c", 3, time.Minute)
+	if _, found := cache.Get("c"); !found {
+		t.Error("Expected the item just set to stay in the cache")
+	}
+}
+
+func TestCacheOversizedItem(t *testing.T) {
+	cache, _ := NewBoundedCache(CacheOptions{MaxBytes: 4})
+	cache.Set("big", "more than four bytes", time.Minute)
+	if _, found := cache.Get("big"); found {
+		t.Error("Expected an item over the byte budget not to be cached")
+	}
+}
+
+func TestCacheJanitorAndStats(t *testing.T) {
+	cache, _ := NewBoundedCache(CacheOptions{MaxEntries: 10, Janitor: 10 * time.Millisecond})
+	defer cache.Close()
+
+	cache.Set("short", 1, time.Millisecond)
+	cache.Set("long", 2, time.Minute)
+	cache.Get("long")
+	cache.Get("missing")
+
+	time.Sleep(50 * time.Millisecond)
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Expirations != 1 {
+		t.Errorf("Expected the janitor to expire one of two items, got %d entries and %d expirations", stats.Entries, stats.Expirations)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", stats.Hits, stats.Misses)
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	cache, _ := NewBoundedCache(CacheOptions{MaxEntries: 50, Policy: EvictLFU})
+	done := make(chan struct{})
+	for worker := 0; worker < 8; worker++ {
+		go func(worker int) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 1000; i++ {
+				key := string(rune('a' + (worker*i)%80))
+				cache.Set(key, i, time.Millisecond*time.Duration(i%3))
+				cache.Get(key)
+				if i%100 == 0 {
+					cache.DeleteExpired()
+				}
+			}
+		}(worker)
+	}
+	for worker := 0; worker < 8; worker++ {
+		<-done
+	}
+	if stats := cache.Stats(); stats.Entries > 50 {
+		t.Errorf("Expected at most 50 entries, got %d", stats.Entries)
+	}
+}
+
+func TestNewBoundedCacheRejects(t *testing.T) {
+	for _, options := range []CacheOptions{{}, {MaxEntries: 1, Policy: "fifo"}, {MaxEntries: -1}} {
+		if _, err := NewBoundedCache(options); err == nil {
+			t.Errorf("Expected options %+v to be rejected", options)
+		}
+	}
+}
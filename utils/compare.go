@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Comparator orders two values: negative when a sorts before b, zero on a tie
+// and positive when a sorts after b.
+type Comparator[T any] func(a, b T) int
+
+// By compares values by an ordered key.
+func By[T any, K cmp.Ordered](key func(item T) K) Comparator[T] {
+	return func(a, b T) int {
+		return cmp.Compare(key(a), key(b))
+	}
+}
+
+// ByBig compares values by a big.Int key. Nil keys sort first.
+func ByBig[T any](key func(item T) *big.Int) Comparator[T] {
+	return func(a, b T) int {
+		x, y := key(a), key(b)
+		switch {
+		case x == nil && y == nil:
+			return 0
+		case x == nil:
+			return -1
+		case y == nil:
+			return 1
+		}
+		return x.Cmp(y)
+	}
+}
+
+// Reverse returns the comparator sorting in the opposite direction.
+func (c Comparator[T]) Reverse() Comparator[T] {
+	return func(a, b T) int {
+		return c(b, a)
+	}
+}
+
+// Then returns a comparator breaking the ties of c with next.
+func (c Comparator[T]) Then(next Comparator[T]) Comparator[T] {
+	return func(a, b T) int {
+		if res := c(a, b); res != 0 {
+			return res
+		}
+		return next(a, b)
+	}
+}
+
+// Sort sorts items in place, keeping the order of ties.
+func (c Comparator[T]) Sort(items []T) {
+	slices.SortStableFunc(items, c)
+}
+
+// SortFields names the comparators a list can be sorted by.
+type SortFields[T any] map[string]Comparator[T]
+
+// Parse reads a sort such as "-time,gid": comma separated field names, each
+// ascending or, with a leading "-", descending. Later fields break the ties of
+// earlier ones.
+//
+// Parameters:
+//   - spec: The sort asked for.
+//
+// Returns:
+//   - res: The comparator, nil when spec is empty.
+//   - err: An error naming an unknown field.
+func (f SortFields[T]) Parse(spec string) (res Comparator[T], err error) {
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		descending := strings.HasPrefix(field, "-")
+		name := strings.TrimLeft(field, "+-")
+		compare, found := f[name]
+		if !found {
+			return nil, fmt.Errorf("cannot sort by %q, use one of %s", name, strings.Join(f.names(), ", "))
+		}
+		if descending {
+			compare = compare.Reverse()
+		}
+		if res == nil {
+			res = compare
+		} else {
+			res = res.Then(compare)
+		}
+	}
+	return res, nil
+}
+
+func (f SortFields[T]) names() []string {
+	res := make([]string, 0, len(f))
+	for name := range f {
+		res = append(res, name)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// Filter reports whether an item is kept.
+type Filter[T any] func(item T) bool
+
+// Where returns the items every filter keeps, in a new slice.
+func Where[T any](items []T, filters ...Filter[T]) []T {
+	res := make([]T, 0, len(items))
+	for _, item := range items {
+		kept := true
+		for _, filter := range filters {
+			if !filter(item) {
+				kept = false
+				break
+			}
+		}
+		if kept {
+			res = append(res, item)
+		}
+	}
+	return res
+}
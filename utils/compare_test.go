@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sortItem is a listed item sorted by its fields.
+type sortItem struct {
+	name   string
+	group  int
+	amount *big.Int
+}
+
+var sortItemFields = SortFields[sortItem]{
+	"name":   By(func(item sortItem) string { return item.name }),
+	"group":  By(func(item sortItem) int { return item.group }),
+	"amount": ByBig(func(item sortItem) *big.Int { return item.amount }),
+}
+
+func sortItems() []sortItem {
+	return []sortItem{
+		{name: "b", group: 2, amount: big.NewInt(30)},
+		{name: "a", group: 1, amount: big.NewInt(20)},
+		{name: "d", group: 2, amount: nil},
+		{name: "c", group: 1, amount: big.NewInt(10)},
+	}
+}
+
+func sortNames(items []sortItem) string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.name)
+	}
+	return strings.Join(names, "")
+}
+
+func TestSortFieldsParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Ascending", spec: "name", want: "abcd"},
+		{name: "Descending", spec: "-name", want: "dcba"},
+		{name: "Big Keys With Nil First", spec: "amount", want: "dcab"},
+		{name: "Descending Big Keys", spec: "-amount", want: "bacd"},
+		{name: "Ties Broken By Later Fields", spec: "group,-name", want: "cadb"},
+		{name: "Spaces And Plus", spec: " -group , +amount", want: "dbca"},
+		{name: "Empty Keeps Order", spec: "", want: "badc"},
+		{name: "Unknown Field", spec: "name,colour", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := sortItemFields.Parse(tt.spec)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "amount, group, name") {
+					t.Fatalf("Expected an error listing the fields, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			items := sortItems()
+			if order != nil {
+				order.Sort(items)
+			}
+			if got := sortNames(items); got != tt.want {
+				t.Errorf("Sorted %q as %s, want %s", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparatorSortIsStable(t *testing.T) {
+	items := sortItems()
+	By(func(item sortItem) int { return item.group }).Sort(items)
+	if got := sortNames(items); got != "acbd" {
+		t.Errorf("Expected ties in their original order, got %s", got)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	items := sortItems()
+	grouped := func(item sortItem) bool { return item.group == 2 }
+	priced := func(item sortItem) bool { return item.amount != nil }
+
+	tests := []struct {
+		name    string
+		filters []Filter[sortItem]
+		want    string
+	}{
+		{name: "No Filters", filters: nil, want: "badc"},
+		{name: "One Filter", filters: []Filter[sortItem]{grouped}, want: "bd"},
+		{name: "Every Filter", filters: []Filter[sortItem]{grouped, priced}, want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Where(items, tt.filters...)
+			if sortNames(got) != tt.want {
+				t.Errorf("Where() = %s, want %s", sortNames(got), tt.want)
+			}
+		})
+	}
+
+	kept := Where(items)
+	kept[0].name = "z"
+	if !reflect.DeepEqual(items, sortItems()) {
+		t.Error("Expected Where to leave the items untouched")
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LoadJSON decodes the JSON file at path into v.
+//
+// A missing file is not an error and leaves v untouched, so callers can
+// start from an empty store on first run.
+func LoadJSON(path string, v interface{}) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, v)
+}
+
+// SaveJSON writes v as JSON to path.
+//
+// The file is written to a temporary file in the same directory and renamed
+// over the old one, so a crash never leaves a half written store behind.
+func SaveJSON(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
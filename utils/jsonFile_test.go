@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "store.json")
+
+	// Test loading a store that does not exist yet
+	loaded := map[string]int{"untouched": 1}
+	if err := LoadJSON(path, &loaded); err != nil {
+		t.Fatalf("Expected no error for a missing file, got %v", err)
+	}
+	if loaded["untouched"] != 1 {
+		t.Error("Expected a missing file to leave the value untouched")
+	}
+
+	// Test round tripping a value
+	if err := SaveJSON(path, map[string]int{"a": 1, "b": 2}); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	loaded = map[string]int{}
+	if err := LoadJSON(path, &loaded); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	if loaded["a"] != 1 || loaded["b"] != 2 {
+		t.Errorf("Expected the saved values, got %v", loaded)
+	}
+
+	// Test that no temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the store file, got %d entries", len(entries))
+	}
+}
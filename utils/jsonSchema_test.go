@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["score", "mode"],
+	"additionalProperties": false,
+	"properties": {
+		"score": {"type": "integer", "minimum": 0, "maximum": 1000},
+		"mode": {"enum": ["easy", "hard"]},
+		"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+		"laps": {"type": "array", "maxItems": 2, "items": {"type": "number", "exclusiveMinimum": 0}},
+		"bonus": {"type": ["number", "null"]}
+	}
+}`
+
+func TestCompileJSONSchema(t *testing.T) {
+	if _, err := CompileJSONSchema([]byte(testSchema)); err != nil {
+		t.Fatalf("Expected the schema to compile, got %v", err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"type": "text"}`,
+		`{"properties": {"name": {"pattern": "("}}}`,
+	}
+	for _, schema := range invalid {
+		if _, err := CompileJSONSchema([]byte(schema)); err == nil {
+			t.Errorf("Expected %s to be rejected", schema)
+		}
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, _ := CompileJSONSchema([]byte(testSchema))
+
+	tests := []struct {
+		name     string
+		document string
+		want     []FieldError
+	}{
+		{
+			name:     "Valid Document",
+			document: `{"score": 10, "mode": "easy", "name": "bob", "laps": [1.5, 2], "bonus": null}`,
+			want:     []FieldError{},
+		},
+		{
+			name:     "Not Json",
+			document: `score=10`,
+			want:     []FieldError{{Field: "$", Message: "must be valid json"}},
+		},
+		{
+			name:     "Wrong Root Type",
+			document: `[1]`,
+			want:     []FieldError{{Field: "$", Message: "must be of type object"}},
+		},
+		{
+			name:     "Field Errors",
+			document: `{"score": 10.5, "name": "B", "extra": true, "laps": [0, 1, 2]}`,
+			want: []FieldError{
+				{Field: "mode", Message: "is required"},
+				{Field: "extra", Message: "is not allowed"},
+				{Field: "laps", Message: "must have at most 2 items"},
+				{Field: "laps[0]", Message: "must be greater than 0"},
+				{Field: "name", Message: "must be at least 2 characters"},
+				{Field: "name", Message: "must match pattern ^[a-z]+$"},
+				{Field: "score", Message: "must be of type integer"},
+			},
+		},
+		{
+			name:     "Range And Enum",
+			document: `{"score": 1001, "mode": "nightmare"}`,
+			want: []FieldError{
+				{Field: "mode", Message: "must be one of the allowed values"},
+				{Field: "score", Message: "must be at most 1000"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.ValidateJSON(tt.document); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseKeyValueList parses a comma separated list of key=value pairs such as
+// "EGC=0.01,MATIC=0.7" into a map. Keys and values are trimmed and entries
+// without a key are ignored.
+func ParseKeyValueList(list string) map[string]string {
+	res := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		key, value, _ := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		res[key] = strings.TrimSpace(value)
+	}
+	return res
+}
+
+// ParseList parses a comma separated list such as "10.0.0.1, 10.1.0.0/16",
+// trimming entries and dropping empty ones. An empty list returns nil.
+func ParseList(list string) []string {
+	var res []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// ParseIntList parses a comma separated list of integers such as "1, 7,8".
+func ParseIntList(list string) ([]int, error) {
+	res := make([]int, 0)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		value, err := strconv.Atoi(entry)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, value)
+	}
+	return res, nil
+}
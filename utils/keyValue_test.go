@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyValueList(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want map[string]string
+	}{
+		{
+			name: "Empty List",
+			list: "",
+			want: map[string]string{},
+		},
+		{
+			name: "Pairs With Spaces",
+			list: " EGC = 0.01, MATIC=0.7 ",
+			want: map[string]string{"EGC": "0.01", "MATIC": "0.7"},
+		},
+		{
+			name: "Missing Key And Value",
+			list: "=1,USDT",
+			want: map[string]string{"USDT": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseKeyValueList(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeyValueList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	if got := ParseList(" "); got != nil {
+		t.Errorf("ParseList() = %v, want nil", got)
+	}
+	if got := ParseList(" 10.0.0.1,, 10.1.0.0/16 "); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.1.0.0/16"}) {
+		t.Errorf("ParseList() = %v, want [10.0.0.1 10.1.0.0/16]", got)
+	}
+}
+
+func TestParseIntList(t *testing.T) {
+	got, err := ParseIntList(" 1, 7,,8 ")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 7, 8}) {
+		t.Errorf("ParseIntList() = %v, want [1 7 8]", got)
+	}
+
+	if _, err := ParseIntList("1,x"); err == nil {
+		t.Error("Expected an error for a non numeric entry")
+	}
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// Pagination defaults.
+const (
+	DefaultPageSize    = 20
+	DefaultMaxPageSize = 100
+)
+
+var (
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidPage     = errors.New("invalid page number")
+	ErrInvalidPageSize = errors.New("invalid page size")
+)
+
+// Cursor marks the last item of a page by its sort position and identity, so
+// the next page starts after it however many items were added in front.
+type Cursor struct {
+	Position int64  `json:"p"`
+	ID       string `json:"i"`
+	// Item holds the JSON of the fields the item can be sorted by, so a page
+	// in another order than by position can resume once the item is gone.
+	Item json.RawMessage `json:"k,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor handed to clients.
+func (c Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeCursor reads a cursor returned by Encode.
+func DecodeCursor(cursor string) (res Cursor, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return res, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(decoded, &res); err != nil || res.ID == "" {
+		return res, ErrInvalidCursor
+	}
+	return res, nil
+}
+
+// PageRequest is the page a client asked for. With a cursor the page starts
+// after it, otherwise Page counts pages of Size from 1.
+type PageRequest struct {
+	Size   int
+	Page   int
+	Cursor *Cursor
+}
+
+// Pagination bounds the page sizes clients can ask for.
+type Pagination struct {
+	// DefaultSize is used when no size is asked for, DefaultPageSize when zero.
+	DefaultSize int
+	// MaxSize caps the size asked for, DefaultMaxPageSize when zero.
+	MaxSize int
+}
+
+// Parse reads a page request from the cursor, page and pageSize query
+// parameters. Sizes above the maximum are cut to it.
+//
+// Parameters:
+//   - query: The request query.
+//
+// Returns:
+//   - res: The page request.
+//   - err: An error for a malformed cursor, page number or page size.
+func (p Pagination) Parse(query url.Values) (res PageRequest, err error) {
+	res.Size = p.DefaultSize
+	if res.Size <= 0 {
+		res.Size = DefaultPageSize
+	}
+	maxSize := p.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPageSize
+	}
+
+	if size := query.Get("pageSize"); size != "" {
+		if res.Size, err = strconv.Atoi(size); err != nil || res.Size < 1 {
+			return res, ErrInvalidPageSize
+		}
+	}
+	res.Size = min(res.Size, maxSize)
+
+	res.Page = 1
+	if page := query.Get("page"); page != "" {
+		if res.Page, err = strconv.Atoi(page); err != nil || res.Page < 1 {
+			return res, ErrInvalidPage
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		decoded, err := DecodeCursor(cursor)
+		if err != nil {
+			return res, err
+		}
+		res.Cursor = &decoded
+	}
+	return res, nil
+}
+
+// Page is one page of a list.
+type Page[T any] struct {
+	Items   []T
+	Total   int
+	HasMore bool
+	// Next is the encoded cursor of the following page, empty on the last one.
+	Next string
+}
+
+// Paginate cuts a page from items sorted by order, or by descending position
+// when order is nil.
+//
+// A cursor resumes after the item it names. When that item is gone, the page
+// starts at the first item that sorts after the cursor's Item under order, or
+// that is positioned below the cursor without one.
+//
+// Parameters:
+//   - items: The whole list, sorted.
+//   - request: The page asked for.
+//   - cursorOf: Returns the cursor of an item.
+//   - order: The order items are sorted in, nil for newest first.
+//
+// Returns:
+//   - res: The page. Pages past the end are empty.
+func Paginate[T any](items []T, request PageRequest, cursorOf func(item T) Cursor, order Comparator[T]) (res Page[T]) {
+	res.Total = len(items)
+	if request.Size < 1 {
+		request.Size = DefaultPageSize
+	}
+	request.Page = max(request.Page, 1)
+
+	start := len(items)
+	if request.Cursor == nil {
+		// Checked before multiplying so huge page numbers cannot overflow.
+		if request.Page-1 < len(items)/request.Size+1 {
+			start = min((request.Page-1)*request.Size, len(items))
+		}
+	} else {
+		start = resumeAt(items, *request.Cursor, cursorOf, order)
+	}
+
+	end := min(start+request.Size, len(items))
+	res.Items = items[start:end]
+	res.HasMore = end < len(items)
+	if res.HasMore {
+		res.Next = cursorOf(items[end-1]).Encode()
+	}
+	return res
+}
+
+// resumeAt returns the index of the first item after cursor.
+func resumeAt[T any](items []T, cursor Cursor, cursorOf func(item T) Cursor, order Comparator[T]) int {
+	for i, item := range items {
+		if cursorOf(item).ID == cursor.ID {
+			return i + 1
+		}
+	}
+
+	var anchor T
+	if order != nil && json.Unmarshal(cursor.Item, &anchor) == nil {
+		for i, item := range items {
+			if order(item, anchor) > 0 {
+				return i
+			}
+		}
+		return len(items)
+	}
+	for i, item := range items {
+		if cursorOf(item).Position < cursor.Position {
+			return i
+		}
+	}
+	return len(items)
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// pageItem is a listed item positioned by its time.
+type pageItem struct {
+	id   string
+	time int64
+}
+
+func itemCursor(item pageItem) Cursor {
+	return Cursor{Position: item.time, ID: item.id}
+}
+
+func itemIDs(items []pageItem) []string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.id)
+	}
+	return res
+}
+
+func TestPaginationParse(t *testing.T) {
+	cursor := Cursor{Position: 10, ID: "a"}
+	tests := []struct {
+		name    string
+		query   string
+		want    PageRequest
+		wantErr error
+	}{
+		{name: "Defaults", query: "", want: PageRequest{Size: 20, Page: 1}},
+		{name: "Page And Size", query: "page=3&pageSize=5", want: PageRequest{Size: 5, Page: 3}},
+		{name: "Size Above Maximum", query: "pageSize=500", want: PageRequest{Size: 50, Page: 1}},
+		{name: "Cursor", query: "cursor=" + cursor.Encode(), want: PageRequest{Size: 20, Page: 1, Cursor: &cursor}},
+		{name: "Negative Size", query: "pageSize=-1", wantErr: ErrInvalidPageSize},
+		{name: "Zero Page", query: "page=0", wantErr: ErrInvalidPage},
+		{name: "Garbled Cursor", query: "cursor=%21%21", wantErr: ErrInvalidCursor},
+	}
+
+	pages := Pagination{MaxSize: 50}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := pages.Parse(query)
+			if err != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := make([]pageItem, 0, 5)
+	for i := 5; i >= 1; i-- {
+		items = append(items, pageItem{id: "s" + strconv.Itoa(i), time: int64(i)})
+	}
+
+	first := Paginate(items, PageRequest{Size: 2, Page: 1}, itemCursor, nil)
+	if !reflect.DeepEqual(itemIDs(first.Items), []string{"s5", "s4"}) || first.Total != 5 || !first.HasMore {
+		t.Fatalf("Unexpected first page %+v", first)
+	}
+
+	// A newer item arriving does not shift the next page.
+	items = append([]pageItem{{id: "s6", time: 6}}, items...)
+	cursor, err := DecodeCursor(first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := Paginate(items, PageRequest{Size: 2, Cursor: &cursor}, itemCursor, nil)
+	if !reflect.DeepEqual(itemIDs(second.Items), []string{"s3", "s2"}) || second.Total != 6 {
+		t.Fatalf("Unexpected second page %+v", second)
+	}
+
+	// The cursor item disappearing resumes at the next older one.
+	items = append(items[:4], items[5:]...)
+	cursor, _ = DecodeCursor(second.Next)
+	last := Paginate(items, PageRequest{Size: 2, Cursor: &cursor}, itemCursor, nil)
+	if !reflect.DeepEqual(itemIDs(last.Items), []string{"s1"}) || last.HasMore || last.Next != "" {
+		t.Fatalf("Unexpected last page %+v", last)
+	}
+
+	past := Paginate(items, PageRequest{Size: 2, Page: 9}, itemCursor, nil)
+	if len(past.Items) != 0 || past.HasMore || past.Total != 5 {
+		t.Errorf("Expected an empty page past the end, got %+v", past)
+	}
+}
+
+func TestPaginateResumesInSortOrder(t *testing.T) {
+	type scored struct {
+		ID    string
+		Score int
+	}
+	cursorOf := func(item scored) Cursor {
+		keys, _ := json.Marshal(item)
+		return Cursor{ID: item.ID, Item: keys}
+	}
+	byScore := By(func(item scored) int { return item.Score })
+	items := []scored{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}
+
+	first := Paginate(items, PageRequest{Size: 2}, cursorOf, byScore)
+	cursor, err := DecodeCursor(first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cursor item disappearing resumes at the next one in the sort order.
+	items = []scored{{"a", 1}, {"c", 3}, {"d", 4}}
+	second := Paginate(items, PageRequest{Size: 2, Cursor: &cursor}, cursorOf, byScore)
+	if len(second.Items) != 2 || second.Items[0].ID != "c" || second.HasMore {
+		t.Fatalf("Unexpected second page %+v", second)
+	}
+
+	huge := Paginate(items, PageRequest{Size: 100, Page: math.MaxInt / 10}, cursorOf, byScore)
+	if len(huge.Items) != 0 || huge.HasMore {
+		t.Errorf("Expected an empty page for a huge page number, got %+v", huge)
+	}
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis cache defaults.
+const (
+	DefaultRedisPrefix   = "egc:cache:"
+	DefaultRedisLocalTTL = 30 * time.Second
+	redisPoolSize        = 8
+)
+
+// RedisCacheOptions configures a RedisCache.
+type RedisCacheOptions struct {
+	// URL is the redis://[user:password@]host:port[/db] server URL.
+	URL string
+	// Prefix starts every key, DefaultRedisPrefix when empty.
+	Prefix string
+	// Local bounds the in-process copy of recently read values.
+	Local CacheOptions
+	// LocalTTL caps how long a value is served from the local copy, in case an
+	// invalidation is missed while the subscription reconnects.
+	// DefaultRedisLocalTTL when zero.
+	LocalTTL time.Duration
+}
+
+// RedisCache is a CacheBackend shared by every instance connected to the
+// same Redis server. Values are stored as JSON, and recently used values are
+// also kept decoded in a local CacheStore. Writes and deletes are published
+// on an invalidation channel so the other instances drop their local copy.
+type RedisCache struct {
+	client   *RedisClient
+	prefix   string
+	channel  string
+	instance string
+	local    *CacheStore
+	localTTL time.Duration
+	mutex    sync.Mutex
+	hits     uint64
+	misses   uint64
+	errors   uint64
+}
+
+// NewRedisCache connects a RedisCache and subscribes to its invalidations.
+//
+// Parameters:
+//   - options: The server, key prefix and local copy bounds.
+//
+// Returns:
+//   - res: The backend. Call Close to stop it.
+//   - err: An error for a malformed URL or unusable local bounds.
+func NewRedisCache(options RedisCacheOptions) (res *RedisCache, err error) {
+	client, err := NewRedisClient(options.URL, redisPoolSize)
+	if err != nil {
+		return nil, err
+	}
+	local, err := NewBoundedCache(options.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := make([]byte, 8)
+	if _, err := rand.Read(instance); err != nil {
+		return nil, err
+	}
+	res = &RedisCache{
+		client:   client,
+		prefix:   options.Prefix,
+		instance: hex.EncodeToString(instance),
+		local:    local,
+		localTTL: options.LocalTTL,
+	}
+	if res.prefix == "" {
+		res.prefix = DefaultRedisPrefix
+	}
+	if res.localTTL <= 0 {
+		res.localTTL = DefaultRedisLocalTTL
+	}
+	res.channel = res.prefix + "invalidate"
+
+	go client.Subscribe(res.channel, res.invalidated)
+	return res, nil
+}
+
+// Fetch implements CacheBackend.
+func (r *RedisCache) Fetch(key string, decode func(data []byte) (interface{}, error)) (interface{}, bool) {
+	if value, found := r.local.Get(key); found {
+		r.count(&r.hits)
+		return value, true
+	}
+
+	reply, err := r.client.Do("GET", r.prefix+key)
+	if err != nil {
+		r.failed("GET", err)
+		r.count(&r.misses)
+		return nil, false
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		r.count(&r.misses)
+		return nil, false
+	}
+	value, err := decode(data)
+	if err != nil {
+		r.failed("decode", err)
+		r.count(&r.misses)
+		return nil, false
+	}
+
+	ttl := r.localTTL
+	if remaining, err := r.client.Do("PTTL", r.prefix+key); err == nil {
+		if ms, ok := remaining.(int64); ok && ms > 0 && time.Duration(ms)*time.Millisecond < ttl {
+			ttl = time.Duration(ms) * time.Millisecond
+		}
+	}
+	r.local.Set(key, value, ttl)
+	r.count(&r.hits)
+	return value, true
+}
+
+// Set implements CacheBackend. Values that cannot be encoded as JSON are only
+// kept locally.
+func (r *RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	r.local.Set(key, value, min(ttl, r.localTTL))
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		r.failed("encode", err)
+		return
+	}
+	ms := max(ttl.Milliseconds(), 1)
+	if _, err := r.client.Do("SET", r.prefix+key, string(data), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		r.failed("SET", err)
+		return
+	}
+	r.publish(key)
+}
+
+// Delete implements CacheBackend.
+func (r *RedisCache) Delete(key string) {
+	r.local.Delete(key)
+	if _, err := r.client.Do("DEL", r.prefix+key); err != nil {
+		r.failed("DEL", err)
+	}
+	r.publish(key)
+}
+
+// Stats implements CacheBackend. Entries, bytes and evictions are those of
+// the local copy, hits and misses count every read.
+func (r *RedisCache) Stats() CacheStats {
+	res := r.local.Stats()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	res.Policy = "redis+" + res.Policy
+	res.Hits = r.hits
+	res.Misses = r.misses
+	res.Errors = r.errors
+	return res
+}
+
+// Close implements CacheBackend.
+func (r *RedisCache) Close() {
+	r.client.Close()
+	r.local.Close()
+}
+
+// publish tells the other instances a key changed.
+func (r *RedisCache) publish(key string) {
+	if _, err := r.client.Do("PUBLISH", r.channel, r.instance+" "+key); err != nil {
+		r.failed("PUBLISH", err)
+	}
+}
+
+// invalidated drops the local copy of a key another instance changed.
+func (r *RedisCache) invalidated(payload []byte) {
+	instance, key, found := strings.Cut(string(payload), " ")
+	if !found || instance == r.instance {
+		return
+	}
+	r.local.Delete(key)
+}
+
+func (r *RedisCache) count(counter *uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	*counter++
+}
+
+func (r *RedisCache) failed(operation string, err error) {
+	r.count(&r.errors)
+	log.Println("while using the redis cache, "+operation+": ", err.Error())
+}
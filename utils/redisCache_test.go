@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joey1123455/easy_get_coin/storage"
+)
+
+// redisStandIn is an in-process server answering the Redis commands the
+// cache uses: AUTH, SELECT, PING, GET, SET with PX, PTTL, DEL, PUBLISH and
+// SUBSCRIBE.
+type redisStandIn struct {
+	listener    net.Listener
+	password    string
+	mutex       sync.Mutex
+	values      map[string]string
+	expires     map[string]time.Time
+	subscribers map[string][]*bufio.Writer
+	commands    []string
+}
+
+func newRedisStandIn(t *testing.T, password string) *redisStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &redisStandIn{
+		listener:    listener,
+		password:    password,
+		values:      make(map[string]string),
+		expires:     make(map[string]time.Time),
+		subscribers: make(map[string][]*bufio.Writer),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *redisStandIn) url() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.listener.Addr().String() + "/2"
+	}
+	return "redis://" + s.listener.Addr().String()
+}
+
+func (s *redisStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authed := s.password == ""
+
+	for {
+		request, err := readResp(reader)
+		if err != nil {
+			return
+		}
+		items, _ := request.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			data, _ := item.([]byte)
+			args[i] = string(data)
+		}
+		if len(args) == 0 {
+			return
+		}
+		command := strings.ToUpper(args[0])
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, command)
+		switch {
+		case command == "AUTH":
+			authed = args[len(args)-1] == s.password
+			if authed {
+				writer.WriteString("+OK\r\n")
+			} else {
+				writer.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			writer.WriteString("-NOAUTH Authentication required.\r\n")
+		case command == "PING":
+			writer.WriteString("+PONG\r\n")
+		case command == "SELECT":
+			writer.WriteString("+OK\r\n")
+		case command == "GET":
+			value, found := s.value(args[1])
+			if !found {
+				writer.WriteString("$-1\r\n")
+			} else {
+				fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(value), value)
+			}
+		case command == "SET":
+			s.values[args[1]] = args[2]
+			delete(s.expires, args[1])
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			writer.WriteString("+OK\r\n")
+		case command == "PTTL":
+			if _, found := s.value(args[1]); !found {
+				writer.WriteString(":-2\r\n")
+			} else if expires, found := s.expires[args[1]]; found {
+				fmt.Fprintf(writer, ":%d\r\n", time.Until(expires).Milliseconds())
+			} else {
+				writer.WriteString(":-1\r\n")
+			}
+		case command == "DEL":
+			_, found := s.value(args[1])
+			delete(s.values, args[1])
+			if found {
+				writer.WriteString(":1\r\n")
+			} else {
+				writer.WriteString(":0\r\n")
+			}
+		case command == "PUBLISH":
+			subscribers := s.subscribers[args[1]]
+			for _, subscriber := range subscribers {
+				fmt.Fprintf(subscriber, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+				subscriber.Flush()
+			}
+			fmt.Fprintf(writer, ":%d\r\n", len(subscribers))
+		case command == "SUBSCRIBE":
+			s.subscribers[args[1]] = append(s.subscribers[args[1]], writer)
+			fmt.Fprintf(writer, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		default:
+			fmt.Fprintf(writer, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		writer.Flush()
+		s.mutex.Unlock()
+	}
+}
+
+// value returns an unexpired value. The caller holds the lock.
+func (s *redisStandIn) value(key string) (string, bool) {
+	if expires, found := s.expires[key]; found && time.Now().After(expires) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+	value, found := s.values[key]
+	return value, found
+}
+
+func (s *redisStandIn) subscribed(channel string, count int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mutex.Lock()
+		subscribers := len(s.subscribers[channel])
+		s.mutex.Unlock()
+		if subscribers >= count {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestReadResp(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "Simple String", input: "+OK\r\n", want: "OK"},
+		{name: "Integer", input: ":42\r\n", want: "42"},
+		{name: "Bulk String", input: "$5\r\nhe\r\nl\r\n", want: "[104 101 13 10 108]"},
+		{name: "Null", input: "$-1\r\n", want: "<nil>"},
+		{name: "Array", input: "*2\r\n$1\r\na\r\n:1\r\n", want: "[[97] 1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := readResp(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(reply); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	_, err := readResp(bufio.NewReader(strings.NewReader("-ERR wrong\r\n")))
+	if _, ok := err.(RespError); !ok {
+		t.Errorf("Expected a RespError, got %v", err)
+	}
+}
+
+func TestRedisCacheSerializesSessions(t *testing.T) {
+	server := newRedisStandIn(t, "secret")
+	backend, err := NewRedisCache(RedisCacheOptions{URL: server.url(), Local: CacheOptions{MaxEntries: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	games := NewNamespace[Gid, []storage.GameHistoryGameSession](backend, "games")
+	stakes := NewNamespace[Address, []storage.GameHistoryPayment](backend, "stakes")
+	games.Set(7, []storage.GameHistoryGameSession{{Gid: big.NewInt(7), Uid: "alice", Data: `{"score":9}`, Time: huge}}, time.Minute)
+	stakes.Set(AddressKey("0xAB"), []storage.GameHistoryPayment{{Sender: common.HexToAddress("0xAB"), Amount: huge, Time: big.NewInt(1)}}, time.Minute)
+
+	// A second instance has no local copy and reads what the first stored.
+	other, err := NewRedisCache(RedisCacheOptions{URL: server.url(), Local: CacheOptions{MaxEntries: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	sessions, found := NewNamespace[Gid, []storage.GameHistoryGameSession](other, "games").Get(7)
+	if !found || len(sessions) != 1 || sessions[0].Time.Cmp(huge) != 0 || sessions[0].Data != `{"score":9}` {
+		t.Errorf("Expected the stored session to round trip, got %+v %v", sessions, found)
+	}
+	payments, found := NewNamespace[Address, []storage.GameHistoryPayment](other, "stakes").Get(AddressKey("0xab"))
+	if !found || len(payments) != 1 || payments[0].Amount.Cmp(huge) != 0 || payments[0].Sender != common.HexToAddress("0xAB") {
+		t.Errorf("Expected the stored payment to round trip, got %+v %v", payments, found)
+	}
+	if stats := other.Stats(); stats.Hits != 2 || stats.Entries != 2 {
+		t.Errorf("Expected 2 hits kept locally, got %+v", stats)
+	}
+}
+
+func TestRedisCacheBroadcastsInvalidations(t *testing.T) {
+	server := newRedisStandIn(t, "")
+	first, _ := NewRedisCache(RedisCacheOptions{URL: server.url(), Local: CacheOptions{MaxEntries: 10}})
+	defer first.Close()
+	second, _ := NewRedisCache(RedisCacheOptions{URL: server.url(), Local: CacheOptions{MaxEntries: 10}})
+	defer second.Close()
+	if !server.subscribed(DefaultRedisPrefix+"invalidate", 2) {
+		t.Fatal("Expected both instances to subscribe to invalidations")
+	}
+
+	firstUsers := NewNamespace[Uid, int](first, "users")
+	secondUsers := NewNamespace[Uid, int](second, "users")
+	firstUsers.Set("alice", 1, time.Minute)
+	if value, found := secondUsers.Get("alice"); !found || value != 1 {
+		t.Fatalf("Expected the second instance to read 1, got %d %v", value, found)
+	}
+
+	firstUsers.Set("alice", 2, time.Minute)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		value, _ := secondUsers.Get("alice")
+		if value == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the second instance to drop its local copy, still reads %d", value)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	firstUsers.Delete("alice")
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		if _, found := secondUsers.Get("alice"); !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a delete to reach the second instance")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	server := newRedisStandIn(t, "secret")
+	backend, err := NewRedisCache(RedisCacheOptions{URL: strings.Replace(server.url(), "secret", "wrong", 1), Local: CacheOptions{MaxEntries: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	users := NewNamespace[Uid, int](backend, "users")
+	users.Set("alice", 1, time.Minute)
+	backend.local.Clear()
+	if _, found := users.Get("alice"); found {
+		t.Error("Expected a miss when the server refuses the client")
+	}
+	if stats := backend.Stats(); stats.Errors == 0 {
+		t.Error("Expected the refused commands to be counted as errors")
+	}
+
+	if _, err := NewRedisCache(RedisCacheOptions{URL: "http://localhost", Local: CacheOptions{MaxEntries: 1}}); err == nil {
+		t.Error("Expected a non redis url to be rejected")
+	}
+}
@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RespError is an error reply of a Redis server.
+type RespError string
+
+func (e RespError) Error() string {
+	return string(e)
+}
+
+var ErrRedisClosed = errors.New("redis client closed")
+
+// respConn speaks RESP, the Redis serialization protocol, over one connection.
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func newRespConn(conn net.Conn) *respConn {
+	return &respConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+// writeCommand sends a command as an array of bulk strings.
+func (r *respConn) writeCommand(args ...string) error {
+	fmt.Fprintf(r.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(r.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return r.writer.Flush()
+}
+
+// readReply reads one reply. Simple strings are returned as string, integers
+// as int64, bulk strings as []byte, nulls as nil, arrays as []interface{} and
+// error replies as a RespError error.
+func (r *respConn) readReply() (interface{}, error) {
+	return readResp(r.reader)
+}
+
+func readResp(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed RESP line %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RespError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP bulk length %q", body)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:length], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP array length %q", body)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readResp(reader); err != nil {
+				var respErr RespError
+				if !errors.As(err, &respErr) {
+					return nil, err
+				}
+				items[i] = respErr
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown RESP type %q", kind)
+	}
+}
+
+// RedisClient is a minimal client for servers speaking the Redis protocol,
+// keeping a small pool of connections.
+type RedisClient struct {
+	address  string
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	pool     chan *respConn
+	done     chan struct{}
+	mutex    sync.Mutex
+	closed   bool
+}
+
+// NewRedisClient creates a client for a redis://[user:password@]host:port[/db] URL.
+// Connections are opened when first needed.
+//
+// Parameters:
+//   - rawURL: The server URL.
+//   - poolSize: How many idle connections are kept.
+//
+// Returns:
+//   - res: The client.
+//   - err: An error for a malformed URL.
+func NewRedisClient(rawURL string, poolSize int) (res *RedisClient, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "redis" || parsed.Host == "" {
+		return nil, fmt.Errorf("redis url must look like redis://[user:password@]host:port[/db]")
+	}
+	res = &RedisClient{
+		address: parsed.Host,
+		timeout: 5 * time.Second,
+		pool:    make(chan *respConn, poolSize),
+		done:    make(chan struct{}),
+	}
+	if !strings.Contains(parsed.Host, ":") {
+		res.address += ":6379"
+	}
+	if parsed.User != nil {
+		res.username = parsed.User.Username()
+		res.password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		if res.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis database %q must be a number", db)
+		}
+	}
+	return res, nil
+}
+
+// Do sends a command and returns its reply.
+func (r *RedisClient) Do(args ...string) (interface{}, error) {
+	conn, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.conn.SetDeadline(time.Now().Add(r.timeout))
+	if err := conn.writeCommand(args...); err != nil {
+		conn.conn.Close()
+		return nil, err
+	}
+	reply, err := conn.readReply()
+	var respErr RespError
+	if err != nil && !errors.As(err, &respErr) {
+		conn.conn.Close()
+		return nil, err
+	}
+	r.put(conn)
+	return reply, err
+}
+
+// Subscribe delivers the messages published on channel to handle until the
+// client is closed, reconnecting with a backoff when the connection drops.
+func (r *RedisClient) Subscribe(channel string, handle func(payload []byte)) {
+	backoff := 100 * time.Millisecond
+	for {
+		started := time.Now()
+		r.subscribe(channel, handle)
+		if time.Since(started) > time.Minute {
+			backoff = 100 * time.Millisecond
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(backoff):
+			backoff = min(2*backoff, 10*time.Second)
+		}
+	}
+}
+
+func (r *RedisClient) subscribe(channel string, handle func(payload []byte)) error {
+	conn, err := r.dial()
+	if err != nil {
+		return err
+	}
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-r.done:
+		case <-finished:
+		}
+		conn.conn.Close()
+	}()
+
+	if err := conn.writeCommand("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := conn.readReply()
+		if err != nil {
+			return err
+		}
+		message, ok := reply.([]interface{})
+		if !ok || len(message) != 3 {
+			continue
+		}
+		if kind, _ := message[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		if payload, ok := message[2].([]byte); ok {
+			handle(payload)
+		}
+	}
+}
+
+// Close closes the idle connections and stops subscriptions.
+func (r *RedisClient) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
+	close(r.done)
+	close(r.pool)
+	for conn := range r.pool {
+		conn.conn.Close()
+	}
+}
+
+func (r *RedisClient) isClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
+
+func (r *RedisClient) get() (*respConn, error) {
+	if r.isClosed() {
+		return nil, ErrRedisClosed
+	}
+	select {
+	case conn, ok := <-r.pool:
+		if ok {
+			return conn, nil
+		}
+		return nil, ErrRedisClosed
+	default:
+		return r.dial()
+	}
+}
+
+func (r *RedisClient) put(conn *respConn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		conn.conn.Close()
+		return
+	}
+	select {
+	case r.pool <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// dial opens a connection, authenticating and selecting the database.
+func (r *RedisClient) dial() (*respConn, error) {
+	netConn, err := net.DialTimeout("tcp", r.address, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := newRespConn(netConn)
+
+	var setup [][]string
+	switch {
+	case r.password != "" && r.username != "":
+		setup = append(setup, []string{"AUTH", r.username, r.password})
+	case r.password != "":
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	netConn.SetDeadline(time.Now().Add(r.timeout))
+	for _, command := range setup {
+		if err := conn.writeCommand(command...); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		if _, err := conn.readReply(); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis %s: %w", command[0], err)
+		}
+	}
+	netConn.SetDeadline(time.Time{})
+	return conn, nil
+}
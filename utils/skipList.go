@@ -0,0 +1,173 @@
+package utils
+
+import "math/rand"
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+type skipListNode[T any] struct {
+	value T
+	next  []*skipListNode[T]
+	// span[i] is how many nodes next[i] skips over, which lets ranks be
+	// computed while walking the list like a redis sorted set.
+	span []int
+}
+
+// SkipList is an ordered list with O(log n) insert, delete and rank lookups.
+//
+// Values are kept in the order given by less. Values that compare equal in
+// both directions are treated as the same value by Delete and Rank, so less
+// must break ties down to a unique key. SkipList is not safe for concurrent use.
+type SkipList[T any] struct {
+	head   *skipListNode[T]
+	level  int
+	length int
+	less   func(a, b T) bool
+}
+
+// NewSkipList creates an empty SkipList ordered by less.
+func NewSkipList[T any](less func(a, b T) bool) *SkipList[T] {
+	return &SkipList[T]{
+		head: &skipListNode[T]{
+			next: make([]*skipListNode[T], skipListMaxLevel),
+			span: make([]int, skipListMaxLevel),
+		},
+		level: 1,
+		less:  less,
+	}
+}
+
+// Len returns the number of values in the list.
+func (s *SkipList[T]) Len() int {
+	return s.length
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// Insert adds value to the list.
+func (s *SkipList[T]) Insert(value T) {
+	var update [skipListMaxLevel]*skipListNode[T]
+	var rank [skipListMaxLevel]int
+
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for node.next[i] != nil && s.less(node.next[i].value, value) {
+			rank[i] += node.span[i]
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = s.head
+			update[i].span[i] = s.length
+		}
+		s.level = level
+	}
+
+	created := &skipListNode[T]{
+		value: value,
+		next:  make([]*skipListNode[T], level),
+		span:  make([]int, level),
+	}
+	for i := 0; i < level; i++ {
+		created.next[i] = update[i].next[i]
+		update[i].next[i] = created
+		created.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	for i := level; i < s.level; i++ {
+		update[i].span[i]++
+	}
+	s.length++
+}
+
+// Delete removes value from the list and reports whether it was present.
+func (s *SkipList[T]) Delete(value T) bool {
+	var update [skipListMaxLevel]*skipListNode[T]
+
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && s.less(node.next[i].value, value) {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	node = node.next[0]
+	if node == nil || s.less(value, node.value) {
+		return false
+	}
+
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i] == node {
+			update[i].span[i] += node.span[i] - 1
+			update[i].next[i] = node.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+	return true
+}
+
+// Rank returns the 1 based position of value, or 0 when it is not in the list.
+func (s *SkipList[T]) Rank(value T) int {
+	rank := 0
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && s.less(node.next[i].value, value) {
+			rank += node.span[i]
+			node = node.next[i]
+		}
+	}
+
+	node = node.next[0]
+	if node == nil || s.less(value, node.value) {
+		return 0
+	}
+	return rank + 1
+}
+
+// Range returns up to count values starting at the 1 based rank start.
+func (s *SkipList[T]) Range(start int, count int) []T {
+	if start < 1 {
+		count += start - 1
+		start = 1
+	}
+	if count <= 0 || start > s.length {
+		return []T{}
+	}
+
+	traversed := 0
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && traversed+node.span[i] < start {
+			traversed += node.span[i]
+			node = node.next[i]
+		}
+	}
+
+	res := make([]T, 0, min(count, s.length-start+1))
+	for node = node.next[0]; node != nil && len(res) < count; node = node.next[0] {
+		res = append(res, node.value)
+	}
+	return res
+}
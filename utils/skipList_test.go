@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSkipListOrderAndRank(t *testing.T) {
+	list := NewSkipList(func(a, b int) bool { return a < b })
+
+	for _, v := range []int{50, 10, 40, 20, 30} {
+		list.Insert(v)
+	}
+
+	if list.Len() != 5 {
+		t.Fatalf("Expected 5 values, got %d", list.Len())
+	}
+	if got := list.Range(1, 10); !reflect.DeepEqual(got, []int{10, 20, 30, 40, 50}) {
+		t.Errorf("Expected sorted values, got %v", got)
+	}
+	if rank := list.Rank(40); rank != 4 {
+		t.Errorf("Expected rank 4, got %d", rank)
+	}
+	if rank := list.Rank(35); rank != 0 {
+		t.Errorf("Expected rank 0 for a missing value, got %d", rank)
+	}
+	if got := list.Range(2, 2); !reflect.DeepEqual(got, []int{20, 30}) {
+		t.Errorf("Expected [20 30], got %v", got)
+	}
+	if got := list.Range(-1, 3); !reflect.DeepEqual(got, []int{10}) {
+		t.Errorf("Expected a range before the start to be clipped, got %v", got)
+	}
+
+	if !list.Delete(20) {
+		t.Error("Expected 20 to be deleted")
+	}
+	if list.Delete(20) {
+		t.Error("Expected a second delete to report false")
+	}
+	if rank := list.Rank(40); rank != 3 {
+		t.Errorf("Expected rank 3 after delete, got %d", rank)
+	}
+}
+
+func TestSkipListMatchesSortedSlice(t *testing.T) {
+	list := NewSkipList(func(a, b int) bool { return a < b })
+	present := make(map[int]bool)
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		v := random.Intn(1000)
+		if present[v] {
+			list.Delete(v)
+			delete(present, v)
+		} else {
+			list.Insert(v)
+			present[v] = true
+		}
+	}
+
+	want := make([]int, 0, len(present))
+	for v := range present {
+		want = append(want, v)
+	}
+	sort.Ints(want)
+
+	if got := list.Range(1, len(want)); !reflect.DeepEqual(got, want) {
+		t.Fatal("Expected the skip list to match the sorted values")
+	}
+	for i, v := range want {
+		if rank := list.Rank(v); rank != i+1 {
+			t.Fatalf("Expected rank %d for %d, got %d", i+1, v, rank)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheBackend stores the values of typed caches. CacheStore keeps them in
+// process memory and RedisCache shares them between instances.
+type CacheBackend interface {
+	// Fetch returns the value of key. Backends keeping values encoded turn
+	// them back into values with decode.
+	Fetch(key string, decode func(data []byte) (interface{}, error)) (interface{}, bool)
+	// Set stores a value for ttl.
+	Set(key string, value interface{}, ttl time.Duration)
+	// Delete removes a value, on every instance sharing the backend.
+	Delete(key string)
+	// Stats returns the counters of the backend.
+	Stats() CacheStats
+	// Close stops the background work of the backend.
+	Close()
+}
+
+// namespaces records the key and value types each namespace of a backend was
+// opened with.
+var namespaces = struct {
+	sync.Mutex
+	types map[CacheBackend]map[string]string
+}{types: make(map[CacheBackend]map[string]string)}
+
+// Gid is a game ID cache key.
+type Gid int
+
+// Uid is a user ID cache key.
+type Uid string
+
+// Address is a wallet address cache key. Build it with AddressKey so the
+// checksummed and lowercase forms of an address share an entry.
+type Address string
+
+// AddressKey returns the cache key of a wallet address.
+func AddressKey(address string) Address {
+	return Address(strings.ToLower(address))
+}
+
+// CacheKey lists the types typed caches are keyed by.
+type CacheKey interface {
+	~int | ~string
+}
+
+// Cache is a typed namespace of a CacheBackend. Keys of different namespaces
+// never collide, and a namespace always holds values of one type.
+type Cache[K CacheKey, V any] struct {
+	backend   CacheBackend
+	namespace string
+}
+
+// NewNamespace returns the typed cache of a namespace in backend.
+//
+// Parameters:
+//   - backend: The backend holding the values.
+//   - namespace: The name of the kind of data, e.g. "games".
+//
+// Returns:
+//   - res: The typed cache. It panics when the namespace was already opened
+//     with other key or value types.
+func NewNamespace[K CacheKey, V any](backend CacheBackend, namespace string) *Cache[K, V] {
+	signature := reflect.TypeOf((*K)(nil)).Elem().String() + " -> " + reflect.TypeOf((*V)(nil)).Elem().String()
+
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	opened := namespaces.types[backend]
+	if opened == nil {
+		opened = make(map[string]string)
+		namespaces.types[backend] = opened
+	}
+	if previous, found := opened[namespace]; found && previous != signature {
+		panic(fmt.Sprintf("cache namespace %q holds %s, not %s", namespace, previous, signature))
+	}
+	opened[namespace] = signature
+	return &Cache[K, V]{backend: backend, namespace: namespace}
+}
+
+// Get retrieves a value from the cache.
+func (c *Cache[K, V]) Get(key K) (res V, found bool) {
+	value, found := c.backend.Fetch(c.key(key), decodeJSON[V])
+	if !found {
+		return res, false
+	}
+	res, found = value.(V)
+	return res, found
+}
+
+// Set adds a value to the cache for ttl.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.backend.Set(c.key(key), value, ttl)
+}
+
+// Delete removes a value from the cache.
+func (c *Cache[K, V]) Delete(key K) {
+	c.backend.Delete(c.key(key))
+}
+
+// Backend returns the backend the namespace lives in.
+func (c *Cache[K, V]) Backend() CacheBackend {
+	return c.backend
+}
+
+func (c *Cache[K, V]) key(key K) string {
+	return c.namespace + ":" + fmt.Sprint(key)
+}
+
+// decodeJSON decodes a value a backend stored as JSON.
+func decodeJSON[V any](data []byte) (interface{}, error) {
+	var res V
+	err := json.Unmarshal(data, &res)
+	return res, err
+}
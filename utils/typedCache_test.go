@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheNamespaces(t *testing.T) {
+	store := NewCache()
+	defer store.Close()
+	games := NewNamespace[Gid, []string](store, "games")
+	users := NewNamespace[Uid, []string](store, "users")
+
+	games.Set(42, []string{"game"}, time.Minute)
+	users.Set("42", []string{"user"}, time.Minute)
+
+	game, found := games.Get(42)
+	if !found || game[0] != "game" {
+		t.Errorf("Expected the sessions of gid 42, got %v", game)
+	}
+	user, found := users.Get("42")
+	if !found || user[0] != "user" {
+		t.Errorf("Expected the sessions of uid 42, got %v", user)
+	}
+
+	users.Delete("42")
+	if _, found := games.Get(42); !found {
+		t.Error("Expected deleting uid 42 to keep gid 42")
+	}
+	if stats := store.Stats(); stats.Entries != 1 {
+		t.Errorf("Expected 1 entry in the store, got %d", stats.Entries)
+	}
+}
+
+func TestCacheAddressKey(t *testing.T) {
+	stakes := NewNamespace[Address, int](NewCache(), "stakes")
+	stakes.Set(AddressKey("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"), 7, time.Minute)
+
+	value, found := stakes.Get(AddressKey("0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"))
+	if !found || value != 7 {
+		t.Errorf("Expected the lowercase address to share the entry, got %d %v", value, found)
+	}
+}
+
+func TestCacheNamespaceTypes(t *testing.T) {
+	store := NewCache()
+	NewNamespace[Gid, []string](store, "games")
+	NewNamespace[Gid, []string](store, "games")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected reopening a namespace with another value type to panic")
+		}
+	}()
+	NewNamespace[Gid, int](store, "games")
+}